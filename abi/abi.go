@@ -0,0 +1,396 @@
+// Package abi 定义了 TitanChain 合约的应用二进制接口（ABI）：函数选择器、参数编码与事件主题，
+// 并提供从 JSON 描述编码调用数据、解码返回值与事件的工具。
+package abi
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/felixkuang/titanchain/core"
+	"github.com/felixkuang/titanchain/types"
+)
+
+// SelectorSize 是函数选择器的字节数
+const SelectorSize = 4
+
+// maxTopics 是 LOG4 指令支持的最大主题数
+const maxTopics = 4
+
+var (
+	// ErrMethodNotFound 表示 ABI 中没有对应的函数
+	ErrMethodNotFound = errors.New("abi: method not found")
+	// ErrEventNotFound 表示 ABI 中没有对应的事件
+	ErrEventNotFound = errors.New("abi: event not found")
+)
+
+// Argument 表示函数或事件的一个参数
+type Argument struct {
+	Name    string `json:"name"`
+	Type    Type   `json:"type"`
+	Indexed bool   `json:"indexed,omitempty"` // 仅对事件参数有效，为 true 时编码在事件主题中
+}
+
+// Arguments 表示一组参数
+type Arguments []Argument
+
+// types 返回参数的类型列表
+func (args Arguments) types() []Type {
+	ts := make([]Type, len(args))
+	for i, arg := range args {
+		ts[i] = arg.Type
+	}
+
+	return ts
+}
+
+// Pack 按参数类型编码一组值
+func (args Arguments) Pack(values ...any) ([]byte, error) {
+	return encodeTuple(args.types(), values)
+}
+
+// Unpack 解码由 Pack 编码的一组值
+func (args Arguments) Unpack(data []byte) ([]any, error) {
+	return decodeTuple(args.types(), data)
+}
+
+// signature 返回形如 "name(type1,type2)" 的规范签名
+func signature(name string, args Arguments) string {
+	names := make([]string, len(args))
+	for i, arg := range args {
+		names[i] = arg.Type.String()
+	}
+
+	return name + "(" + strings.Join(names, ",") + ")"
+}
+
+// Method 表示合约的一个函数
+type Method struct {
+	Name    string
+	Inputs  Arguments
+	Outputs Arguments
+}
+
+// Sig 返回函数的规范签名，如 "transfer(address,uint256)"
+func (m Method) Sig() string {
+	return signature(m.Name, m.Inputs)
+}
+
+// ID 返回函数选择器，即签名 SHA-256 哈希的前 4 个字节
+// 选择器总是使用 SHA-256，与链配置的哈希算法无关，同一份 ABI 在任何链上编码出相同的调用数据
+func (m Method) ID() []byte {
+	h := sha256.Sum256([]byte(m.Sig()))
+	return h[:SelectorSize]
+}
+
+// Event 表示合约发出的一种事件
+type Event struct {
+	Name      string
+	Inputs    Arguments
+	Anonymous bool // 匿名事件不以事件 ID 作为第一个主题
+}
+
+// Sig 返回事件的规范签名，如 "Transfer(address,address,uint256)"
+func (e Event) Sig() string {
+	return signature(e.Name, e.Inputs)
+}
+
+// ID 返回事件 ID，即签名的 SHA-256 哈希，非匿名事件以其作为第一个主题
+// 与函数选择器一样总是使用 SHA-256，与链配置的哈希算法无关
+func (e Event) ID() types.Hash {
+	return types.Hash(sha256.Sum256([]byte(e.Sig())))
+}
+
+// Pack 按事件定义编码事件的主题与数据
+// 索引参数编码为主题：定长类型为其 32 字节编码，变长类型为内容的 SHA-256 哈希；其余参数编码为数据
+func (e Event) Pack(values ...any) ([]types.Hash, []byte, error) {
+	if len(values) != len(e.Inputs) {
+		return nil, nil, fmt.Errorf("abi: event %s expects %d values, got %d", e.Name, len(e.Inputs), len(values))
+	}
+
+	var (
+		topics    []types.Hash
+		data      Arguments
+		dataValue []any
+	)
+	if !e.Anonymous {
+		topics = append(topics, e.ID())
+	}
+
+	for i, arg := range e.Inputs {
+		if !arg.Indexed {
+			data = append(data, arg)
+			dataValue = append(dataValue, values[i])
+			continue
+		}
+
+		topic, err := encodeTopic(arg.Type, values[i])
+		if err != nil {
+			return nil, nil, err
+		}
+		topics = append(topics, topic)
+	}
+	if len(topics) > maxTopics {
+		return nil, nil, fmt.Errorf("abi: event %s has too many topics (%d)", e.Name, len(topics))
+	}
+
+	b, err := data.Pack(dataValue...)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return topics, b, nil
+}
+
+// encodeTopic 编码一个索引参数
+func encodeTopic(t Type, v any) (types.Hash, error) {
+	b, err := t.encode(v)
+	if err != nil {
+		return types.Hash{}, err
+	}
+
+	if !t.IsDynamic() {
+		if len(b) != wordSize {
+			return types.Hash(sha256.Sum256(b)), nil
+		}
+		return types.HashFromBytes(b), nil
+	}
+
+	switch t.Kind {
+	case BytesKind:
+		b = v.([]byte)
+	case StringKind:
+		b = []byte(v.(string))
+	}
+
+	return types.Hash(sha256.Sum256(b)), nil
+}
+
+// ABI 表示合约的接口描述
+type ABI struct {
+	Methods map[string]Method
+	Events  map[string]Event
+}
+
+// field 是 JSON 描述中的一项
+type field struct {
+	Type      string    `json:"type"`
+	Name      string    `json:"name"`
+	Inputs    Arguments `json:"inputs"`
+	Outputs   Arguments `json:"outputs,omitempty"`
+	Anonymous bool      `json:"anonymous,omitempty"`
+}
+
+// JSON 从 reader 读取 JSON 格式的 ABI 描述
+func JSON(r io.Reader) (*ABI, error) {
+	abi := new(ABI)
+	if err := json.NewDecoder(r).Decode(abi); err != nil {
+		return nil, err
+	}
+
+	return abi, nil
+}
+
+// UnmarshalJSON 解析 JSON 格式的 ABI 描述
+// 描述为数组，每项的 type 为 "function" 或 "event"，函数与事件各自不能重名
+func (abi *ABI) UnmarshalJSON(b []byte) error {
+	var fields []field
+	if err := json.Unmarshal(b, &fields); err != nil {
+		return err
+	}
+
+	abi.Methods = make(map[string]Method)
+	abi.Events = make(map[string]Event)
+	for _, f := range fields {
+		if f.Name == "" {
+			return fmt.Errorf("abi: %s without name", f.Type)
+		}
+
+		switch f.Type {
+		case "function", "":
+			if _, ok := abi.Methods[f.Name]; ok {
+				return fmt.Errorf("abi: duplicate method (%s)", f.Name)
+			}
+			abi.Methods[f.Name] = Method{Name: f.Name, Inputs: f.Inputs, Outputs: f.Outputs}
+
+		case "event":
+			if _, ok := abi.Events[f.Name]; ok {
+				return fmt.Errorf("abi: duplicate event (%s)", f.Name)
+			}
+			abi.Events[f.Name] = Event{Name: f.Name, Inputs: f.Inputs, Anonymous: f.Anonymous}
+
+		default:
+			return fmt.Errorf("abi: unknown field type (%s)", f.Type)
+		}
+	}
+
+	return nil
+}
+
+// MarshalJSON 将 ABI 编码为 JSON 描述，函数在前、事件在后，各自按名称排序
+func (abi ABI) MarshalJSON() ([]byte, error) {
+	fields := make([]field, 0, len(abi.Methods)+len(abi.Events))
+	for _, m := range abi.Methods {
+		fields = append(fields, field{Type: "function", Name: m.Name, Inputs: nonNil(m.Inputs), Outputs: nonNil(m.Outputs)})
+	}
+	for _, e := range abi.Events {
+		fields = append(fields, field{Type: "event", Name: e.Name, Inputs: nonNil(e.Inputs), Anonymous: e.Anonymous})
+	}
+
+	sort.Slice(fields, func(i, j int) bool {
+		if fields[i].Type != fields[j].Type {
+			return fields[i].Type == "function"
+		}
+		return fields[i].Name < fields[j].Name
+	})
+
+	return json.Marshal(fields)
+}
+
+// nonNil 使空参数列表编码为 [] 而不是 null
+func nonNil(args Arguments) Arguments {
+	if args == nil {
+		return Arguments{}
+	}
+
+	return args
+}
+
+// Pack 编码对函数 name 的调用数据：函数选择器后接编码的参数
+func (abi *ABI) Pack(name string, args ...any) ([]byte, error) {
+	m, ok := abi.Methods[name]
+	if !ok {
+		return nil, fmt.Errorf("%w (%s)", ErrMethodNotFound, name)
+	}
+
+	b, err := m.Inputs.Pack(args...)
+	if err != nil {
+		return nil, fmt.Errorf("abi: pack %s: %w", name, err)
+	}
+
+	return append(m.ID(), b...), nil
+}
+
+// Unpack 解码函数 name 的返回数据
+func (abi *ABI) Unpack(name string, output []byte) ([]any, error) {
+	m, ok := abi.Methods[name]
+	if !ok {
+		return nil, fmt.Errorf("%w (%s)", ErrMethodNotFound, name)
+	}
+
+	return m.Outputs.Unpack(output)
+}
+
+// MethodByID 按调用数据开头的函数选择器查找函数
+func (abi *ABI) MethodByID(calldata []byte) (Method, error) {
+	if len(calldata) < SelectorSize {
+		return Method{}, fmt.Errorf("%w: calldata too short (%d)", ErrDecode, len(calldata))
+	}
+
+	for _, m := range abi.Methods {
+		if string(m.ID()) == string(calldata[:SelectorSize]) {
+			return m, nil
+		}
+	}
+
+	return Method{}, fmt.Errorf("%w (%x)", ErrMethodNotFound, calldata[:SelectorSize])
+}
+
+// UnpackCall 解码调用数据，返回被调用的函数与参数
+func (abi *ABI) UnpackCall(calldata []byte) (Method, []any, error) {
+	m, err := abi.MethodByID(calldata)
+	if err != nil {
+		return Method{}, nil, err
+	}
+
+	args, err := m.Inputs.Unpack(calldata[SelectorSize:])
+	if err != nil {
+		return Method{}, nil, err
+	}
+
+	return m, args, nil
+}
+
+// EventByID 按事件 ID 查找非匿名事件
+func (abi *ABI) EventByID(id types.Hash) (Event, error) {
+	for _, e := range abi.Events {
+		if !e.Anonymous && e.ID() == id {
+			return e, nil
+		}
+	}
+
+	return Event{}, fmt.Errorf("%w (%s)", ErrEventNotFound, id)
+}
+
+// UnpackLog 按第一个主题识别事件并解码其参数，参数按名称返回，未命名的参数以 "argN" 为键
+// 变长类型的索引参数只能还原为其哈希，以 types.Hash 返回
+func (abi *ABI) UnpackLog(log *core.Log) (Event, map[string]any, error) {
+	if len(log.Topics) == 0 {
+		return Event{}, nil, fmt.Errorf("%w: log without topics", ErrEventNotFound)
+	}
+
+	e, err := abi.EventByID(log.Topics[0])
+	if err != nil {
+		return Event{}, nil, err
+	}
+
+	var (
+		data   Arguments
+		topics = log.Topics[1:]
+		values = make(map[string]any, len(e.Inputs))
+	)
+	for i, arg := range e.Inputs {
+		if !arg.Indexed {
+			data = append(data, arg)
+			continue
+		}
+
+		if len(topics) == 0 {
+			return Event{}, nil, fmt.Errorf("%w: missing topic for %s", ErrDecode, argName(arg, i))
+		}
+		v, err := decodeTopic(arg.Type, topics[0])
+		if err != nil {
+			return Event{}, nil, err
+		}
+		values[argName(arg, i)] = v
+		topics = topics[1:]
+	}
+	if len(topics) != 0 {
+		return Event{}, nil, fmt.Errorf("%w: unexpected topics for %s", ErrDecode, e.Name)
+	}
+
+	decoded, err := data.Unpack(log.Data)
+	if err != nil {
+		return Event{}, nil, err
+	}
+	j := 0
+	for i, arg := range e.Inputs {
+		if !arg.Indexed {
+			values[argName(arg, i)] = decoded[j]
+			j++
+		}
+	}
+
+	return e, values, nil
+}
+
+// decodeTopic 解码一个索引参数
+func decodeTopic(t Type, topic types.Hash) (any, error) {
+	if t.IsDynamic() || t.headSize() != wordSize {
+		return topic, nil
+	}
+
+	return t.decode(topic.ToSlice())
+}
+
+func argName(arg Argument, i int) string {
+	if arg.Name == "" {
+		return fmt.Sprintf("arg%d", i)
+	}
+
+	return arg.Name
+}
@@ -0,0 +1,352 @@
+package abi
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"math/big"
+	"strings"
+	"testing"
+
+	"github.com/felixkuang/titanchain/asm"
+	"github.com/felixkuang/titanchain/core"
+	"github.com/felixkuang/titanchain/types"
+	"github.com/stretchr/testify/assert"
+)
+
+const testABI = `[
+	{"type": "function", "name": "add", "inputs": [{"name": "a", "type": "uint256"}, {"name": "b", "type": "uint256"}], "outputs": [{"name": "", "type": "uint256"}]},
+	{"type": "function", "name": "echo", "inputs": [{"name": "data", "type": "bytes"}], "outputs": [{"name": "", "type": "bytes"}]},
+	{"type": "event", "name": "Added", "inputs": [{"name": "a", "type": "uint256", "indexed": true}, {"name": "sum", "type": "uint256"}]},
+	{"type": "event", "name": "Transfer", "inputs": [{"name": "from", "type": "address", "indexed": true}, {"name": "memo", "type": "string", "indexed": true}, {"name": "", "type": "int64"}, {"name": "tags", "type": "bytes4[]"}]}
+]`
+
+// word 返回十六进制字符串表示的 32 字节字，不足部分在左侧补 0
+func word(s string) string {
+	return strings.Repeat("0", 64-len(s)) + s
+}
+
+func mustType(t *testing.T, s string) Type {
+	typ, err := NewType(s)
+	assert.Nil(t, err)
+	return typ
+}
+
+func TestNewType(t *testing.T) {
+	for s, want := range map[string]string{
+		"uint":         "uint256",
+		"int":          "int256",
+		"uint8":        "uint8",
+		"int128":       "int128",
+		"bool":         "bool",
+		"address":      "address",
+		"bytes1":       "bytes1",
+		"bytes32":      "bytes32",
+		"bytes":        "bytes",
+		"string":       "string",
+		"uint64[]":     "uint64[]",
+		"bytes[2][]":   "bytes[2][]",
+		"address[3]":   "address[3]",
+		"uint8[65536]": "uint8[65536]",
+		"uint[2][2]":   "uint256[2][2]",
+		"string[][4]":  "string[][4]",
+	} {
+		typ, err := NewType(s)
+		assert.Nil(t, err, s)
+		assert.Equal(t, want, typ.String())
+	}
+
+	for _, s := range []string{"", "uint7", "uint264", "int0", "uint08", "bytes0", "bytes33", "float", "[]", "uint[0]", "uint[-1]", "uint[x]", "uint]", "uint8[65537]", "uint[256][257]", "uint8[65536][2]"} {
+		_, err := NewType(s)
+		assert.NotNil(t, err, s)
+	}
+
+	assert.False(t, mustType(t, "uint256[2]").IsDynamic())
+	assert.True(t, mustType(t, "string[2]").IsDynamic())
+	assert.True(t, mustType(t, "uint8[]").IsDynamic())
+}
+
+func TestPackLayout(t *testing.T) {
+	args := Arguments{
+		{Type: mustType(t, "uint32")},
+		{Type: mustType(t, "bytes")},
+		{Type: mustType(t, "int8")},
+		{Type: mustType(t, "uint16[2]")},
+		{Type: mustType(t, "uint8[]")},
+	}
+
+	b, err := args.Pack(uint32(0x123), []byte("hello"), -1, []int{1, 2}, []uint8{7})
+	assert.Nil(t, err)
+
+	// 头部：uint32、bytes 的偏移、int8、uint16[2] 的两个元素、uint8[] 的偏移，共 6 个字
+	want := word("123") +
+		word("c0") +
+		strings.Repeat("f", 64) +
+		word("1") + word("2") +
+		word("100") +
+		word("5") + hex.EncodeToString([]byte("hello")) + strings.Repeat("0", 54) +
+		word("1") + word("7")
+	assert.Equal(t, want, hex.EncodeToString(b))
+
+	values, err := args.Unpack(b)
+	assert.Nil(t, err)
+	assert.Equal(t, []any{big.NewInt(0x123), []byte("hello"), big.NewInt(-1), []any{big.NewInt(1), big.NewInt(2)}, []any{big.NewInt(7)}}, values)
+}
+
+func TestPackRoundTrip(t *testing.T) {
+	addr := types.AddressFromBytes(bytes.Repeat([]byte{0xab}, 20))
+	max := new(big.Int).Sub(new(big.Int).Lsh(big.NewInt(1), 256), big.NewInt(1))
+	min := new(big.Int).Neg(new(big.Int).Lsh(big.NewInt(1), 255))
+
+	args := Arguments{
+		{Type: mustType(t, "uint256")},
+		{Type: mustType(t, "int256")},
+		{Type: mustType(t, "bool")},
+		{Type: mustType(t, "address")},
+		{Type: mustType(t, "bytes3")},
+		{Type: mustType(t, "string")},
+		{Type: mustType(t, "string[2]")},
+		{Type: mustType(t, "bytes[][]")},
+	}
+	in := []any{max, min, true, addr, [3]byte{1, 2, 3}, "titan", []string{"a", ""}, [][][]byte{{{1}, {}}, {}}}
+
+	b, err := args.Pack(in...)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(b)%wordSize)
+
+	out, err := args.Unpack(b)
+	assert.Nil(t, err)
+	assert.Equal(t, []any{
+		max, min, true, addr, []byte{1, 2, 3}, "titan",
+		[]any{"a", ""},
+		[]any{[]any{[]byte{1}, []byte{}}, []any{}},
+	}, out)
+}
+
+func TestPackErrors(t *testing.T) {
+	for _, c := range []struct {
+		typ   string
+		value any
+	}{
+		{"uint8", 256},
+		{"uint8", -1},
+		{"int8", 128},
+		{"int8", -129},
+		{"uint256", new(big.Int).Lsh(big.NewInt(1), 256)},
+		{"uint256", "1"},
+		{"bool", 1},
+		{"address", []byte{1}},
+		{"bytes2", []byte{1}},
+		{"bytes", "x"},
+		{"string", []byte("x")},
+		{"uint8[2]", []int{1}},
+		{"uint8[]", 1},
+	} {
+		_, err := Arguments{{Type: mustType(t, c.typ)}}.Pack(c.value)
+		assert.NotNil(t, err, "%s %v", c.typ, c.value)
+	}
+
+	_, err := Arguments{{Type: mustType(t, "bool")}}.Pack()
+	assert.NotNil(t, err)
+}
+
+func TestUnpackErrors(t *testing.T) {
+	decode := func(typ string, s string) error {
+		b, err := hex.DecodeString(s)
+		assert.Nil(t, err)
+		_, err = Arguments{{Type: mustType(t, typ)}}.Unpack(b)
+		return err
+	}
+
+	assert.Nil(t, decode("uint8", word("ff")))
+	assert.ErrorIs(t, decode("uint8", word("100")), ErrDecode)
+	assert.ErrorIs(t, decode("int8", word("80")), ErrDecode)
+	assert.ErrorIs(t, decode("bool", word("2")), ErrDecode)
+	assert.ErrorIs(t, decode("address", word("1"+strings.Repeat("0", 40))), ErrDecode)
+	assert.ErrorIs(t, decode("bytes1", "01"+strings.Repeat("0", 61)+"1"), ErrDecode)
+	assert.ErrorIs(t, decode("uint256", "00"), ErrDecode)
+
+	// 偏移量与长度越界
+	assert.ErrorIs(t, decode("bytes", word("40")), ErrDecode)
+	assert.ErrorIs(t, decode("bytes", word("20")+word("21")), ErrDecode)
+	assert.ErrorIs(t, decode("uint8[]", word("20")+word("ffffffffffffffff")), ErrDecode)
+	assert.ErrorIs(t, decode("string", word("20")+strings.Repeat("f", 64)), ErrDecode)
+	assert.ErrorIs(t, decode("string[65536]", word("20")), ErrDecode)
+}
+
+func TestABIJSON(t *testing.T) {
+	abi, err := JSON(strings.NewReader(testABI))
+	assert.Nil(t, err)
+	assert.Len(t, abi.Methods, 2)
+	assert.Len(t, abi.Events, 2)
+
+	assert.Equal(t, "add(uint256,uint256)", abi.Methods["add"].Sig())
+	assert.Equal(t, "Transfer(address,string,int64,bytes4[])", abi.Events["Transfer"].Sig())
+	assert.Len(t, abi.Methods["add"].ID(), SelectorSize)
+
+	b, err := abi.MarshalJSON()
+	assert.Nil(t, err)
+	again, err := JSON(bytes.NewReader(b))
+	assert.Nil(t, err)
+	assert.Equal(t, abi, again)
+	b2, err := again.MarshalJSON()
+	assert.Nil(t, err)
+	assert.Equal(t, string(b), string(b2))
+
+	for _, s := range []string{
+		`[{"type": "function", "name": "f"}, {"type": "function", "name": "f"}]`,
+		`[{"type": "event", "name": "E"}, {"type": "event", "name": "E"}]`,
+		`[{"type": "constructor", "name": "f"}]`,
+		`[{"type": "function", "name": ""}]`,
+		`[{"type": "function", "name": "f", "inputs": [{"type": "uint7"}]}]`,
+		`{}`,
+	} {
+		_, err := JSON(strings.NewReader(s))
+		assert.NotNil(t, err, s)
+	}
+}
+
+func TestCallEncoding(t *testing.T) {
+	abi, err := JSON(strings.NewReader(testABI))
+	assert.Nil(t, err)
+
+	calldata, err := abi.Pack("echo", []byte{1, 2})
+	assert.Nil(t, err)
+	assert.Equal(t, abi.Methods["echo"].ID(), calldata[:SelectorSize])
+
+	m, args, err := abi.UnpackCall(calldata)
+	assert.Nil(t, err)
+	assert.Equal(t, "echo", m.Name)
+	assert.Equal(t, []any{[]byte{1, 2}}, args)
+
+	_, err = abi.Pack("missing")
+	assert.ErrorIs(t, err, ErrMethodNotFound)
+	_, err = abi.Pack("add", 1)
+	assert.NotNil(t, err)
+	_, err = abi.MethodByID([]byte{0, 0, 0, 0})
+	assert.ErrorIs(t, err, ErrMethodNotFound)
+	_, err = abi.MethodByID([]byte{0})
+	assert.ErrorIs(t, err, ErrDecode)
+}
+
+func TestEventLog(t *testing.T) {
+	abi, err := JSON(strings.NewReader(testABI))
+	assert.Nil(t, err)
+
+	from := types.AddressFromBytes(bytes.Repeat([]byte{1}, 20))
+	e := abi.Events["Transfer"]
+	topics, data, err := e.Pack(from, "memo", int64(-5), [][4]byte{{1, 2, 3, 4}})
+	assert.Nil(t, err)
+	assert.Len(t, topics, 3)
+	assert.Equal(t, e.ID(), topics[0])
+
+	got, values, err := abi.UnpackLog(&core.Log{Topics: topics, Data: data})
+	assert.Nil(t, err)
+	assert.Equal(t, "Transfer", got.Name)
+	assert.Equal(t, map[string]any{
+		"from": from,
+		"memo": types.Hash(sha256.Sum256([]byte("memo"))),
+		"arg2": big.NewInt(-5),
+		"tags": []any{[]byte{1, 2, 3, 4}},
+	}, values)
+
+	_, _, err = abi.UnpackLog(&core.Log{Topics: topics[:2], Data: data})
+	assert.ErrorIs(t, err, ErrDecode)
+	_, _, err = abi.UnpackLog(&core.Log{Topics: []types.Hash{{}}})
+	assert.ErrorIs(t, err, ErrEventNotFound)
+	_, _, err = abi.UnpackLog(&core.Log{})
+	assert.ErrorIs(t, err, ErrEventNotFound)
+
+	// 匿名事件不包含事件 ID 主题
+	anon := Event{Name: "A", Anonymous: true, Inputs: Arguments{{Type: mustType(t, "uint8"), Indexed: true}}}
+	topics, data, err = anon.Pack(3)
+	assert.Nil(t, err)
+	assert.Equal(t, []types.Hash{types.HashFromBytes(wordFromUint(3))}, topics)
+	assert.Empty(t, data)
+}
+
+// TestContractCall 用 ABI 编码调用数据，在虚拟机中执行按函数选择器分发的合约，并解码返回值与事件
+func TestContractCall(t *testing.T) {
+	abi, err := JSON(strings.NewReader(testABI))
+	assert.Nil(t, err)
+
+	added := abi.Events["Added"].ID()
+	src := fmt.Sprintf(`
+.const ADD 0x%x
+.const ECHO 0x%x
+.const ADDED 0x%x
+	PUSH 0
+	CALLDATALOAD
+	PUSH 224
+	SHR                 ; 函数选择器
+	DUP
+	PUSH ADD
+	EQ
+	PUSH add
+	SWAP
+	JUMPI
+	PUSH ECHO
+	EQ
+	PUSH echo
+	SWAP
+	JUMPI
+	REVERT
+
+add: JUMPDEST
+	POP
+	PUSH 4
+	CALLDATALOAD
+	PUSH 36
+	CALLDATALOAD
+	ADD
+	DUP                 ; 事件数据为 sum
+	PUSH ADDED
+	PUSH 4
+	CALLDATALOAD        ; 索引参数 a
+	LOG2
+	RETURN
+
+echo: JUMPDEST
+	PUSH 4
+	CALLDATASIZE
+	PUSH 4
+	SUB
+	CALLDATACOPY        ; 参数编码即返回值编码
+	RETURN
+`, abi.Methods["add"].ID(), abi.Methods["echo"].ID(), added.ToSlice())
+
+	code, err := asm.Assemble(src)
+	assert.Nil(t, err)
+	config := core.DefaultChainConfig().VM
+	assert.Nil(t, core.ValidateCode(code, config))
+
+	call := func(calldata []byte) *core.VM {
+		vm := core.NewContractVM(core.ExecContext{Input: calldata}, code, core.NewState(), config)
+		assert.Nil(t, vm.Run())
+		return vm
+	}
+
+	calldata, err := abi.Pack("add", 40, big.NewInt(2))
+	assert.Nil(t, err)
+	vm := call(calldata)
+	out, err := abi.Unpack("add", vm.ReturnData())
+	assert.Nil(t, err)
+	assert.Equal(t, []any{big.NewInt(42)}, out)
+
+	assert.Len(t, vm.Logs(), 1)
+	e, values, err := abi.UnpackLog(vm.Logs()[0])
+	assert.Nil(t, err)
+	assert.Equal(t, "Added", e.Name)
+	assert.Equal(t, map[string]any{"a": big.NewInt(40), "sum": big.NewInt(42)}, values)
+
+	payload := bytes.Repeat([]byte{0xee}, 40)
+	calldata, err = abi.Pack("echo", payload)
+	assert.Nil(t, err)
+	out, err = abi.Unpack("echo", call(calldata).ReturnData())
+	assert.Nil(t, err)
+	assert.Equal(t, []any{payload}, out)
+
+	vm = core.NewContractVM(core.ExecContext{Input: []byte{1, 2, 3, 4}}, code, core.NewState(), config)
+	assert.ErrorIs(t, vm.Run(), core.ErrExecutionReverted)
+}
@@ -0,0 +1,552 @@
+package abi
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/felixkuang/titanchain/types"
+)
+
+const (
+	// wordSize 是 ABI 编码的基本单位，与虚拟机的整数宽度一致
+	wordSize = 32
+	// maxArrayWords 是定长数组的元素个数以及编码在头部的总字数的上限，防止解析与解码时分配过多内存
+	maxArrayWords = 1 << 16
+)
+
+// ErrDecode 表示 ABI 编码的数据不合法
+var ErrDecode = errors.New("abi: invalid encoding")
+
+// Kind 表示 ABI 类型的种类
+type Kind int
+
+const (
+	// UintKind 表示 uint8~uint256 无符号整数
+	UintKind Kind = iota
+	// IntKind 表示 int8~int256 有符号整数，按二进制补码编码
+	IntKind
+	// BoolKind 表示布尔值
+	BoolKind
+	// AddressKind 表示 20 字节地址
+	AddressKind
+	// FixedBytesKind 表示 bytes1~bytes32 定长字节数组
+	FixedBytesKind
+	// BytesKind 表示变长字节切片
+	BytesKind
+	// StringKind 表示 UTF-8 字符串
+	StringKind
+	// SliceKind 表示变长数组 T[]
+	SliceKind
+	// ArrayKind 表示定长数组 T[k]
+	ArrayKind
+)
+
+// Type 表示一个 ABI 类型
+type Type struct {
+	Kind Kind
+	Size int   // 整数的位数、定长字节数组的长度或定长数组的元素个数
+	Elem *Type // 数组的元素类型
+}
+
+// NewType 解析类型名，如 "uint256"、"address"、"bytes32"、"string"、"uint64[]"、"bytes[2][]"
+// "uint" 与 "int" 分别是 "uint256" 与 "int256" 的别名
+func NewType(s string) (Type, error) {
+	if strings.HasSuffix(s, "]") {
+		i := strings.LastIndex(s, "[")
+		if i <= 0 {
+			return Type{}, fmt.Errorf("abi: invalid type (%s)", s)
+		}
+
+		elem, err := NewType(s[:i])
+		if err != nil {
+			return Type{}, err
+		}
+
+		n := s[i+1 : len(s)-1]
+		if n == "" {
+			return Type{Kind: SliceKind, Elem: &elem}, nil
+		}
+		size, err := strconv.Atoi(n)
+		if err != nil || size <= 0 {
+			return Type{}, fmt.Errorf("abi: invalid array length in type (%s)", s)
+		}
+		if size > maxArrayWords || size*elem.headSize() > maxArrayWords*wordSize {
+			return Type{}, fmt.Errorf("abi: array too large in type (%s)", s)
+		}
+		return Type{Kind: ArrayKind, Size: size, Elem: &elem}, nil
+	}
+
+	switch s {
+	case "bool":
+		return Type{Kind: BoolKind}, nil
+	case "address":
+		return Type{Kind: AddressKind}, nil
+	case "bytes":
+		return Type{Kind: BytesKind}, nil
+	case "string":
+		return Type{Kind: StringKind}, nil
+	case "uint":
+		return Type{Kind: UintKind, Size: 256}, nil
+	case "int":
+		return Type{Kind: IntKind, Size: 256}, nil
+	}
+
+	for _, p := range []struct {
+		prefix string
+		kind   Kind
+		valid  func(n int) bool
+	}{
+		{"uint", UintKind, func(n int) bool { return n > 0 && n <= 256 && n%8 == 0 }},
+		{"int", IntKind, func(n int) bool { return n > 0 && n <= 256 && n%8 == 0 }},
+		{"bytes", FixedBytesKind, func(n int) bool { return n > 0 && n <= wordSize }},
+	} {
+		if !strings.HasPrefix(s, p.prefix) {
+			continue
+		}
+		n, err := strconv.Atoi(s[len(p.prefix):])
+		if err != nil || !p.valid(n) || strconv.Itoa(n) != s[len(p.prefix):] {
+			break
+		}
+		return Type{Kind: p.kind, Size: n}, nil
+	}
+
+	return Type{}, fmt.Errorf("abi: unknown type (%s)", s)
+}
+
+// String 返回规范的类型名，用于计算函数选择器与事件主题
+func (t Type) String() string {
+	switch t.Kind {
+	case UintKind:
+		return fmt.Sprintf("uint%d", t.Size)
+	case IntKind:
+		return fmt.Sprintf("int%d", t.Size)
+	case BoolKind:
+		return "bool"
+	case AddressKind:
+		return "address"
+	case FixedBytesKind:
+		return fmt.Sprintf("bytes%d", t.Size)
+	case BytesKind:
+		return "bytes"
+	case StringKind:
+		return "string"
+	case SliceKind:
+		return t.Elem.String() + "[]"
+	case ArrayKind:
+		return fmt.Sprintf("%s[%d]", t.Elem, t.Size)
+	default:
+		return fmt.Sprintf("unknown(%d)", t.Kind)
+	}
+}
+
+// MarshalJSON 将类型编码为类型名字符串
+func (t Type) MarshalJSON() ([]byte, error) {
+	return json.Marshal(t.String())
+}
+
+// UnmarshalJSON 从类型名字符串解析类型
+func (t *Type) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return err
+	}
+
+	parsed, err := NewType(s)
+	if err != nil {
+		return err
+	}
+	*t = parsed
+
+	return nil
+}
+
+// IsDynamic 判断类型的编码长度是否可变
+// 变长类型在参数头部只占一个偏移量，内容编码在尾部
+func (t Type) IsDynamic() bool {
+	switch t.Kind {
+	case BytesKind, StringKind, SliceKind:
+		return true
+	case ArrayKind:
+		return t.Elem.IsDynamic()
+	default:
+		return false
+	}
+}
+
+// headSize 返回类型在参数头部占用的字节数
+func (t Type) headSize() int {
+	if t.Kind == ArrayKind && !t.IsDynamic() {
+		return t.Size * t.Elem.headSize()
+	}
+
+	return wordSize
+}
+
+// encode 编码单个值
+func (t Type) encode(v any) ([]byte, error) {
+	switch t.Kind {
+	case UintKind, IntKind:
+		x, err := toBigInt(v)
+		if err != nil {
+			return nil, err
+		}
+		return t.encodeInt(x)
+
+	case BoolKind:
+		b, ok := v.(bool)
+		if !ok {
+			return nil, typeError(t, v)
+		}
+		return wordFromUint(boolToUint(b)), nil
+
+	case AddressKind:
+		addr, ok := v.(types.Address)
+		if !ok {
+			return nil, typeError(t, v)
+		}
+		return leftPad(addr.ToSlice()), nil
+
+	case FixedBytesKind:
+		b, err := toFixedBytes(v)
+		if err != nil || len(b) != t.Size {
+			return nil, typeError(t, v)
+		}
+		return rightPad(b), nil
+
+	case BytesKind:
+		b, ok := v.([]byte)
+		if !ok {
+			return nil, typeError(t, v)
+		}
+		return append(wordFromUint(uint64(len(b))), rightPad(b)...), nil
+
+	case StringKind:
+		s, ok := v.(string)
+		if !ok {
+			return nil, typeError(t, v)
+		}
+		return append(wordFromUint(uint64(len(s))), rightPad([]byte(s))...), nil
+
+	case SliceKind, ArrayKind:
+		items, err := toSlice(v)
+		if err != nil {
+			return nil, typeError(t, v)
+		}
+		if t.Kind == ArrayKind && len(items) != t.Size {
+			return nil, fmt.Errorf("abi: %s expects %d elements, got %d", t, t.Size, len(items))
+		}
+
+		elems := make([]Type, len(items))
+		for i := range elems {
+			elems[i] = *t.Elem
+		}
+		b, err := encodeTuple(elems, items)
+		if err != nil {
+			return nil, err
+		}
+		if t.Kind == SliceKind {
+			b = append(wordFromUint(uint64(len(items))), b...)
+		}
+		return b, nil
+
+	default:
+		return nil, fmt.Errorf("abi: cannot encode type (%s)", t)
+	}
+}
+
+// encodeInt 检查整数的范围并编码为 32 字节，负数按二进制补码编码
+func (t Type) encodeInt(x *big.Int) ([]byte, error) {
+	min, max := new(big.Int), new(big.Int).Lsh(big.NewInt(1), uint(t.Size))
+	if t.Kind == IntKind {
+		max.Rsh(max, 1)
+		min.Neg(max)
+	}
+	if x.Cmp(min) < 0 || x.Cmp(max) >= 0 {
+		return nil, fmt.Errorf("abi: value (%s) out of range for %s", x, t)
+	}
+
+	if x.Sign() < 0 {
+		x = new(big.Int).Add(x, new(big.Int).Lsh(big.NewInt(1), 256))
+	}
+
+	return x.FillBytes(make([]byte, wordSize)), nil
+}
+
+// decode 从 data 开头解码单个值，data 为值所在元组的编码中从该值开始的部分
+func (t Type) decode(data []byte) (any, error) {
+	switch t.Kind {
+	case UintKind, IntKind:
+		w, err := readWord(data, 0)
+		if err != nil {
+			return nil, err
+		}
+		return t.decodeInt(w)
+
+	case BoolKind:
+		w, err := readWord(data, 0)
+		if err != nil {
+			return nil, err
+		}
+		if !isZero(w[:wordSize-1]) || w[wordSize-1] > 1 {
+			return nil, fmt.Errorf("%w: bool value", ErrDecode)
+		}
+		return w[wordSize-1] == 1, nil
+
+	case AddressKind:
+		w, err := readWord(data, 0)
+		if err != nil {
+			return nil, err
+		}
+		if !isZero(w[:wordSize-20]) {
+			return nil, fmt.Errorf("%w: address value", ErrDecode)
+		}
+		return types.AddressFromBytes(w[wordSize-20:]), nil
+
+	case FixedBytesKind:
+		w, err := readWord(data, 0)
+		if err != nil {
+			return nil, err
+		}
+		if !isZero(w[t.Size:]) {
+			return nil, fmt.Errorf("%w: %s value", ErrDecode, t)
+		}
+		return append([]byte{}, w[:t.Size]...), nil
+
+	case BytesKind, StringKind:
+		n, err := readLength(data, 0)
+		if err != nil {
+			return nil, err
+		}
+		if wordSize+n > len(data) {
+			return nil, fmt.Errorf("%w: %s length (%d) out of range", ErrDecode, t, n)
+		}
+		b := append([]byte{}, data[wordSize:wordSize+n]...)
+		if t.Kind == StringKind {
+			return string(b), nil
+		}
+		return b, nil
+
+	case SliceKind, ArrayKind:
+		n := t.Size
+		if t.Kind == SliceKind {
+			var err error
+			if n, err = readLength(data, 0); err != nil {
+				return nil, err
+			}
+			data = data[wordSize:]
+		}
+		// 每个元素至少占一个字，拒绝超出数据长度的元素个数
+		if n > len(data)/wordSize {
+			return nil, fmt.Errorf("%w: %s length (%d) out of range", ErrDecode, t, n)
+		}
+
+		elems := make([]Type, n)
+		for i := range elems {
+			elems[i] = *t.Elem
+		}
+		return decodeTuple(elems, data)
+
+	default:
+		return nil, fmt.Errorf("abi: cannot decode type (%s)", t)
+	}
+}
+
+// decodeInt 解码整数并检查其范围
+func (t Type) decodeInt(w []byte) (*big.Int, error) {
+	x := new(big.Int).SetBytes(w)
+	if t.Kind == IntKind && w[0]&0x80 != 0 {
+		x.Sub(x, new(big.Int).Lsh(big.NewInt(1), 256))
+	}
+
+	if _, err := t.encodeInt(x); err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrDecode, err)
+	}
+
+	return x, nil
+}
+
+// encodeTuple 按头部与尾部编码一组值
+// 定长类型直接编码在头部，变长类型在头部写入内容相对元组开头的偏移量，内容依次编码在尾部
+func encodeTuple(ts []Type, values []any) ([]byte, error) {
+	if len(ts) != len(values) {
+		return nil, fmt.Errorf("abi: expected %d values, got %d", len(ts), len(values))
+	}
+
+	headLen := 0
+	for _, t := range ts {
+		headLen += t.headSize()
+	}
+
+	var head, tail []byte
+	for i, t := range ts {
+		b, err := t.encode(values[i])
+		if err != nil {
+			return nil, err
+		}
+		if t.IsDynamic() {
+			head = append(head, wordFromUint(uint64(headLen+len(tail)))...)
+			tail = append(tail, b...)
+		} else {
+			head = append(head, b...)
+		}
+	}
+
+	return append(head, tail...), nil
+}
+
+// decodeTuple 解码由 encodeTuple 编码的一组值
+func decodeTuple(ts []Type, data []byte) ([]any, error) {
+	values := make([]any, len(ts))
+	pos := 0
+
+	for i, t := range ts {
+		var (
+			v   any
+			err error
+		)
+		if t.IsDynamic() {
+			offset, err := readLength(data, pos)
+			if err != nil {
+				return nil, err
+			}
+			if offset > len(data) {
+				return nil, fmt.Errorf("%w: offset (%d) out of range", ErrDecode, offset)
+			}
+			v, err = t.decode(data[offset:])
+			if err != nil {
+				return nil, err
+			}
+		} else {
+			if pos > len(data) {
+				return nil, fmt.Errorf("%w: unexpected end", ErrDecode)
+			}
+			if v, err = t.decode(data[pos:]); err != nil {
+				return nil, err
+			}
+		}
+		values[i] = v
+		pos += t.headSize()
+	}
+
+	return values, nil
+}
+
+// readWord 读取 data 中 pos 处的一个字
+func readWord(data []byte, pos int) ([]byte, error) {
+	if pos < 0 || pos+wordSize > len(data) {
+		return nil, fmt.Errorf("%w: unexpected end", ErrDecode)
+	}
+
+	return data[pos : pos+wordSize], nil
+}
+
+// readLength 读取 data 中 pos 处作为长度或偏移量的字
+func readLength(data []byte, pos int) (int, error) {
+	w, err := readWord(data, pos)
+	if err != nil {
+		return 0, err
+	}
+
+	x := new(big.Int).SetBytes(w)
+	if !x.IsInt64() || x.Int64() > int64(len(data)) {
+		return 0, fmt.Errorf("%w: length or offset (%s) out of range", ErrDecode, x)
+	}
+
+	return int(x.Int64()), nil
+}
+
+func wordFromUint(n uint64) []byte {
+	return new(big.Int).SetUint64(n).FillBytes(make([]byte, wordSize))
+}
+
+// leftPad 在左侧补 0 至一个字
+func leftPad(b []byte) []byte {
+	return append(make([]byte, wordSize-len(b)), b...)
+}
+
+// rightPad 在右侧补 0 至字长的整数倍
+func rightPad(b []byte) []byte {
+	n := (len(b) + wordSize - 1) / wordSize * wordSize
+	return append(append([]byte{}, b...), make([]byte, n-len(b))...)
+}
+
+func isZero(b []byte) bool {
+	for _, c := range b {
+		if c != 0 {
+			return false
+		}
+	}
+
+	return true
+}
+
+func boolToUint(b bool) uint64 {
+	if b {
+		return 1
+	}
+
+	return 0
+}
+
+func typeError(t Type, v any) error {
+	return fmt.Errorf("abi: cannot use %T as %s", v, t)
+}
+
+// toBigInt 将 Go 整数或 *big.Int 转换为 *big.Int
+func toBigInt(v any) (*big.Int, error) {
+	switch v := v.(type) {
+	case *big.Int:
+		return v, nil
+	case big.Int:
+		return &v, nil
+	}
+
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return big.NewInt(rv.Int()), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return new(big.Int).SetUint64(rv.Uint()), nil
+	default:
+		return nil, fmt.Errorf("abi: cannot use %T as integer", v)
+	}
+}
+
+// toFixedBytes 将 []byte、types.Hash 或字节数组转换为字节切片
+func toFixedBytes(v any) ([]byte, error) {
+	if b, ok := v.([]byte); ok {
+		return b, nil
+	}
+
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Array || rv.Type().Elem().Kind() != reflect.Uint8 {
+		return nil, fmt.Errorf("abi: cannot use %T as fixed bytes", v)
+	}
+	b := make([]byte, rv.Len())
+	reflect.Copy(reflect.ValueOf(b), rv)
+
+	return b, nil
+}
+
+// toSlice 将任意切片或数组转换为 []any
+func toSlice(v any) ([]any, error) {
+	if items, ok := v.([]any); ok {
+		return items, nil
+	}
+
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array {
+		return nil, fmt.Errorf("abi: cannot use %T as array", v)
+	}
+	items := make([]any, rv.Len())
+	for i := range items {
+		items[i] = rv.Index(i).Interface()
+	}
+
+	return items, nil
+}
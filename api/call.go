@@ -0,0 +1,101 @@
+package api
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/felixkuang/titanchain/core"
+	"github.com/felixkuang/titanchain/types"
+)
+
+// CallArgs 是 titan_call 与 titan_estimateGas 的消息参数
+// To 缺省时表示部署 Data 中的合约代码，Gas 缺省时使用链配置的 gas 上限
+type CallArgs struct {
+	From  types.Address  `json:"from"`
+	To    *types.Address `json:"to"`
+	Value uint64         `json:"value"`
+	Data  string         `json:"data"` // 十六进制编码的调用数据，可以带 0x 前缀
+	Gas   uint64         `json:"gas"`
+}
+
+// RPCCallResult 是 titan_call 的返回结果
+type RPCCallResult struct {
+	Failed      bool      `json:"failed"`
+	Error       string    `json:"error,omitempty"` // 合约执行失败的原因
+	GasUsed     uint64    `json:"gasUsed"`
+	ReturnValue string    `json:"returnValue"` // 十六进制编码的返回数据
+	Logs        []*RPCLog `json:"logs"`
+}
+
+// toMsg 将参数转换为 core.CallMsg
+func (args *CallArgs) toMsg() (*core.CallMsg, error) {
+	data, err := hex.DecodeString(strings.TrimPrefix(args.Data, "0x"))
+	if err != nil {
+		return nil, invalidParams(fmt.Errorf("invalid data: %s", err))
+	}
+
+	msg := &core.CallMsg{From: args.From, Value: args.Value, Data: data, Gas: args.Gas}
+	if args.To != nil {
+		msg.To = *args.To
+	}
+
+	return msg, nil
+}
+
+// call 在指定高度的状态副本上执行消息并返回结果，不修改链上状态
+// 参数：[CallArgs, 区块高度]，区块高度缺省为当前高度
+func (s *Server) call(params json.RawMessage) (any, error) {
+	args := new(CallArgs)
+	var height *uint32
+	if err := parseParams(params, args, &height); err != nil {
+		return nil, err
+	}
+
+	msg, err := args.toMsg()
+	if err != nil {
+		return nil, err
+	}
+
+	atHeight := s.chain.Height()
+	if height != nil {
+		atHeight = *height
+	}
+
+	res, err := s.chain.Call(msg, atHeight)
+	if err != nil {
+		return nil, err
+	}
+
+	out := &RPCCallResult{
+		Failed:      res.Failed(),
+		GasUsed:     res.GasUsed,
+		ReturnValue: hex.EncodeToString(res.ReturnData),
+		Logs:        make([]*RPCLog, len(res.Logs)),
+	}
+	if res.Err != nil {
+		out.Error = res.Err.Error()
+	}
+	for i, l := range res.Logs {
+		out.Logs[i] = newRPCLog(l)
+	}
+
+	return out, nil
+}
+
+// estimateGas 估算在当前状态上执行消息所需的最小 gas 上限
+// 参数：[CallArgs]
+func (s *Server) estimateGas(params json.RawMessage) (any, error) {
+	args := new(CallArgs)
+	if err := parseParams(params, args); err != nil {
+		return nil, err
+	}
+
+	msg, err := args.toMsg()
+	if err != nil {
+		return nil, err
+	}
+
+	return s.chain.EstimateGas(msg)
+}
@@ -0,0 +1,24 @@
+package api
+
+import (
+	"encoding/json"
+
+	"github.com/felixkuang/titanchain/core"
+	"github.com/felixkuang/titanchain/types"
+)
+
+// traceTransaction 在父状态上重新执行一笔已上链的交易并返回结构化追踪结果
+// 参数：[交易ID]
+func (s *Server) traceTransaction(params json.RawMessage) (any, error) {
+	var hash types.Hash
+	if err := parseParams(params, &hash); err != nil {
+		return nil, err
+	}
+
+	tracer := core.NewStructLogger()
+	if _, err := s.chain.TraceTransaction(hash, tracer); err != nil {
+		return nil, err
+	}
+
+	return tracer.Result(), nil
+}
@@ -0,0 +1,146 @@
+package api
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+
+	"github.com/felixkuang/titanchain/core"
+	"github.com/felixkuang/titanchain/types"
+)
+
+// RPCLog 是日志在 RPC 响应中的表示
+type RPCLog struct {
+	Address     types.Address `json:"address"`
+	Topics      []types.Hash  `json:"topics"`
+	Data        string        `json:"data"` // 十六进制编码的事件数据
+	BlockHeight uint32        `json:"blockHeight"`
+	TxHash      types.Hash    `json:"transactionHash"`
+	TxIndex     uint32        `json:"transactionIndex"`
+	LogIndex    uint32        `json:"logIndex"`
+}
+
+// RPCReceipt 是交易收据在 RPC 响应中的表示
+type RPCReceipt struct {
+	TxHash          types.Hash     `json:"transactionHash"`
+	BlockHeight     uint32         `json:"blockHeight"`
+	TxIndex         uint32         `json:"transactionIndex"`
+	Status          uint8          `json:"status"`
+	GasUsed         uint64         `json:"gasUsed"`
+	ContractAddress *types.Address `json:"contractAddress"` // 非部署交易为 null
+	Logs            []*RPCLog      `json:"logs"`
+}
+
+// LogFilterArgs 是 titan_getLogs 的过滤参数
+// ToBlock 缺省为当前高度，FromBlock 缺省为以 ToBlock 结尾的最多 core.MaxLogBlockRange 个区块的起始高度
+type LogFilterArgs struct {
+	FromBlock *uint32         `json:"fromBlock"`
+	ToBlock   *uint32         `json:"toBlock"`
+	Addresses []types.Address `json:"addresses"`
+	Topics    [][]types.Hash  `json:"topics"`
+}
+
+// newRPCLog 将日志转换为 RPC 表示
+func newRPCLog(l *core.Log) *RPCLog {
+	topics := l.Topics
+	if topics == nil {
+		topics = []types.Hash{}
+	}
+
+	return &RPCLog{
+		Address:     l.Address,
+		Topics:      topics,
+		Data:        hex.EncodeToString(l.Data),
+		BlockHeight: l.BlockHeight,
+		TxHash:      l.TxHash,
+		TxIndex:     l.TxIndex,
+		LogIndex:    l.Index,
+	}
+}
+
+// newRPCReceipt 将收据转换为 RPC 表示
+func newRPCReceipt(r *core.Receipt) *RPCReceipt {
+	res := &RPCReceipt{
+		TxHash:      r.TxHash,
+		BlockHeight: r.BlockHeight,
+		TxIndex:     r.TxIndex,
+		Status:      uint8(r.Status),
+		GasUsed:     r.GasUsed,
+		Logs:        make([]*RPCLog, len(r.Logs)),
+	}
+	if r.ContractAddress != (types.Address{}) {
+		addr := r.ContractAddress
+		res.ContractAddress = &addr
+	}
+	for i, l := range r.Logs {
+		res.Logs[i] = newRPCLog(l)
+	}
+
+	return res
+}
+
+// registerMethods 注册全部 RPC 方法
+func (s *Server) registerMethods() {
+	s.register("titan_blockNumber", s.blockNumber)
+	s.register("titan_getTransactionReceipt", s.getTransactionReceipt)
+	s.register("titan_getLogs", s.getLogs)
+	s.register("titan_call", s.call)
+	s.register("titan_estimateGas", s.estimateGas)
+	s.register("debug_traceTransaction", s.traceTransaction)
+}
+
+// blockNumber 返回当前区块高度
+func (s *Server) blockNumber(params json.RawMessage) (any, error) {
+	return s.chain.Height(), nil
+}
+
+// getTransactionReceipt 根据交易ID返回收据，交易未上链时返回 null
+// 参数：[交易ID]
+func (s *Server) getTransactionReceipt(params json.RawMessage) (any, error) {
+	var hash types.Hash
+	if err := parseParams(params, &hash); err != nil {
+		return nil, err
+	}
+
+	r, err := s.chain.GetReceipt(hash)
+	if err != nil {
+		return json.RawMessage("null"), nil
+	}
+
+	return newRPCReceipt(r), nil
+}
+
+// getLogs 返回区块范围内满足过滤条件的日志
+// 参数：[LogFilterArgs]
+func (s *Server) getLogs(params json.RawMessage) (any, error) {
+	args := new(LogFilterArgs)
+	if err := parseParams(params, args); err != nil {
+		return nil, err
+	}
+
+	filter := &core.LogFilter{
+		ToHeight:  s.chain.Height(),
+		Addresses: args.Addresses,
+		Topics:    args.Topics,
+	}
+	if args.ToBlock != nil {
+		filter.ToHeight = *args.ToBlock
+	}
+	if args.FromBlock != nil {
+		filter.FromHeight = *args.FromBlock
+	} else if filter.ToHeight >= core.MaxLogBlockRange {
+		filter.FromHeight = filter.ToHeight - core.MaxLogBlockRange + 1
+	}
+
+	logs, err := s.chain.FilterLogs(filter)
+	if err != nil {
+		return nil, invalidParams(fmt.Errorf("invalid filter: %s", err))
+	}
+
+	res := make([]*RPCLog, len(logs))
+	for i, l := range logs {
+		res[i] = newRPCLog(l)
+	}
+
+	return res, nil
+}
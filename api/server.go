@@ -0,0 +1,175 @@
+// Package api 实现了 TitanChain 节点的 JSON-RPC 2.0 接口
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/go-kit/log"
+
+	"github.com/felixkuang/titanchain/core"
+)
+
+const (
+	// jsonRPCVersion 是支持的 JSON-RPC 协议版本
+	jsonRPCVersion = "2.0"
+	// maxRequestSize 是请求体的最大字节数
+	maxRequestSize = 1 << 20
+	// readTimeout 与 writeTimeout 限制单个连接读取请求与写出响应的时间
+	readTimeout  = 10 * time.Second
+	writeTimeout = 30 * time.Second
+)
+
+// JSON-RPC 2.0 标准错误码
+const (
+	ErrCodeParse          = -32700 // 请求不是合法的 JSON
+	ErrCodeInvalidRequest = -32600 // 请求结构不合法
+	ErrCodeMethodNotFound = -32601 // 方法不存在
+	ErrCodeInvalidParams  = -32602 // 参数不合法
+	ErrCodeServer         = -32000 // 方法执行出错
+)
+
+// Request 表示一个 JSON-RPC 请求
+type Request struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params"`
+}
+
+// Response 表示一个 JSON-RPC 响应
+type Response struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id"`
+	Result  any             `json:"result,omitempty"`
+	Error   *Error          `json:"error,omitempty"`
+}
+
+// Error 表示 JSON-RPC 响应中的错误对象
+type Error struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("rpc error %d: %s", e.Code, e.Message)
+}
+
+// invalidParams 返回参数不合法的错误
+func invalidParams(err error) *Error {
+	return &Error{Code: ErrCodeInvalidParams, Message: err.Error()}
+}
+
+// methodFunc 是 RPC 方法的处理函数，params 为原始的参数数组
+type methodFunc func(params json.RawMessage) (any, error)
+
+// Server 是基于 HTTP 的 JSON-RPC 服务器
+// 每个 HTTP POST 请求体包含一个 JSON-RPC 请求
+type Server struct {
+	logger  log.Logger
+	chain   *core.Blockchain
+	methods map[string]methodFunc
+}
+
+// NewServer 创建一个 JSON-RPC 服务器并注册全部方法
+// chain: 提供查询数据的区块链实例
+func NewServer(logger log.Logger, chain *core.Blockchain) *Server {
+	s := &Server{
+		logger:  logger,
+		chain:   chain,
+		methods: make(map[string]methodFunc),
+	}
+	s.registerMethods()
+
+	return s
+}
+
+// register 注册一个 RPC 方法
+func (s *Server) register(name string, fn methodFunc) {
+	s.methods[name] = fn
+}
+
+// Start 在给定地址上启动 HTTP 服务，阻塞直到出错
+// 读取请求与写出响应分别受 readTimeout 与 writeTimeout 限制
+func (s *Server) Start(addr string) error {
+	s.logger.Log("msg", "starting JSON-RPC server", "addr", addr)
+
+	srv := &http.Server{
+		Addr:         addr,
+		Handler:      s,
+		ReadTimeout:  readTimeout,
+		WriteTimeout: writeTimeout,
+	}
+
+	return srv.ListenAndServe()
+}
+
+// ServeHTTP 实现 http.Handler，处理单个 JSON-RPC 请求
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxRequestSize)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(s.handle(r))
+}
+
+// handle 解析请求并分发到对应方法
+func (s *Server) handle(r *http.Request) *Response {
+	req := new(Request)
+	if err := json.NewDecoder(r.Body).Decode(req); err != nil {
+		return errorResponse(nil, &Error{Code: ErrCodeParse, Message: err.Error()})
+	}
+
+	if req.JSONRPC != jsonRPCVersion || req.Method == "" {
+		return errorResponse(req.ID, &Error{Code: ErrCodeInvalidRequest, Message: "invalid request"})
+	}
+
+	fn, ok := s.methods[req.Method]
+	if !ok {
+		return errorResponse(req.ID, &Error{Code: ErrCodeMethodNotFound, Message: fmt.Sprintf("method %s not found", req.Method)})
+	}
+
+	result, err := fn(req.Params)
+	if err != nil {
+		rpcErr, ok := err.(*Error)
+		if !ok {
+			rpcErr = &Error{Code: ErrCodeServer, Message: err.Error()}
+		}
+		return errorResponse(req.ID, rpcErr)
+	}
+
+	return &Response{JSONRPC: jsonRPCVersion, ID: req.ID, Result: result}
+}
+
+// errorResponse 构造错误响应
+func errorResponse(id json.RawMessage, err *Error) *Response {
+	return &Response{JSONRPC: jsonRPCVersion, ID: id, Error: err}
+}
+
+// parseParams 将参数数组解析到 args 指向的各个变量，缺省的尾部参数保持零值
+func parseParams(params json.RawMessage, args ...any) error {
+	if len(params) == 0 {
+		return nil
+	}
+
+	var raw []json.RawMessage
+	if err := json.Unmarshal(params, &raw); err != nil {
+		return invalidParams(fmt.Errorf("params must be an array: %s", err))
+	}
+	if len(raw) > len(args) {
+		return invalidParams(fmt.Errorf("too many params: have (%d) => want (%d)", len(raw), len(args)))
+	}
+
+	for i, r := range raw {
+		if err := json.Unmarshal(r, args[i]); err != nil {
+			return invalidParams(fmt.Errorf("invalid param %d: %s", i, err))
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,234 @@
+package api
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-kit/log"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/felixkuang/titanchain/core"
+	"github.com/felixkuang/titanchain/crypto"
+	"github.com/felixkuang/titanchain/types"
+)
+
+// newTestChain 创建一条链，部署一个以调用数据为事件数据的合约并调用一次
+// 返回区块链、合约地址与调用交易
+func newTestChain(t *testing.T) (*core.Blockchain, types.Address, *core.Transaction) {
+	privKey := crypto.GeneratePrivateKey()
+	sender := privKey.PublicKey().Address()
+
+	g := core.DefaultGenesis()
+	g.Alloc[sender] = core.GenesisAccount{Balance: 100}
+	bc, err := core.NewBlockchainFromGenesis(log.NewNopLogger(), g)
+	assert.Nil(t, err)
+
+	code := []byte{byte(core.InstrCallData), 1, byte(core.InstrPushInt), byte(core.InstrLog1)}
+	deploy := &core.Transaction{Type: core.TxTypeDeploy, ChainID: core.DefaultChainID, Data: code}
+	assert.Nil(t, deploy.Sign(privKey))
+	addBlock(t, bc, deploy)
+
+	addr := core.ContractAddress(crypto.HashSHA256, sender, 0)
+	call := &core.Transaction{Type: core.TxTypeCall, ChainID: core.DefaultChainID, Nonce: 1, To: addr, Data: []byte("hi")}
+	assert.Nil(t, call.Sign(privKey))
+	addBlock(t, bc, call)
+
+	return bc, addr, call
+}
+
+// addBlock 将交易打包为新区块并添加到链上
+func addBlock(t *testing.T, bc *core.Blockchain, txx ...*core.Transaction) {
+	prevHeader, err := bc.GetHeader(bc.Height())
+	assert.Nil(t, err)
+	b, err := core.NewBlockFromPrevHeader(crypto.HashSHA256, prevHeader, txx)
+	assert.Nil(t, err)
+
+	receipts, err := bc.ExecuteBlock(b)
+	assert.Nil(t, err)
+	b.ReceiptsRoot = core.ReceiptsRoot(crypto.HashSHA256, receipts)
+	assert.Nil(t, b.Sign(crypto.GeneratePrivateKey()))
+	assert.Nil(t, bc.AddBlock(b))
+}
+
+// call 发送一个 JSON-RPC 请求并解析结果
+func call(t *testing.T, s *Server, method string, params any, result any) *Error {
+	body, err := json.Marshal(map[string]any{"jsonrpc": "2.0", "id": 1, "method": method, "params": params})
+	assert.Nil(t, err)
+
+	rec := httptest.NewRecorder()
+	s.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(body)))
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	var res struct {
+		Result json.RawMessage `json:"result"`
+		Error  *Error          `json:"error"`
+	}
+	assert.Nil(t, json.Unmarshal(rec.Body.Bytes(), &res))
+	if res.Error != nil {
+		return res.Error
+	}
+	if result != nil {
+		assert.Nil(t, json.Unmarshal(res.Result, result))
+	}
+
+	return nil
+}
+
+func TestGetTransactionReceipt(t *testing.T) {
+	bc, addr, tx := newTestChain(t)
+	s := NewServer(log.NewNopLogger(), bc)
+
+	var height uint32
+	assert.Nil(t, call(t, s, "titan_blockNumber", []any{}, &height))
+	assert.Equal(t, uint32(2), height)
+
+	r := new(RPCReceipt)
+	assert.Nil(t, call(t, s, "titan_getTransactionReceipt", []any{tx.Hash(core.TxHasher{})}, r))
+	assert.Equal(t, tx.Hash(core.TxHasher{}), r.TxHash)
+	assert.Equal(t, uint32(2), r.BlockHeight)
+	assert.Equal(t, uint8(core.ReceiptStatusSuccessful), r.Status)
+	assert.Nil(t, r.ContractAddress)
+	assert.Equal(t, 1, len(r.Logs))
+	assert.Equal(t, addr, r.Logs[0].Address)
+	assert.Equal(t, hex.EncodeToString([]byte("hi")), r.Logs[0].Data)
+
+	// 未上链的交易返回 null
+	var missing *RPCReceipt
+	assert.Nil(t, call(t, s, "titan_getTransactionReceipt", []any{types.Hash{0x01}}, &missing))
+	assert.Nil(t, missing)
+
+	// 参数不合法
+	err := call(t, s, "titan_getTransactionReceipt", []any{"zz"}, nil)
+	assert.NotNil(t, err)
+	assert.Equal(t, ErrCodeInvalidParams, err.Code)
+}
+
+func TestGetLogs(t *testing.T) {
+	bc, addr, tx := newTestChain(t)
+	s := NewServer(log.NewNopLogger(), bc)
+
+	var topic types.Hash
+	topic[31] = 1
+
+	var logs []*RPCLog
+	filter := map[string]any{"addresses": []types.Address{addr}, "topics": [][]types.Hash{{topic}}}
+	assert.Nil(t, call(t, s, "titan_getLogs", []any{filter}, &logs))
+	assert.Equal(t, 1, len(logs))
+	assert.Equal(t, tx.Hash(core.TxHasher{}), logs[0].TxHash)
+	assert.Equal(t, []types.Hash{topic}, logs[0].Topics)
+
+	// 区块范围不包含调用交易
+	filter = map[string]any{"fromBlock": 0, "toBlock": 1}
+	assert.Nil(t, call(t, s, "titan_getLogs", []any{filter}, &logs))
+	assert.Equal(t, 0, len(logs))
+
+	// 主题不匹配
+	filter = map[string]any{"topics": [][]types.Hash{{{0x02}}}}
+	assert.Nil(t, call(t, s, "titan_getLogs", []any{filter}, &logs))
+	assert.Equal(t, 0, len(logs))
+
+	err := call(t, s, "titan_getLogs", []any{map[string]any{"fromBlock": 5, "toBlock": 1}}, nil)
+	assert.NotNil(t, err)
+	assert.Equal(t, ErrCodeInvalidParams, err.Code)
+
+	// 区块范围超过上限
+	err = call(t, s, "titan_getLogs", []any{map[string]any{"fromBlock": 0, "toBlock": core.MaxLogBlockRange}}, nil)
+	assert.NotNil(t, err)
+	assert.Equal(t, ErrCodeInvalidParams, err.Code)
+
+	// 缺省的起始高度使范围不超过上限
+	filter = map[string]any{"toBlock": core.MaxLogBlockRange + 1, "addresses": []types.Address{addr}}
+	assert.Nil(t, call(t, s, "titan_getLogs", []any{filter}, &logs))
+	assert.Equal(t, 1, len(logs))
+}
+
+func TestTraceTransaction(t *testing.T) {
+	bc, _, tx := newTestChain(t)
+	s := NewServer(log.NewNopLogger(), bc)
+
+	trace := new(core.ExecutionTrace)
+	assert.Nil(t, call(t, s, "debug_traceTransaction", []any{tx.Hash(core.TxHasher{})}, trace))
+	assert.False(t, trace.Failed)
+
+	r, err := bc.GetReceipt(tx.Hash(core.TxHasher{}))
+	assert.Nil(t, err)
+	assert.Equal(t, r.GasUsed, trace.GasUsed)
+
+	ops := []string{}
+	for _, l := range trace.StructLogs {
+		ops = append(ops, l.Op)
+	}
+	assert.Equal(t, []string{"CALLDATA", "PUSHINT", "LOG1"}, ops)
+
+	rpcErr := call(t, s, "debug_traceTransaction", []any{types.Hash{0x01}}, nil)
+	assert.NotNil(t, rpcErr)
+	assert.Equal(t, ErrCodeServer, rpcErr.Code)
+}
+
+func TestCallAndEstimateGas(t *testing.T) {
+	bc, addr, tx := newTestChain(t)
+	s := NewServer(log.NewNopLogger(), bc)
+	sender, err := tx.Sender(crypto.HashSHA256)
+	assert.Nil(t, err)
+
+	args := map[string]any{"from": sender, "to": addr, "data": "0x" + hex.EncodeToString([]byte("hi"))}
+	res := new(RPCCallResult)
+	assert.Nil(t, call(t, s, "titan_call", []any{args}, res))
+	assert.False(t, res.Failed)
+	assert.Equal(t, 1, len(res.Logs))
+	assert.Equal(t, hex.EncodeToString([]byte("hi")), res.Logs[0].Data)
+
+	r, err := bc.GetReceipt(tx.Hash(core.TxHasher{}))
+	assert.Nil(t, err)
+	assert.Equal(t, r.GasUsed, res.GasUsed)
+
+	var gas uint64
+	assert.Nil(t, call(t, s, "titan_estimateGas", []any{args}, &gas))
+	assert.Equal(t, r.GasUsed, gas)
+
+	// 指定区块高度，以及 gas 不足时执行失败
+	args["gas"] = gas - 1
+	assert.Nil(t, call(t, s, "titan_call", []any{args, 1}, res))
+	assert.True(t, res.Failed)
+	assert.Equal(t, core.ErrOutOfGas.Error(), res.Error)
+
+	// 部署之前合约不存在
+	rpcErr := call(t, s, "titan_call", []any{args, 0}, nil)
+	assert.NotNil(t, rpcErr)
+	assert.Equal(t, ErrCodeServer, rpcErr.Code)
+
+	rpcErr = call(t, s, "titan_estimateGas", []any{map[string]any{"to": addr, "data": "zz"}}, nil)
+	assert.NotNil(t, rpcErr)
+	assert.Equal(t, ErrCodeInvalidParams, rpcErr.Code)
+}
+
+func TestServerErrors(t *testing.T) {
+	bc, _, _ := newTestChain(t)
+	s := NewServer(log.NewNopLogger(), bc)
+
+	err := call(t, s, "titan_unknown", []any{}, nil)
+	assert.NotNil(t, err)
+	assert.Equal(t, ErrCodeMethodNotFound, err.Code)
+
+	rec := httptest.NewRecorder()
+	s.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/", bytes.NewReader([]byte("{"))))
+	res := new(Response)
+	assert.Nil(t, json.Unmarshal(rec.Body.Bytes(), res))
+	assert.Equal(t, ErrCodeParse, res.Error.Code)
+
+	// 超出大小限制的请求体
+	body := append([]byte(`{"jsonrpc":"2.0","id":1,"method":"titan_blockNumber","params":["`), bytes.Repeat([]byte("a"), maxRequestSize)...)
+	rec = httptest.NewRecorder()
+	s.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(append(body, `"]}`...))))
+	res = new(Response)
+	assert.Nil(t, json.Unmarshal(rec.Body.Bytes(), res))
+	assert.Equal(t, ErrCodeParse, res.Error.Code)
+
+	rec = httptest.NewRecorder()
+	s.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+}
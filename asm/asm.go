@@ -0,0 +1,380 @@
+// Package asm 实现了 TitanChain 虚拟机字节码的汇编器与反汇编器
+package asm
+
+import (
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/felixkuang/titanchain/core"
+)
+
+// labelWidth 是标签地址作为 PUSHN 立即数时的固定字节数，因此单个程序最长 65535 字节
+const labelWidth = 2
+
+// operand 表示指令的操作数：数值或标签引用
+type operand struct {
+	value *big.Int // 数值，标签引用时在第二遍填充
+	width int      // 十六进制字面量给出的字节宽度，0 表示按最小宽度编码
+	label string   // 引用的标签名
+}
+
+// item 表示汇编后的一条指令或一段原始字节
+type item struct {
+	line   int // 源代码行号
+	instr  core.Instruction
+	arg    *operand // 操作数，无操作数的指令为 nil
+	raw    []byte   // .byte 指令给出的原始字节
+	offset int      // 在字节码中的偏移
+	size   int      // 编码后的字节数
+}
+
+// assembler 保存汇编过程中的状态
+type assembler struct {
+	consts map[string]*operand // 常量定义
+	labels map[string]int      // 标签到字节码偏移的映射
+	items  []*item
+	offset int
+}
+
+// Assemble 将汇编源代码翻译为虚拟机字节码
+//
+// 语法（每行一条，不区分大小写的助记符）：
+//
+//	; 注释，从分号到行尾
+//	.const NAME VALUE   定义常量，可在任何位置引用
+//	label:              定义标签，值为下一条指令的偏移
+//	.byte V, V, ...     直接写入原始字节
+//	PUSH VALUE          伪指令：0~255 编码为 PUSHINT，更大的值与标签编码为 PUSHN
+//	PUSHINT/PUSHBYTE V  1 字节立即数
+//	PUSHN VALUE         多字节立即数，十六进制字面量的位数决定宽度，标签固定为 2 字节
+//	ADD、JUMP ...       其余无操作数的指令
+//
+// 数值可以是十进制、0x 开头的十六进制、'c' 形式的字符、常量名或标签名。
+// 出错时返回带行号的错误
+func Assemble(src string) ([]byte, error) {
+	a := &assembler{
+		consts: make(map[string]*operand),
+		labels: make(map[string]int),
+	}
+
+	lines := strings.Split(src, "\n")
+
+	// 先收集全部常量，常量的宽度决定了引用它的指令长度
+	for i, line := range lines {
+		fields := tokenize(stripComment(line))
+		if len(fields) == 0 || strings.ToLower(fields[0]) != ".const" {
+			continue
+		}
+		if err := a.defineConst(fields); err != nil {
+			return nil, fmt.Errorf("line %d: %s", i+1, err)
+		}
+	}
+
+	for i, line := range lines {
+		if err := a.parseLine(i+1, stripComment(line)); err != nil {
+			return nil, fmt.Errorf("line %d: %s", i+1, err)
+		}
+	}
+
+	code := make([]byte, 0, a.offset)
+	for _, it := range a.items {
+		b, err := a.encode(it)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %s", it.line, err)
+		}
+		code = append(code, b...)
+	}
+
+	return code, nil
+}
+
+// defineConst 处理 .const 指令
+func (a *assembler) defineConst(fields []string) error {
+	if len(fields) != 3 {
+		return fmt.Errorf(".const expects a name and a value")
+	}
+	name := fields[1]
+	if !isIdent(name) {
+		return fmt.Errorf("invalid constant name %s", name)
+	}
+	if _, ok := a.consts[name]; ok {
+		return fmt.Errorf("constant %s already defined", name)
+	}
+
+	op, err := parseLiteral(fields[2])
+	if err != nil {
+		return err
+	}
+	a.consts[name] = op
+
+	return nil
+}
+
+// parseLine 解析一行源代码，记录标签与指令
+func (a *assembler) parseLine(line int, text string) error {
+	fields := tokenize(text)
+
+	// 行首可以有多个标签
+	for len(fields) > 0 && strings.HasSuffix(fields[0], ":") {
+		name := strings.TrimSuffix(fields[0], ":")
+		if !isIdent(name) {
+			return fmt.Errorf("invalid label name %s", name)
+		}
+		if _, ok := a.labels[name]; ok {
+			return fmt.Errorf("label %s already defined", name)
+		}
+		if _, ok := a.consts[name]; ok {
+			return fmt.Errorf("label %s conflicts with a constant", name)
+		}
+		a.labels[name] = a.offset
+		fields = fields[1:]
+	}
+
+	if len(fields) == 0 {
+		return nil
+	}
+
+	mnemonic := strings.ToUpper(fields[0])
+	args := fields[1:]
+	it := &item{line: line, offset: a.offset}
+
+	switch mnemonic {
+	case ".CONST":
+		return nil
+
+	case ".BYTE":
+		if len(args) == 0 {
+			return fmt.Errorf(".byte expects at least one value")
+		}
+		for _, arg := range args {
+			op, err := a.parseOperand(arg)
+			if err != nil {
+				return err
+			}
+			if op.label != "" || op.value.BitLen() > 8 {
+				return fmt.Errorf(".byte value %s out of range", arg)
+			}
+			it.raw = append(it.raw, byte(op.value.Uint64()))
+		}
+		it.size = len(it.raw)
+
+	default:
+		instr, err := a.parseInstruction(mnemonic, args, it)
+		if err != nil {
+			return err
+		}
+		it.instr = instr
+	}
+
+	a.items = append(a.items, it)
+	a.offset += it.size
+
+	return nil
+}
+
+// parseInstruction 解析指令及其操作数，计算编码后的长度
+func (a *assembler) parseInstruction(mnemonic string, args []string, it *item) (core.Instruction, error) {
+	if mnemonic == "PUSH" {
+		if len(args) != 1 {
+			return 0, fmt.Errorf("PUSH expects one operand")
+		}
+		op, err := a.parseOperand(args[0])
+		if err != nil {
+			return 0, err
+		}
+		it.arg = op
+
+		if op.label == "" && op.value.BitLen() <= 8 && op.width <= 1 {
+			it.size = 2
+			return core.InstrPushInt, nil
+		}
+		width, err := pushWidth(op)
+		if err != nil {
+			return 0, err
+		}
+		it.size = 2 + width
+		return core.InstrPushN, nil
+	}
+
+	instr, ok := core.InstructionByName(mnemonic)
+	if !ok {
+		return 0, fmt.Errorf("unknown instruction %s", mnemonic)
+	}
+
+	switch instr {
+	case core.InstrPushInt, core.InstrPushByte, core.InstrDupN, core.InstrSwapN:
+		if len(args) != 1 {
+			return 0, fmt.Errorf("%s expects one operand", instr)
+		}
+		op, err := a.parseOperand(args[0])
+		if err != nil {
+			return 0, err
+		}
+		it.arg = op
+		it.size = 2
+
+	case core.InstrPushN:
+		if len(args) != 1 {
+			return 0, fmt.Errorf("%s expects one operand", instr)
+		}
+		op, err := a.parseOperand(args[0])
+		if err != nil {
+			return 0, err
+		}
+		width, err := pushWidth(op)
+		if err != nil {
+			return 0, err
+		}
+		it.arg = op
+		it.size = 2 + width
+
+	default:
+		if len(args) != 0 {
+			return 0, fmt.Errorf("%s takes no operands", instr)
+		}
+		it.size = 1
+	}
+
+	return instr, nil
+}
+
+// encode 在标签全部确定后编码一条指令，立即数位于操作码之前
+func (a *assembler) encode(it *item) ([]byte, error) {
+	if it.raw != nil {
+		return it.raw, nil
+	}
+	if it.arg == nil {
+		return []byte{byte(it.instr)}, nil
+	}
+
+	value, err := a.resolve(it.arg)
+	if err != nil {
+		return nil, err
+	}
+
+	switch it.instr {
+	case core.InstrPushInt, core.InstrPushByte, core.InstrDupN, core.InstrSwapN:
+		if value.BitLen() > 8 {
+			return nil, fmt.Errorf("%s operand %s out of range", it.instr, value)
+		}
+		return []byte{byte(value.Uint64()), byte(it.instr)}, nil
+
+	default:
+		width := it.size - 2
+		if (value.BitLen()+7)/8 > width {
+			return nil, fmt.Errorf("%s operand %s does not fit in %d bytes", it.instr, value, width)
+		}
+		b := append(value.FillBytes(make([]byte, width)), byte(width), byte(it.instr))
+		return b, nil
+	}
+}
+
+// resolve 返回操作数的数值，标签引用返回标签偏移
+func (a *assembler) resolve(op *operand) (*big.Int, error) {
+	if op.label == "" {
+		return op.value, nil
+	}
+
+	offset, ok := a.labels[op.label]
+	if !ok {
+		return nil, fmt.Errorf("undefined label or constant %s", op.label)
+	}
+
+	return big.NewInt(int64(offset)), nil
+}
+
+// parseOperand 解析操作数：字面量、常量名或标签名
+func (a *assembler) parseOperand(s string) (*operand, error) {
+	if isIdent(s) {
+		if c, ok := a.consts[s]; ok {
+			return c, nil
+		}
+		return &operand{label: s}, nil
+	}
+
+	return parseLiteral(s)
+}
+
+// pushWidth 返回 PUSHN 立即数的字节宽度
+func pushWidth(op *operand) (int, error) {
+	width := op.width
+	switch {
+	case op.label != "":
+		width = labelWidth
+	case width == 0:
+		width = (op.value.BitLen() + 7) / 8
+	}
+	if width == 0 {
+		width = 1
+	}
+	if width > 32 {
+		return 0, fmt.Errorf("operand wider than 32 bytes")
+	}
+
+	return width, nil
+}
+
+// parseLiteral 解析十进制、十六进制或字符字面量
+func parseLiteral(s string) (*operand, error) {
+	switch {
+	case len(s) == 3 && s[0] == '\'' && s[2] == '\'':
+		return &operand{value: big.NewInt(int64(s[1])), width: 1}, nil
+
+	case strings.HasPrefix(s, "0x") || strings.HasPrefix(s, "0X"):
+		digits := s[2:]
+		v, ok := new(big.Int).SetString(digits, 16)
+		if !ok || digits == "" {
+			return nil, fmt.Errorf("invalid hex literal %s", s)
+		}
+		return &operand{value: v, width: (len(digits) + 1) / 2}, nil
+
+	default:
+		v, ok := new(big.Int).SetString(s, 10)
+		if !ok || v.Sign() < 0 {
+			return nil, fmt.Errorf("invalid value %s", s)
+		}
+		return &operand{value: v}, nil
+	}
+}
+
+// stripComment 去掉分号开始的注释，字符字面量中的分号除外
+func stripComment(line string) string {
+	inChar := false
+	for i := 0; i < len(line); i++ {
+		switch line[i] {
+		case '\'':
+			inChar = !inChar
+		case ';':
+			if !inChar {
+				return line[:i]
+			}
+		}
+	}
+
+	return line
+}
+
+// tokenize 按空白与逗号拆分一行
+func tokenize(line string) []string {
+	return strings.FieldsFunc(line, func(r rune) bool {
+		return r == ' ' || r == '\t' || r == ',' || r == '\r'
+	})
+}
+
+// isIdent 判断是否为合法的标识符（字母或下划线开头，后跟字母、数字或下划线）
+func isIdent(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i, r := range s {
+		switch {
+		case r == '_', r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z':
+		case i > 0 && r >= '0' && r <= '9':
+		default:
+			return false
+		}
+	}
+
+	return true
+}
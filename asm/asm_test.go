@@ -0,0 +1,180 @@
+package asm
+
+import (
+	"math/big"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/felixkuang/titanchain/core"
+	"github.com/felixkuang/titanchain/types"
+)
+
+// TestAssembleStore 测试汇编 core 中 TestVM 使用的程序
+func TestAssembleStore(t *testing.T) {
+	src := `
+; 将 5 写入键 "FOO"
+    PUSHBYTE 'F'
+    PUSHBYTE 'O'
+    PUSHBYTE 'O'
+    PUSHINT 3
+    PACK
+    PUSH 5        ; 伪指令，编码为 PUSHINT
+    STORE
+`
+	code, err := Assemble(src)
+	assert.Nil(t, err)
+	assert.Equal(t, []byte{0x46, 0x0c, 0x4f, 0x0c, 0x4f, 0x0c, 0x03, 0x0a, 0x0d, 0x05, 0x0a, 0x0f}, code)
+
+	state := core.NewState()
+	assert.Nil(t, core.NewVM(code, state).Run())
+	_, err = state.GetStorage(types.Address{}, []byte("FOO"))
+	assert.Nil(t, err)
+}
+
+// TestAssembleLabelsAndConsts 测试标签、常量与 PUSH 伪指令的编码
+func TestAssembleLabelsAndConsts(t *testing.T) {
+	src := `
+.const COUNT 5
+.const WIDE 0x0001
+
+    push COUNT
+loop: JUMPDEST
+    PUSH 1
+    SUB
+    DUP
+    PUSH loop     ; 标签固定编码为 2 字节 PUSHN
+    SWAP
+    JUMPI
+    PUSH WIDE     ; 十六进制字面量的宽度被保留
+    PUSH 256
+    PUSHN 0x00ff
+`
+	code, err := Assemble(src)
+	assert.Nil(t, err)
+	assert.Equal(t, []byte{
+		0x05, 0x0a,
+		0x30,
+		0x01, 0x0a,
+		0x0e,
+		0x20,
+		0x00, 0x02, 0x02, 0x09,
+		0x21,
+		0x32,
+		0x00, 0x01, 0x02, 0x09,
+		0x01, 0x00, 0x02, 0x09,
+		0x00, 0xff, 0x02, 0x09,
+	}, code)
+}
+
+// TestAssembleLoop 测试汇编的循环程序在虚拟机中正确执行
+func TestAssembleLoop(t *testing.T) {
+	src := `
+    PUSHINT 3
+loop:
+    JUMPDEST
+    PUSH 1
+    SUB
+    DUP
+    PUSH loop
+    SWAP
+    JUMPI
+    .byte 0x00    ; HALT
+`
+	code, err := Assemble(src)
+	assert.Nil(t, err)
+	assert.Equal(t, byte(core.InstrHalt), code[len(code)-1])
+	assert.Nil(t, core.NewVM(code, core.NewState()).Run())
+}
+
+// TestAssembleErrors 测试错误源代码返回带行号的错误
+func TestAssembleErrors(t *testing.T) {
+	cases := map[string]string{
+		"unknown instruction":  "FOO",
+		"undefined label":      "PUSH nowhere\nJUMP",
+		"duplicate label":      "a:\na:",
+		"operand out of range": "PUSHINT 256",
+		"missing operand":      "PUSHBYTE",
+		"unexpected operand":   "ADD 1",
+		"too wide":             "PUSH 0x1" + zeros(64),
+		"bad literal":          "PUSH 12ab",
+		"bad const":            ".const 1X 2",
+		"byte out of range":    ".byte 0x100",
+	}
+
+	for name, src := range cases {
+		t.Run(name, func(t *testing.T) {
+			_, err := Assemble(src)
+			assert.NotNil(t, err)
+			assert.Contains(t, err.Error(), "line ")
+		})
+	}
+}
+
+// zeros 返回 n 个 '0' 组成的字符串
+func zeros(n int) string {
+	b := make([]byte, n)
+	for i := range b {
+		b[i] = '0'
+	}
+	return string(b)
+}
+
+// TestDisassemble 测试反汇编输出
+func TestDisassemble(t *testing.T) {
+	code := []byte{0x03, 0x0a, 0x46, 0x0c, 0x30, 0x00, 0x04, 0x02, 0x09, 0x31, 0x66}
+	expected := `    PUSHINT 3
+    PUSHBYTE 'F'
+L4:
+    JUMPDEST
+    PUSHN 0x0004
+    JUMP
+    .byte 0x66
+`
+	assert.Equal(t, expected, Disassemble(code))
+}
+
+// TestDisassembleMatchesVM 测试反汇编器与虚拟机对截断与不合法立即数的判断一致
+func TestDisassembleMatchesVM(t *testing.T) {
+	cases := [][]byte{
+		{0x01, 0x04, 0x09},
+		{0x00, 0x09},
+		{0x21, 0x09, 0x0b},
+		{0x09},
+		{0x23},
+	}
+
+	for _, code := range cases {
+		err := core.NewVM(code, core.NewState()).Run()
+		assert.ErrorIs(t, err, core.ErrTruncatedImmediate)
+		assert.True(t, strings.HasPrefix(Disassemble(code), "    .byte "), code)
+	}
+}
+
+// TestRoundTrip 测试反汇编结果可以重新汇编为相同的字节码
+func TestRoundTrip(t *testing.T) {
+	word := new(big.Int).Lsh(big.NewInt(1), 255).Bytes()
+
+	cases := [][]byte{
+		{0x46, 0x0c, 0x4f, 0x0c, 0x4f, 0x0c, 0x03, 0x0a, 0x0d, 0x05, 0x0a, 0x0f},
+		{';', 0x0c, '\'', 0x0c, ',', 0x0c, ' ', 0x0c, 0xff, 0x0c},
+		append(word, 0x20, 0x09),
+		{0x30, 0x00, 0x0a, 0x31},
+		// DUPN 与 SWAPN 的 1 字节立即数
+		{0x01, 0x0a, 0x02, 0x0a, 0x02, 0x23, 0x02, 0x24},
+		{0xee, 0x00, 0xff},
+		// 被截断的第一条指令与长度不合法的 PUSHN
+		{0x01, 0x04, 0x09, 0x0b},
+		{0x0b, 0x00, 0x09},
+		{0x21, 0x09, 0x0b},
+		{0x0a},
+	}
+
+	for _, code := range cases {
+		src := Disassemble(code)
+		got, err := Assemble(src)
+		assert.Nil(t, err, src)
+		assert.Equal(t, code, got, src)
+	}
+}
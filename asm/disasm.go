@@ -0,0 +1,71 @@
+package asm
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/felixkuang/titanchain/core"
+)
+
+// Disassemble 将虚拟机字节码翻译为汇编源代码
+// 立即数位于操作码之前，指令边界从字节码末尾向前解码。
+// 位于指令边界上的 JUMPDEST 前生成 L<偏移> 形式的标签；未知操作码、长度不合法的 PUSHN
+// 与被截断的第一条指令输出为 .byte。输出可以由 Assemble 重新汇编为相同的字节码
+func Disassemble(code []byte) string {
+	// 从末尾向前解码，记录每条指令的起始位置与操作码位置
+	type span struct{ start, pos int }
+	var spans []span
+	for pos := len(code) - 1; pos >= 0; {
+		start := max(pos-core.ImmediateSize(code, pos), 0)
+		spans = append(spans, span{start, pos})
+		pos = start - 1
+	}
+
+	sb := &strings.Builder{}
+	for i := len(spans) - 1; i >= 0; i-- {
+		start, pos := spans[i].start, spans[i].pos
+		instr := core.Instruction(code[pos])
+
+		if !instr.IsValid() || pos-start != core.ImmediateSize(code, pos) ||
+			(instr == core.InstrPushN && (code[pos-1] == 0 || code[pos-1] > 32)) {
+			fmt.Fprintf(sb, "    .byte %s\n", hexBytes(code[start:pos+1]))
+			continue
+		}
+
+		if instr == core.InstrJumpDest {
+			fmt.Fprintf(sb, "L%d:\n", pos)
+		}
+
+		switch instr {
+		case core.InstrPushInt, core.InstrDupN, core.InstrSwapN:
+			fmt.Fprintf(sb, "    %s %d\n", instr, code[pos-1])
+		case core.InstrPushByte:
+			fmt.Fprintf(sb, "    %s %s\n", instr, formatByte(code[pos-1]))
+		case core.InstrPushN:
+			fmt.Fprintf(sb, "    %s 0x%x\n", instr, code[start:pos-1])
+		default:
+			fmt.Fprintf(sb, "    %s\n", instr)
+		}
+	}
+
+	return sb.String()
+}
+
+// formatByte 将可打印字符输出为字符字面量，其余输出为十六进制
+func formatByte(b byte) string {
+	if b > ' ' && b < 0x7f && b != ';' && b != '\'' && b != ',' {
+		return fmt.Sprintf("'%c'", b)
+	}
+
+	return fmt.Sprintf("0x%02x", b)
+}
+
+// hexBytes 将字节列表格式化为逗号分隔的十六进制
+func hexBytes(b []byte) string {
+	parts := make([]string, len(b))
+	for i, v := range b {
+		parts[i] = fmt.Sprintf("0x%02x", v)
+	}
+
+	return strings.Join(parts, ", ")
+}
@@ -0,0 +1,193 @@
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/felixkuang/titanchain/asm"
+	"github.com/felixkuang/titanchain/compiler"
+	"github.com/felixkuang/titanchain/crypto"
+)
+
+// commands 记录命令行子命令及其处理函数
+// 子命令的参数不包含子命令名本身
+var commands = map[string]func(args []string) error{
+	"asm":     asmCommand,
+	"compile": compileCommand,
+	"disasm":  disasmCommand,
+	"keygen":  keygenCommand,
+}
+
+// runCommand 执行 args[0] 对应的子命令
+// 返回是否存在该子命令，以及子命令执行的错误
+func runCommand(args []string) (bool, error) {
+	if len(args) == 0 {
+		return false, nil
+	}
+
+	cmd, ok := commands[args[0]]
+	if !ok {
+		return false, nil
+	}
+
+	return true, cmd(args[1:])
+}
+
+// asmCommand 汇编源文件并以十六进制输出字节码
+// 用法：titanchain asm [file]，省略 file 或为 - 时从标准输入读取
+func asmCommand(args []string) error {
+	src, err := readInput(args)
+	if err != nil {
+		return err
+	}
+
+	code, err := asm.Assemble(string(src))
+	if err != nil {
+		return err
+	}
+
+	fmt.Println(hex.EncodeToString(code))
+
+	return nil
+}
+
+// disasmCommand 反汇编十六进制字节码并输出汇编源代码
+// 用法：titanchain disasm [file|0x...]，参数以 0x 开头时视为字节码本身，
+// 否则为包含十六进制字节码的文件，省略或为 - 时从标准输入读取
+func disasmCommand(args []string) error {
+	var input []byte
+	if len(args) == 1 && strings.HasPrefix(args[0], "0x") {
+		input = []byte(args[0])
+	} else {
+		b, err := readInput(args)
+		if err != nil {
+			return err
+		}
+		input = b
+	}
+
+	text := strings.Join(strings.Fields(string(input)), "")
+	code, err := hex.DecodeString(strings.TrimPrefix(text, "0x"))
+	if err != nil {
+		return fmt.Errorf("invalid hex bytecode: %s", err)
+	}
+
+	fmt.Print(asm.Disassemble(code))
+
+	return nil
+}
+
+// compileCommand 编译合约源文件，以 JSON 输出合约名、十六进制字节码与 ABI
+// 用法：titanchain compile [-asm] [file]，指定 -asm 时改为输出生成的汇编代码
+func compileCommand(args []string) error {
+	printAsm := len(args) > 0 && args[0] == "-asm"
+	if printAsm {
+		args = args[1:]
+	}
+
+	src, err := readInput(args)
+	if err != nil {
+		return err
+	}
+
+	out, err := compiler.Compile(string(src))
+	if err != nil {
+		return err
+	}
+
+	if printAsm {
+		fmt.Print(out.Asm)
+		return nil
+	}
+
+	b, err := json.MarshalIndent(map[string]any{
+		"contract": out.Name,
+		"bytecode": "0x" + hex.EncodeToString(out.Code),
+		"abi":      out.ABI,
+	}, "", "  ")
+	if err != nil {
+		return err
+	}
+	fmt.Println(string(b))
+
+	return nil
+}
+
+// keygenCommand 生成新的私钥并以口令加密保存为 keystore 文件，输出密钥类型、公钥、地址及推导地址所用的哈希算法
+// 公钥为十六进制的自描述公钥，可以直接填入创世配置的 validators；地址按 -hash 指定的算法推导，需与链配置的哈希算法一致
+// 用法：titanchain keygen [-type p256|ed25519|secp256k1] [-hash sha256|keccak256|blake2b256] -password-file file out.json，
+// 默认生成 Ed25519 密钥并按 SHA256 推导地址
+func keygenCommand(args []string) error {
+	fs := flag.NewFlagSet("keygen", flag.ContinueOnError)
+	keyType := fs.String("type", crypto.KeyTypeEd25519.String(), "key type: p256, ed25519 or secp256k1")
+	hashName := fs.String("hash", crypto.HashSHA256.String(), "hash algorithm of the chain used to derive the address: sha256, keccak256 or blake2b256")
+	passwordFile := fs.String("password-file", "", "path to a file containing the keystore password")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 || *passwordFile == "" {
+		return fmt.Errorf("usage: keygen [-type p256|ed25519|secp256k1] [-hash sha256|keccak256|blake2b256] -password-file file out.json")
+	}
+
+	t, err := crypto.ParseKeyType(*keyType)
+	if err != nil {
+		return err
+	}
+	algo := crypto.HashAlgorithm(*hashName)
+	if err := algo.Validate(); err != nil {
+		return err
+	}
+	password, err := readPassword(*passwordFile)
+	if err != nil {
+		return err
+	}
+
+	privKey, err := crypto.GenerateKey(t)
+	if err != nil {
+		return err
+	}
+	if err := crypto.SaveKey(fs.Arg(0), privKey, password); err != nil {
+		return err
+	}
+
+	b, err := json.MarshalIndent(map[string]any{
+		"keyType":   t.String(),
+		"publicKey": hex.EncodeToString(privKey.PublicKey().ToSlice()),
+		"address":   privKey.PublicKey().AddressWith(algo),
+		"hash":      algo.String(),
+		"keystore":  fs.Arg(0),
+	}, "", "  ")
+	if err != nil {
+		return err
+	}
+	fmt.Println(string(b))
+
+	return nil
+}
+
+// readPassword 读取口令文件，去掉末尾的换行符
+func readPassword(path string) (string, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimRight(string(b), "\r\n"), nil
+}
+
+// readInput 读取参数指定的文件，无参数或参数为 - 时读取标准输入
+func readInput(args []string) ([]byte, error) {
+	switch {
+	case len(args) == 0 || (len(args) == 1 && args[0] == "-"):
+		return io.ReadAll(os.Stdin)
+	case len(args) == 1:
+		return os.ReadFile(args[0])
+	default:
+		return nil, fmt.Errorf("expected at most one input file")
+	}
+}
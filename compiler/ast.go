@@ -0,0 +1,250 @@
+package compiler
+
+import (
+	"math/big"
+)
+
+// TypeKind 表示语言中值的类型种类
+type TypeKind int
+
+const (
+	// TypeVoid 表示函数没有返回值
+	TypeVoid TypeKind = iota
+	// TypeUint 表示 256 位无符号整数，对应 ABI 类型 uint256
+	TypeUint
+	// TypeBool 表示布尔值
+	TypeBool
+	// TypeAddress 表示 20 字节地址
+	TypeAddress
+	// TypeMapping 表示存储映射，只能作为存储变量的类型
+	TypeMapping
+)
+
+// Type 表示一个类型，映射类型带有键与值的类型
+type Type struct {
+	Kind  TypeKind
+	Key   *Type
+	Value *Type
+}
+
+var (
+	voidType    = &Type{Kind: TypeVoid}
+	uintType    = &Type{Kind: TypeUint}
+	boolType    = &Type{Kind: TypeBool}
+	addressType = &Type{Kind: TypeAddress}
+)
+
+func (t *Type) String() string {
+	switch t.Kind {
+	case TypeUint:
+		return "uint"
+	case TypeBool:
+		return "bool"
+	case TypeAddress:
+		return "address"
+	case TypeMapping:
+		return "mapping(" + t.Key.String() + " => " + t.Value.String() + ")"
+	default:
+		return "void"
+	}
+}
+
+// Equal 判断两个类型是否相同
+func (t *Type) Equal(o *Type) bool {
+	if t.Kind != o.Kind {
+		return false
+	}
+	if t.Kind == TypeMapping {
+		return t.Key.Equal(o.Key) && t.Value.Equal(o.Value)
+	}
+
+	return true
+}
+
+// abiType 返回值类型对应的 ABI 类型名
+func (t *Type) abiType() string {
+	if t.Kind == TypeUint {
+		return "uint256"
+	}
+
+	return t.String()
+}
+
+// Contract 是一个合约的语法树
+type Contract struct {
+	Name    string
+	Storage []*StorageVar
+	Events  []*EventDecl
+	Funcs   []*FuncDecl
+}
+
+// StorageVar 声明一个存储变量
+type StorageVar struct {
+	Name string
+	Type *Type
+	Line int
+}
+
+// Param 是函数或事件的参数
+type Param struct {
+	Name    string
+	Type    *Type
+	Indexed bool // 仅用于事件参数
+}
+
+// EventDecl 声明一个事件
+type EventDecl struct {
+	Name   string
+	Params []*Param
+	Line   int
+}
+
+// FuncDecl 声明一个函数，Pub 为 true 时可以通过调用数据从外部调用
+type FuncDecl struct {
+	Name   string
+	Pub    bool
+	Params []*Param
+	Result *Type
+	Body   *Block
+	Line   int
+}
+
+// Block 是花括号括起的语句序列，块内声明的局部变量在块结束时失效
+type Block struct {
+	Stmts []Stmt
+}
+
+// Stmt 是语句
+type Stmt interface {
+	line() int
+}
+
+// LetStmt 声明并初始化局部变量，Type 为 nil 时由初始值推导
+type LetStmt struct {
+	Name  string
+	Type  *Type
+	Value Expr
+	Line  int
+}
+
+// AssignStmt 为局部变量、存储变量或映射元素赋值
+type AssignStmt struct {
+	Target Expr
+	Value  Expr
+	Line   int
+}
+
+// IfStmt 是条件语句，Else 为 nil、*BlockStmt 或 *IfStmt
+type IfStmt struct {
+	Cond Expr
+	Then *Block
+	Else Stmt
+	Line int
+}
+
+// WhileStmt 是循环语句
+type WhileStmt struct {
+	Cond Expr
+	Body *Block
+	Line int
+}
+
+// BranchStmt 是 break 或 continue
+type BranchStmt struct {
+	Keyword string
+	Line    int
+}
+
+// ReturnStmt 从函数返回，Value 为 nil 时表示无返回值
+type ReturnStmt struct {
+	Value Expr
+	Line  int
+}
+
+// EmitStmt 发出事件
+type EmitStmt struct {
+	Event string
+	Args  []Expr
+	Line  int
+}
+
+// ExprStmt 是作为语句的表达式，只能是函数调用
+type ExprStmt struct {
+	X    Expr
+	Line int
+}
+
+// BlockStmt 是嵌套的语句块
+type BlockStmt struct {
+	Block *Block
+	Line  int
+}
+
+func (s *LetStmt) line() int    { return s.Line }
+func (s *AssignStmt) line() int { return s.Line }
+func (s *IfStmt) line() int     { return s.Line }
+func (s *WhileStmt) line() int  { return s.Line }
+func (s *BranchStmt) line() int { return s.Line }
+func (s *ReturnStmt) line() int { return s.Line }
+func (s *EmitStmt) line() int   { return s.Line }
+func (s *ExprStmt) line() int   { return s.Line }
+func (s *BlockStmt) line() int  { return s.Line }
+
+// Expr 是表达式
+type Expr interface {
+	line() int
+}
+
+// NumberLit 是整数字面量
+type NumberLit struct {
+	Value *big.Int
+	Line  int
+}
+
+// BoolLit 是 true 或 false
+type BoolLit struct {
+	Value bool
+	Line  int
+}
+
+// Ident 引用局部变量、参数或存储变量
+type Ident struct {
+	Name string
+	Line int
+}
+
+// IndexExpr 按键访问映射
+type IndexExpr struct {
+	X    Expr
+	Key  Expr
+	Line int
+}
+
+// CallExpr 调用函数、内置函数或类型转换
+type CallExpr struct {
+	Func string
+	Args []Expr
+	Line int
+}
+
+// UnaryExpr 是一元运算，目前只有逻辑非 !
+type UnaryExpr struct {
+	Op   string
+	X    Expr
+	Line int
+}
+
+// BinaryExpr 是二元运算
+type BinaryExpr struct {
+	Op   string
+	X, Y Expr
+	Line int
+}
+
+func (e *NumberLit) line() int  { return e.Line }
+func (e *BoolLit) line() int    { return e.Line }
+func (e *Ident) line() int      { return e.Line }
+func (e *IndexExpr) line() int  { return e.Line }
+func (e *CallExpr) line() int   { return e.Line }
+func (e *UnaryExpr) line() int  { return e.Line }
+func (e *BinaryExpr) line() int { return e.Line }
@@ -0,0 +1,978 @@
+package compiler
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/felixkuang/titanchain/abi"
+)
+
+const (
+	// maxStorageVars 是存储变量个数的上限，存储槽位编码为 1 字节
+	maxStorageVars = 256
+	// maxStackDepth 是函数内可以访问的最大栈深度，受 DUPN/SWAPN 的 1 字节立即数限制
+	maxStackDepth = 255
+	// maxIndexed 是事件索引参数个数的上限，LOG4 的第一个主题为事件 ID
+	maxIndexed = 3
+	// revertLabel 是调度器中参数不合法时跳转的位置
+	revertLabel = "revert"
+)
+
+// builtins 记录内置函数的返回类型，require 与 revert 只能作为语句使用
+var builtins = map[string]*Type{
+	"caller":    addressType,
+	"self":      addressType,
+	"value":     uintType,
+	"height":    uintType,
+	"timestamp": uintType,
+	"require":   voidType,
+	"revert":    voidType,
+}
+
+// builtinInstrs 记录无参数内置函数对应的指令
+var builtinInstrs = map[string]string{
+	"caller":    "CALLER",
+	"self":      "ADDRESS",
+	"value":     "CALLVALUE",
+	"height":    "HEIGHT",
+	"timestamp": "TIMESTAMP",
+}
+
+// binaryInstrs 记录二元运算符对应的指令，带 "!" 后缀的表示对结果取逻辑非
+var binaryInstrs = map[string]string{
+	"+": "ADD", "-": "SUB", "*": "MUL", "/": "DIV", "%": "MOD", "**": "EXP",
+	"<": "LT", ">": "GT", "==": "EQ",
+	"<=": "GT!", ">=": "LT!", "!=": "EQ!",
+}
+
+// storageSlot 是存储变量的槽位
+type storageSlot struct {
+	slot int
+	typ  *Type
+}
+
+// local 是函数参数或局部变量，pos 为其在函数栈帧中的位置，0 为第一个参数
+type local struct {
+	pos int
+	typ *Type
+}
+
+// loopLabels 记录循环的标签与进入循环体前的栈高度，供 break 与 continue 使用
+type loopLabels struct {
+	head, end string
+	height    int
+}
+
+// generator 在类型检查的同时生成汇编代码
+// 函数编译为子程序：参数按顺序位于栈帧底部，局部变量依次压入栈，通过 DUPN/SWAPN 访问；
+// 返回时只在栈上保留返回值
+type generator struct {
+	contract *Contract
+	storage  map[string]*storageSlot
+	events   map[string]*abi.Event
+	funcs    map[string]*FuncDecl
+	abi      *abi.ABI
+	sb       strings.Builder
+	labels   int
+
+	// 当前函数的状态
+	fn     *FuncDecl
+	height int // 栈帧内的元素个数
+	scopes []map[string]*local
+	loops  []loopLabels
+}
+
+func newGenerator(c *Contract) *generator {
+	return &generator{
+		contract: c,
+		storage:  make(map[string]*storageSlot),
+		events:   make(map[string]*abi.Event),
+		funcs:    make(map[string]*FuncDecl),
+		abi:      &abi.ABI{Methods: make(map[string]abi.Method), Events: make(map[string]abi.Event)},
+	}
+}
+
+func errorf(line int, format string, args ...any) error {
+	return fmt.Errorf("line %d: %s", line, fmt.Sprintf(format, args...))
+}
+
+// generate 检查合约并生成汇编代码
+func (g *generator) generate() error {
+	if err := g.declare(); err != nil {
+		return err
+	}
+
+	g.dispatcher()
+	for _, f := range g.contract.Funcs {
+		if err := g.function(f); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// declare 登记存储变量、事件与函数，并生成 ABI
+func (g *generator) declare() error {
+	c := g.contract
+	if len(c.Storage) > maxStorageVars {
+		return errorf(c.Storage[maxStorageVars].Line, "too many storage variables (max %d)", maxStorageVars)
+	}
+
+	names := make(map[string]bool)
+	declareName := func(line int, name string) error {
+		if names[name] {
+			return errorf(line, "%s redeclared", name)
+		}
+		if _, ok := builtins[name]; ok {
+			return errorf(line, "%s is a builtin function", name)
+		}
+		names[name] = true
+		return nil
+	}
+
+	for i, v := range c.Storage {
+		if err := declareName(v.Line, v.Name); err != nil {
+			return err
+		}
+		g.storage[v.Name] = &storageSlot{slot: i, typ: v.Type}
+	}
+
+	for _, e := range c.Events {
+		if err := declareName(e.Line, e.Name); err != nil {
+			return err
+		}
+		event := abi.Event{Name: e.Name}
+		indexed := 0
+		for _, p := range e.Params {
+			arg, err := abiArgument(p)
+			if err != nil {
+				return errorf(e.Line, "%s", err)
+			}
+			event.Inputs = append(event.Inputs, arg)
+			if p.Indexed {
+				indexed++
+			}
+		}
+		if indexed > maxIndexed {
+			return errorf(e.Line, "event %s has too many indexed parameters (max %d)", e.Name, maxIndexed)
+		}
+		if err := checkParams(e.Line, e.Params); err != nil {
+			return err
+		}
+		g.events[e.Name] = &event
+		g.abi.Events[e.Name] = event
+	}
+
+	selectors := make(map[string]string)
+	for _, f := range c.Funcs {
+		if err := declareName(f.Line, f.Name); err != nil {
+			return err
+		}
+		if err := checkParams(f.Line, f.Params); err != nil {
+			return err
+		}
+		g.funcs[f.Name] = f
+		if !f.Pub {
+			continue
+		}
+
+		m := abi.Method{Name: f.Name}
+		for _, p := range f.Params {
+			arg, err := abiArgument(p)
+			if err != nil {
+				return errorf(f.Line, "%s", err)
+			}
+			m.Inputs = append(m.Inputs, arg)
+		}
+		if f.Result.Kind != TypeVoid {
+			arg, err := abiArgument(&Param{Type: f.Result})
+			if err != nil {
+				return errorf(f.Line, "%s", err)
+			}
+			m.Outputs = abi.Arguments{arg}
+		}
+
+		id := string(m.ID())
+		if other, ok := selectors[id]; ok {
+			return errorf(f.Line, "selector of %s collides with %s", f.Name, other)
+		}
+		selectors[id] = f.Name
+		g.abi.Methods[f.Name] = m
+	}
+
+	return nil
+}
+
+// checkParams 检查参数名不重复
+func checkParams(line int, params []*Param) error {
+	seen := make(map[string]bool)
+	for _, p := range params {
+		if seen[p.Name] {
+			return errorf(line, "duplicate parameter %s", p.Name)
+		}
+		seen[p.Name] = true
+	}
+
+	return nil
+}
+
+func abiArgument(p *Param) (abi.Argument, error) {
+	t, err := abi.NewType(p.Type.abiType())
+	if err != nil {
+		return abi.Argument{}, err
+	}
+
+	return abi.Argument{Name: p.Name, Type: t, Indexed: p.Indexed}, nil
+}
+
+// dispatcher 生成入口代码：按调用数据的前 4 字节选择公开函数，从调用数据读取参数后调用该函数，
+// 以函数的返回值结束执行；选择器不匹配、调用数据过短或参数不合法时回滚
+func (g *generator) dispatcher() {
+	g.comment("dispatcher")
+	g.line("PUSH 0")
+	g.line("CALLDATALOAD")
+	g.line("PUSH 224")
+	g.line("SHR")
+	for _, f := range g.contract.Funcs {
+		if !f.Pub {
+			continue
+		}
+		g.line("DUP")
+		g.line("PUSH 0x%x", g.abi.Methods[f.Name].ID())
+		g.line("EQ")
+		g.line("PUSH pub_%s", f.Name)
+		g.line("SWAP")
+		g.line("JUMPI")
+	}
+	g.label(revertLabel)
+	g.line("REVERT")
+
+	for _, f := range g.contract.Funcs {
+		if !f.Pub {
+			continue
+		}
+
+		g.label("pub_" + f.Name)
+		g.line("POP")
+		g.line("CALLDATASIZE")
+		g.line("PUSH %d", abi.SelectorSize+32*len(f.Params))
+		g.line("LT")
+		g.line("PUSH %s", revertLabel)
+		g.line("SWAP")
+		g.line("JUMPI")
+
+		for i, p := range f.Params {
+			g.line("PUSH %d", abi.SelectorSize+32*i)
+			g.line("CALLDATALOAD")
+			// bool 参数只能是 0 或 1，address 参数的高 96 位必须为 0
+			switch p.Type.Kind {
+			case TypeBool:
+				g.line("DUP")
+				g.line("PUSH 1")
+				g.line("GT")
+			case TypeAddress:
+				g.line("DUP")
+				g.line("PUSH 160")
+				g.line("SHR")
+			default:
+				continue
+			}
+			g.line("PUSH %s", revertLabel)
+			g.line("SWAP")
+			g.line("JUMPI")
+		}
+
+		g.line("PUSH fn_%s", f.Name)
+		g.line("CALLSUB")
+		if f.Result.Kind == TypeVoid {
+			g.line("HALT")
+		} else {
+			g.line("RETURN")
+		}
+	}
+}
+
+// function 生成函数的子程序
+func (g *generator) function(f *FuncDecl) error {
+	g.fn = f
+	g.height = 0
+	g.loops = nil
+	g.scopes = []map[string]*local{{}}
+
+	g.comment("fn " + f.Name)
+	g.label("fn_" + f.Name)
+	for _, p := range f.Params {
+		if err := g.declareLocal(f.Line, p.Name, p.Type); err != nil {
+			return err
+		}
+	}
+
+	terminated, err := g.block(f.Body, false)
+	if err != nil {
+		return err
+	}
+	if terminated {
+		return nil
+	}
+	if f.Result.Kind != TypeVoid {
+		return errorf(f.Line, "missing return at end of %s", f.Name)
+	}
+
+	g.pop(g.height)
+	g.line("RETSUB")
+
+	return nil
+}
+
+// block 生成语句块，返回块是否必然不会执行到结尾
+// scoped 为 true 时块内声明的局部变量在块结束时出栈
+func (g *generator) block(b *Block, scoped bool) (bool, error) {
+	if scoped {
+		g.scopes = append(g.scopes, map[string]*local{})
+	}
+
+	terminated := false
+	for _, s := range b.Stmts {
+		t, err := g.stmt(s)
+		if err != nil {
+			return false, err
+		}
+		terminated = terminated || t
+	}
+
+	if scoped {
+		n := len(g.scopes[len(g.scopes)-1])
+		g.scopes = g.scopes[:len(g.scopes)-1]
+		if terminated {
+			g.height -= n
+		} else {
+			g.pop(n)
+		}
+	}
+
+	return terminated, nil
+}
+
+// stmt 生成一条语句，返回语句是否必然不会执行到结尾
+func (g *generator) stmt(s Stmt) (bool, error) {
+	switch s := s.(type) {
+	case *LetStmt:
+		t, err := g.value(s.Value)
+		if err != nil {
+			return false, err
+		}
+		if s.Type != nil && !s.Type.Equal(t) {
+			return false, errorf(s.Line, "cannot use %s as %s in declaration of %s", t, s.Type, s.Name)
+		}
+		g.height--
+		return false, g.declareLocal(s.Line, s.Name, t)
+
+	case *AssignStmt:
+		return false, g.assign(s)
+
+	case *IfStmt:
+		return g.ifStmt(s)
+
+	case *WhileStmt:
+		head, end := g.newLabel(), g.newLabel()
+		g.label(head)
+		if err := g.cond(s.Cond); err != nil {
+			return false, err
+		}
+		g.jumpIfNot(end)
+
+		g.loops = append(g.loops, loopLabels{head: head, end: end, height: g.height})
+		terminated, err := g.block(s.Body, true)
+		g.loops = g.loops[:len(g.loops)-1]
+		if err != nil {
+			return false, err
+		}
+		if !terminated {
+			g.jump(head)
+		}
+		g.label(end)
+		return false, nil
+
+	case *BranchStmt:
+		if len(g.loops) == 0 {
+			return false, errorf(s.Line, "%s outside loop", s.Keyword)
+		}
+		loop := g.loops[len(g.loops)-1]
+		height := g.height
+		g.pop(g.height - loop.height)
+		g.height = height
+		if s.Keyword == "break" {
+			g.jump(loop.end)
+		} else {
+			g.jump(loop.head)
+		}
+		return true, nil
+
+	case *ReturnStmt:
+		return true, g.returnStmt(s)
+
+	case *EmitStmt:
+		return false, g.emit(s)
+
+	case *ExprStmt:
+		call, ok := s.X.(*CallExpr)
+		if !ok {
+			return false, errorf(s.Line, "expression is not used")
+		}
+		t, err := g.call(call)
+		if err != nil {
+			return false, err
+		}
+		if t.Kind != TypeVoid {
+			g.pop(1)
+		}
+		return call.Func == "revert", nil
+
+	case *BlockStmt:
+		return g.block(s.Block, true)
+
+	default:
+		return false, errorf(s.line(), "unknown statement %T", s)
+	}
+}
+
+// ifStmt 生成条件语句，两个分支都不会执行到结尾时整个语句也不会
+func (g *generator) ifStmt(s *IfStmt) (bool, error) {
+	if err := g.cond(s.Cond); err != nil {
+		return false, err
+	}
+	elseLabel := g.newLabel()
+	g.jumpIfNot(elseLabel)
+
+	thenTerminated, err := g.block(s.Then, true)
+	if err != nil {
+		return false, err
+	}
+	if s.Else == nil {
+		g.label(elseLabel)
+		return false, nil
+	}
+
+	endLabel := g.newLabel()
+	if !thenTerminated {
+		g.jump(endLabel)
+	}
+	g.label(elseLabel)
+	elseTerminated, err := g.stmt(s.Else)
+	if err != nil {
+		return false, err
+	}
+	g.label(endLabel)
+
+	return thenTerminated && elseTerminated, nil
+}
+
+// assign 为局部变量、存储变量或映射元素赋值
+func (g *generator) assign(s *AssignStmt) error {
+	if id, ok := s.Target.(*Ident); ok {
+		if l := g.lookup(id.Name); l != nil {
+			t, err := g.value(s.Value)
+			if err != nil {
+				return err
+			}
+			if !l.typ.Equal(t) {
+				return errorf(s.Line, "cannot assign %s to %s of type %s", t, id.Name, l.typ)
+			}
+			// 新值位于栈顶，与变量交换后丢弃旧值
+			if err := g.stackOp(s.Line, "SWAPN", g.height-1-l.pos); err != nil {
+				return err
+			}
+			g.pop(1)
+			return nil
+		}
+	}
+
+	target, err := g.storageKey(s.Target)
+	if err != nil {
+		return err
+	}
+	if target.Kind == TypeMapping {
+		return errorf(s.Line, "cannot assign to mapping")
+	}
+
+	t, err := g.value(s.Value)
+	if err != nil {
+		return err
+	}
+	if !target.Equal(t) {
+		return errorf(s.Line, "cannot assign %s to storage of type %s", t, target)
+	}
+	g.op("STORE", -2)
+
+	return nil
+}
+
+// returnStmt 将返回值移到栈帧底部，丢弃栈帧中的其余元素后返回调用处
+func (g *generator) returnStmt(s *ReturnStmt) error {
+	height := g.height
+
+	if s.Value == nil {
+		if g.fn.Result.Kind != TypeVoid {
+			return errorf(s.Line, "missing return value")
+		}
+		g.pop(g.height)
+		g.line("RETSUB")
+		g.height = height
+		return nil
+	}
+
+	if g.fn.Result.Kind == TypeVoid {
+		return errorf(s.Line, "%s does not return a value", g.fn.Name)
+	}
+	t, err := g.value(s.Value)
+	if err != nil {
+		return err
+	}
+	if !g.fn.Result.Equal(t) {
+		return errorf(s.Line, "cannot return %s from %s, want %s", t, g.fn.Name, g.fn.Result)
+	}
+
+	if n := g.height - 1; n > 0 {
+		if err := g.stackOp(s.Line, "SWAPN", n); err != nil {
+			return err
+		}
+		g.pop(n)
+	}
+	g.line("RETSUB")
+	g.height = height
+
+	return nil
+}
+
+// emit 生成事件：非索引参数按 ABI 编码拼接为事件数据，主题依次为事件 ID 与索引参数
+// 非索引参数先于索引参数求值
+func (g *generator) emit(s *EmitStmt) error {
+	event, ok := g.events[s.Event]
+	if !ok {
+		return errorf(s.Line, "undefined event %s", s.Event)
+	}
+	var decl *EventDecl
+	for _, e := range g.contract.Events {
+		if e.Name == s.Event {
+			decl = e
+		}
+	}
+	if len(s.Args) != len(decl.Params) {
+		return errorf(s.Line, "event %s expects %d arguments, got %d", s.Event, len(decl.Params), len(s.Args))
+	}
+
+	check := func(i int) error {
+		t, err := g.value(s.Args[i])
+		if err != nil {
+			return err
+		}
+		if !decl.Params[i].Type.Equal(t) {
+			return errorf(s.Line, "cannot use %s as %s in argument %d of %s", t, decl.Params[i].Type, i+1, s.Event)
+		}
+		return nil
+	}
+
+	data := 0
+	for i, p := range decl.Params {
+		if p.Indexed {
+			continue
+		}
+		if err := check(i); err != nil {
+			return err
+		}
+		if data++; data > 1 {
+			g.op("CONCAT", -1)
+		}
+	}
+	if data == 0 {
+		g.op("PUSH 0", 1)
+		g.op("PACK", 0)
+	}
+
+	g.op(fmt.Sprintf("PUSH 0x%x", event.ID().ToSlice()), 1)
+	topics := 1
+	for i, p := range decl.Params {
+		if !p.Indexed {
+			continue
+		}
+		if err := check(i); err != nil {
+			return err
+		}
+		topics++
+	}
+	g.op(fmt.Sprintf("LOG%d", topics), -(topics + 1))
+
+	return nil
+}
+
+// value 生成求值表达式的代码，结果压入栈，表达式必须有值
+func (g *generator) value(e Expr) (*Type, error) {
+	t, err := g.expr(e)
+	if err != nil {
+		return nil, err
+	}
+	switch t.Kind {
+	case TypeVoid:
+		return nil, errorf(e.line(), "expression has no value")
+	case TypeMapping:
+		return nil, errorf(e.line(), "mapping cannot be used as a value")
+	}
+
+	return t, nil
+}
+
+// cond 生成条件表达式的代码，条件必须为 bool
+func (g *generator) cond(e Expr) error {
+	t, err := g.value(e)
+	if err != nil {
+		return err
+	}
+	if t.Kind != TypeBool {
+		return errorf(e.line(), "non-bool %s used as condition", t)
+	}
+
+	return nil
+}
+
+func (g *generator) expr(e Expr) (*Type, error) {
+	switch e := e.(type) {
+	case *NumberLit:
+		g.op("PUSH "+e.Value.String(), 1)
+		return uintType, nil
+
+	case *BoolLit:
+		if e.Value {
+			g.op("PUSH 1", 1)
+		} else {
+			g.op("PUSH 0", 1)
+		}
+		return boolType, nil
+
+	case *Ident:
+		if l := g.lookup(e.Name); l != nil {
+			return l.typ, g.stackOp(e.Line, "DUPN", g.height-l.pos)
+		}
+		return g.load(e)
+
+	case *IndexExpr:
+		return g.load(e)
+
+	case *CallExpr:
+		return g.call(e)
+
+	case *UnaryExpr:
+		if err := g.cond(e.X); err != nil {
+			return nil, err
+		}
+		g.not()
+		return boolType, nil
+
+	case *BinaryExpr:
+		return g.binary(e)
+
+	default:
+		return nil, errorf(e.line(), "unknown expression %T", e)
+	}
+}
+
+// load 读取存储变量或映射元素
+func (g *generator) load(e Expr) (*Type, error) {
+	t, err := g.storageKey(e)
+	if err != nil {
+		return nil, err
+	}
+	if t.Kind == TypeMapping {
+		return nil, errorf(e.line(), "mapping cannot be used as a value")
+	}
+	g.op("LOAD", 0)
+
+	return t, nil
+}
+
+// storageKey 生成存储键并返回所存值的类型
+// 存储变量的键为 1 字节槽位，映射元素的键为槽位后接各级键的 32 字节编码
+func (g *generator) storageKey(e Expr) (*Type, error) {
+	switch e := e.(type) {
+	case *Ident:
+		if g.lookup(e.Name) != nil {
+			return nil, errorf(e.Line, "%s is not a mapping", e.Name)
+		}
+		s, ok := g.storage[e.Name]
+		if !ok {
+			return nil, errorf(e.Line, "undefined %s", e.Name)
+		}
+		g.op(fmt.Sprintf("PUSHBYTE %d", s.slot), 1)
+		g.op("PUSH 1", 1)
+		g.op("PACK", -1)
+		return s.typ, nil
+
+	case *IndexExpr:
+		t, err := g.storageKey(e.X)
+		if err != nil {
+			return nil, err
+		}
+		if t.Kind != TypeMapping {
+			return nil, errorf(e.Line, "cannot index %s", t)
+		}
+		key, err := g.value(e.Key)
+		if err != nil {
+			return nil, err
+		}
+		if !t.Key.Equal(key) {
+			return nil, errorf(e.Line, "cannot use %s as mapping key of type %s", key, t.Key)
+		}
+		g.op("CONCAT", -1)
+		return t.Value, nil
+
+	default:
+		return nil, errorf(e.line(), "cannot assign to expression")
+	}
+}
+
+// call 生成函数调用、内置函数或类型转换
+func (g *generator) call(e *CallExpr) (*Type, error) {
+	switch e.Func {
+	case "uint", "bool", "address":
+		return g.conversion(e)
+	}
+
+	if result, ok := builtins[e.Func]; ok {
+		return result, g.builtin(e)
+	}
+
+	f, ok := g.funcs[e.Func]
+	if !ok {
+		return nil, errorf(e.Line, "undefined function %s", e.Func)
+	}
+	if len(e.Args) != len(f.Params) {
+		return nil, errorf(e.Line, "%s expects %d arguments, got %d", f.Name, len(f.Params), len(e.Args))
+	}
+
+	for i, arg := range e.Args {
+		t, err := g.value(arg)
+		if err != nil {
+			return nil, err
+		}
+		if !f.Params[i].Type.Equal(t) {
+			return nil, errorf(e.Line, "cannot use %s as %s in argument %d of %s", t, f.Params[i].Type, i+1, f.Name)
+		}
+	}
+
+	// 子程序消耗全部参数，只留下返回值
+	g.op("PUSH fn_"+f.Name, 1)
+	results := 0
+	if f.Result.Kind != TypeVoid {
+		results = 1
+	}
+	g.op("CALLSUB", -1-len(f.Params)+results)
+
+	return f.Result, nil
+}
+
+// builtin 生成内置函数
+func (g *generator) builtin(e *CallExpr) error {
+	want := 0
+	if e.Func == "require" {
+		want = 1
+	}
+	if len(e.Args) != want {
+		return errorf(e.Line, "%s expects %d arguments, got %d", e.Func, want, len(e.Args))
+	}
+
+	switch e.Func {
+	case "require":
+		if err := g.cond(e.Args[0]); err != nil {
+			return err
+		}
+		ok := g.newLabel()
+		g.jumpIf(ok)
+		g.line("REVERT")
+		g.label(ok)
+	case "revert":
+		g.line("REVERT")
+	default:
+		g.op(builtinInstrs[e.Func], 1)
+	}
+
+	return nil
+}
+
+// conversion 生成类型转换：uint 与 address 互相转换时截取低 160 位，uint 转为 bool 时非 0 为 true
+func (g *generator) conversion(e *CallExpr) (*Type, error) {
+	if len(e.Args) != 1 {
+		return nil, errorf(e.Line, "conversion to %s expects 1 argument", e.Func)
+	}
+	t, err := g.value(e.Args[0])
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case e.Func == t.String():
+		return t, nil
+	case e.Func == "uint":
+		return uintType, nil
+	case e.Func == "address" && t.Kind == TypeUint:
+		g.op("PUSH 0x"+strings.Repeat("ff", 20), 1)
+		g.op("AND", -1)
+		return addressType, nil
+	case e.Func == "bool" && t.Kind == TypeUint:
+		g.not()
+		g.not()
+		return boolType, nil
+	default:
+		return nil, errorf(e.Line, "cannot convert %s to %s", t, e.Func)
+	}
+}
+
+// binary 生成二元运算，&& 与 || 短路求值
+func (g *generator) binary(e *BinaryExpr) (*Type, error) {
+	if e.Op == "&&" || e.Op == "||" {
+		if err := g.cond(e.X); err != nil {
+			return nil, err
+		}
+		end := g.newLabel()
+		// 左操作数已能决定结果时保留它并跳过右操作数
+		g.op("DUP", 1)
+		if e.Op == "&&" {
+			g.not()
+		}
+		g.jumpIf(end)
+		g.pop(1)
+		if err := g.cond(e.Y); err != nil {
+			return nil, err
+		}
+		g.label(end)
+		return boolType, nil
+	}
+
+	x, err := g.value(e.X)
+	if err != nil {
+		return nil, err
+	}
+	y, err := g.value(e.Y)
+	if err != nil {
+		return nil, err
+	}
+
+	result := boolType
+	switch e.Op {
+	case "==", "!=":
+		if !x.Equal(y) {
+			return nil, errorf(e.Line, "mismatched types %s and %s for %s", x, y, e.Op)
+		}
+	default:
+		if x.Kind != TypeUint || y.Kind != TypeUint {
+			return nil, errorf(e.Line, "operator %s requires uint operands, got %s and %s", e.Op, x, y)
+		}
+		switch e.Op {
+		case "+", "-", "*", "/", "%", "**":
+			result = uintType
+		}
+	}
+
+	instr := binaryInstrs[e.Op]
+	g.op(strings.TrimSuffix(instr, "!"), -1)
+	if strings.HasSuffix(instr, "!") {
+		g.not()
+	}
+
+	return result, nil
+}
+
+// declareLocal 在当前作用域声明位于栈顶的局部变量
+func (g *generator) declareLocal(line int, name string, t *Type) error {
+	if g.lookup(name) != nil {
+		return errorf(line, "%s redeclared", name)
+	}
+	if _, ok := g.storage[name]; ok {
+		return errorf(line, "%s shadows storage variable", name)
+	}
+	if _, ok := builtins[name]; ok {
+		return errorf(line, "%s is a builtin function", name)
+	}
+
+	g.scopes[len(g.scopes)-1][name] = &local{pos: g.height, typ: t}
+	g.height++
+
+	return nil
+}
+
+// lookup 查找参数或局部变量
+func (g *generator) lookup(name string) *local {
+	for i := len(g.scopes) - 1; i >= 0; i-- {
+		if l, ok := g.scopes[i][name]; ok {
+			return l
+		}
+	}
+
+	return nil
+}
+
+// stackOp 生成 DUPN 或 SWAPN，深度超出立即数范围时报错
+func (g *generator) stackOp(line int, instr string, n int) error {
+	if n < 1 || n > maxStackDepth {
+		return errorf(line, "too many local variables (stack depth %d)", n)
+	}
+	if instr == "DUPN" {
+		g.op(fmt.Sprintf("DUPN %d", n), 1)
+	} else {
+		g.op(fmt.Sprintf("SWAPN %d", n), 0)
+	}
+
+	return nil
+}
+
+// not 对栈顶的 bool 取逻辑非
+func (g *generator) not() {
+	g.op("PUSH 0", 1)
+	g.op("EQ", -1)
+}
+
+// jumpIf 弹出栈顶的条件，条件为真时跳转到 label
+func (g *generator) jumpIf(label string) {
+	g.op("PUSH "+label, 1)
+	g.op("SWAP", 0)
+	g.op("JUMPI", -2)
+}
+
+// jumpIfNot 弹出栈顶的条件，条件为假时跳转到 label
+func (g *generator) jumpIfNot(label string) {
+	g.not()
+	g.jumpIf(label)
+}
+
+func (g *generator) jump(label string) {
+	g.line("PUSH %s", label)
+	g.line("JUMP")
+}
+
+func (g *generator) pop(n int) {
+	for range n {
+		g.op("POP", -1)
+	}
+}
+
+func (g *generator) newLabel() string {
+	g.labels++
+	return fmt.Sprintf("L%d", g.labels)
+}
+
+// op 生成一条指令并按其栈效果调整栈高度
+func (g *generator) op(instr string, delta int) {
+	g.line("%s", instr)
+	g.height += delta
+}
+
+func (g *generator) line(format string, args ...any) {
+	fmt.Fprintf(&g.sb, "    "+format+"\n", args...)
+}
+
+func (g *generator) label(name string) {
+	fmt.Fprintf(&g.sb, "%s: JUMPDEST\n", name)
+}
+
+func (g *generator) comment(text string) {
+	fmt.Fprintf(&g.sb, "; %s\n", text)
+}
@@ -0,0 +1,43 @@
+// Package compiler 实现了 TitanChain 合约语言的编译器，将源代码编译为 core.VM 字节码与 ABI
+package compiler
+
+import (
+	"fmt"
+
+	"github.com/felixkuang/titanchain/abi"
+	"github.com/felixkuang/titanchain/asm"
+	"github.com/felixkuang/titanchain/core"
+)
+
+// Output 是合约的编译结果
+type Output struct {
+	Name string   // 合约名
+	Code []byte   // core.VM 字节码，可作为部署交易的数据
+	ABI  *abi.ABI // 公开函数与事件的 ABI
+	Asm  string   // 生成的汇编代码，由 asm.Assemble 汇编为 Code
+}
+
+// Compile 编译合约源代码，出错时返回带行号的错误
+func Compile(src string) (*Output, error) {
+	c, err := Parse(src)
+	if err != nil {
+		return nil, err
+	}
+
+	g := newGenerator(c)
+	if err := g.generate(); err != nil {
+		return nil, err
+	}
+
+	text := g.sb.String()
+	code, err := asm.Assemble(text)
+	if err != nil {
+		return nil, fmt.Errorf("assemble %s: %w", c.Name, err)
+	}
+	// 生成的代码应当总能通过部署前的静态校验
+	if err := core.ValidateCode(code, core.VMConfig{}); err != nil {
+		return nil, fmt.Errorf("compile %s: %w", c.Name, err)
+	}
+
+	return &Output{Name: c.Name, Code: code, ABI: g.abi, Asm: text}, nil
+}
@@ -0,0 +1,355 @@
+package compiler
+
+import (
+	"math/big"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/felixkuang/titanchain/core"
+	"github.com/felixkuang/titanchain/types"
+)
+
+// tokenSource 是测试使用的代币合约
+const tokenSource = `
+// 简单的代币合约
+contract Token {
+    storage owner: address;
+    storage total: uint;
+    storage balances: mapping(address => uint);
+    storage allowances: mapping(address => mapping(address => uint));
+
+    event Transfer(from: address indexed, to: address indexed, amount: uint);
+    event Approval(owner: address indexed, spender: address indexed, amount: uint);
+
+    pub fn init() {
+        require(owner == address(0));
+        owner = caller();
+    }
+
+    pub fn mint(to: address, amount: uint) {
+        require(caller() == owner);
+        balances[to] = balances[to] + amount;
+        total = total + amount;
+        emit Transfer(address(0), to, amount);
+    }
+
+    pub fn transfer(to: address, amount: uint) -> bool {
+        move(caller(), to, amount);
+        return true;
+    }
+
+    pub fn approve(spender: address, amount: uint) -> bool {
+        allowances[caller()][spender] = amount;
+        emit Approval(caller(), spender, amount);
+        return true;
+    }
+
+    pub fn transferFrom(from: address, to: address, amount: uint) -> bool {
+        let allowed = allowances[from][caller()];
+        require(allowed >= amount);
+        allowances[from][caller()] = allowed - amount;
+        move(from, to, amount);
+        return true;
+    }
+
+    pub fn balanceOf(who: address) -> uint {
+        return balances[who];
+    }
+
+    pub fn totalSupply() -> uint {
+        return total;
+    }
+
+    fn move(from: address, to: address, amount: uint) {
+        let balance: uint = balances[from];
+        if balance < amount {
+            revert();
+        }
+        balances[from] = balance - amount;
+        balances[to] = balances[to] + amount;
+        emit Transfer(from, to, amount);
+    }
+}
+`
+
+// mathSource 覆盖局部变量、循环、递归与短路求值
+const mathSource = `
+contract Math {
+    storage calls: uint;
+
+    pub fn fact(n: uint) -> uint {
+        if n <= 1 {
+            return 1;
+        }
+        return n * fact(n - 1);
+    }
+
+    // 1 到 n 中跳过 3 的倍数、遇到 limit 停止时的和
+    pub fn sum(n: uint, limit: uint) -> uint {
+        let total = 0;
+        let i = 0;
+        while i < n {
+            i = i + 1;
+            if i % 3 == 0 {
+                continue;
+            }
+            if i > limit {
+                break;
+            }
+            let next = total + i;
+            total = next;
+        }
+        return total;
+    }
+
+    pub fn between(x: uint, lo: uint, hi: uint) -> bool {
+        return x >= lo && x <= hi;
+    }
+
+    // 右操作数只在需要时求值，求值会增加 calls
+    pub fn lazy(a: bool, b: bool) -> bool {
+        let r = a || touch(b);
+        return r;
+    }
+
+    pub fn callCount() -> uint {
+        return calls;
+    }
+
+    pub fn pick(flag: bool, x: uint) -> uint {
+        if flag {
+            let y = x * 2;
+            return y;
+        } else if x == 0 {
+            return 7;
+        } else {
+            {
+                let z = x + 1;
+                x = z;
+            }
+        }
+        return x ** 2 - 1;
+    }
+
+    pub fn convert(x: uint) -> address {
+        let ok: bool = bool(x);
+        require(ok);
+        return address(x);
+    }
+
+    fn touch(b: bool) -> bool {
+        calls = calls + 1;
+        return b;
+    }
+}
+`
+
+// contract 辅助类型：在同一个状态上执行编译后的合约
+type contract struct {
+	t     *testing.T
+	out   *Output
+	state *core.State
+	addr  types.Address
+}
+
+func newContract(t *testing.T, src string) *contract {
+	out, err := Compile(src)
+	if !assert.Nil(t, err) {
+		t.FailNow()
+	}
+
+	return &contract{t: t, out: out, state: core.NewState(), addr: types.Address{0xcc}}
+}
+
+// call 以 caller 的身份调用函数 name，返回执行结果与虚拟机
+func (c *contract) call(caller types.Address, name string, args ...any) ([]any, *core.VM, error) {
+	input, err := c.out.ABI.Pack(name, args...)
+	assert.Nil(c.t, err)
+
+	ctx := core.ExecContext{Address: c.addr, Caller: caller, Input: input}
+	vm := core.NewContractVM(ctx, c.out.Code, c.state, core.DefaultChainConfig().VM)
+	if err := vm.Run(); err != nil {
+		return nil, vm, err
+	}
+
+	values, err := c.out.ABI.Unpack(name, vm.ReturnData())
+	assert.Nil(c.t, err)
+
+	return values, vm, nil
+}
+
+// value 调用函数并返回唯一的返回值
+func (c *contract) value(name string, args ...any) any {
+	values, _, err := c.call(types.Address{}, name, args...)
+	assert.Nil(c.t, err, name)
+	if !assert.Len(c.t, values, 1) {
+		return nil
+	}
+
+	return values[0]
+}
+
+// uint 调用返回 uint 的函数
+func (c *contract) uint(name string, args ...any) uint64 {
+	x, ok := c.value(name, args...).(*big.Int)
+	if !assert.True(c.t, ok, name) {
+		return 0
+	}
+
+	return x.Uint64()
+}
+
+func TestCompileMath(t *testing.T) {
+	c := newContract(t, mathSource)
+
+	assert.Equal(t, uint64(1), c.uint("fact", 0))
+	assert.Equal(t, uint64(120), c.uint("fact", 5))
+
+	// 1 + 2 + 4 + 5 + 7 + 8 + 10
+	assert.Equal(t, uint64(37), c.uint("sum", 10, 100))
+	// 遇到 7 停止：1 + 2 + 4 + 5
+	assert.Equal(t, uint64(12), c.uint("sum", 10, 6))
+	assert.Equal(t, uint64(0), c.uint("sum", 0, 100))
+
+	assert.Equal(t, true, c.value("between", 5, 1, 5))
+	assert.Equal(t, false, c.value("between", 6, 1, 5))
+	assert.Equal(t, false, c.value("between", 0, 1, 5))
+
+	assert.Equal(t, true, c.value("lazy", true, false))
+	assert.Equal(t, uint64(0), c.uint("callCount"))
+	assert.Equal(t, false, c.value("lazy", false, false))
+	assert.Equal(t, uint64(1), c.uint("callCount"))
+
+	assert.Equal(t, uint64(6), c.uint("pick", true, 3))
+	assert.Equal(t, uint64(7), c.uint("pick", false, 0))
+	assert.Equal(t, uint64(15), c.uint("pick", false, 3))
+
+	assert.Equal(t, types.Address{19: 0x2a}, c.value("convert", 0x2a))
+	_, _, err := c.call(types.Address{}, "convert", 0)
+	assert.ErrorIs(t, err, core.ErrExecutionReverted)
+}
+
+func TestCompileToken(t *testing.T) {
+	c := newContract(t, tokenSource)
+	owner, alice, bob := types.Address{0x01}, types.Address{0x02}, types.Address{0x03}
+
+	_, _, err := c.call(owner, "init")
+	assert.Nil(t, err)
+	_, _, err = c.call(alice, "init")
+	assert.ErrorIs(t, err, core.ErrExecutionReverted)
+
+	_, _, err = c.call(alice, "mint", alice, 100)
+	assert.ErrorIs(t, err, core.ErrExecutionReverted)
+	_, vm, err := c.call(owner, "mint", alice, 100)
+	assert.Nil(t, err)
+	assert.Len(t, vm.Logs(), 1)
+	event, values, err := c.out.ABI.UnpackLog(vm.Logs()[0])
+	assert.Nil(t, err)
+	assert.Equal(t, "Transfer", event.Name)
+	assert.Equal(t, map[string]any{"from": types.Address{}, "to": alice, "amount": big.NewInt(100)}, values)
+
+	out, vm, err := c.call(alice, "transfer", bob, 30)
+	assert.Nil(t, err)
+	assert.Equal(t, []any{true}, out)
+	_, values, err = c.out.ABI.UnpackLog(vm.Logs()[0])
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]any{"from": alice, "to": bob, "amount": big.NewInt(30)}, values)
+
+	_, _, err = c.call(bob, "transfer", alice, 31)
+	assert.ErrorIs(t, err, core.ErrExecutionReverted)
+
+	// bob 授权 owner 转出 20
+	_, _, err = c.call(bob, "approve", owner, 20)
+	assert.Nil(t, err)
+	_, _, err = c.call(owner, "transferFrom", bob, alice, 21)
+	assert.ErrorIs(t, err, core.ErrExecutionReverted)
+	_, _, err = c.call(owner, "transferFrom", bob, alice, 20)
+	assert.Nil(t, err)
+	_, _, err = c.call(owner, "transferFrom", bob, alice, 1)
+	assert.ErrorIs(t, err, core.ErrExecutionReverted)
+
+	assert.Equal(t, uint64(90), c.uint("balanceOf", alice))
+	assert.Equal(t, uint64(10), c.uint("balanceOf", bob))
+	assert.Equal(t, uint64(0), c.uint("balanceOf", owner))
+	assert.Equal(t, uint64(100), c.uint("totalSupply"))
+}
+
+func TestCompileDispatch(t *testing.T) {
+	c := newContract(t, tokenSource)
+	config := core.DefaultChainConfig().VM
+	run := func(input []byte) error {
+		return core.NewContractVM(core.ExecContext{Address: c.addr, Input: input}, c.out.Code, c.state, config).Run()
+	}
+
+	selector := c.out.ABI.Methods["balanceOf"].ID()
+	word := make([]byte, 32)
+
+	// 未知选择器、缺少参数与高位不为 0 的地址参数都会回滚
+	assert.ErrorIs(t, run([]byte{0xde, 0xad, 0xbe, 0xef}), core.ErrExecutionReverted)
+	assert.ErrorIs(t, run(nil), core.ErrExecutionReverted)
+	assert.ErrorIs(t, run(append(selector, word[:31]...)), core.ErrExecutionReverted)
+	word[0] = 1
+	assert.ErrorIs(t, run(append(selector, word...)), core.ErrExecutionReverted)
+
+	// ABI 只包含公开函数
+	assert.Len(t, c.out.ABI.Methods, 7)
+	_, ok := c.out.ABI.Methods["move"]
+	assert.False(t, ok)
+	assert.Equal(t, "transferFrom(address,address,uint256)", c.out.ABI.Methods["transferFrom"].Sig())
+	assert.Len(t, c.out.ABI.Events, 2)
+}
+
+func TestCompileErrors(t *testing.T) {
+	wrap := func(body string) string {
+		return "contract C {\n storage s: uint;\n storage m: mapping(uint => bool);\n event E(a: uint indexed, b: bool);\n" +
+			" fn f(x: uint) -> uint { return x; }\n" + body + "\n}"
+	}
+
+	cases := map[string]struct {
+		src string
+		err string
+	}{
+		"lex":                {"contract C { $ }", "line 1: unexpected character"},
+		"number overflow":    {"contract C { fn f() { let x = 0x1" + strings.Repeat("0", 64) + "; } }", "overflows uint"},
+		"missing brace":      {"contract C { fn f() {", "unexpected end of file"},
+		"mapping local":      {wrap("fn g() { let x: mapping(uint => uint) = 1; }"), "line 6: mapping is only allowed as storage type"},
+		"redeclared storage": {wrap("storage s: bool;"), "line 6: s redeclared"},
+		"builtin name":       {wrap("fn caller() {}"), "caller is a builtin function"},
+		"duplicate param":    {wrap("fn g(a: uint, a: uint) {}"), "duplicate parameter a"},
+		"too many indexed":   {wrap("event F(a: uint indexed, b: uint indexed, c: uint indexed, d: uint indexed);"), "too many indexed"},
+		"undefined":          {wrap("fn g() { let a = b; }"), "line 6: undefined b"},
+		"undefined func":     {wrap("fn g() { h(); }"), "undefined function h"},
+		"type mismatch":      {wrap("fn g() { let a: bool = 1; }"), "cannot use uint as bool"},
+		"assign mismatch":    {wrap("fn g() { s = true; }"), "cannot assign bool to storage of type uint"},
+		"operand types":      {wrap("fn g() -> uint { return 1 + true; }"), "requires uint operands"},
+		"compare types":      {wrap("fn g() -> bool { return caller() == 1; }"), "mismatched types"},
+		"condition":          {wrap("fn g() { if 1 { } }"), "non-bool uint used as condition"},
+		"mapping value":      {wrap("fn g() { let a = m; }"), "mapping cannot be used as a value"},
+		"mapping key":        {wrap("fn g() -> bool { return m[true]; }"), "cannot use bool as mapping key"},
+		"index scalar":       {wrap("fn g() -> uint { return s[1]; }"), "cannot index uint"},
+		"assign mapping":     {wrap("fn g() { m = 1; }"), "cannot assign to mapping"},
+		"void value":         {wrap("fn h() {} fn g() { let a = h(); }"), "expression has no value"},
+		"argument count":     {wrap("fn g() { f(); }"), "f expects 1 arguments, got 0"},
+		"missing return":     {wrap("fn g(a: bool) -> uint { if a { return 1; } }"), "missing return at end of g"},
+		"return value":       {wrap("fn g() { return 1; }"), "g does not return a value"},
+		"break":              {wrap("fn g() { break; }"), "break outside loop"},
+		"unused":             {wrap("fn g() { 1 + 2; }"), "expression is not used"},
+		"shadow":             {wrap("fn g(s: uint) {}"), "s shadows storage variable"},
+		"redeclared local":   {wrap("fn g(a: uint) { let a = 1; }"), "a redeclared"},
+		"emit count":         {wrap("fn g() { emit E(1); }"), "event E expects 2 arguments"},
+		"emit type":          {wrap("fn g() { emit E(1, 2); }"), "cannot use uint as bool in argument 2 of E"},
+		"conversion":         {wrap("fn g() -> bool { return bool(caller()); }"), "cannot convert address to bool"},
+		"require":            {wrap("fn g() { require(); }"), "require expects 1 arguments"},
+	}
+
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			_, err := Compile(c.src)
+			if assert.NotNil(t, err) {
+				assert.Contains(t, err.Error(), c.err)
+			}
+		})
+	}
+}
@@ -0,0 +1,165 @@
+package compiler
+
+import (
+	"encoding/hex"
+	"math/big"
+	"testing"
+
+	"github.com/go-kit/log"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/felixkuang/titanchain/core"
+	"github.com/felixkuang/titanchain/crypto"
+	"github.com/felixkuang/titanchain/types"
+)
+
+// chain 辅助类型：内存中的区块链与交易发起者
+type chain struct {
+	t     *testing.T
+	bc    *core.Blockchain
+	keys  map[types.Address]crypto.PrivateKey
+	nonce map[types.Address]uint64
+}
+
+func newChain(t *testing.T, keys ...crypto.PrivateKey) *chain {
+	g := core.DefaultGenesis()
+	c := &chain{t: t, keys: make(map[types.Address]crypto.PrivateKey), nonce: make(map[types.Address]uint64)}
+	for _, k := range keys {
+		addr := k.PublicKey().Address()
+		g.Alloc[addr] = core.GenesisAccount{Balance: 1000}
+		c.keys[addr] = k
+	}
+
+	bc, err := core.NewBlockchainFromGenesis(log.NewNopLogger(), g)
+	assert.Nil(t, err)
+	c.bc = bc
+
+	return c
+}
+
+// send 签名交易并打包为一个新区块，返回交易的收据
+func (c *chain) send(from types.Address, tx *core.Transaction) *core.Receipt {
+	tx.ChainID = core.DefaultChainID
+	tx.Nonce = c.nonce[from]
+	assert.Nil(c.t, tx.Sign(c.keys[from]))
+	c.nonce[from]++
+
+	prev, err := c.bc.GetHeader(c.bc.Height())
+	assert.Nil(c.t, err)
+	b, err := core.NewBlockFromPrevHeader(crypto.HashSHA256, prev, []*core.Transaction{tx})
+	assert.Nil(c.t, err)
+	receipts, err := c.bc.ExecuteBlock(b)
+	assert.Nil(c.t, err)
+	b.ReceiptsRoot = core.ReceiptsRoot(crypto.HashSHA256, receipts)
+	assert.Nil(c.t, b.Sign(crypto.GeneratePrivateKey()))
+	assert.Nil(c.t, c.bc.AddBlock(b))
+
+	receipt, err := c.bc.GetReceipt(tx.Hash(core.TxHasher{}))
+	assert.Nil(c.t, err)
+
+	return receipt
+}
+
+// deploy 部署编译后的合约，返回合约地址
+func (c *chain) deploy(from types.Address, out *Output) types.Address {
+	nonce := c.nonce[from]
+	receipt := c.send(from, &core.Transaction{Type: core.TxTypeDeploy, Data: out.Code})
+	assert.Equal(c.t, core.ReceiptStatusSuccessful, receipt.Status)
+
+	return core.ContractAddress(crypto.HashSHA256, from, nonce)
+}
+
+// call 发送调用合约函数的交易，返回收据与通过重放交易得到的返回值
+func (c *chain) call(from, to types.Address, out *Output, name string, args ...any) (*core.Receipt, []any) {
+	input, err := out.ABI.Pack(name, args...)
+	assert.Nil(c.t, err)
+
+	receipt := c.send(from, &core.Transaction{Type: core.TxTypeCall, To: to, Data: input})
+	if receipt.Status != core.ReceiptStatusSuccessful {
+		return receipt, nil
+	}
+
+	tracer := core.NewStructLogger()
+	_, err = c.bc.TraceTransaction(receipt.TxHash, tracer)
+	assert.Nil(c.t, err)
+	ret, err := hex.DecodeString(tracer.Result().ReturnValue)
+	assert.Nil(c.t, err)
+	values, err := out.ABI.Unpack(name, ret)
+	assert.Nil(c.t, err)
+
+	return receipt, values
+}
+
+// TestTokenOnChain 将代币合约部署到内存中的链上，通过交易调用并检查收据、事件与返回值
+func TestTokenOnChain(t *testing.T) {
+	ownerKey, aliceKey := crypto.GeneratePrivateKey(), crypto.GeneratePrivateKey()
+	owner, alice := ownerKey.PublicKey().Address(), aliceKey.PublicKey().Address()
+	bob := types.Address{0xb0}
+	c := newChain(t, ownerKey, aliceKey)
+
+	out, err := Compile(tokenSource)
+	assert.Nil(t, err)
+	token := c.deploy(owner, out)
+
+	receipt, _ := c.call(owner, token, out, "init")
+	assert.Equal(t, core.ReceiptStatusSuccessful, receipt.Status)
+
+	receipt, _ = c.call(owner, token, out, "mint", alice, big.NewInt(1000))
+	assert.Equal(t, core.ReceiptStatusSuccessful, receipt.Status)
+	assert.Len(t, receipt.Logs, 1)
+
+	receipt, values := c.call(alice, token, out, "transfer", bob, 250)
+	assert.Equal(t, core.ReceiptStatusSuccessful, receipt.Status)
+	assert.Equal(t, []any{true}, values)
+	event, args, err := out.ABI.UnpackLog(receipt.Logs[0])
+	assert.Nil(t, err)
+	assert.Equal(t, "Transfer", event.Name)
+	assert.Equal(t, map[string]any{"from": alice, "to": bob, "amount": big.NewInt(250)}, args)
+
+	// 余额不足的转账回滚，交易仍然上链但收据为失败且没有事件
+	receipt, _ = c.call(alice, token, out, "transfer", bob, 751)
+	assert.Equal(t, core.ReceiptStatusFailed, receipt.Status)
+	assert.Empty(t, receipt.Logs)
+
+	// 非所有者不能增发
+	receipt, _ = c.call(alice, token, out, "mint", alice, 1)
+	assert.Equal(t, core.ReceiptStatusFailed, receipt.Status)
+
+	_, values = c.call(alice, token, out, "balanceOf", alice)
+	assert.Equal(t, "750", values[0].(*big.Int).String())
+	_, values = c.call(owner, token, out, "balanceOf", bob)
+	assert.Equal(t, "250", values[0].(*big.Int).String())
+	_, values = c.call(owner, token, out, "totalSupply")
+	assert.Equal(t, "1000", values[0].(*big.Int).String())
+
+	// 按事件 ID 与接收者过滤链上的 Transfer 事件
+	transfer := out.ABI.Events["Transfer"].ID()
+	bobTopic := types.HashFromBytes(append(make([]byte, 12), bob.ToSlice()...))
+	logs, err := c.bc.FilterLogs(&core.LogFilter{
+		ToHeight:  c.bc.Height(),
+		Addresses: []types.Address{token},
+		Topics:    [][]types.Hash{{transfer}, nil, {bobTopic}},
+	})
+	assert.Nil(t, err)
+	assert.Len(t, logs, 1)
+}
+
+// TestMathOnChain 在链上执行含循环与递归的合约，并检查 gas 消耗随循环次数增长
+func TestMathOnChain(t *testing.T) {
+	key := crypto.GeneratePrivateKey()
+	from := key.PublicKey().Address()
+	c := newChain(t, key)
+
+	out, err := Compile(mathSource)
+	assert.Nil(t, err)
+	math := c.deploy(from, out)
+
+	short, values := c.call(from, math, out, "sum", 3, 100)
+	assert.Equal(t, "3", values[0].(*big.Int).String())
+	long, values := c.call(from, math, out, "sum", 30, 100)
+	assert.Equal(t, "300", values[0].(*big.Int).String())
+	assert.Greater(t, long.GasUsed, short.GasUsed)
+
+	_, values = c.call(from, math, out, "fact", 20)
+	assert.Equal(t, "2432902008176640000", values[0].(*big.Int).String())
+}
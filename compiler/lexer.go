@@ -0,0 +1,131 @@
+package compiler
+
+import (
+	"fmt"
+	"math/big"
+	"unicode"
+)
+
+// tokenKind 表示词法单元的种类
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokIdent
+	tokNumber
+	tokKeyword
+	tokPunct
+)
+
+// keywords 记录语言的保留字
+var keywords = map[string]bool{
+	"contract": true, "storage": true, "event": true, "indexed": true, "mapping": true,
+	"pub": true, "fn": true, "let": true, "if": true, "else": true, "while": true,
+	"break": true, "continue": true, "return": true, "emit": true,
+	"true": true, "false": true, "uint": true, "bool": true, "address": true,
+}
+
+// puncts 记录运算符与分隔符，较长的在前以便优先匹配
+var puncts = []string{
+	"=>", "->", "==", "!=", "<=", ">=", "&&", "||", "**",
+	"(", ")", "{", "}", "[", "]", ",", ";", ":", "=", "<", ">", "+", "-", "*", "/", "%", "!",
+}
+
+// token 表示一个词法单元
+type token struct {
+	kind  tokenKind
+	text  string
+	value *big.Int // 整数字面量的值
+	line  int
+}
+
+func (t token) String() string {
+	if t.kind == tokEOF {
+		return "end of file"
+	}
+
+	return fmt.Sprintf("%q", t.text)
+}
+
+// tokenize 将源代码切分为词法单元，以 tokEOF 结尾
+// 标识符由 ASCII 字母、数字与下划线组成，支持 // 行注释，整数字面量为十进制或 0x 开头的十六进制，且不超过 256 位
+func tokenize(src string) ([]token, error) {
+	var (
+		toks []token
+		line = 1
+		rs   = []rune(src)
+	)
+
+	for i := 0; i < len(rs); {
+		c := rs[i]
+
+		switch {
+		case c == '\n':
+			line++
+			i++
+
+		case unicode.IsSpace(c):
+			i++
+
+		case c == '/' && i+1 < len(rs) && rs[i+1] == '/':
+			for i < len(rs) && rs[i] != '\n' {
+				i++
+			}
+
+		case isLetter(c):
+			start := i
+			for i < len(rs) && (isLetter(rs[i]) || isDigit(rs[i])) {
+				i++
+			}
+			text := string(rs[start:i])
+			kind := tokIdent
+			if keywords[text] {
+				kind = tokKeyword
+			}
+			toks = append(toks, token{kind: kind, text: text, line: line})
+
+		case isDigit(c):
+			start := i
+			for i < len(rs) && (isLetter(rs[i]) || isDigit(rs[i])) {
+				i++
+			}
+			text := string(rs[start:i])
+			digits, base := text, 10
+			if len(text) > 2 && (text[:2] == "0x" || text[:2] == "0X") {
+				digits, base = text[2:], 16
+			}
+			value, ok := new(big.Int).SetString(digits, base)
+			if !ok || value.Sign() < 0 {
+				return nil, fmt.Errorf("line %d: invalid number %s", line, text)
+			}
+			if value.BitLen() > 256 {
+				return nil, fmt.Errorf("line %d: number %s overflows uint", line, text)
+			}
+			toks = append(toks, token{kind: tokNumber, text: text, value: value, line: line})
+
+		default:
+			matched := ""
+			for _, p := range puncts {
+				if i+len(p) <= len(rs) && string(rs[i:i+len(p)]) == p {
+					matched = p
+					break
+				}
+			}
+			if matched == "" {
+				return nil, fmt.Errorf("line %d: unexpected character %q", line, c)
+			}
+			toks = append(toks, token{kind: tokPunct, text: matched, line: line})
+			i += len(matched)
+		}
+	}
+
+	return append(toks, token{kind: tokEOF, line: line}), nil
+}
+
+func isLetter(c rune) bool {
+	return c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
+
+func isDigit(c rune) bool {
+	return c >= '0' && c <= '9'
+}
@@ -0,0 +1,539 @@
+package compiler
+
+import (
+	"fmt"
+)
+
+// binaryPrec 记录二元运算符的优先级，数值越大结合越紧
+var binaryPrec = map[string]int{
+	"||": 1,
+	"&&": 2,
+	"==": 3, "!=": 3,
+	"<": 4, ">": 4, "<=": 4, ">=": 4,
+	"+": 5, "-": 5,
+	"*": 6, "/": 6, "%": 6,
+	"**": 7,
+}
+
+// parser 是递归下降语法分析器
+type parser struct {
+	toks []token
+	pos  int
+}
+
+// Parse 解析源代码，返回合约的语法树
+func Parse(src string) (*Contract, error) {
+	toks, err := tokenize(src)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &parser{toks: toks}
+	c, err := p.contract()
+	if err != nil {
+		return nil, err
+	}
+	if p.peek().kind != tokEOF {
+		return nil, p.errorf("unexpected %s after contract", p.peek())
+	}
+
+	return c, nil
+}
+
+func (p *parser) peek() token {
+	return p.toks[p.pos]
+}
+
+func (p *parser) next() token {
+	t := p.toks[p.pos]
+	if t.kind != tokEOF {
+		p.pos++
+	}
+
+	return t
+}
+
+// is 判断下一个词法单元是否为指定的保留字或符号
+func (p *parser) is(text string) bool {
+	t := p.peek()
+	return (t.kind == tokKeyword || t.kind == tokPunct) && t.text == text
+}
+
+// accept 在下一个词法单元为 text 时消耗它并返回 true
+func (p *parser) accept(text string) bool {
+	if p.is(text) {
+		p.pos++
+		return true
+	}
+
+	return false
+}
+
+func (p *parser) expect(text string) error {
+	if !p.accept(text) {
+		return p.errorf("expected %q, found %s", text, p.peek())
+	}
+
+	return nil
+}
+
+func (p *parser) ident() (string, error) {
+	t := p.peek()
+	if t.kind != tokIdent {
+		return "", p.errorf("expected identifier, found %s", t)
+	}
+	p.pos++
+
+	return t.text, nil
+}
+
+func (p *parser) errorf(format string, args ...any) error {
+	return fmt.Errorf("line %d: %s", p.peek().line, fmt.Sprintf(format, args...))
+}
+
+// contract = "contract" IDENT "{" { storage | event | func } "}"
+func (p *parser) contract() (*Contract, error) {
+	if err := p.expect("contract"); err != nil {
+		return nil, err
+	}
+	name, err := p.ident()
+	if err != nil {
+		return nil, err
+	}
+	if err := p.expect("{"); err != nil {
+		return nil, err
+	}
+
+	c := &Contract{Name: name}
+	for !p.accept("}") {
+		line := p.peek().line
+
+		switch {
+		case p.accept("storage"):
+			name, err := p.ident()
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expect(":"); err != nil {
+				return nil, err
+			}
+			typ, err := p.typ(true)
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expect(";"); err != nil {
+				return nil, err
+			}
+			c.Storage = append(c.Storage, &StorageVar{Name: name, Type: typ, Line: line})
+
+		case p.accept("event"):
+			e, err := p.event(line)
+			if err != nil {
+				return nil, err
+			}
+			c.Events = append(c.Events, e)
+
+		case p.is("pub") || p.is("fn"):
+			f, err := p.function(line)
+			if err != nil {
+				return nil, err
+			}
+			c.Funcs = append(c.Funcs, f)
+
+		default:
+			return nil, p.errorf("expected storage, event or fn, found %s", p.peek())
+		}
+	}
+
+	return c, nil
+}
+
+// typ = "uint" | "bool" | "address" | "mapping" "(" typ "=>" typ ")"
+// 只有存储变量可以是映射类型，映射的键不能是映射
+func (p *parser) typ(allowMapping bool) (*Type, error) {
+	switch {
+	case p.accept("uint"):
+		return uintType, nil
+	case p.accept("bool"):
+		return boolType, nil
+	case p.accept("address"):
+		return addressType, nil
+	case p.is("mapping"):
+		if !allowMapping {
+			return nil, p.errorf("mapping is only allowed as storage type")
+		}
+		p.next()
+		if err := p.expect("("); err != nil {
+			return nil, err
+		}
+		key, err := p.typ(false)
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect("=>"); err != nil {
+			return nil, err
+		}
+		value, err := p.typ(true)
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect(")"); err != nil {
+			return nil, err
+		}
+		return &Type{Kind: TypeMapping, Key: key, Value: value}, nil
+	default:
+		return nil, p.errorf("expected type, found %s", p.peek())
+	}
+}
+
+// event = "event" IDENT "(" [ IDENT ":" typ ["indexed"] { "," ... } ] ")" ";"
+func (p *parser) event(line int) (*EventDecl, error) {
+	name, err := p.ident()
+	if err != nil {
+		return nil, err
+	}
+
+	params, err := p.params(true)
+	if err != nil {
+		return nil, err
+	}
+	if err := p.expect(";"); err != nil {
+		return nil, err
+	}
+
+	return &EventDecl{Name: name, Params: params, Line: line}, nil
+}
+
+// function = ["pub"] "fn" IDENT "(" [ IDENT ":" typ { "," ... } ] ")" [ "->" typ ] block
+func (p *parser) function(line int) (*FuncDecl, error) {
+	f := &FuncDecl{Pub: p.accept("pub"), Result: voidType, Line: line}
+	if err := p.expect("fn"); err != nil {
+		return nil, err
+	}
+
+	name, err := p.ident()
+	if err != nil {
+		return nil, err
+	}
+	f.Name = name
+
+	if f.Params, err = p.params(false); err != nil {
+		return nil, err
+	}
+	if p.accept("->") {
+		if f.Result, err = p.typ(false); err != nil {
+			return nil, err
+		}
+	}
+	if f.Body, err = p.block(); err != nil {
+		return nil, err
+	}
+
+	return f, nil
+}
+
+// params 解析括号括起的参数列表，事件参数可以带 indexed
+func (p *parser) params(event bool) ([]*Param, error) {
+	if err := p.expect("("); err != nil {
+		return nil, err
+	}
+
+	var params []*Param
+	for !p.accept(")") {
+		if len(params) > 0 {
+			if err := p.expect(","); err != nil {
+				return nil, err
+			}
+		}
+
+		name, err := p.ident()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect(":"); err != nil {
+			return nil, err
+		}
+		typ, err := p.typ(false)
+		if err != nil {
+			return nil, err
+		}
+		param := &Param{Name: name, Type: typ}
+		if event {
+			param.Indexed = p.accept("indexed")
+		}
+		params = append(params, param)
+	}
+
+	return params, nil
+}
+
+// block = "{" { stmt } "}"
+func (p *parser) block() (*Block, error) {
+	if err := p.expect("{"); err != nil {
+		return nil, err
+	}
+
+	b := &Block{}
+	for !p.accept("}") {
+		if p.peek().kind == tokEOF {
+			return nil, p.errorf("unexpected end of file, expected \"}\"")
+		}
+		s, err := p.stmt()
+		if err != nil {
+			return nil, err
+		}
+		b.Stmts = append(b.Stmts, s)
+	}
+
+	return b, nil
+}
+
+func (p *parser) stmt() (Stmt, error) {
+	line := p.peek().line
+
+	switch {
+	case p.accept("let"):
+		name, err := p.ident()
+		if err != nil {
+			return nil, err
+		}
+		s := &LetStmt{Name: name, Line: line}
+		if p.accept(":") {
+			if s.Type, err = p.typ(false); err != nil {
+				return nil, err
+			}
+		}
+		if err := p.expect("="); err != nil {
+			return nil, err
+		}
+		if s.Value, err = p.expr(); err != nil {
+			return nil, err
+		}
+		return s, p.expect(";")
+
+	case p.accept("if"):
+		return p.ifStmt(line)
+
+	case p.accept("while"):
+		cond, err := p.expr()
+		if err != nil {
+			return nil, err
+		}
+		body, err := p.block()
+		if err != nil {
+			return nil, err
+		}
+		return &WhileStmt{Cond: cond, Body: body, Line: line}, nil
+
+	case p.is("break") || p.is("continue"):
+		s := &BranchStmt{Keyword: p.next().text, Line: line}
+		return s, p.expect(";")
+
+	case p.accept("return"):
+		s := &ReturnStmt{Line: line}
+		if !p.is(";") {
+			var err error
+			if s.Value, err = p.expr(); err != nil {
+				return nil, err
+			}
+		}
+		return s, p.expect(";")
+
+	case p.accept("emit"):
+		name, err := p.ident()
+		if err != nil {
+			return nil, err
+		}
+		args, err := p.args()
+		if err != nil {
+			return nil, err
+		}
+		return &EmitStmt{Event: name, Args: args, Line: line}, p.expect(";")
+
+	case p.is("{"):
+		b, err := p.block()
+		if err != nil {
+			return nil, err
+		}
+		return &BlockStmt{Block: b, Line: line}, nil
+	}
+
+	x, err := p.expr()
+	if err != nil {
+		return nil, err
+	}
+	if p.accept("=") {
+		value, err := p.expr()
+		if err != nil {
+			return nil, err
+		}
+		return &AssignStmt{Target: x, Value: value, Line: line}, p.expect(";")
+	}
+
+	return &ExprStmt{X: x, Line: line}, p.expect(";")
+}
+
+// ifStmt = "if" expr block [ "else" ( ifStmt | block ) ]
+func (p *parser) ifStmt(line int) (*IfStmt, error) {
+	cond, err := p.expr()
+	if err != nil {
+		return nil, err
+	}
+	then, err := p.block()
+	if err != nil {
+		return nil, err
+	}
+
+	s := &IfStmt{Cond: cond, Then: then, Line: line}
+	if !p.accept("else") {
+		return s, nil
+	}
+
+	elseLine := p.peek().line
+	if p.accept("if") {
+		s.Else, err = p.ifStmt(elseLine)
+	} else {
+		var b *Block
+		b, err = p.block()
+		s.Else = &BlockStmt{Block: b, Line: elseLine}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// expr 按优先级解析二元运算，** 为右结合，其余为左结合
+func (p *parser) expr() (Expr, error) {
+	return p.binary(1)
+}
+
+func (p *parser) binary(minPrec int) (Expr, error) {
+	x, err := p.unary()
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		t := p.peek()
+		prec, ok := binaryPrec[t.text]
+		if t.kind != tokPunct || !ok || prec < minPrec {
+			return x, nil
+		}
+		p.next()
+
+		next := prec + 1
+		if t.text == "**" {
+			next = prec
+		}
+		y, err := p.binary(next)
+		if err != nil {
+			return nil, err
+		}
+		x = &BinaryExpr{Op: t.text, X: x, Y: y, Line: t.line}
+	}
+}
+
+func (p *parser) unary() (Expr, error) {
+	line := p.peek().line
+	if p.accept("!") {
+		x, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		return &UnaryExpr{Op: "!", X: x, Line: line}, nil
+	}
+
+	return p.postfix()
+}
+
+// postfix 解析基本表达式及其后的映射下标
+func (p *parser) postfix() (Expr, error) {
+	x, err := p.primary()
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		line := p.peek().line
+		if !p.accept("[") {
+			return x, nil
+		}
+		key, err := p.expr()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect("]"); err != nil {
+			return nil, err
+		}
+		x = &IndexExpr{X: x, Key: key, Line: line}
+	}
+}
+
+func (p *parser) primary() (Expr, error) {
+	t := p.peek()
+
+	switch {
+	case t.kind == tokNumber:
+		p.next()
+		return &NumberLit{Value: t.value, Line: t.line}, nil
+
+	case p.is("true") || p.is("false"):
+		p.next()
+		return &BoolLit{Value: t.text == "true", Line: t.line}, nil
+
+	case p.accept("("):
+		x, err := p.expr()
+		if err != nil {
+			return nil, err
+		}
+		return x, p.expect(")")
+
+	// 类型名后接括号为类型转换
+	case p.is("uint") || p.is("bool") || p.is("address"):
+		p.next()
+		args, err := p.args()
+		if err != nil {
+			return nil, err
+		}
+		return &CallExpr{Func: t.text, Args: args, Line: t.line}, nil
+
+	case t.kind == tokIdent:
+		p.next()
+		if !p.is("(") {
+			return &Ident{Name: t.text, Line: t.line}, nil
+		}
+		args, err := p.args()
+		if err != nil {
+			return nil, err
+		}
+		return &CallExpr{Func: t.text, Args: args, Line: t.line}, nil
+
+	default:
+		return nil, p.errorf("unexpected %s", t)
+	}
+}
+
+// args = "(" [ expr { "," expr } ] ")"
+func (p *parser) args() ([]Expr, error) {
+	if err := p.expect("("); err != nil {
+		return nil, err
+	}
+
+	var args []Expr
+	for !p.accept(")") {
+		if len(args) > 0 {
+			if err := p.expect(","); err != nil {
+				return nil, err
+			}
+		}
+		x, err := p.expr()
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, x)
+	}
+
+	return args, nil
+}
@@ -0,0 +1,151 @@
+package core
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/gob"
+	"fmt"
+
+	"github.com/felixkuang/titanchain/crypto"
+	"github.com/felixkuang/titanchain/types"
+	"github.com/felixkuang/titanchain/wasm"
+)
+
+var (
+	// accountPrefix 是账户数据在状态存储中的键前缀
+	accountPrefix = []byte("account/")
+	// codePrefix 是合约代码在状态存储中的键前缀
+	codePrefix = []byte("code/")
+	// storagePrefix 是合约存储在状态存储中的键前缀
+	storagePrefix = []byte("storage/")
+)
+
+// Account 表示链上账户的状态
+// 包含账户余额、质押金额、已使用的交易序号，合约账户还记录执行代码的运行时
+type Account struct {
+	Balance uint64 // 账户余额
+	Staked  uint64 // 已质押的金额
+	Nonce   uint64 // 账户下一笔交易应使用的序号
+	VMType  VMType // 合约代码的运行时，普通账户为 VMTypeStack
+}
+
+// VMType 表示执行合约代码的运行时
+type VMType byte
+
+const (
+	// VMTypeStack 表示栈式字节码虚拟机
+	VMTypeStack VMType = iota
+	// VMTypeWASM 表示 WebAssembly 运行时
+	VMTypeWASM
+)
+
+func (t VMType) String() string {
+	switch t {
+	case VMTypeStack:
+		return "stack"
+	case VMTypeWASM:
+		return "wasm"
+	default:
+		return fmt.Sprintf("unknown(%d)", byte(t))
+	}
+}
+
+// CodeVMType 根据代码内容判断部署后使用的运行时
+// 以 WASM 模块文件头开始的代码由 WASM 运行时执行，其余代码由栈式虚拟机执行
+func CodeVMType(code []byte) VMType {
+	if wasm.IsWASM(code) {
+		return VMTypeWASM
+	}
+
+	return VMTypeStack
+}
+
+// accountKey 返回账户在状态存储中的键
+func accountKey(addr types.Address) []byte {
+	return append(append([]byte{}, accountPrefix...), addr.ToSlice()...)
+}
+
+// codeKey 返回合约代码在状态存储中的键
+func codeKey(addr types.Address) []byte {
+	return append(append([]byte{}, codePrefix...), addr.ToSlice()...)
+}
+
+// storageKey 返回合约存储项在状态存储中的键
+// 地址长度固定，因此不同合约的存储空间互不重叠
+func storageKey(addr types.Address, key []byte) []byte {
+	k := make([]byte, 0, len(storagePrefix)+len(addr)+len(key))
+	k = append(k, storagePrefix...)
+	k = append(k, addr[:]...)
+
+	return append(k, key...)
+}
+
+// ContractAddress 根据部署者地址和部署交易的序号推导合约地址
+// 取 algo(部署者地址 || 序号) 的最后20字节，algo 为链配置的哈希算法
+func ContractAddress(algo crypto.HashAlgorithm, sender types.Address, nonce uint64) types.Address {
+	b := make([]byte, 0, 28)
+	b = append(b, sender[:]...)
+	b = binary.BigEndian.AppendUint64(b, nonce)
+	h := algo.Sum(b)
+
+	return types.AddressFromBytes(h[len(h)-20:])
+}
+
+// GetAccount 读取指定地址的账户
+// 若账户不存在，返回零值账户
+func (s *State) GetAccount(addr types.Address) (*Account, error) {
+	acc := new(Account)
+
+	b, err := s.Get(accountKey(addr))
+	if err != nil {
+		return acc, nil
+	}
+
+	if err := gob.NewDecoder(bytes.NewReader(b)).Decode(acc); err != nil {
+		return nil, err
+	}
+
+	return acc, nil
+}
+
+// PutAccount 写入指定地址的账户
+func (s *State) PutAccount(addr types.Address, acc *Account) error {
+	buf := &bytes.Buffer{}
+	if err := gob.NewEncoder(buf).Encode(acc); err != nil {
+		return err
+	}
+
+	return s.Put(accountKey(addr), buf.Bytes())
+}
+
+// GetCode 读取合约地址上的代码
+// 地址上没有合约时返回错误
+func (s *State) GetCode(addr types.Address) ([]byte, error) {
+	code, err := s.Get(codeKey(addr))
+	if err != nil {
+		return nil, fmt.Errorf("no contract at address (%s)", addr)
+	}
+
+	return code, nil
+}
+
+// PutCode 保存合约地址上的代码
+func (s *State) PutCode(addr types.Address, code []byte) error {
+	return s.Put(codeKey(addr), code)
+}
+
+// GetStorage 读取合约存储中的值
+// 键不存在时返回错误
+func (s *State) GetStorage(addr types.Address, key []byte) ([]byte, error) {
+	return s.Get(storageKey(addr, key))
+}
+
+// PutStorage 写入合约存储
+func (s *State) PutStorage(addr types.Address, key, value []byte) error {
+	return s.Put(storageKey(addr, key), value)
+}
+
+// DeleteStorage 删除合约存储中的值
+func (s *State) DeleteStorage(addr types.Address, key []byte) error {
+	return s.Delete(storageKey(addr, key))
+}
@@ -3,7 +3,6 @@ package core
 
 import (
 	"bytes"
-	"crypto/sha256"
 	"encoding/gob"
 	"fmt"
 	"github.com/felixkuang/titanchain/crypto"
@@ -12,10 +11,11 @@ import (
 )
 
 // Header 表示区块链中区块的元数据结构
-// 包含版本号、数据哈希、前区块哈希、高度、时间戳
+// 包含版本号、数据哈希、收据根、前区块哈希、高度、时间戳
 type Header struct {
 	Version       uint32     // 协议版本号
 	DataHash      types.Hash // 区块中所有交易的Merkle根哈希
+	ReceiptsRoot  types.Hash // 区块中所有交易收据的Merkle根哈希
 	PrevBlockHash types.Hash // 前一个区块的哈希值
 	Height        uint32     // 区块在链中的高度
 	Timestamp     int64      // 区块创建时间戳
@@ -36,11 +36,12 @@ func (h *Header) Bytes() []byte {
 // Block 表示区块链中的完整区块
 // 包含区块头、交易列表、验证者公钥、签名、哈希缓存
 type Block struct {
-	*Header                        // 嵌入区块头
-	Transactions []*Transaction    // 区块中包含的交易列表
-	Validator    []byte            // 验证者的公钥
-	Signature    *crypto.Signature // 验证者对区块的签名
-	hash         types.Hash        // 缓存的区块头哈希值，用于提升性能
+	*Header                      // 嵌入区块头
+	Transactions []*Transaction  // 区块中包含的交易列表
+	Validator    []byte          // 验证者的自描述公钥（类型标识 || 公钥）
+	Signature    []byte          // 验证者对区块的自描述签名（类型标识 || 签名）
+	hash         types.Hash      // 缓存的区块头哈希值，用于提升性能
+	hashedBy     Hasher[*Header] // 计算缓存哈希所用的哈希器，哈希器不同时重新计算
 }
 
 // NewBlock 创建一个新的区块实例
@@ -55,11 +56,13 @@ func NewBlock(h *Header, txx []*Transaction) (*Block, error) {
 }
 
 // NewBlockFromPrevHeader 基于前一区块头和交易列表创建新区块
+// algo: 链配置的哈希算法，用于计算交易 Merkle 根与前一区块哈希
 // prevHeader: 前一区块头
 // txx: 新区块的交易列表
 // 返回新建的区块和可能的错误
-func NewBlockFromPrevHeader(prevHeader *Header, txx []*Transaction) (*Block, error) {
-	dataHash, err := CalculateDataHash(txx)
+// ReceiptsRoot 需要在执行交易后由 Blockchain.ExecuteBlock 的结果填写
+func NewBlockFromPrevHeader(algo crypto.HashAlgorithm, prevHeader *Header, txx []*Transaction) (*Block, error) {
+	dataHash, err := CalculateDataHash(algo, txx)
 	if err != nil {
 		return nil, err
 	}
@@ -68,7 +71,7 @@ func NewBlockFromPrevHeader(prevHeader *Header, txx []*Transaction) (*Block, err
 		Version:       1,
 		Height:        prevHeader.Height + 1,
 		DataHash:      dataHash,
-		PrevBlockHash: BlockHasher{}.Hash(prevHeader),
+		PrevBlockHash: BlockHasher{Algorithm: algo}.Hash(prevHeader),
 		Timestamp:     time.Now().UnixNano(),
 	}
 
@@ -91,15 +94,16 @@ func (b *Block) Sign(privKey crypto.PrivateKey) error {
 	}
 
 	b.Validator = privKey.PublicKey().ToSlice()
-	b.Signature = sig
+	b.Signature = sig.ToSlice()
 
 	return nil
 }
 
 // Verify 验证区块的签名是否有效
+// algo: 链配置的哈希算法，用于校验交易 Merkle 根
 // 返回验证过程中可能发生的错误
-func (b *Block) Verify() error {
-	if b.Signature == nil {
+func (b *Block) Verify(algo crypto.HashAlgorithm) error {
+	if len(b.Signature) == 0 {
 		return fmt.Errorf("block has no signature")
 	}
 
@@ -108,7 +112,15 @@ func (b *Block) Verify() error {
 		return err
 	}
 
-	if !b.Signature.Verify(publicKey, b.Header.Bytes()) {
+	sig, err := crypto.ToSignature(b.Signature)
+	if err != nil {
+		return err
+	}
+	if err := sig.Validate(); err != nil {
+		return fmt.Errorf("block signature: %w", err)
+	}
+
+	if !sig.Verify(publicKey, b.Header.Bytes()) {
 		return fmt.Errorf("block has invalid signature")
 	}
 
@@ -118,12 +130,12 @@ func (b *Block) Verify() error {
 		}
 	}
 
-	dataHash, err := CalculateDataHash(b.Transactions)
+	dataHash, err := CalculateDataHash(algo, b.Transactions)
 	if err != nil {
 		return err
 	}
 	if dataHash != b.DataHash {
-		return fmt.Errorf("block (%s) has an invalid data hash", b.Hash(BlockHasher{}))
+		return fmt.Errorf("block (%s) has an invalid data hash", b.Hash(BlockHasher{Algorithm: algo}))
 	}
 
 	return nil
@@ -146,29 +158,28 @@ func (b *Block) Encode(enc Encoder[*Block]) error {
 }
 
 // Hash 计算并返回区块的哈希值
-// hasher: 用于计算哈希的实例
-// 如果哈希值已经计算过，则直接返回缓存的值
+// hasher: 用于计算哈希的实例，需与链配置的哈希算法一致（见 ChainConfig.BlockHasher）
+// 如果已经用同一哈希器计算过，则直接返回缓存的值
 func (b *Block) Hash(hasher Hasher[*Header]) types.Hash {
-	if b.hash.IsZero() {
+	if b.hash.IsZero() || b.hashedBy != hasher {
 		b.hash = hasher.Hash(b.Header)
+		b.hashedBy = hasher
 	}
 
 	return b.hash
 }
 
 // CalculateDataHash 计算交易列表的整体哈希（Merkle根）
+// algo: 链配置的哈希算法
 // txx: 交易列表
-// 返回交易数据的SHA256哈希和可能的错误
-func CalculateDataHash(txx []*Transaction) (hash types.Hash, err error) {
-	buf := &bytes.Buffer{}
-
-	for _, tx := range txx {
-		if err = tx.Encode(NewGobTxEncoder(buf)); err != nil {
-			return
-		}
+// 以交易ID作为叶子构建 Merkle 树，返回树根和可能的错误
+func CalculateDataHash(algo crypto.HashAlgorithm, txx []*Transaction) (hash types.Hash, err error) {
+	leaves := make([]types.Hash, len(txx))
+	for i, tx := range txx {
+		leaves[i] = TxHasher{Algorithm: algo}.Hash(tx)
 	}
 
-	hash = sha256.Sum256(buf.Bytes())
+	hash = MerkleRoot(algo, leaves)
 
 	return
 }
@@ -26,16 +26,16 @@ func TestVerifyBlock(t *testing.T) {
 	b := randomBlock(t, 0, types.Hash{})
 
 	assert.Nil(t, b.Sign(privKey))
-	assert.Nil(t, b.Verify())
+	assert.Nil(t, b.Verify(crypto.HashSHA256))
 
 	otherPrivKey := crypto.GeneratePrivateKey()
 	b.Validator = otherPrivKey.PublicKey().ToSlice()
 	// 验证者公钥被篡改，验证应失败
-	assert.NotNil(t, b.Verify())
+	assert.NotNil(t, b.Verify(crypto.HashSHA256))
 
 	b.Height = 100
 	// 区块高度被篡改，验证应失败
-	assert.NotNil(t, b.Verify())
+	assert.NotNil(t, b.Verify(crypto.HashSHA256))
 }
 
 func TestDecodeEncodeBlock(t *testing.T) {
@@ -61,10 +61,27 @@ func randomBlock(t *testing.T, height uint32, prevBlockHash types.Hash) *Block {
 
 	b, err := NewBlock(header, []*Transaction{tx})
 	assert.Nil(t, err)
-	dataHash, err := CalculateDataHash(b.Transactions)
+	dataHash, err := CalculateDataHash(crypto.HashSHA256, b.Transactions)
 	assert.Nil(t, err)
 	b.Header.DataHash = dataHash
 	assert.Nil(t, b.Sign(privKey))
 
 	return b
 }
+
+// TestVerifyBlockMalleated 测试签名被延展为 high-S 形式的区块验证失败
+func TestVerifyBlockMalleated(t *testing.T) {
+	privKey := crypto.GeneratePrivateKey()
+	b := randomBlock(t, 0, types.Hash{})
+	assert.Nil(t, b.Sign(privKey))
+
+	signature := b.Signature
+	b.Signature = malleateP256(signature)
+	assert.ErrorIs(t, b.Verify(crypto.HashSHA256), crypto.ErrNonCanonicalSignature)
+
+	// 区块中交易的签名被延展
+	b.Signature = signature
+	assert.Nil(t, b.Verify(crypto.HashSHA256))
+	b.Transactions[0].Signature = malleateP256(b.Transactions[0].Signature)
+	assert.ErrorIs(t, b.Verify(crypto.HashSHA256), crypto.ErrNonCanonicalSignature)
+}
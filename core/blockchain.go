@@ -1,12 +1,26 @@
 package core
 
 import (
+	"bytes"
+	"errors"
 	"fmt"
 	"sync"
 
 	"github.com/go-kit/log"
+
+	"github.com/felixkuang/titanchain/types"
+)
+
+const (
+	// stateCheckpointInterval 每隔多少个区块保存一次状态副本
+	stateCheckpointInterval = 64
+	// maxStateCheckpoints 最多保留的状态副本个数，更早高度的状态不再可用
+	maxStateCheckpoints = 32
 )
 
+// ErrStateUnavailable 表示所需的历史状态早于保留的最早状态副本，无法重建
+var ErrStateUnavailable = errors.New("historical state not available")
+
 // Blockchain 表示区块链的核心数据结构
 type Blockchain struct {
 	logger    log.Logger
@@ -16,24 +30,112 @@ type Blockchain struct {
 	validator Validator // 区块验证器
 	// TODO: make this an interface.
 	contractState *State
+	config        *ChainConfig // 链配置
+	validatorSet  [][]byte     // 允许出块的验证者公钥，为空表示不做限制
+	genesis       *Genesis     // 创世配置，重放历史区块时用于重建初始状态
+	// txLookup 交易ID到已上链交易的索引
+	txLookup map[types.Hash]*Transaction
+	// receipts 按区块高度保存的交易收据
+	receipts map[uint32][]*Receipt
+	// receiptLookup 交易ID到收据的索引
+	receiptLookup map[types.Hash]*Receipt
+	// checkpoints 按高度保存的状态副本，重建历史状态时从最近的副本开始重放
+	checkpoints map[uint32]*State
+	// stateLock 保证同一时间只有一个区块在状态上执行，同时保护 checkpoints
+	stateLock sync.Mutex
 }
 
 // NewBlockchain 创建一个新的区块链实例
 // genesis: 创世区块
-// 返回新创建的区块链实例和可能发生的错误
+// 使用默认链配置，返回新创建的区块链实例和可能发生的错误
 func NewBlockchain(l log.Logger, genesis *Block) (*Blockchain, error) {
 	bc := &Blockchain{
 		contractState: NewState(),
 		headers:       []*Header{},
 		store:         NewMemorystore(),
 		logger:        l,
+		config:        DefaultChainConfig(),
+		txLookup:      make(map[types.Hash]*Transaction),
+		receipts:      make(map[uint32][]*Receipt),
+		receiptLookup: make(map[types.Hash]*Receipt),
+		checkpoints:   make(map[uint32]*State),
 	}
 	bc.validator = NewBlockValidator(bc)
+	bc.saveCheckpoint(0)
 	err := bc.addBlockWithoutValidation(genesis)
 
 	return bc, err
 }
 
+// NewBlockchainFromGenesis 根据创世配置创建区块链实例
+// g: 创世配置，会先校验链参数与验证者公钥；未配置验证者集合时（如 DefaultGenesis）接受任何验证者签名的区块
+// 创世区块由配置确定性地构建，账户分配写入初始状态
+func NewBlockchainFromGenesis(l log.Logger, g *Genesis) (*Blockchain, error) {
+	if err := g.validate(); err != nil {
+		return nil, err
+	}
+
+	validators, err := g.ValidatorKeys()
+	if err != nil {
+		return nil, err
+	}
+
+	genesis, err := g.ToBlock()
+	if err != nil {
+		return nil, err
+	}
+
+	bc, err := NewBlockchain(l, genesis)
+	if err != nil {
+		return nil, err
+	}
+
+	config := g.Config
+	bc.config = &config
+	bc.validatorSet = validators
+	bc.genesis = g
+
+	if err := g.Commit(bc.contractState); err != nil {
+		return nil, err
+	}
+	bc.contractState.Commit()
+	bc.saveCheckpoint(0)
+
+	return bc, nil
+}
+
+// Config 返回区块链的链配置
+func (bc *Blockchain) Config() *ChainConfig {
+	return bc.config
+}
+
+// ChainID 返回区块链的链ID
+func (bc *Blockchain) ChainID() uint64 {
+	return bc.config.ChainID
+}
+
+// GenesisHash 返回创世区块的哈希
+func (bc *Blockchain) GenesisHash() types.Hash {
+	genesis, _ := bc.GetHeader(0)
+	return bc.config.BlockHasher().Hash(genesis)
+}
+
+// IsValidator 检查给定公钥是否属于验证者集合
+// 未配置验证者集合时，任何公钥都被接受
+func (bc *Blockchain) IsValidator(pubKey []byte) bool {
+	if len(bc.validatorSet) == 0 {
+		return true
+	}
+
+	for _, v := range bc.validatorSet {
+		if bytes.Equal(v, pubKey) {
+			return true
+		}
+	}
+
+	return false
+}
+
 // SetValidator 设置区块链的验证器
 // v: 要使用的验证器实例
 func (bc *Blockchain) SetValidator(v Validator) {
@@ -42,23 +144,307 @@ func (bc *Blockchain) SetValidator(v Validator) {
 
 // AddBlock 添加新的区块到链中
 // b: 要添加的区块
-// 在添加之前会进行验证，返回可能发生的错误
+// 在添加之前会进行验证，随后按交易类型依次执行区块内的交易，
+// 并检查执行得到的收据根与区块头中的 ReceiptsRoot 一致，返回可能发生的错误
+// 区块的执行是原子的：任何一笔交易不合法都会撤销该区块对状态的全部修改
 func (bc *Blockchain) AddBlock(b *Block) error {
 	if err := bc.validator.ValidateBlock(b); err != nil {
 		return err
 	}
 
-	for _, tx := range b.Transactions {
-		bc.logger.Log("msg", "executing code", "len", len(tx.Data), "hash", tx.Hash(&TxHasher{}))
+	bc.stateLock.Lock()
+	defer bc.stateLock.Unlock()
+
+	snapshot := bc.contractState.Snapshot()
+
+	receipts, err := bc.executeBlock(b)
+	if err != nil {
+		bc.contractState.RevertToSnapshot(snapshot)
+		return err
+	}
+
+	if root := ReceiptsRoot(bc.config.Hash, receipts); root != b.ReceiptsRoot {
+		bc.contractState.RevertToSnapshot(snapshot)
+		return fmt.Errorf("block (%s) has receipts root (%s) => expected (%s)", b.Hash(bc.config.BlockHasher()), b.ReceiptsRoot, root)
+	}
+
+	if err := bc.addBlockWithoutValidation(b); err != nil {
+		bc.contractState.RevertToSnapshot(snapshot)
+		return err
+	}
+	bc.storeReceipts(b.Height, receipts)
+	bc.contractState.Commit()
+	if b.Height%stateCheckpointInterval == 0 {
+		bc.saveCheckpoint(b.Height)
+	}
+
+	return nil
+}
+
+// saveCheckpoint 保存当前状态在 height 处的副本，并删除超出保留个数的最早副本
+// 调用者需持有 stateLock（创建区块链时除外）
+func (bc *Blockchain) saveCheckpoint(height uint32) {
+	bc.checkpoints[height] = bc.contractState.Copy()
+
+	if height >= maxStateCheckpoints*stateCheckpointInterval {
+		delete(bc.checkpoints, height-maxStateCheckpoints*stateCheckpointInterval)
+	}
+}
+
+// ExecuteBlock 在当前状态上试执行区块中的交易并返回收据，不修改状态
+// 出块者在签名前用它计算区块头的 ReceiptsRoot
+func (bc *Blockchain) ExecuteBlock(b *Block) ([]*Receipt, error) {
+	bc.stateLock.Lock()
+	defer bc.stateLock.Unlock()
+
+	snapshot := bc.contractState.Snapshot()
+	defer bc.contractState.RevertToSnapshot(snapshot)
+
+	return bc.executeBlock(b)
+}
+
+// BuildBlock 在当前状态上依次试执行候选交易，构建 prevHeader 之后的下一个区块（未签名）
+// 每笔交易在各自的快照上执行：合约执行失败的交易照常打包（收据状态为失败），
+// 不合法的交易（序号不符、余额不足、调用的地址没有合约代码等）被撤销并跳过，不影响之后的交易。
+// 返回填好 DataHash 与 ReceiptsRoot 的区块，以及被跳过的交易；当前状态不被修改
+func (bc *Blockchain) BuildBlock(prevHeader *Header, txx []*Transaction) (*Block, []*Transaction, error) {
+	b, err := NewBlockFromPrevHeader(bc.config.Hash, prevHeader, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	bc.stateLock.Lock()
+	defer bc.stateLock.Unlock()
+
+	snapshot := bc.contractState.Snapshot()
+	defer bc.contractState.RevertToSnapshot(snapshot)
+
+	receipts := make([]*Receipt, 0, len(txx))
+	rejected := []*Transaction{}
+	logIndex := uint32(0)
+	for _, tx := range txx {
+		txSnapshot := bc.contractState.Snapshot()
+		receipt, err := applyTransaction(bc.contractState, bc.config, b.Header, tx, nil)
+		if err != nil {
+			bc.contractState.RevertToSnapshot(txSnapshot)
+			bc.logger.Log("msg", "skipping invalid transaction", "hash", tx.Hash(bc.config.TxHasher()), "err", err)
+			rejected = append(rejected, tx)
+			continue
+		}
+
+		logIndex = bc.fillReceipt(receipt, tx, b.Height, uint32(len(b.Transactions)), logIndex)
+		b.AddTransaction(tx)
+		receipts = append(receipts, receipt)
+	}
+
+	dataHash, err := CalculateDataHash(bc.config.Hash, b.Transactions)
+	if err != nil {
+		return nil, nil, err
+	}
+	b.DataHash = dataHash
+	b.ReceiptsRoot = ReceiptsRoot(bc.config.Hash, receipts)
+
+	return b, rejected, nil
+}
+
+// CheckTransaction 在当前状态上检查交易发起者的序号与余额
+// 序号小于账户当前序号（已被使用）或余额不足以支付转移金额时返回错误；
+// 序号大于当前序号的交易可能排在同一发起者的其他待打包交易之后，因此被接受
+func (bc *Blockchain) CheckTransaction(tx *Transaction) error {
+	sender, err := tx.Sender(bc.config.Hash)
+	if err != nil {
+		return err
+	}
+
+	bc.stateLock.Lock()
+	defer bc.stateLock.Unlock()
+
+	acc, err := bc.contractState.GetAccount(sender)
+	if err != nil {
+		return err
+	}
+	if tx.Nonce < acc.Nonce {
+		return fmt.Errorf("transaction (%s) has nonce (%d) => account (%s) is at nonce (%d)", tx.Hash(bc.config.TxHasher()), tx.Nonce, sender, acc.Nonce)
+	}
+	if acc.Balance < tx.Value {
+		return fmt.Errorf("insufficient balance of (%s): have (%d) => want (%d)", sender, acc.Balance, tx.Value)
+	}
+
+	return nil
+}
+
+// executeBlock 依次执行区块中的交易，返回填好区块信息的收据
+func (bc *Blockchain) executeBlock(b *Block) ([]*Receipt, error) {
+	receipts := make([]*Receipt, 0, len(b.Transactions))
+	logIndex := uint32(0)
+
+	for i, tx := range b.Transactions {
+		bc.logger.Log("msg", "executing transaction", "type", tx.Type, "len", len(tx.Data), "hash", tx.Hash(bc.config.TxHasher()))
 
-		vm := NewVM(tx.Data, bc.contractState)
-		if err := vm.Run(); err != nil {
-			return err
+		receipt, err := applyTransaction(bc.contractState, bc.config, b.Header, tx, nil)
+		if err != nil {
+			return nil, err
 		}
 
+		logIndex = bc.fillReceipt(receipt, tx, b.Height, uint32(i), logIndex)
+		receipts = append(receipts, receipt)
 	}
 
-	return bc.addBlockWithoutValidation(b)
+	return receipts, nil
+}
+
+// fillReceipt 填写收据的交易ID、区块高度、交易序号以及事件在区块内的位置
+// logIndex 为该交易第一个事件在区块内的序号，返回下一笔交易第一个事件的序号
+func (bc *Blockchain) fillReceipt(receipt *Receipt, tx *Transaction, height, txIndex, logIndex uint32) uint32 {
+	receipt.TxHash = tx.Hash(bc.config.TxHasher())
+	receipt.BlockHeight = height
+	receipt.TxIndex = txIndex
+	for _, l := range receipt.Logs {
+		l.BlockHeight = height
+		l.TxHash = receipt.TxHash
+		l.TxIndex = txIndex
+		l.Index = logIndex
+		logIndex++
+	}
+
+	return logIndex
+}
+
+// TraceTransaction 在交易所在区块的父状态上重新执行一笔已上链的交易，由 tracer 观察合约执行过程
+// 父状态由最近的状态副本开始依次重放之前的区块与同一区块中排在前面的交易得到，不影响当前状态
+// 返回重新执行得到的收据
+func (bc *Blockchain) TraceTransaction(hash types.Hash, tracer Tracer) (*Receipt, error) {
+	receipt, err := bc.GetReceipt(hash)
+	if err != nil {
+		return nil, err
+	}
+
+	b, err := bc.GetBlock(receipt.BlockHeight)
+	if err != nil {
+		return nil, err
+	}
+
+	state, err := bc.stateAt(b.Height - 1)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, tx := range b.Transactions[:receipt.TxIndex] {
+		if _, err := applyTransaction(state, bc.config, b.Header, tx, nil); err != nil {
+			return nil, err
+		}
+	}
+
+	return applyTransaction(state, bc.config, b.Header, b.Transactions[receipt.TxIndex], tracer)
+}
+
+// stateAt 从不高于 height 的最近状态副本开始重放区块，返回执行完指定高度区块之后的状态副本
+// 最多重放 stateCheckpointInterval-1 个区块；所需副本已被删除时返回 ErrStateUnavailable
+func (bc *Blockchain) stateAt(height uint32) (*State, error) {
+	base := height - height%stateCheckpointInterval
+
+	bc.stateLock.Lock()
+	checkpoint, ok := bc.checkpoints[base]
+	bc.stateLock.Unlock()
+	if !ok {
+		return nil, fmt.Errorf("%w: height (%d)", ErrStateUnavailable, height)
+	}
+
+	// 状态副本保存后不再修改，复制时无需持有锁
+	state := checkpoint.Copy()
+	for h := base + 1; h <= height; h++ {
+		b, err := bc.GetBlock(h)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, tx := range b.Transactions {
+			if _, err := applyTransaction(state, bc.config, b.Header, tx, nil); err != nil {
+				return nil, err
+			}
+		}
+		state.Commit()
+	}
+
+	return state, nil
+}
+
+// storeReceipts 保存区块的收据并建立交易ID索引
+func (bc *Blockchain) storeReceipts(height uint32, receipts []*Receipt) {
+	bc.lock.Lock()
+	defer bc.lock.Unlock()
+
+	bc.receipts[height] = receipts
+	for _, r := range receipts {
+		bc.receiptLookup[r.TxHash] = r
+	}
+}
+
+// GetReceipt 根据交易ID查询交易收据
+// 未找到时返回错误
+func (bc *Blockchain) GetReceipt(hash types.Hash) (*Receipt, error) {
+	bc.lock.RLock()
+	defer bc.lock.RUnlock()
+
+	r, ok := bc.receiptLookup[hash]
+	if !ok {
+		return nil, fmt.Errorf("could not find receipt for tx with hash (%s)", hash)
+	}
+
+	return r, nil
+}
+
+// GetBlockReceipts 返回指定高度区块的全部收据
+func (bc *Blockchain) GetBlockReceipts(height uint32) ([]*Receipt, error) {
+	if height > bc.Height() {
+		return nil, fmt.Errorf("given height (%d) too high", height)
+	}
+
+	bc.lock.RLock()
+	defer bc.lock.RUnlock()
+
+	return bc.receipts[height], nil
+}
+
+// FilterLogs 返回区块范围内满足过滤条件的日志，按区块和日志序号排列
+// 请求的范围超过 MaxLogBlockRange 个区块时返回 ErrLogRangeTooLarge，结束高度超过当前高度时截断到当前高度
+func (bc *Blockchain) FilterLogs(f *LogFilter) ([]*Log, error) {
+	if f.ToHeight >= f.FromHeight && f.ToHeight-f.FromHeight >= MaxLogBlockRange {
+		return nil, fmt.Errorf("%w: (%d) => (%d), at most %d blocks", ErrLogRangeTooLarge, f.FromHeight, f.ToHeight, MaxLogBlockRange)
+	}
+
+	to := f.ToHeight
+	if h := bc.Height(); to > h {
+		to = h
+	}
+	if f.FromHeight > to {
+		return nil, fmt.Errorf("invalid block range (%d) => (%d)", f.FromHeight, f.ToHeight)
+	}
+
+	bc.lock.RLock()
+	defer bc.lock.RUnlock()
+
+	logs := []*Log{}
+	for height := f.FromHeight; height <= to; height++ {
+		for _, r := range bc.receipts[height] {
+			for _, l := range r.Logs {
+				if f.Match(l) {
+					logs = append(logs, l)
+				}
+			}
+		}
+	}
+
+	return logs, nil
+}
+
+// GetBlock 根据高度查询区块
+func (bc *Blockchain) GetBlock(height uint32) (*Block, error) {
+	if height > bc.Height() {
+		return nil, fmt.Errorf("given height (%d) too high", height)
+	}
+
+	return bc.store.Get(height)
 }
 
 func (bc *Blockchain) GetHeader(height uint32) (*Header, error) {
@@ -72,6 +458,21 @@ func (bc *Blockchain) GetHeader(height uint32) (*Header, error) {
 	return bc.headers[height], nil
 }
 
+// GetTxByHash 根据交易ID查询已上链的交易
+// hash: 交易ID
+// 返回对应交易，未找到时返回错误
+func (bc *Blockchain) GetTxByHash(hash types.Hash) (*Transaction, error) {
+	bc.lock.RLock()
+	defer bc.lock.RUnlock()
+
+	tx, ok := bc.txLookup[hash]
+	if !ok {
+		return nil, fmt.Errorf("could not find tx with hash (%s)", hash)
+	}
+
+	return tx, nil
+}
+
 // HasBlock 检查指定高度的区块是否存在
 // height: 要检查的区块高度
 // 返回是否存在该高度的区块
@@ -94,11 +495,14 @@ func (bc *Blockchain) Height() uint32 {
 func (bc *Blockchain) addBlockWithoutValidation(b *Block) error {
 	bc.lock.Lock()
 	bc.headers = append(bc.headers, b.Header)
+	for _, tx := range b.Transactions {
+		bc.txLookup[tx.Hash(bc.config.TxHasher())] = tx
+	}
 	defer bc.lock.Unlock()
 
 	bc.logger.Log(
 		"msg", "new block",
-		"hash", b.Hash(BlockHasher{}),
+		"hash", b.Hash(bc.config.BlockHasher()),
 		"height", b.Height,
 		"transactions", len(b.Transactions),
 	)
@@ -5,6 +5,7 @@ import (
 
 	"github.com/go-kit/log"
 
+	"github.com/felixkuang/titanchain/crypto"
 	"github.com/felixkuang/titanchain/types"
 	"github.com/stretchr/testify/assert"
 )
@@ -15,7 +16,7 @@ func TestAddBlock(t *testing.T) {
 
 	lenBlocks := 1000
 	for i := 0; i < lenBlocks; i++ {
-		block := randomBlock(t, uint32(i+1), getPrevBlockHash(t, bc, uint32(i+1)))
+		block := sealBlock(t, bc, randomBlock(t, uint32(i+1), getPrevBlockHash(t, bc, uint32(i+1))), crypto.GeneratePrivateKey())
 		assert.Nil(t, bc.AddBlock(block))
 	}
 
@@ -46,7 +47,7 @@ func TestGetHeader(t *testing.T) {
 	lenBlocks := 1000
 
 	for i := 0; i < lenBlocks; i++ {
-		block := randomBlock(t, uint32(i+1), getPrevBlockHash(t, bc, uint32(i+1)))
+		block := sealBlock(t, bc, randomBlock(t, uint32(i+1), getPrevBlockHash(t, bc, uint32(i+1))), crypto.GeneratePrivateKey())
 		assert.Nil(t, bc.AddBlock(block))
 		header, err := bc.GetHeader(block.Height)
 		assert.Nil(t, err)
@@ -58,11 +59,44 @@ func TestGetHeader(t *testing.T) {
 func TestAddBlockToHigh(t *testing.T) {
 	bc := newBlockchainWithGenesis(t)
 
-	assert.Nil(t, bc.AddBlock(randomBlock(t, 1, getPrevBlockHash(t, bc, uint32(1)))))
+	assert.Nil(t, bc.AddBlock(sealBlock(t, bc, randomBlock(t, 1, getPrevBlockHash(t, bc, uint32(1))), crypto.GeneratePrivateKey())))
 	// 跳跃高度添加区块应返回错误
 	assert.NotNil(t, bc.AddBlock(randomBlock(t, 3, types.Hash{})))
 }
 
+// TestGetTxByHash 测试通过交易ID查询已上链交易
+func TestGetTxByHash(t *testing.T) {
+	bc := newBlockchainWithGenesis(t)
+	b := sealBlock(t, bc, randomBlock(t, 1, getPrevBlockHash(t, bc, 1)), crypto.GeneratePrivateKey())
+	assert.Nil(t, bc.AddBlock(b))
+
+	tx := b.Transactions[0]
+	got, err := bc.GetTxByHash(tx.Hash(TxHasher{}))
+	assert.Nil(t, err)
+	assert.Equal(t, tx, got)
+
+	_, err = bc.GetTxByHash(types.Hash{})
+	assert.NotNil(t, err)
+}
+
+// TestAddBlockWrongChainID 测试包含其他链交易的区块被拒绝
+func TestAddBlockWrongChainID(t *testing.T) {
+	bc := newBlockchainWithGenesis(t)
+	privKey := crypto.GeneratePrivateKey()
+
+	b := randomBlock(t, 1, getPrevBlockHash(t, bc, 1))
+	tx := b.Transactions[0]
+	tx.ChainID = DefaultChainID + 1
+	assert.Nil(t, tx.Sign(privKey))
+
+	dataHash, err := CalculateDataHash(crypto.HashSHA256, b.Transactions)
+	assert.Nil(t, err)
+	b.DataHash = dataHash
+	assert.Nil(t, b.Sign(privKey))
+
+	assert.NotNil(t, bc.AddBlock(b))
+}
+
 // newBlockchainWithGenesis 辅助函数：创建带创世区块的区块链
 func newBlockchainWithGenesis(t *testing.T) *Blockchain {
 	bc, err := NewBlockchain(log.NewNopLogger(), randomBlock(t, 0, types.Hash{}))
@@ -71,9 +105,19 @@ func newBlockchainWithGenesis(t *testing.T) *Blockchain {
 	return bc
 }
 
+// sealBlock 辅助函数：执行区块得到收据根，写入区块头后签名
+func sealBlock(t *testing.T, bc *Blockchain, b *Block, privKey crypto.PrivateKey) *Block {
+	receipts, err := bc.ExecuteBlock(b)
+	assert.Nil(t, err)
+	b.ReceiptsRoot = ReceiptsRoot(bc.config.Hash, receipts)
+	assert.Nil(t, b.Sign(privKey))
+
+	return b
+}
+
 // getPrevBlockHash 辅助函数：获取前一区块的哈希
 func getPrevBlockHash(t *testing.T, bc *Blockchain, height uint32) types.Hash {
 	prevHeader, err := bc.GetHeader(height - 1)
 	assert.Nil(t, err)
-	return BlockHasher{}.Hash(prevHeader)
+	return bc.config.BlockHasher().Hash(prevHeader)
 }
@@ -0,0 +1,198 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/felixkuang/titanchain/types"
+)
+
+// CallMsg 表示一次不上链的合约执行请求，不需要签名与交易序号
+// To 为空时按部署交易执行 Data，否则按调用交易以 Data 为调用数据执行 To 处的合约
+type CallMsg struct {
+	From  types.Address // 调用者地址
+	To    types.Address // 合约地址，为空表示部署
+	Value uint64        // 随调用转入的金额
+	Data  []byte        // 调用数据或部署的合约代码
+	Gas   uint64        // gas 上限，为 0 时使用链配置的 VMConfig.GasLimit，不能超过该值
+}
+
+// CallResult 是 CallMsg 的执行结果
+type CallResult struct {
+	ReturnData      []byte        // 合约执行给出的返回数据
+	GasUsed         uint64        // 合约执行消耗的 gas
+	Logs            []*Log        // 合约执行发出的事件，执行失败时为空
+	ContractAddress types.Address // 部署时创建的合约地址
+	Err             error         // 合约执行失败的原因，如 ErrExecutionReverted 或 ErrOutOfGas
+}
+
+// Failed 判断合约执行是否失败
+func (r *CallResult) Failed() bool {
+	return r.Err != nil
+}
+
+// Call 在指定高度区块执行之后的状态上执行 msg，执行结果不会写入链上状态
+// 合约看到的区块信息为该高度的区块头；合约执行失败时错误记录在 CallResult.Err 中，
+// 消息不合法（如余额不足、合约不存在、gas 上限过大）时返回错误。
+// 当前高度直接在链上状态上执行后回滚，历史高度在从最近状态副本重放得到的状态上执行
+func (bc *Blockchain) Call(msg *CallMsg, atHeight uint32) (*CallResult, error) {
+	height := bc.Height()
+	if atHeight > height {
+		return nil, fmt.Errorf("given height (%d) too high", atHeight)
+	}
+
+	if atHeight < height {
+		header, err := bc.GetHeader(atHeight)
+		if err != nil {
+			return nil, err
+		}
+		state, err := bc.stateAt(atHeight)
+		if err != nil {
+			return nil, err
+		}
+		return applyMessage(state, bc.config, header, msg)
+	}
+
+	var res *CallResult
+	err := bc.withHeadState(func(state *State, header *Header) error {
+		var err error
+		res, err = applyMessage(state, bc.config, header, msg)
+		return err
+	})
+
+	return res, err
+}
+
+// EstimateGas 在当前状态上估算执行 msg 所需的最小 gas 上限
+// 先以 msg.Gas（为 0 时为链配置的上限）执行一次，成功后在实际消耗与上限之间二分查找使执行成功的最小值；
+// 嵌套调用只转发 63/64 的剩余 gas，所需的上限可能高于实际消耗。以上限执行仍失败时返回执行失败的原因
+func (bc *Blockchain) EstimateGas(msg *CallMsg) (uint64, error) {
+	var gas uint64
+	err := bc.withHeadState(func(state *State, header *Header) error {
+		run := func(limit uint64) (*CallResult, error) {
+			snap := state.Snapshot()
+			defer state.RevertToSnapshot(snap)
+
+			m := *msg
+			m.Gas = limit
+			return applyMessage(state, bc.config, header, &m)
+		}
+
+		hi := msg.Gas
+		if hi == 0 {
+			hi = bc.config.VM.GasLimit
+		}
+
+		res, err := run(hi)
+		if err != nil {
+			return err
+		}
+		if res.Failed() {
+			return fmt.Errorf("execution failed with gas limit (%d): %w", hi, res.Err)
+		}
+
+		// 不执行合约代码的消息不消耗 gas；否则上限低于实际消耗时必然 gas 耗尽
+		if res.GasUsed == 0 {
+			return nil
+		}
+		lo := res.GasUsed - 1
+		for lo+1 < hi {
+			mid := lo + (hi-lo)/2
+			res, err := run(mid)
+			if err != nil {
+				return err
+			}
+			if res.Failed() {
+				lo = mid
+			} else {
+				hi = mid
+			}
+		}
+		gas = hi
+
+		return nil
+	})
+
+	return gas, err
+}
+
+// withHeadState 持有 stateLock，以当前链上状态与最新区块头调用 fn，返回前撤销 fn 对状态的全部修改
+func (bc *Blockchain) withHeadState(fn func(state *State, header *Header) error) error {
+	bc.stateLock.Lock()
+	defer bc.stateLock.Unlock()
+
+	header, err := bc.GetHeader(bc.Height())
+	if err != nil {
+		return err
+	}
+
+	snap := bc.contractState.Snapshot()
+	defer bc.contractState.RevertToSnapshot(snap)
+
+	return fn(bc.contractState, header)
+}
+
+// applyMessage 在给定状态上执行 msg，不检查与递增交易序号
+// 部署地址由调用者当前的交易序号推导，与发送同样内容的交易时一致
+func applyMessage(state *State, config *ChainConfig, header *Header, msg *CallMsg) (*CallResult, error) {
+	if msg.Gas > config.VM.GasLimit {
+		return nil, fmt.Errorf("gas (%d) exceeds limit (%d)", msg.Gas, config.VM.GasLimit)
+	}
+
+	acc, err := state.GetAccount(msg.From)
+	if err != nil {
+		return nil, err
+	}
+
+	tx := &Transaction{
+		Type:    TxTypeCall,
+		Nonce:   acc.Nonce,
+		To:      msg.To,
+		Value:   msg.Value,
+		Data:    msg.Data,
+		ChainID: config.ChainID,
+	}
+	if msg.To == (types.Address{}) {
+		tx.Type = TxTypeDeploy
+	}
+
+	h, err := getTxHandler(tx.Type)
+	if err != nil {
+		return nil, err
+	}
+	if err := h.Validate(tx, config); err != nil {
+		return nil, err
+	}
+
+	cfg := *config
+	if msg.Gas > 0 {
+		cfg.VM.GasLimit = msg.Gas
+	}
+
+	ctx := &TxContext{
+		State:  state,
+		Config: &cfg,
+		Header: header,
+		Sender: msg.From,
+	}
+	err = h.Execute(ctx, tx)
+
+	res := &CallResult{
+		ReturnData:      ctx.ReturnData,
+		GasUsed:         ctx.GasUsed,
+		Logs:            ctx.Logs,
+		ContractAddress: ctx.ContractAddress,
+	}
+
+	var execErr *ExecutionError
+	if errors.As(err, &execErr) {
+		res.Err = execErr.Err
+		res.Logs = nil
+		return res, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
@@ -0,0 +1,208 @@
+package core
+
+import (
+	"bytes"
+	"math/big"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/felixkuang/titanchain/crypto"
+	"github.com/felixkuang/titanchain/types"
+)
+
+// readCounterCode 返回以调用数据为存储键、返回其中计数的字节码
+func readCounterCode() []byte {
+	return []byte{byte(InstrCallData), byte(InstrLoad), byte(InstrReturn)}
+}
+
+// proxyCode 返回以全部可用 gas 调用 target 的字节码，嵌套调用失败时回滚
+func proxyCode(target types.Address) []byte {
+	code := append(target.ToSlice(), 20, byte(InstrPushN))
+	code = append(code, 0, byte(InstrPushInt), 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 8, byte(InstrPushN))
+	code = append(code, byte(InstrCallData), byte(InstrCall))
+
+	return append(code, byte(len(code)+5), byte(InstrPushInt), byte(InstrSwap), byte(InstrJumpI), byte(InstrRevert), byte(InstrJumpDest))
+}
+
+// deployContracts 辅助函数：在同一区块中部署给定的合约，返回合约地址
+func deployContracts(t *testing.T, bc *Blockchain, privKey crypto.PrivateKey, codes ...[]byte) []types.Address {
+	sender := privKey.PublicKey().Address()
+	acc, err := bc.contractState.GetAccount(sender)
+	assert.Nil(t, err)
+
+	txx := make([]*Transaction, len(codes))
+	addrs := make([]types.Address, len(codes))
+	for i, code := range codes {
+		nonce := acc.Nonce + uint64(i)
+		txx[i] = signedTx(t, privKey, &Transaction{Type: TxTypeDeploy, Nonce: nonce, Data: code})
+		addrs[i] = ContractAddress(crypto.HashSHA256, sender, nonce)
+	}
+	assert.Nil(t, addBlockWithTxs(t, bc, txx...))
+
+	return addrs
+}
+
+func TestCall(t *testing.T) {
+	privKey := crypto.GeneratePrivateKey()
+	sender := privKey.PublicKey().Address()
+	bc := newBlockchainWithAlloc(t, sender, 100)
+
+	addrs := deployContracts(t, bc, privKey, counterCode(), readCounterCode(), []byte{byte(InstrRevert)})
+	counter, reader, reverter := addrs[0], addrs[1], addrs[2]
+	assert.Nil(t, addBlockWithTxs(t, bc, signedTx(t, privKey, &Transaction{Type: TxTypeCall, Nonce: 3, To: counter, Data: []byte("c")})))
+
+	// 读取计数：合约的存储空间与调用者无关，读取的是 reader 自己的存储
+	res, err := bc.Call(&CallMsg{From: sender, To: reader, Data: []byte("c")}, bc.Height())
+	assert.Nil(t, err)
+	assert.False(t, res.Failed())
+	assert.Equal(t, serializeWord(big.NewInt(0)), res.ReturnData)
+
+	// 在当前状态上执行计数合约，修改不会写入链上状态
+	res, err = bc.Call(&CallMsg{From: sender, To: counter, Data: []byte("c")}, bc.Height())
+	assert.Nil(t, err)
+	assert.False(t, res.Failed())
+	assert.Greater(t, res.GasUsed, uint64(0))
+	b, err := bc.contractState.GetStorage(counter, []byte("c"))
+	assert.Nil(t, err)
+	v, err := decodeStorageValue(b)
+	assert.Nil(t, err)
+	assertWord(t, big.NewInt(1), v.(*big.Int))
+
+	// 调用者不需要余额，也不要求交易序号
+	res, err = bc.Call(&CallMsg{From: types.Address{0x01}, To: counter, Data: []byte("c")}, 1)
+	assert.Nil(t, err)
+	assert.False(t, res.Failed())
+
+	// 模拟部署返回将要创建的合约地址
+	res, err = bc.Call(&CallMsg{From: sender, Data: counterCode()}, bc.Height())
+	assert.Nil(t, err)
+	assert.Equal(t, ContractAddress(crypto.HashSHA256, sender, 4), res.ContractAddress)
+
+	// 合约回滚与 gas 耗尽记录在结果中
+	res, err = bc.Call(&CallMsg{From: sender, To: reverter}, bc.Height())
+	assert.Nil(t, err)
+	assert.ErrorIs(t, res.Err, ErrExecutionReverted)
+	res, err = bc.Call(&CallMsg{From: sender, To: counter, Data: []byte("c"), Gas: 3}, bc.Height())
+	assert.Nil(t, err)
+	assert.ErrorIs(t, res.Err, ErrOutOfGas)
+
+	// 不合法的消息
+	_, err = bc.Call(&CallMsg{From: sender, To: counter}, bc.Height()+1)
+	assert.NotNil(t, err)
+	_, err = bc.Call(&CallMsg{From: sender, To: types.Address{0x02}}, bc.Height())
+	assert.NotNil(t, err)
+	_, err = bc.Call(&CallMsg{From: sender, To: counter, Value: 101}, bc.Height())
+	assert.NotNil(t, err)
+	_, err = bc.Call(&CallMsg{From: sender, To: counter, Gas: bc.Config().VM.GasLimit + 1}, bc.Height())
+	assert.NotNil(t, err)
+	_, err = bc.Call(&CallMsg{From: sender, Data: []byte{byte(InstrJump)}}, bc.Height())
+	assert.NotNil(t, err)
+}
+
+func TestCallAtHeight(t *testing.T) {
+	privKey := crypto.GeneratePrivateKey()
+	sender := privKey.PublicKey().Address()
+	bc := newBlockchainWithAlloc(t, sender, 100)
+
+	// 合约以调用数据为键，计数加 1 后返回
+	code := append(counterCode(), readCounterCode()...)
+	addr := deployContracts(t, bc, privKey, code)[0]
+	for nonce := uint64(1); nonce <= 2; nonce++ {
+		assert.Nil(t, addBlockWithTxs(t, bc, signedTx(t, privKey, &Transaction{Type: TxTypeCall, Nonce: nonce, To: addr, Data: []byte("c")})))
+	}
+
+	for height, want := range map[uint32]int64{1: 1, 2: 2, 3: 3} {
+		res, err := bc.Call(&CallMsg{From: sender, To: addr, Data: []byte("c")}, height)
+		assert.Nil(t, err)
+		assert.Equal(t, serializeWord(big.NewInt(want)), res.ReturnData)
+	}
+
+	// 部署之前合约不存在
+	_, err := bc.Call(&CallMsg{From: sender, To: addr, Data: []byte("c")}, 0)
+	assert.NotNil(t, err)
+}
+
+func TestEstimateGas(t *testing.T) {
+	privKey := crypto.GeneratePrivateKey()
+	sender := privKey.PublicKey().Address()
+	bc := newBlockchainWithAlloc(t, sender, 100)
+
+	// 被调用合约消耗的 gas 足够多，使转发时保留的 1/64 超过调用之后的指令消耗
+	counter := deployContracts(t, bc, privKey, counterCode(), bytes.Repeat(counterCode(), 10))
+	proxy := deployContracts(t, bc, privKey, proxyCode(counter[1]), []byte{byte(InstrRevert)})
+	proxyAddr, reverter := proxy[0], proxy[1]
+
+	assertMinimal := func(msg *CallMsg) uint64 {
+		gas, err := bc.EstimateGas(msg)
+		assert.Nil(t, err)
+
+		m := *msg
+		m.Gas = gas
+		res, err := bc.Call(&m, bc.Height())
+		assert.Nil(t, err)
+		assert.False(t, res.Failed())
+
+		m.Gas = gas - 1
+		res, err = bc.Call(&m, bc.Height())
+		assert.Nil(t, err)
+		assert.True(t, res.Failed())
+
+		return gas
+	}
+
+	// 直接调用时所需的 gas 就是实际消耗的 gas
+	gas := assertMinimal(&CallMsg{From: sender, To: counter[0], Data: []byte("c")})
+	res, err := bc.Call(&CallMsg{From: sender, To: counter[0], Data: []byte("c")}, bc.Height())
+	assert.Nil(t, err)
+	assert.Equal(t, res.GasUsed, gas)
+
+	// 嵌套调用只转发 63/64 的 gas，所需的 gas 上限高于实际消耗
+	gas = assertMinimal(&CallMsg{From: sender, To: proxyAddr, Data: []byte("c")})
+	res, err = bc.Call(&CallMsg{From: sender, To: proxyAddr, Data: []byte("c")}, bc.Height())
+	assert.Nil(t, err)
+	assert.Greater(t, gas, res.GasUsed)
+
+	// 试探执行的写入全部回滚，链上状态不受影响
+	_, err = bc.contractState.GetStorage(counter[1], []byte("c"))
+	assert.NotNil(t, err)
+
+	// 不执行合约代码的部署不消耗 gas
+	gas, err = bc.EstimateGas(&CallMsg{From: sender, Data: counterCode()})
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(0), gas)
+
+	// 以上限执行仍失败
+	_, err = bc.EstimateGas(&CallMsg{From: sender, To: reverter})
+	assert.ErrorIs(t, err, ErrExecutionReverted)
+	_, err = bc.EstimateGas(&CallMsg{From: sender, To: counter[0], Data: []byte("c"), Gas: 3})
+	assert.ErrorIs(t, err, ErrOutOfGas)
+}
+
+func TestCallAtCheckpoint(t *testing.T) {
+	privKey := crypto.GeneratePrivateKey()
+	sender := privKey.PublicKey().Address()
+	bc := newBlockchainWithAlloc(t, sender, 100)
+
+	code := append(counterCode(), readCounterCode()...)
+	addr := deployContracts(t, bc, privKey, code)[0]
+	for h := bc.Height() + 1; h <= stateCheckpointInterval+2; h++ {
+		assert.Nil(t, addBlockWithTxs(t, bc, signedTx(t, privKey, &Transaction{Type: TxTypeCall, Nonce: uint64(h - 1), To: addr, Data: []byte("c")})))
+	}
+	assert.Contains(t, bc.checkpoints, uint32(stateCheckpointInterval))
+
+	// 副本之前与之后的高度都从最近的副本重放得到
+	for _, height := range []uint32{stateCheckpointInterval - 1, stateCheckpointInterval, stateCheckpointInterval + 2} {
+		res, err := bc.Call(&CallMsg{From: sender, To: addr, Data: []byte("c")}, height)
+		assert.Nil(t, err)
+		assert.Equal(t, serializeWord(big.NewInt(int64(height))), res.ReturnData)
+	}
+
+	// 所需副本被删除后历史状态不可用
+	bc.saveCheckpoint(maxStateCheckpoints * stateCheckpointInterval)
+	assert.NotContains(t, bc.checkpoints, uint32(0))
+	_, err := bc.Call(&CallMsg{From: sender, To: addr, Data: []byte("c")}, stateCheckpointInterval-1)
+	assert.ErrorIs(t, err, ErrStateUnavailable)
+	_, err = bc.Call(&CallMsg{From: sender, To: addr, Data: []byte("c")}, stateCheckpointInterval+1)
+	assert.Nil(t, err)
+}
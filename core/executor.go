@@ -0,0 +1,341 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/felixkuang/titanchain/types"
+)
+
+// TxContext 表示交易执行时的上下文
+// 包含状态存储、链配置、所在区块头与交易发起者，以及处理器填写的执行结果
+type TxContext struct {
+	State  *State        // 交易执行所作用的状态
+	Config *ChainConfig  // 链配置
+	Header *Header       // 交易所在区块的区块头
+	Sender types.Address // 交易发起者地址
+	Tracer Tracer        // 合约执行的追踪钩子，为 nil 时不追踪
+
+	GasUsed         uint64        // 合约执行消耗的 gas
+	ReturnData      []byte        // 合约执行给出的返回数据
+	Logs            []*Log        // 合约执行发出的事件
+	ContractAddress types.Address // 部署交易创建的合约地址
+}
+
+// ExecutionError 表示合约代码执行失败
+// 处理器返回该错误时，交易仍会上链，收据状态为失败，执行产生的状态修改被撤销；
+// 返回其他错误时交易不合法，整个区块被拒绝
+type ExecutionError struct {
+	Err error
+}
+
+func (e *ExecutionError) Error() string {
+	return fmt.Sprintf("execution failed: %s", e.Err)
+}
+
+func (e *ExecutionError) Unwrap() error {
+	return e.Err
+}
+
+// runContract 在给定执行环境中以 vmType 对应的运行时运行合约代码，记录消耗的 gas 与发出的事件
+// 执行出错时返回 *ExecutionError
+func (ctx *TxContext) runContract(execCtx ExecContext, vmType VMType, code []byte) error {
+	vm := newRuntime(vmType, execCtx, code, ctx.State, ctx.Config.vmConfig())
+	vm.SetTracer(ctx.Tracer)
+	err := vm.Run()
+	ctx.GasUsed += vm.GasUsed()
+	ctx.ReturnData = vm.ReturnData()
+	if err != nil {
+		return &ExecutionError{Err: err}
+	}
+	ctx.Logs = append(ctx.Logs, vm.Logs()...)
+
+	return nil
+}
+
+// runPrecompile 以链配置的 gas 上限执行预编译合约，规则与合约之间调用预编译合约时相同
+// 执行出错时消耗全部 gas，返回包装了原因的 ExecutionError
+func (ctx *TxContext) runPrecompile(p PrecompiledContract, input []byte) error {
+	config := ctx.Config.vmConfig()
+	out, gasLeft, err := runPrecompile(p, input, config.GasLimit, config.hash)
+	ctx.GasUsed += config.GasLimit - gasLeft
+	if ctx.Tracer != nil {
+		ctx.Tracer.CaptureEnd(0, out, config.GasLimit-gasLeft, err)
+	}
+	if err != nil {
+		return &ExecutionError{Err: err}
+	}
+	ctx.ReturnData = out
+
+	return nil
+}
+
+// execContext 返回在 addr 处执行合约代码时的虚拟机执行环境
+// 调用者为交易发起者，调用数据为交易的 Data
+func (ctx *TxContext) execContext(addr types.Address, tx *Transaction) ExecContext {
+	return ExecContext{
+		Address:   addr,
+		Caller:    ctx.Sender,
+		Value:     tx.Value,
+		Input:     tx.Data,
+		Height:    ctx.Header.Height,
+		Timestamp: ctx.Header.Timestamp,
+	}
+}
+
+// TxHandler 定义了某一类型交易的校验与执行逻辑
+// 新的交易类型只需实现该接口并注册，不影响已有类型的编码与执行
+type TxHandler interface {
+	// Validate 对交易进行与状态无关的格式校验，config 为交易所在链的链配置
+	Validate(tx *Transaction, config *ChainConfig) error
+	// Execute 在给定上下文中执行交易，修改状态
+	Execute(ctx *TxContext, tx *Transaction) error
+}
+
+// txHandlersLock 保护 txHandlers，注册可能与交易执行并发进行
+var txHandlersLock sync.RWMutex
+
+// txHandlers 记录每种交易类型对应的处理器
+var txHandlers = map[TxType]TxHandler{
+	TxTypeLegacy:     legacyTxHandler{},
+	TxTypeTransfer:   transferTxHandler{},
+	TxTypeDeploy:     deployTxHandler{},
+	TxTypeCall:       callTxHandler{},
+	TxTypeStake:      stakeTxHandler{},
+	TxTypeGovernance: governanceTxHandler{},
+}
+
+// RegisterTxHandler 注册交易类型对应的处理器
+// t: 交易类型
+// h: 处理器实例，会覆盖已注册的同类型处理器
+func RegisterTxHandler(t TxType, h TxHandler) {
+	txHandlersLock.Lock()
+	defer txHandlersLock.Unlock()
+
+	txHandlers[t] = h
+}
+
+// getTxHandler 返回交易类型对应的处理器
+func getTxHandler(t TxType) (TxHandler, error) {
+	txHandlersLock.RLock()
+	h, ok := txHandlers[t]
+	txHandlersLock.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown transaction type (%s)", t)
+	}
+
+	return h, nil
+}
+
+// ValidateTransaction 根据交易类型对交易进行格式校验
+// config: 交易所在链的链配置，如部署交易按其中的虚拟机参数校验合约代码
+// 返回未知类型或格式不合法时的错误
+func ValidateTransaction(tx *Transaction, config *ChainConfig) error {
+	h, err := getTxHandler(tx.Type)
+	if err != nil {
+		return err
+	}
+
+	return h.Validate(tx, config)
+}
+
+// applyTransaction 在给定状态上执行一笔交易并返回收据
+// 1. 检查发起者的交易序号并递增
+// 2. 分发到交易类型对应的处理器执行
+// 3. 合约执行失败时撤销处理器的修改（序号递增保留），收据状态为失败
+// tracer 不为 nil 时用于追踪交易中的合约执行
+func applyTransaction(state *State, config *ChainConfig, header *Header, tx *Transaction, tracer Tracer) (*Receipt, error) {
+	h, err := getTxHandler(tx.Type)
+	if err != nil {
+		return nil, err
+	}
+
+	sender, err := tx.Sender(config.Hash)
+	if err != nil {
+		return nil, err
+	}
+
+	acc, err := state.GetAccount(sender)
+	if err != nil {
+		return nil, err
+	}
+	if acc.Nonce != tx.Nonce {
+		return nil, fmt.Errorf("transaction (%s) has nonce (%d) => expected (%d)", tx.Hash(config.TxHasher()), tx.Nonce, acc.Nonce)
+	}
+	acc.Nonce++
+	if err := state.PutAccount(sender, acc); err != nil {
+		return nil, err
+	}
+
+	ctx := &TxContext{
+		State:  state,
+		Config: config,
+		Header: header,
+		Sender: sender,
+		Tracer: tracer,
+	}
+
+	snapshot := state.Snapshot()
+	err = h.Execute(ctx, tx)
+
+	receipt := &Receipt{
+		Status:          ReceiptStatusSuccessful,
+		GasUsed:         ctx.GasUsed,
+		Logs:            ctx.Logs,
+		ContractAddress: ctx.ContractAddress,
+	}
+
+	var execErr *ExecutionError
+	if errors.As(err, &execErr) {
+		state.RevertToSnapshot(snapshot)
+		receipt.Status = ReceiptStatusFailed
+		receipt.Logs = nil
+		return receipt, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return receipt, nil
+}
+
+// transfer 在两个账户之间转移余额
+// 发起者余额不足时返回错误且不修改状态
+func transfer(state *State, from, to types.Address, amount uint64) error {
+	if amount == 0 {
+		return nil
+	}
+
+	fromAcc, err := state.GetAccount(from)
+	if err != nil {
+		return err
+	}
+	if fromAcc.Balance < amount {
+		return fmt.Errorf("insufficient balance of (%s): have (%d) => want (%d)", from, fromAcc.Balance, amount)
+	}
+	fromAcc.Balance -= amount
+	if err := state.PutAccount(from, fromAcc); err != nil {
+		return err
+	}
+
+	toAcc, err := state.GetAccount(to)
+	if err != nil {
+		return err
+	}
+	toAcc.Balance += amount
+
+	return state.PutAccount(to, toAcc)
+}
+
+// legacyTxHandler 处理原始交易，直接将 Data 作为字节码执行
+// Data 总是在栈式虚拟机中执行，因此与部署的栈式合约一样须通过 ValidateCode 静态校验
+type legacyTxHandler struct{}
+
+func (legacyTxHandler) Validate(tx *Transaction, config *ChainConfig) error {
+	return ValidateCode(tx.Data, config.VM)
+}
+
+func (legacyTxHandler) Execute(ctx *TxContext, tx *Transaction) error {
+	execCtx := ctx.execContext(types.Address{}, tx)
+	execCtx.Input = nil
+
+	return ctx.runContract(execCtx, VMTypeStack, tx.Data)
+}
+
+// transferTxHandler 处理转账交易
+type transferTxHandler struct{}
+
+func (transferTxHandler) Validate(tx *Transaction, config *ChainConfig) error {
+	if tx.To == (types.Address{}) {
+		return fmt.Errorf("transfer transaction has no recipient")
+	}
+	if tx.Value == 0 {
+		return fmt.Errorf("transfer transaction has zero value")
+	}
+
+	return nil
+}
+
+func (transferTxHandler) Execute(ctx *TxContext, tx *Transaction) error {
+	return transfer(ctx.State, ctx.Sender, tx.To, tx.Value)
+}
+
+// deployTxHandler 处理合约部署交易
+// 合约代码须通过 ValidateContract 静态校验，保存在由发起者地址和交易序号推导出的合约地址下，
+// 合约账户的 VMType 由代码内容决定
+type deployTxHandler struct{}
+
+func (deployTxHandler) Validate(tx *Transaction, config *ChainConfig) error {
+	if len(tx.Data) == 0 {
+		return fmt.Errorf("deploy transaction has no code")
+	}
+	if tx.To != (types.Address{}) {
+		return fmt.Errorf("deploy transaction must not have a recipient")
+	}
+
+	return ValidateContract(tx.Data, config.VM)
+}
+
+func (deployTxHandler) Execute(ctx *TxContext, tx *Transaction) error {
+	addr := ContractAddress(ctx.Config.Hash, ctx.Sender, tx.Nonce)
+
+	if _, err := ctx.State.GetCode(addr); err == nil {
+		return fmt.Errorf("contract (%s) already exists", addr)
+	}
+
+	if err := ctx.State.PutCode(addr, tx.Data); err != nil {
+		return err
+	}
+	ctx.ContractAddress = addr
+
+	if vmType := CodeVMType(tx.Data); vmType != VMTypeStack {
+		acc, err := ctx.State.GetAccount(addr)
+		if err != nil {
+			return err
+		}
+		acc.VMType = vmType
+		if err := ctx.State.PutAccount(addr, acc); err != nil {
+			return err
+		}
+	}
+
+	return transfer(ctx.State, ctx.Sender, addr, tx.Value)
+}
+
+// callTxHandler 处理合约调用交易，以 Data 为调用数据执行 To 地址上保存的合约代码
+// 合约代码由合约账户的 VMType 对应的运行时执行；To 为预编译合约的保留地址时直接执行预编译合约
+type callTxHandler struct{}
+
+func (callTxHandler) Validate(tx *Transaction, config *ChainConfig) error {
+	if tx.To == (types.Address{}) {
+		return fmt.Errorf("call transaction has no contract address")
+	}
+
+	return nil
+}
+
+func (callTxHandler) Execute(ctx *TxContext, tx *Transaction) error {
+	if p, ok := lookupPrecompile(tx.To); ok {
+		if err := transfer(ctx.State, ctx.Sender, tx.To, tx.Value); err != nil {
+			return err
+		}
+		return ctx.runPrecompile(p, tx.Data)
+	}
+
+	code, err := ctx.State.GetCode(tx.To)
+	if err != nil {
+		return err
+	}
+
+	acc, err := ctx.State.GetAccount(tx.To)
+	if err != nil {
+		return err
+	}
+
+	if err := transfer(ctx.State, ctx.Sender, tx.To, tx.Value); err != nil {
+		return err
+	}
+
+	return ctx.runContract(ctx.execContext(tx.To, tx), acc.VMType, code)
+}
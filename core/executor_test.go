@@ -0,0 +1,428 @@
+package core
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/go-kit/log"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/felixkuang/titanchain/crypto"
+	"github.com/felixkuang/titanchain/types"
+)
+
+// TestTransferTransaction 测试转账交易的执行与余额不足的情况
+func TestTransferTransaction(t *testing.T) {
+	privKey := crypto.GeneratePrivateKey()
+	sender := privKey.PublicKey().Address()
+	to := types.Address{0x01}
+	bc := newBlockchainWithAlloc(t, sender, 100)
+
+	tx := signedTx(t, privKey, &Transaction{Type: TxTypeTransfer, To: to, Value: 40})
+	assert.Nil(t, addBlockWithTxs(t, bc, tx))
+	assert.Equal(t, uint64(60), getAccount(t, bc, sender).Balance)
+	assert.Equal(t, uint64(40), getAccount(t, bc, to).Balance)
+	assert.Equal(t, uint64(1), getAccount(t, bc, sender).Nonce)
+
+	tx = signedTx(t, privKey, &Transaction{Type: TxTypeTransfer, Nonce: 1, To: to, Value: 1000})
+	assert.NotNil(t, addBlockWithTxs(t, bc, tx))
+}
+
+// TestBlockAtomicity 测试区块中任一交易失败时撤销整个区块的状态修改
+func TestBlockAtomicity(t *testing.T) {
+	privKey := crypto.GeneratePrivateKey()
+	sender := privKey.PublicKey().Address()
+	to := types.Address{0x01}
+	bc := newBlockchainWithAlloc(t, sender, 100)
+
+	ok := signedTx(t, privKey, &Transaction{Type: TxTypeTransfer, To: to, Value: 40})
+	bad := signedTx(t, privKey, &Transaction{Type: TxTypeTransfer, Nonce: 1, To: to, Value: 1000})
+	assert.NotNil(t, addBlockWithTxs(t, bc, ok, bad))
+
+	assert.Equal(t, uint64(100), getAccount(t, bc, sender).Balance)
+	assert.Equal(t, uint64(0), getAccount(t, bc, sender).Nonce)
+	assert.Equal(t, uint64(0), getAccount(t, bc, to).Balance)
+}
+
+// TestBuildBlockSkipsInvalid 测试构建区块时跳过不合法的交易，保留其余交易且不修改当前状态
+func TestBuildBlockSkipsInvalid(t *testing.T) {
+	privKey := crypto.GeneratePrivateKey()
+	sender := privKey.PublicKey().Address()
+	to := types.Address{0x01}
+	bc := newBlockchainWithAlloc(t, sender, 100)
+
+	ok := signedTx(t, privKey, &Transaction{Type: TxTypeTransfer, To: to, Value: 40})
+	overdraft := signedTx(t, privKey, &Transaction{Type: TxTypeTransfer, Nonce: 1, To: to, Value: 1000})
+	wrongNonce := signedTx(t, privKey, &Transaction{Type: TxTypeTransfer, Nonce: 5, To: to, Value: 1})
+	noCode := signedTx(t, privKey, &Transaction{Type: TxTypeCall, Nonce: 1, To: types.Address{0x02}})
+	next := signedTx(t, privKey, &Transaction{Type: TxTypeTransfer, Nonce: 1, To: to, Value: 10})
+
+	prevHeader, err := bc.GetHeader(bc.Height())
+	assert.Nil(t, err)
+	b, rejected, err := bc.BuildBlock(prevHeader, []*Transaction{ok, overdraft, wrongNonce, noCode, next})
+	assert.Nil(t, err)
+	assert.Equal(t, []*Transaction{overdraft, wrongNonce, noCode}, rejected)
+	assert.Equal(t, []*Transaction{ok, next}, b.Transactions)
+
+	// 构建区块不修改当前状态
+	assert.Equal(t, uint64(100), getAccount(t, bc, sender).Balance)
+	assert.Equal(t, uint64(0), getAccount(t, bc, sender).Nonce)
+
+	assert.Nil(t, b.Sign(crypto.GeneratePrivateKey()))
+	assert.Nil(t, bc.AddBlock(b))
+	assert.Equal(t, uint64(50), getAccount(t, bc, sender).Balance)
+	assert.Equal(t, uint64(2), getAccount(t, bc, sender).Nonce)
+}
+
+// TestCheckTransaction 测试在当前状态上检查交易发起者的序号与余额
+func TestCheckTransaction(t *testing.T) {
+	privKey := crypto.GeneratePrivateKey()
+	sender := privKey.PublicKey().Address()
+	to := types.Address{0x01}
+	bc := newBlockchainWithAlloc(t, sender, 100)
+
+	assert.Nil(t, addBlockWithTxs(t, bc, signedTx(t, privKey, &Transaction{Type: TxTypeTransfer, To: to, Value: 40})))
+
+	assert.Nil(t, bc.CheckTransaction(signedTx(t, privKey, &Transaction{Type: TxTypeTransfer, Nonce: 1, To: to, Value: 60})))
+	// 序号大于当前序号的交易可排在其他待打包交易之后
+	assert.Nil(t, bc.CheckTransaction(signedTx(t, privKey, &Transaction{Type: TxTypeTransfer, Nonce: 3, To: to, Value: 1})))
+	// 序号已被使用
+	assert.NotNil(t, bc.CheckTransaction(signedTx(t, privKey, &Transaction{Type: TxTypeTransfer, To: to, Value: 1})))
+	// 余额不足
+	assert.NotNil(t, bc.CheckTransaction(signedTx(t, privKey, &Transaction{Type: TxTypeTransfer, Nonce: 1, To: to, Value: 61})))
+}
+
+// TestReceipts 测试合约调用产生的收据与日志查询
+func TestReceipts(t *testing.T) {
+	privKey := crypto.GeneratePrivateKey()
+	sender := privKey.PublicKey().Address()
+	bc := newBlockchainWithAlloc(t, sender, 100)
+
+	// 以调用数据为事件数据、调用金额为主题发出事件
+	code := []byte{byte(InstrCallData), byte(InstrCallValue), byte(InstrLog1)}
+	deploy := signedTx(t, privKey, &Transaction{Type: TxTypeDeploy, Data: code})
+	assert.Nil(t, addBlockWithTxs(t, bc, deploy))
+	addr := ContractAddress(crypto.HashSHA256, sender, 0)
+
+	r, err := bc.GetReceipt(deploy.Hash(TxHasher{}))
+	assert.Nil(t, err)
+	assert.Equal(t, ReceiptStatusSuccessful, r.Status)
+	assert.Equal(t, addr, r.ContractAddress)
+	assert.Equal(t, uint32(1), r.BlockHeight)
+
+	call := signedTx(t, privKey, &Transaction{Type: TxTypeCall, Nonce: 1, To: addr, Value: 3, Data: []byte("hi")})
+	assert.Nil(t, addBlockWithTxs(t, bc, call))
+
+	r, err = bc.GetReceipt(call.Hash(TxHasher{}))
+	assert.Nil(t, err)
+	assert.Equal(t, ReceiptStatusSuccessful, r.Status)
+	assert.Equal(t, GasCost(InstrCallData)+GasCost(InstrCallValue)+GasCost(InstrLog1), r.GasUsed)
+	assert.Equal(t, 1, len(r.Logs))
+
+	l := r.Logs[0]
+	topic := types.HashFromBytes(serializeWord(big.NewInt(3)))
+	assert.Equal(t, addr, l.Address)
+	assert.Equal(t, []types.Hash{topic}, l.Topics)
+	assert.Equal(t, []byte("hi"), l.Data)
+	assert.Equal(t, call.Hash(TxHasher{}), l.TxHash)
+	assert.Equal(t, uint32(2), l.BlockHeight)
+
+	// 区块头承诺收据根
+	header, err := bc.GetHeader(2)
+	assert.Nil(t, err)
+	receipts, err := bc.GetBlockReceipts(2)
+	assert.Nil(t, err)
+	assert.Equal(t, ReceiptsRoot(bc.config.Hash, receipts), header.ReceiptsRoot)
+
+	// 按地址与主题过滤日志
+	logs, err := bc.FilterLogs(&LogFilter{ToHeight: 10, Addresses: []types.Address{addr}, Topics: [][]types.Hash{{topic}}})
+	assert.Nil(t, err)
+	assert.Equal(t, []*Log{l}, logs)
+
+	logs, err = bc.FilterLogs(&LogFilter{FromHeight: 0, ToHeight: 1})
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(logs))
+
+	logs, err = bc.FilterLogs(&LogFilter{Addresses: []types.Address{{0x01}}, ToHeight: 2})
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(logs))
+
+	// 区块范围最多覆盖 MaxLogBlockRange 个区块
+	logs, err = bc.FilterLogs(&LogFilter{FromHeight: 1, ToHeight: MaxLogBlockRange})
+	assert.Nil(t, err)
+	assert.Equal(t, []*Log{l}, logs)
+
+	_, err = bc.FilterLogs(&LogFilter{ToHeight: MaxLogBlockRange})
+	assert.ErrorIs(t, err, ErrLogRangeTooLarge)
+}
+
+// TestFailedCallReceipt 测试合约执行失败的交易仍然上链，收据状态为失败且修改被撤销
+func TestFailedCallReceipt(t *testing.T) {
+	privKey := crypto.GeneratePrivateKey()
+	sender := privKey.PublicKey().Address()
+	bc := newBlockchainWithAlloc(t, sender, 100)
+
+	code := []byte{byte(InstrCallData), byte(InstrLog0), byte(InstrRevert)}
+	deploy := signedTx(t, privKey, &Transaction{Type: TxTypeDeploy, Data: code})
+	assert.Nil(t, addBlockWithTxs(t, bc, deploy))
+	addr := ContractAddress(crypto.HashSHA256, sender, 0)
+
+	call := signedTx(t, privKey, &Transaction{Type: TxTypeCall, Nonce: 1, To: addr, Value: 5})
+	assert.Nil(t, addBlockWithTxs(t, bc, call))
+
+	r, err := bc.GetReceipt(call.Hash(TxHasher{}))
+	assert.Nil(t, err)
+	assert.Equal(t, ReceiptStatusFailed, r.Status)
+	assert.Equal(t, 0, len(r.Logs))
+	assert.True(t, r.GasUsed > 0)
+
+	// 转账被撤销，序号递增保留
+	assert.Equal(t, uint64(100), getAccount(t, bc, sender).Balance)
+	assert.Equal(t, uint64(2), getAccount(t, bc, sender).Nonce)
+}
+
+// TestReceiptsRootMismatch 测试收据根与执行结果不一致的区块被拒绝
+func TestReceiptsRootMismatch(t *testing.T) {
+	privKey := crypto.GeneratePrivateKey()
+	sender := privKey.PublicKey().Address()
+	bc := newBlockchainWithAlloc(t, sender, 100)
+
+	tx := signedTx(t, privKey, &Transaction{Type: TxTypeTransfer, To: types.Address{0x01}, Value: 1})
+	prevHeader, err := bc.GetHeader(bc.Height())
+	assert.Nil(t, err)
+	b, err := NewBlockFromPrevHeader(crypto.HashSHA256, prevHeader, []*Transaction{tx})
+	assert.Nil(t, err)
+	b.ReceiptsRoot = types.Hash{0x01}
+	assert.Nil(t, b.Sign(crypto.GeneratePrivateKey()))
+
+	assert.NotNil(t, bc.AddBlock(b))
+	assert.Equal(t, uint32(0), bc.Height())
+	assert.Equal(t, uint64(100), getAccount(t, bc, sender).Balance)
+}
+
+// TestTransactionNonce 测试序号不匹配的交易被拒绝
+func TestTransactionNonce(t *testing.T) {
+	privKey := crypto.GeneratePrivateKey()
+	sender := privKey.PublicKey().Address()
+	bc := newBlockchainWithAlloc(t, sender, 100)
+
+	tx := signedTx(t, privKey, &Transaction{Type: TxTypeTransfer, Nonce: 5, To: types.Address{0x01}, Value: 1})
+	assert.NotNil(t, addBlockWithTxs(t, bc, tx))
+}
+
+// TestDeployAndCallTransaction 测试合约部署与调用
+func TestDeployAndCallTransaction(t *testing.T) {
+	privKey := crypto.GeneratePrivateKey()
+	sender := privKey.PublicKey().Address()
+	bc := newBlockchainWithAlloc(t, sender, 100)
+	code := []byte{0x46, 0x0c, 0x4f, 0x0c, 0x4f, 0x0c, 0x03, 0x0a, 0x0d, 0x05, 0x0a, 0x0f}
+
+	deploy := signedTx(t, privKey, &Transaction{Type: TxTypeDeploy, Data: code, Value: 10})
+	assert.Nil(t, addBlockWithTxs(t, bc, deploy))
+
+	addr := ContractAddress(crypto.HashSHA256, sender, 0)
+	stored, err := bc.contractState.GetCode(addr)
+	assert.Nil(t, err)
+	assert.Equal(t, code, stored)
+	assert.Equal(t, uint64(10), getAccount(t, bc, addr).Balance)
+
+	call := signedTx(t, privKey, &Transaction{Type: TxTypeCall, Nonce: 1, To: addr})
+	assert.Nil(t, addBlockWithTxs(t, bc, call))
+	// 合约存储按合约地址隔离
+	_, err = bc.contractState.GetStorage(addr, []byte("FOO"))
+	assert.Nil(t, err)
+	_, err = bc.contractState.Get([]byte("FOO"))
+	assert.NotNil(t, err)
+
+	// 未通过静态校验的代码不能部署
+	bad := signedTx(t, privKey, &Transaction{Type: TxTypeDeploy, Nonce: 2, Data: []byte{byte(InstrAdd)}})
+	assert.ErrorIs(t, ValidateTransaction(bad, bc.Config()), ErrStackUnderflow)
+	assert.NotNil(t, addBlockWithTxs(t, bc, bad))
+
+	// 调用不存在的合约应失败
+	call = signedTx(t, privKey, &Transaction{Type: TxTypeCall, Nonce: 2, To: types.Address{0x02}})
+	assert.NotNil(t, addBlockWithTxs(t, bc, call))
+}
+
+// storeEnv 生成将环境指令 instr 的结果写入存储键 key 的字节码
+func storeEnv(key byte, instr Instruction) []byte {
+	return []byte{key, byte(InstrPushByte), 1, byte(InstrPushInt), byte(InstrPack), byte(instr), byte(InstrStore)}
+}
+
+// TestCallTransactionContext 测试合约调用时可读取调用数据、调用者、金额与区块信息
+func TestCallTransactionContext(t *testing.T) {
+	privKey := crypto.GeneratePrivateKey()
+	sender := privKey.PublicKey().Address()
+	bc := newBlockchainWithAlloc(t, sender, 100)
+
+	var code []byte
+	code = append(code, 'd', byte(InstrPushByte), 1, byte(InstrPushInt), byte(InstrPack),
+		0, byte(InstrPushInt), byte(InstrCallDataLoad), byte(InstrStore))
+	code = append(code, storeEnv('n', InstrCallDataSize)...)
+	code = append(code, storeEnv('c', InstrCaller)...)
+	code = append(code, storeEnv('v', InstrCallValue)...)
+	code = append(code, storeEnv('a', InstrAddress)...)
+	code = append(code, storeEnv('h', InstrHeight)...)
+	code = append(code, storeEnv('t', InstrTimestamp)...)
+
+	deploy := signedTx(t, privKey, &Transaction{Type: TxTypeDeploy, Data: code})
+	assert.Nil(t, addBlockWithTxs(t, bc, deploy))
+	addr := ContractAddress(crypto.HashSHA256, sender, 0)
+
+	input := []byte{0x01, 0x02}
+	call := signedTx(t, privKey, &Transaction{Type: TxTypeCall, Nonce: 1, To: addr, Value: 7, Data: input})
+	assert.Nil(t, addBlockWithTxs(t, bc, call))
+	header, err := bc.GetHeader(bc.Height())
+	assert.Nil(t, err)
+
+	load := func(key byte) *big.Int {
+		b, err := bc.contractState.GetStorage(addr, []byte{key})
+		assert.Nil(t, err)
+		v, err := decodeStorageValue(b)
+		assert.Nil(t, err)
+		return v.(*big.Int)
+	}
+
+	// 调用数据右侧补 0 至 32 字节
+	word := make([]byte, 32)
+	copy(word, input)
+	assertWord(t, new(big.Int).SetBytes(word), load('d'))
+	assertWord(t, big.NewInt(2), load('n'))
+	assertWord(t, new(big.Int).SetBytes(sender.ToSlice()), load('c'))
+	assertWord(t, big.NewInt(7), load('v'))
+	assertWord(t, new(big.Int).SetBytes(addr.ToSlice()), load('a'))
+	assertWord(t, big.NewInt(int64(header.Height)), load('h'))
+	assertWord(t, big.NewInt(header.Timestamp), load('t'))
+}
+
+// TestStakeAndGovernanceTransaction 测试质押、提案与按质押权重投票
+func TestStakeAndGovernanceTransaction(t *testing.T) {
+	privKey := crypto.GeneratePrivateKey()
+	sender := privKey.PublicKey().Address()
+	bc := newBlockchainWithAlloc(t, sender, 100)
+
+	stake := signedTx(t, privKey, &Transaction{Type: TxTypeStake, Data: []byte{byte(StakeOpStake)}, Value: 70})
+	unstake := signedTx(t, privKey, &Transaction{Type: TxTypeStake, Nonce: 1, Data: []byte{byte(StakeOpUnstake)}, Value: 20})
+	assert.Nil(t, addBlockWithTxs(t, bc, stake, unstake))
+
+	acc := getAccount(t, bc, sender)
+	assert.Equal(t, uint64(50), acc.Balance)
+	assert.Equal(t, uint64(50), acc.Staked)
+
+	propose := signedTx(t, privKey, &Transaction{Type: TxTypeGovernance, Nonce: 2, Data: append([]byte{byte(GovOpPropose)}, "raise gas limit"...)})
+	assert.Nil(t, addBlockWithTxs(t, bc, propose))
+
+	id := propose.Hash(TxHasher{})
+	voteData := append(append([]byte{byte(GovOpVote)}, id[:]...), 1)
+	vote := signedTx(t, privKey, &Transaction{Type: TxTypeGovernance, Nonce: 3, Data: voteData})
+	assert.Nil(t, addBlockWithTxs(t, bc, vote))
+
+	p, err := bc.contractState.GetProposal(id)
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("raise gas limit"), p.Content)
+	assert.Equal(t, uint64(50), p.Yes)
+
+	// 重复投票应失败
+	vote = signedTx(t, privKey, &Transaction{Type: TxTypeGovernance, Nonce: 4, Data: voteData})
+	assert.NotNil(t, addBlockWithTxs(t, bc, vote))
+}
+
+// TestAddBlockTxValidityWindow 测试区块验证拒绝不在有效期内的交易
+func TestAddBlockTxValidityWindow(t *testing.T) {
+	privKey := crypto.GeneratePrivateKey()
+	sender := privKey.PublicKey().Address()
+	bc := newBlockchainWithAlloc(t, sender, 100)
+
+	tx := signedTx(t, privKey, &Transaction{Type: TxTypeTransfer, To: types.Address{0x01}, Value: 1, ValidAfter: 1})
+	assert.NotNil(t, addBlockWithTxs(t, bc, tx))
+
+	tx = signedTx(t, privKey, &Transaction{Type: TxTypeTransfer, To: types.Address{0x01}, Value: 1, ValidUntil: 1})
+	assert.Nil(t, addBlockWithTxs(t, bc, tx))
+
+	tx = signedTx(t, privKey, &Transaction{Type: TxTypeTransfer, Nonce: 1, To: types.Address{0x01}, Value: 1, ValidUntil: 1})
+	assert.NotNil(t, addBlockWithTxs(t, bc, tx))
+}
+
+// TestValidateTransaction 测试各类型交易的格式校验
+func TestValidateTransaction(t *testing.T) {
+	assert.Nil(t, ValidateTransaction(&Transaction{Type: TxTypeLegacy}, DefaultChainConfig()))
+	assert.NotNil(t, ValidateTransaction(&Transaction{Type: TxTypeLegacy, Data: []byte{byte(InstrAdd)}}, DefaultChainConfig()))
+	assert.NotNil(t, ValidateTransaction(&Transaction{Type: TxTypeLegacy, Data: []byte("foo")}, DefaultChainConfig()))
+	assert.NotNil(t, ValidateTransaction(&Transaction{Type: TxType(0xff)}, DefaultChainConfig()))
+	assert.NotNil(t, ValidateTransaction(&Transaction{Type: TxTypeTransfer, Value: 1}, DefaultChainConfig()))
+	assert.NotNil(t, ValidateTransaction(&Transaction{Type: TxTypeDeploy}, DefaultChainConfig()))
+	assert.NotNil(t, ValidateTransaction(&Transaction{Type: TxTypeCall}, DefaultChainConfig()))
+	assert.NotNil(t, ValidateTransaction(&Transaction{Type: TxTypeStake, Data: []byte{0x09}, Value: 1}, DefaultChainConfig()))
+	assert.NotNil(t, ValidateTransaction(&Transaction{Type: TxTypeGovernance, Data: []byte{byte(GovOpVote)}}, DefaultChainConfig()))
+}
+
+// noopTxHandler 测试用的自定义交易处理器
+type noopTxHandler struct{}
+
+func (noopTxHandler) Validate(tx *Transaction, config *ChainConfig) error { return nil }
+func (noopTxHandler) Execute(ctx *TxContext, tx *Transaction) error       { return nil }
+
+// TestRegisterTxHandler 测试注册新的交易类型
+func TestRegisterTxHandler(t *testing.T) {
+	const txTypeNoop TxType = 0x7f
+	assert.NotNil(t, ValidateTransaction(&Transaction{Type: txTypeNoop}, DefaultChainConfig()))
+
+	RegisterTxHandler(txTypeNoop, noopTxHandler{})
+	defer delete(txHandlers, txTypeNoop)
+	assert.Nil(t, ValidateTransaction(&Transaction{Type: txTypeNoop}, DefaultChainConfig()))
+
+	// 注册可以与交易校验并发进行（配合 -race 检查）
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			RegisterTxHandler(txTypeNoop, noopTxHandler{})
+		}
+	}()
+	for i := 0; i < 100; i++ {
+		assert.Nil(t, ValidateTransaction(&Transaction{Type: txTypeNoop}, DefaultChainConfig()))
+	}
+	<-done
+}
+
+// newBlockchainWithAlloc 辅助函数：创建为指定地址分配了余额的区块链
+func newBlockchainWithAlloc(t *testing.T, addr types.Address, balance uint64) *Blockchain {
+	g := DefaultGenesis()
+	g.Alloc[addr] = GenesisAccount{Balance: balance}
+
+	bc, err := NewBlockchainFromGenesis(log.NewNopLogger(), g)
+	assert.Nil(t, err)
+
+	return bc
+}
+
+// signedTx 辅助函数：为交易设置默认链ID并签名
+func signedTx(t *testing.T, privKey crypto.PrivateKey, tx *Transaction) *Transaction {
+	tx.ChainID = DefaultChainID
+	assert.Nil(t, tx.Sign(privKey))
+	return tx
+}
+
+// addBlockWithTxs 辅助函数：基于当前链头打包交易生成新区块并加入链中
+func addBlockWithTxs(t *testing.T, bc *Blockchain, txx ...*Transaction) error {
+	prevHeader, err := bc.GetHeader(bc.Height())
+	assert.Nil(t, err)
+
+	b, err := NewBlockFromPrevHeader(bc.config.Hash, prevHeader, txx)
+	assert.Nil(t, err)
+
+	// 交易不合法时无法得到收据，直接提交由 AddBlock 拒绝
+	if receipts, err := bc.ExecuteBlock(b); err == nil {
+		b.ReceiptsRoot = ReceiptsRoot(bc.config.Hash, receipts)
+	}
+	assert.Nil(t, b.Sign(crypto.GeneratePrivateKey()))
+
+	return bc.AddBlock(b)
+}
+
+// getAccount 辅助函数：读取链上账户
+func getAccount(t *testing.T, bc *Blockchain, addr types.Address) *Account {
+	acc, err := bc.contractState.GetAccount(addr)
+	assert.Nil(t, err)
+	return acc
+}
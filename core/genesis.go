@@ -0,0 +1,231 @@
+package core
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/felixkuang/titanchain/crypto"
+	"github.com/felixkuang/titanchain/types"
+)
+
+// DefaultChainID 是未指定创世配置时使用的链ID
+const DefaultChainID uint64 = 1
+
+// ChainConfig 定义了链级别的参数
+// 所有节点必须使用相同的配置才能达成一致
+type ChainConfig struct {
+	ChainID   uint64          `json:"chainId" yaml:"chainId"`     // 链ID，用于区分不同网络
+	Consensus ConsensusConfig `json:"consensus" yaml:"consensus"` // 共识参数
+	VM        VMConfig        `json:"vm" yaml:"vm"`               // 虚拟机参数
+	// Hash 是链上使用的哈希算法，用于区块头与交易哈希、Merkle 根、地址推导与创世配置哈希，
+	// 为空时使用 SHA256
+	Hash crypto.HashAlgorithm `json:"hash,omitempty" yaml:"hash,omitempty"`
+}
+
+// BlockHasher 返回使用链配置的哈希算法计算区块头哈希的哈希器
+func (c *ChainConfig) BlockHasher() BlockHasher {
+	return BlockHasher{Algorithm: c.Hash}
+}
+
+// TxHasher 返回使用链配置的哈希算法计算交易ID的哈希器
+func (c *ChainConfig) TxHasher() TxHasher {
+	return TxHasher{Algorithm: c.Hash}
+}
+
+// vmConfig 返回执行合约时使用的虚拟机参数，附带链配置的哈希算法供预编译合约使用
+func (c *ChainConfig) vmConfig() VMConfig {
+	config := c.VM
+	config.hash = c.Hash
+
+	return config
+}
+
+// ConsensusConfig 定义了共识相关参数
+type ConsensusConfig struct {
+	BlockTime uint64 `json:"blockTime" yaml:"blockTime"` // 出块间隔（毫秒）
+}
+
+// VMConfig 定义了虚拟机相关参数
+type VMConfig struct {
+	StackSize int    `json:"stackSize" yaml:"stackSize"` // 操作数栈的最大容量
+	GasLimit  uint64 `json:"gasLimit" yaml:"gasLimit"`   // 单次执行可消耗的 gas 上限
+
+	hash crypto.HashAlgorithm // 链配置的哈希算法，由 ChainConfig 填写
+}
+
+// DefaultChainConfig 返回默认的链配置
+func DefaultChainConfig() *ChainConfig {
+	return &ChainConfig{
+		ChainID: DefaultChainID,
+		Consensus: ConsensusConfig{
+			BlockTime: uint64((5 * time.Second).Milliseconds()),
+		},
+		VM: VMConfig{
+			StackSize: 128,
+			GasLimit:  1_000_000,
+		},
+	}
+}
+
+// GenesisAccount 表示创世时分配给某个地址的初始资产
+type GenesisAccount struct {
+	Balance uint64 `json:"balance" yaml:"balance"` // 初始余额
+}
+
+// Genesis 描述了链的创世配置
+// 包含链参数、初始验证者集合与账户初始分配
+// 相同的创世配置总是生成相同的创世区块
+type Genesis struct {
+	Config     ChainConfig                      `json:"config" yaml:"config"`         // 链参数
+	Timestamp  int64                            `json:"timestamp" yaml:"timestamp"`   // 创世区块时间戳
+	Validators []string                         `json:"validators" yaml:"validators"` // 初始验证者公钥（十六进制的自描述公钥，见 crypto.PublicKey.ToSlice）
+	Alloc      map[types.Address]GenesisAccount `json:"alloc" yaml:"alloc"`           // 账户初始分配
+}
+
+// DefaultGenesis 返回默认的创世配置
+// 不包含验证者限制与账户分配，适用于开发和测试环境
+func DefaultGenesis() *Genesis {
+	return &Genesis{
+		Config: *DefaultChainConfig(),
+		Alloc:  map[types.Address]GenesisAccount{},
+	}
+}
+
+// LoadGenesis 从文件中加载创世配置
+// 根据扩展名选择格式：.yaml/.yml 使用 YAML，其余使用 JSON
+// 文件中未给出的链参数使用默认值
+func LoadGenesis(path string) (*Genesis, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	g := DefaultGenesis()
+	switch filepath.Ext(path) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(b, g)
+	default:
+		err = json.Unmarshal(b, g)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse genesis file %s: %s", path, err)
+	}
+
+	if err := g.Validate(); err != nil {
+		return nil, err
+	}
+
+	return g, nil
+}
+
+// Validate 检查创世配置是否合法
+// 除链参数与验证者公钥外，还要求至少配置一个验证者，否则链上没有确定的出块者
+func (g *Genesis) Validate() error {
+	if len(g.Validators) == 0 {
+		return fmt.Errorf("genesis must list at least one validator")
+	}
+
+	return g.validate()
+}
+
+// validate 检查链参数与验证者公钥
+// 不要求配置验证者集合，供 DefaultGenesis 这类开发与测试配置使用
+func (g *Genesis) validate() error {
+	if g.Config.ChainID == 0 {
+		return fmt.Errorf("genesis chain id must not be zero")
+	}
+
+	if err := g.Config.Hash.Validate(); err != nil {
+		return err
+	}
+
+	if g.Config.VM.GasLimit == 0 {
+		return fmt.Errorf("genesis vm gas limit must not be zero")
+	}
+	if g.Config.VM.StackSize <= 0 {
+		return fmt.Errorf("genesis vm stack size (%d) must be positive", g.Config.VM.StackSize)
+	}
+
+	for _, v := range g.Validators {
+		if _, err := g.decodeValidator(v); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// ValidatorKeys 返回解码后的初始验证者公钥列表
+func (g *Genesis) ValidatorKeys() ([][]byte, error) {
+	keys := make([][]byte, 0, len(g.Validators))
+	for _, v := range g.Validators {
+		key, err := g.decodeValidator(v)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+
+	return keys, nil
+}
+
+// decodeValidator 解码并校验单个验证者公钥
+func (g *Genesis) decodeValidator(v string) ([]byte, error) {
+	key, err := hex.DecodeString(v)
+	if err != nil {
+		return nil, fmt.Errorf("invalid genesis validator %s: %s", v, err)
+	}
+	if _, err := crypto.ToPublicKey(key); err != nil {
+		return nil, fmt.Errorf("invalid genesis validator %s: %s", v, err)
+	}
+
+	return key, nil
+}
+
+// Hash 计算创世配置的哈希
+// 使用规范化的 JSON 编码（map 键有序），保证结果确定；哈希算法由配置本身指定
+func (g *Genesis) Hash() (types.Hash, error) {
+	b, err := json.Marshal(g)
+	if err != nil {
+		return types.Hash{}, err
+	}
+
+	return g.Config.Hash.Sum(b), nil
+}
+
+// ToBlock 根据创世配置构建创世区块
+// 创世区块不包含交易，其 DataHash 承诺了完整的创世配置，
+// 因此配置中的任何差异都会导致不同的创世区块哈希
+func (g *Genesis) ToBlock() (*Block, error) {
+	hash, err := g.Hash()
+	if err != nil {
+		return nil, err
+	}
+
+	header := &Header{
+		Version:      1,
+		DataHash:     hash,
+		ReceiptsRoot: ReceiptsRoot(g.Config.Hash, nil),
+		Height:       0,
+		Timestamp:    g.Timestamp,
+	}
+
+	return NewBlock(header, nil)
+}
+
+// Commit 将创世账户分配写入状态
+func (g *Genesis) Commit(state *State) error {
+	for addr, alloc := range g.Alloc {
+		if err := state.PutAccount(addr, &Account{Balance: alloc.Balance}); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
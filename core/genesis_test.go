@@ -0,0 +1,186 @@
+package core
+
+import (
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/go-kit/log"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/felixkuang/titanchain/crypto"
+	"github.com/felixkuang/titanchain/types"
+)
+
+// genesisValidator 是测试创世配置中的验证者（十六进制的自描述 Ed25519 公钥）
+const genesisValidator = "02ae99fd98b8d6958ecdcb10a6bfb43228492fb80171f13dd126f1306e7705ff58"
+
+const genesisJSON = `{
+	"config": {"chainId": 7, "consensus": {"blockTime": 2000}, "vm": {"stackSize": 256}},
+	"timestamp": 1700000000,
+	"validators": ["` + genesisValidator + `"],
+	"alloc": {"0102030405060708090a0b0c0d0e0f1011121314": {"balance": 1000}}
+}`
+
+const genesisYAML = `
+config:
+  chainId: 7
+  consensus:
+    blockTime: 2000
+  vm:
+    stackSize: 256
+timestamp: 1700000000
+validators:
+  - ` + genesisValidator + `
+alloc:
+  0102030405060708090a0b0c0d0e0f1011121314:
+    balance: 1000
+`
+
+// writeGenesisFile 辅助函数：将创世配置写入临时文件
+func writeGenesisFile(t *testing.T, name, content string) string {
+	path := filepath.Join(t.TempDir(), name)
+	assert.Nil(t, os.WriteFile(path, []byte(content), 0o644))
+	return path
+}
+
+// TestLoadGenesis 测试 JSON 与 YAML 创世配置加载结果一致
+func TestLoadGenesis(t *testing.T) {
+	gJSON, err := LoadGenesis(writeGenesisFile(t, "genesis.json", genesisJSON))
+	assert.Nil(t, err)
+	gYAML, err := LoadGenesis(writeGenesisFile(t, "genesis.yaml", genesisYAML))
+	assert.Nil(t, err)
+
+	assert.Equal(t, gJSON, gYAML)
+	assert.Equal(t, uint64(7), gJSON.Config.ChainID)
+	assert.Equal(t, 256, gJSON.Config.VM.StackSize)
+	// 文件中未给出的参数使用默认值
+	assert.Equal(t, DefaultChainConfig().VM.GasLimit, gJSON.Config.VM.GasLimit)
+
+	addr, err := types.AddressFromHex("0102030405060708090a0b0c0d0e0f1011121314")
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(1000), gJSON.Alloc[addr].Balance)
+}
+
+// TestGenesisDeterministic 测试相同配置生成相同的创世区块，不同配置生成不同的区块
+func TestGenesisDeterministic(t *testing.T) {
+	g1, err := LoadGenesis(writeGenesisFile(t, "genesis.json", genesisJSON))
+	assert.Nil(t, err)
+	g2, err := LoadGenesis(writeGenesisFile(t, "genesis.yml", genesisYAML))
+	assert.Nil(t, err)
+
+	b1, err := g1.ToBlock()
+	assert.Nil(t, err)
+	b2, err := g2.ToBlock()
+	assert.Nil(t, err)
+	assert.Equal(t, b1.Hash(BlockHasher{}), b2.Hash(BlockHasher{}))
+
+	g2.Config.ChainID = 8
+	b3, err := g2.ToBlock()
+	assert.Nil(t, err)
+	assert.NotEqual(t, b1.Hash(BlockHasher{}), b3.Hash(BlockHasher{}))
+}
+
+// TestGenesisInvalid 测试非法的创世配置
+func TestGenesisInvalid(t *testing.T) {
+	cases := []struct {
+		name   string
+		modify func(g *Genesis)
+	}{
+		{"zero chain id", func(g *Genesis) { g.Config.ChainID = 0 }},
+		{"invalid validator", func(g *Genesis) { g.Validators = []string{"zz"} }},
+		{"unknown hash", func(g *Genesis) { g.Config.Hash = "md5" }},
+		{"zero gas limit", func(g *Genesis) { g.Config.VM.GasLimit = 0 }},
+		{"zero stack size", func(g *Genesis) { g.Config.VM.StackSize = 0 }},
+		{"negative stack size", func(g *Genesis) { g.Config.VM.StackSize = -1 }},
+		{"no validators", func(g *Genesis) { g.Validators = nil }},
+	}
+
+	for _, c := range cases {
+		g := DefaultGenesis()
+		g.Validators = []string{genesisValidator}
+		assert.Nil(t, g.Validate(), c.name)
+		c.modify(g)
+		assert.NotNil(t, g.Validate(), c.name)
+	}
+
+	// 创世文件同样会被校验
+	_, err := LoadGenesis(writeGenesisFile(t, "genesis.json", "{"))
+	assert.NotNil(t, err)
+	_, err = LoadGenesis(writeGenesisFile(t, "genesis.json", `{"config": {"chainId": 7}}`))
+	assert.NotNil(t, err)
+	_, err = LoadGenesis(writeGenesisFile(t, "genesis.json", `{"config": {"chainId": 7, "vm": {"gasLimit": 0}}, "validators": ["`+genesisValidator+`"]}`))
+	assert.NotNil(t, err)
+
+	// 开发配置可以不配置验证者集合，但链参数同样要合法
+	g := DefaultGenesis()
+	_, err = NewBlockchainFromGenesis(log.NewNopLogger(), g)
+	assert.Nil(t, err)
+	g.Config.VM.StackSize = 0
+	_, err = NewBlockchainFromGenesis(log.NewNopLogger(), g)
+	assert.NotNil(t, err)
+}
+
+// TestNewBlockchainFromGenesis 测试根据创世配置创建区块链
+func TestNewBlockchainFromGenesis(t *testing.T) {
+	addr := types.AddressFromBytes(make([]byte, 20))
+	g := DefaultGenesis()
+	g.Config.ChainID = 42
+	g.Alloc[addr] = GenesisAccount{Balance: 500}
+
+	bc, err := NewBlockchainFromGenesis(log.NewNopLogger(), g)
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(42), bc.ChainID())
+
+	genesis, err := g.ToBlock()
+	assert.Nil(t, err)
+	assert.Equal(t, genesis.Hash(BlockHasher{}), bc.GenesisHash())
+
+	acc, err := bc.contractState.GetAccount(addr)
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(500), acc.Balance)
+}
+
+// TestGenesisValidatorSet 测试只有创世验证者可以出块
+func TestGenesisValidatorSet(t *testing.T) {
+	validator := crypto.GeneratePrivateKey()
+	g := DefaultGenesis()
+	g.Validators = []string{hex.EncodeToString(validator.PublicKey().ToSlice())}
+
+	bc, err := NewBlockchainFromGenesis(log.NewNopLogger(), g)
+	assert.Nil(t, err)
+
+	// randomBlock 使用随机私钥签名，应被拒绝
+	assert.NotNil(t, bc.AddBlock(randomBlock(t, 1, getPrevBlockHash(t, bc, 1))))
+
+	b := sealBlock(t, bc, randomBlock(t, 1, getPrevBlockHash(t, bc, 1)), validator)
+	assert.Nil(t, bc.AddBlock(b))
+}
+
+// TestGenesisValidatorKeyTypes 测试验证者与交易发起者可以使用不同类型的密钥
+func TestGenesisValidatorKeyTypes(t *testing.T) {
+	validator, err := crypto.GenerateKey(crypto.KeyTypeEd25519)
+	assert.Nil(t, err)
+	sender, err := crypto.GenerateKey(crypto.KeyTypeSecp256k1)
+	assert.Nil(t, err)
+
+	g := DefaultGenesis()
+	g.Validators = []string{hex.EncodeToString(validator.PublicKey().ToSlice())}
+	g.Alloc[sender.PublicKey().Address()] = GenesisAccount{Balance: 100}
+	bc, err := NewBlockchainFromGenesis(log.NewNopLogger(), g)
+	assert.Nil(t, err)
+
+	tx := signedTx(t, sender, &Transaction{Type: TxTypeTransfer, To: types.Address{0x01}, Value: 40})
+	prevHeader, err := bc.GetHeader(0)
+	assert.Nil(t, err)
+	b, err := NewBlockFromPrevHeader(bc.config.Hash, prevHeader, []*Transaction{tx})
+	assert.Nil(t, err)
+	assert.Nil(t, bc.AddBlock(sealBlock(t, bc, b, validator)))
+	assert.Equal(t, uint64(60), getAccount(t, bc, sender.PublicKey().Address()).Balance)
+
+	// 未知类型的验证者公钥
+	g = DefaultGenesis()
+	g.Validators = []string{"7f" + hex.EncodeToString(validator.PublicKey().ToSlice()[1:])}
+	assert.NotNil(t, g.Validate())
+}
@@ -0,0 +1,145 @@
+package core
+
+import (
+	"bytes"
+	"encoding/gob"
+	"fmt"
+
+	"github.com/felixkuang/titanchain/types"
+)
+
+// GovOp 表示治理交易的操作类型，位于交易 Data 的首字节
+type GovOp byte
+
+const (
+	// GovOpPropose 发起提案，Data 其余部分为提案内容
+	GovOpPropose GovOp = 0x01
+	// GovOpVote 对提案投票，Data 其余部分为 32 字节提案ID和 1 字节赞成(1)/反对(0)
+	GovOpVote GovOp = 0x02
+)
+
+var (
+	// proposalPrefix 是提案在状态存储中的键前缀
+	proposalPrefix = []byte("proposal/")
+	// votePrefix 是投票记录在状态存储中的键前缀
+	votePrefix = []byte("vote/")
+)
+
+// Proposal 表示一个治理提案
+// 投票权重为投票者的质押金额
+type Proposal struct {
+	ID       types.Hash    // 提案ID，即发起提案的交易ID
+	Proposer types.Address // 提案发起者
+	Content  []byte        // 提案内容
+	Height   uint32        // 提案所在区块高度
+	Yes      uint64        // 赞成票权重
+	No       uint64        // 反对票权重
+}
+
+// proposalKey 返回提案在状态存储中的键
+func proposalKey(id types.Hash) []byte {
+	return append(append([]byte{}, proposalPrefix...), id.ToSlice()...)
+}
+
+// voteKey 返回投票记录在状态存储中的键
+func voteKey(id types.Hash, voter types.Address) []byte {
+	key := append(append([]byte{}, votePrefix...), id.ToSlice()...)
+	return append(key, voter.ToSlice()...)
+}
+
+// GetProposal 读取指定ID的提案
+func (s *State) GetProposal(id types.Hash) (*Proposal, error) {
+	b, err := s.Get(proposalKey(id))
+	if err != nil {
+		return nil, fmt.Errorf("proposal (%s) not found", id)
+	}
+
+	p := new(Proposal)
+	if err := gob.NewDecoder(bytes.NewReader(b)).Decode(p); err != nil {
+		return nil, err
+	}
+
+	return p, nil
+}
+
+// putProposal 写入提案
+func (s *State) putProposal(p *Proposal) error {
+	buf := &bytes.Buffer{}
+	if err := gob.NewEncoder(buf).Encode(p); err != nil {
+		return err
+	}
+
+	return s.Put(proposalKey(p.ID), buf.Bytes())
+}
+
+// governanceTxHandler 处理治理提案与投票交易
+type governanceTxHandler struct{}
+
+func (governanceTxHandler) Validate(tx *Transaction, config *ChainConfig) error {
+	if len(tx.Data) == 0 {
+		return fmt.Errorf("governance transaction has no operation")
+	}
+	if tx.To != (types.Address{}) || tx.Value != 0 {
+		return fmt.Errorf("governance transaction must not have a recipient or value")
+	}
+
+	switch GovOp(tx.Data[0]) {
+	case GovOpPropose:
+		if len(tx.Data) == 1 {
+			return fmt.Errorf("governance proposal has no content")
+		}
+	case GovOpVote:
+		if len(tx.Data) != 1+32+1 || tx.Data[33] > 1 {
+			return fmt.Errorf("invalid governance vote payload")
+		}
+	default:
+		return fmt.Errorf("unknown governance operation (%d)", tx.Data[0])
+	}
+
+	return nil
+}
+
+func (governanceTxHandler) Execute(ctx *TxContext, tx *Transaction) error {
+	switch GovOp(tx.Data[0]) {
+	case GovOpPropose:
+		return ctx.State.putProposal(&Proposal{
+			ID:       tx.Hash(ctx.Config.TxHasher()),
+			Proposer: ctx.Sender,
+			Content:  tx.Data[1:],
+			Height:   ctx.Header.Height,
+		})
+	case GovOpVote:
+		id := types.HashFromBytes(tx.Data[1:33])
+		p, err := ctx.State.GetProposal(id)
+		if err != nil {
+			return err
+		}
+
+		key := voteKey(id, ctx.Sender)
+		if _, err := ctx.State.Get(key); err == nil {
+			return fmt.Errorf("(%s) already voted on proposal (%s)", ctx.Sender, id)
+		}
+
+		acc, err := ctx.State.GetAccount(ctx.Sender)
+		if err != nil {
+			return err
+		}
+		if acc.Staked == 0 {
+			return fmt.Errorf("(%s) has no stake to vote with", ctx.Sender)
+		}
+
+		if tx.Data[33] == 1 {
+			p.Yes += acc.Staked
+		} else {
+			p.No += acc.Staked
+		}
+
+		if err := ctx.State.Put(key, []byte{tx.Data[33]}); err != nil {
+			return err
+		}
+
+		return ctx.State.putProposal(p)
+	}
+
+	return nil
+}
@@ -2,8 +2,7 @@
 package core
 
 import (
-	"crypto/sha256"
-
+	"github.com/felixkuang/titanchain/crypto"
 	"github.com/felixkuang/titanchain/types"
 )
 
@@ -15,24 +14,27 @@ type Hasher[T any] interface {
 }
 
 // BlockHasher 实现了区块头的哈希计算
-// 使用 SHA256 计算区块头的哈希，不包含交易数据
-type BlockHasher struct{}
+// 使用 Algorithm 指定的哈希算法计算区块头的哈希，不包含交易数据；零值使用 SHA256
+type BlockHasher struct {
+	Algorithm crypto.HashAlgorithm
+}
 
 // Hash 计算区块头的哈希值
 // b: 区块头指针
-// 返回区块头的 SHA256 哈希
-func (BlockHasher) Hash(b *Header) types.Hash {
-	h := sha256.Sum256(b.Bytes())
-	return types.Hash(h)
+// 返回区块头的哈希
+func (h BlockHasher) Hash(b *Header) types.Hash {
+	return h.Algorithm.Sum(b.Bytes())
 }
 
 // TxHasher 实现了交易的哈希计算
-// 使用 SHA256 计算交易数据的哈希
-type TxHasher struct{}
+// 使用 Algorithm 指定的哈希算法计算交易规范化编码的哈希，作为交易ID；零值使用 SHA256
+type TxHasher struct {
+	Algorithm crypto.HashAlgorithm
+}
 
 // Hash 计算交易的哈希值
 // tx: 交易指针
-// 返回交易数据的 SHA256 哈希
-func (TxHasher) Hash(tx *Transaction) types.Hash {
-	return types.Hash(sha256.Sum256(tx.Data))
+// 返回覆盖全部字段（包括发起者和签名）的哈希
+func (h TxHasher) Hash(tx *Transaction) types.Hash {
+	return h.Algorithm.Sum(tx.Bytes())
 }
@@ -0,0 +1,132 @@
+package core
+
+import (
+	"encoding/hex"
+	"strings"
+	"testing"
+
+	"github.com/go-kit/log"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/felixkuang/titanchain/crypto"
+	"github.com/felixkuang/titanchain/types"
+)
+
+var hashAlgorithms = []crypto.HashAlgorithm{crypto.HashSHA256, crypto.HashKeccak256, crypto.HashBlake2b256}
+
+// TestEmptyRootVectors 测试各哈希算法下空列表的 Merkle 根，即空字节串的哈希
+func TestEmptyRootVectors(t *testing.T) {
+	vectors := map[crypto.HashAlgorithm]string{
+		crypto.HashSHA256:     "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855",
+		crypto.HashKeccak256:  "c5d2460186f7233c927e7db2dcc703c0e500b653ca82273b7bfad8045d85a470",
+		crypto.HashBlake2b256: "0e5751c026e543b2e8ab2eb06099daa1d1e5df47778f7787faab45cdf12fe3a8",
+	}
+
+	for algo, want := range vectors {
+		root := MerkleRoot(algo, nil)
+		assert.Equal(t, want, hex.EncodeToString(root[:]), algo)
+		assert.Equal(t, root, ReceiptsRoot(algo, nil), algo)
+	}
+
+	// 未配置时使用 SHA256
+	assert.Equal(t, MerkleRoot(crypto.HashSHA256, nil), MerkleRoot("", nil))
+}
+
+// TestHashAlgorithmsDiffer 测试同一数据在不同哈希算法下得到不同的哈希与地址
+func TestHashAlgorithmsDiffer(t *testing.T) {
+	privKey := crypto.GeneratePrivateKey()
+	tx := signedTx(t, privKey, &Transaction{Type: TxTypeTransfer, To: types.Address{0x01}, Value: 1})
+	leaves := []types.Hash{{0x01}, {0x02}, {0x03}}
+
+	txHashes := map[types.Hash]bool{}
+	roots := map[types.Hash]bool{}
+	senders := map[types.Address]bool{}
+	contracts := map[types.Address]bool{}
+	for _, algo := range hashAlgorithms {
+		txHashes[tx.Hash(TxHasher{Algorithm: algo})] = true
+		roots[MerkleRoot(algo, leaves)] = true
+		sender, err := tx.Sender(algo)
+		assert.Nil(t, err)
+		senders[sender] = true
+		contracts[ContractAddress(algo, sender, 0)] = true
+
+		// 交易哈希缓存随哈希器更新
+		assert.Equal(t, TxHasher{Algorithm: algo}.Hash(tx), tx.Hash(TxHasher{Algorithm: algo}))
+
+		// Merkle 证明只能用生成时的算法校验
+		proof, path, err := MerkleProof(algo, leaves, 1)
+		assert.Nil(t, err)
+		root := MerkleRoot(algo, leaves)
+		for _, other := range hashAlgorithms {
+			assert.Equal(t, algo == other, VerifyMerkleProof(other, root, leaves[1], proof, path))
+		}
+	}
+
+	assert.Len(t, txHashes, len(hashAlgorithms))
+	assert.Len(t, roots, len(hashAlgorithms))
+	assert.Len(t, senders, len(hashAlgorithms))
+	assert.Len(t, contracts, len(hashAlgorithms))
+}
+
+// TestChainHashAlgorithms 测试以不同哈希算法配置的链：区块头、交易根、收据根与地址推导使用同一算法
+func TestChainHashAlgorithms(t *testing.T) {
+	genesisHashes := map[types.Hash]bool{}
+
+	for _, algo := range hashAlgorithms {
+		privKey := crypto.GeneratePrivateKey()
+		sender := privKey.PublicKey().AddressWith(algo)
+
+		g := DefaultGenesis()
+		g.Config.Hash = algo
+		g.Alloc[sender] = GenesisAccount{Balance: 100}
+		bc, err := NewBlockchainFromGenesis(log.NewNopLogger(), g)
+		assert.Nil(t, err)
+		genesisHashes[bc.GenesisHash()] = true
+
+		genesis, err := bc.GetHeader(0)
+		assert.Nil(t, err)
+		assert.Equal(t, algo.Sum(genesis.Bytes()), bc.GenesisHash())
+		assert.Equal(t, MerkleRoot(algo, nil), genesis.ReceiptsRoot)
+
+		// 发起者地址与合约地址按链配置的算法推导
+		deploy := signedTx(t, privKey, &Transaction{Type: TxTypeDeploy, Data: counterCode()})
+		assert.Nil(t, addBlockWithTxs(t, bc, deploy))
+		contract := ContractAddress(algo, sender, 0)
+		code, err := bc.contractState.GetCode(contract)
+		assert.Nil(t, err)
+		assert.Equal(t, counterCode(), code)
+		assert.Equal(t, uint64(1), getAccount(t, bc, sender).Nonce)
+
+		header, err := bc.GetHeader(1)
+		assert.Nil(t, err)
+		assert.Equal(t, algo.Sum(genesis.Bytes()), header.PrevBlockHash)
+		assert.Equal(t, MerkleRoot(algo, []types.Hash{algo.Sum(deploy.Bytes())}), header.DataHash)
+
+		receipt, err := bc.GetReceipt(deploy.Hash(bc.Config().TxHasher()))
+		assert.Nil(t, err)
+		assert.Equal(t, MerkleRoot(algo, []types.Hash{receipt.Hash(algo)}), header.ReceiptsRoot)
+
+		// 以其他算法计算前一区块哈希的区块被拒绝
+		other := crypto.HashSHA256
+		if algo == crypto.HashSHA256 {
+			other = crypto.HashKeccak256
+		}
+		b, err := NewBlockFromPrevHeader(other, header, nil)
+		assert.Nil(t, err)
+		b.ReceiptsRoot = ReceiptsRoot(algo, nil)
+		assert.Nil(t, b.Sign(crypto.GeneratePrivateKey()))
+		assert.NotNil(t, bc.AddBlock(b))
+	}
+
+	assert.Len(t, genesisHashes, len(hashAlgorithms))
+}
+
+// TestLoadGenesisHash 测试从创世配置文件读取哈希算法
+func TestLoadGenesisHash(t *testing.T) {
+	g, err := LoadGenesis(writeGenesisFile(t, "genesis.yaml", strings.Replace(genesisYAML, "config:\n", "config:\n  hash: blake2b256\n", 1)))
+	assert.Nil(t, err)
+	assert.Equal(t, crypto.HashBlake2b256, g.Config.Hash)
+
+	_, err = LoadGenesis(writeGenesisFile(t, "genesis.json", `{"config": {"chainId": 7, "hash": "sha1"}, "validators": ["`+genesisValidator+`"]}`))
+	assert.NotNil(t, err)
+}
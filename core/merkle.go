@@ -0,0 +1,116 @@
+package core
+
+import (
+	"fmt"
+
+	"github.com/felixkuang/titanchain/crypto"
+	"github.com/felixkuang/titanchain/types"
+)
+
+const (
+	// merkleLeafPrefix 是叶子节点哈希的域分隔前缀
+	merkleLeafPrefix byte = 0x00
+	// merkleNodePrefix 是内部节点哈希的域分隔前缀
+	merkleNodePrefix byte = 0x01
+)
+
+// MerkleRoot 计算给定叶子哈希列表的 Merkle 根
+// 叶子与内部节点使用不同前缀哈希，防止二者被混淆；
+// 某一层节点数为奇数时，最后一个节点直接提升到上一层，不做复制，
+// 从而避免不同交易列表得到相同根的问题。
+// algo 为链配置的哈希算法，空列表的根为空字节串的哈希
+func MerkleRoot(algo crypto.HashAlgorithm, leaves []types.Hash) types.Hash {
+	if len(leaves) == 0 {
+		return algo.Sum(nil)
+	}
+
+	level := make([]types.Hash, len(leaves))
+	for i, leaf := range leaves {
+		level[i] = merkleLeaf(algo, leaf)
+	}
+
+	for len(level) > 1 {
+		next := make([]types.Hash, 0, (len(level)+1)/2)
+		for i := 0; i < len(level); i += 2 {
+			if i+1 == len(level) {
+				next = append(next, level[i])
+				continue
+			}
+			next = append(next, merkleNode(algo, level[i], level[i+1]))
+		}
+		level = next
+	}
+
+	return level[0]
+}
+
+// merkleLeaf 计算叶子节点哈希
+func merkleLeaf(algo crypto.HashAlgorithm, h types.Hash) types.Hash {
+	return algo.Sum([]byte{merkleLeafPrefix}, h[:])
+}
+
+// merkleNode 计算内部节点哈希
+func merkleNode(algo crypto.HashAlgorithm, left, right types.Hash) types.Hash {
+	return algo.Sum([]byte{merkleNodePrefix}, left[:], right[:])
+}
+
+// maxMerkleProofDepth 是 Merkle 证明的最大层数，受 path 位数限制
+const maxMerkleProofDepth = 64
+
+// MerkleProof 返回第 index 个叶子到 MerkleRoot(algo, leaves) 的证明
+// proof 为自底向上的兄弟节点哈希，path 的第 i 位为 1 表示 proof[i] 位于左侧；
+// 节点数为奇数的层中被直接提升的节点没有兄弟节点，该层不出现在证明中
+func MerkleProof(algo crypto.HashAlgorithm, leaves []types.Hash, index int) ([]types.Hash, uint64, error) {
+	if index < 0 || index >= len(leaves) {
+		return nil, 0, fmt.Errorf("leaf index (%d) out of range (%d)", index, len(leaves))
+	}
+
+	level := make([]types.Hash, len(leaves))
+	for i, leaf := range leaves {
+		level[i] = merkleLeaf(algo, leaf)
+	}
+
+	var (
+		proof []types.Hash
+		path  uint64
+	)
+	for len(level) > 1 {
+		if sibling := index ^ 1; sibling < len(level) {
+			if sibling < index {
+				path |= 1 << len(proof)
+			}
+			proof = append(proof, level[sibling])
+		}
+
+		next := make([]types.Hash, 0, (len(level)+1)/2)
+		for i := 0; i < len(level); i += 2 {
+			if i+1 == len(level) {
+				next = append(next, level[i])
+				continue
+			}
+			next = append(next, merkleNode(algo, level[i], level[i+1]))
+		}
+		level = next
+		index /= 2
+	}
+
+	return proof, path, nil
+}
+
+// VerifyMerkleProof 校验 leaf 经 proof 与 path（见 MerkleProof）以 algo 计算得到的根是否等于 root
+func VerifyMerkleProof(algo crypto.HashAlgorithm, root, leaf types.Hash, proof []types.Hash, path uint64) bool {
+	if len(proof) > maxMerkleProofDepth {
+		return false
+	}
+
+	h := merkleLeaf(algo, leaf)
+	for i, sibling := range proof {
+		if path&(1<<i) != 0 {
+			h = merkleNode(algo, sibling, h)
+		} else {
+			h = merkleNode(algo, h, sibling)
+		}
+	}
+
+	return h == root
+}
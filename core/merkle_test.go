@@ -0,0 +1,58 @@
+package core
+
+import (
+	"crypto/sha256"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/felixkuang/titanchain/crypto"
+	"github.com/felixkuang/titanchain/types"
+)
+
+// TestMerkleRootEmptyAndSingle 测试空列表与单个叶子的 Merkle 根
+func TestMerkleRootEmptyAndSingle(t *testing.T) {
+	assert.Equal(t, types.Hash(sha256.Sum256(nil)), MerkleRoot(crypto.HashSHA256, nil))
+
+	leaf := types.Hash{0x01}
+	assert.Equal(t, merkleLeaf(crypto.HashSHA256, leaf), MerkleRoot(crypto.HashSHA256, []types.Hash{leaf}))
+}
+
+// TestMerkleRootOrder 测试叶子顺序影响 Merkle 根
+func TestMerkleRootOrder(t *testing.T) {
+	a, b := types.Hash{0x01}, types.Hash{0x02}
+	assert.Equal(t, merkleNode(crypto.HashSHA256, merkleLeaf(crypto.HashSHA256, a), merkleLeaf(crypto.HashSHA256, b)), MerkleRoot(crypto.HashSHA256, []types.Hash{a, b}))
+	assert.NotEqual(t, MerkleRoot(crypto.HashSHA256, []types.Hash{a, b}), MerkleRoot(crypto.HashSHA256, []types.Hash{b, a}))
+}
+
+// TestMerkleRootOddLeaves 测试奇数叶子不会与复制末尾叶子的列表得到相同的根
+func TestMerkleRootOddLeaves(t *testing.T) {
+	a, b, c := types.Hash{0x01}, types.Hash{0x02}, types.Hash{0x03}
+	assert.NotEqual(t, MerkleRoot(crypto.HashSHA256, []types.Hash{a, b, c}), MerkleRoot(crypto.HashSHA256, []types.Hash{a, b, c, c}))
+}
+
+// TestMerkleProof 测试每个叶子的证明都能校验通过，且篡改后校验失败
+func TestMerkleProof(t *testing.T) {
+	for n := 1; n <= 9; n++ {
+		leaves := make([]types.Hash, n)
+		for i := range leaves {
+			leaves[i] = types.Hash{byte(i + 1)}
+		}
+		root := MerkleRoot(crypto.HashSHA256, leaves)
+
+		for i, leaf := range leaves {
+			proof, path, err := MerkleProof(crypto.HashSHA256, leaves, i)
+			assert.Nil(t, err)
+			assert.True(t, VerifyMerkleProof(crypto.HashSHA256, root, leaf, proof, path), "n=%d i=%d", n, i)
+
+			assert.False(t, VerifyMerkleProof(crypto.HashSHA256, root, types.Hash{0xff}, proof, path))
+			if len(proof) > 0 {
+				assert.False(t, VerifyMerkleProof(crypto.HashSHA256, root, leaf, proof, path^1))
+				assert.False(t, VerifyMerkleProof(crypto.HashSHA256, root, leaf, proof[1:], path>>1))
+			}
+		}
+	}
+
+	_, _, err := MerkleProof(crypto.HashSHA256, []types.Hash{{0x01}}, 1)
+	assert.NotNil(t, err)
+}
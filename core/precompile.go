@@ -0,0 +1,244 @@
+package core
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"math/big"
+	"sync"
+
+	"github.com/felixkuang/titanchain/crypto"
+	"github.com/felixkuang/titanchain/types"
+)
+
+var (
+	// ErrPrecompileInput 表示预编译合约的输入长度或格式不合法
+	ErrPrecompileInput = errors.New("invalid precompile input")
+)
+
+// PrecompiledContract 是以 Go 原生代码实现、部署在保留地址上的合约
+// 合约之间的调用（InstrCall/InstrStaticCall）与合约调用交易以保留地址为目标时直接执行 Run，不经过解释器
+type PrecompiledContract interface {
+	// RequiredGas 返回以 input 为调用数据调用一次消耗的 gas
+	RequiredGas(input []byte) uint64
+	// Run 根据调用数据计算返回数据，返回错误时调用失败
+	// algo 为链配置的哈希算法，供推导地址或校验 Merkle 证明的合约使用
+	Run(input []byte, algo crypto.HashAlgorithm) ([]byte, error)
+}
+
+// PrecompileAddress 返回第 n 个保留地址，即最后一个字节为 n、其余字节为 0 的地址
+func PrecompileAddress(n byte) types.Address {
+	var addr types.Address
+	addr[len(addr)-1] = n
+
+	return addr
+}
+
+var (
+	// PrecompileSHA256 计算调用数据的 SHA-256 哈希
+	PrecompileSHA256 = PrecompileAddress(0x01)
+	// PrecompileKeccak256 计算调用数据的 Keccak-256 哈希
+	PrecompileKeccak256 = PrecompileAddress(0x02)
+	// PrecompileP256Recover 从 P-256 签名中恢复签名者地址
+	PrecompileP256Recover = PrecompileAddress(0x03)
+	// PrecompileP256Verify 校验 P-256 签名
+	PrecompileP256Verify = PrecompileAddress(0x04)
+	// PrecompileEd25519Verify 校验 Ed25519 签名
+	PrecompileEd25519Verify = PrecompileAddress(0x05)
+	// PrecompileMerkleVerify 校验 Merkle 证明
+	PrecompileMerkleVerify = PrecompileAddress(0x06)
+)
+
+// precompilesLock 保护 precompiles，注册可能与合约执行并发进行
+var precompilesLock sync.RWMutex
+
+// precompiles 记录保留地址对应的预编译合约
+var precompiles = map[types.Address]PrecompiledContract{
+	PrecompileSHA256:        sha256Precompile{},
+	PrecompileKeccak256:     keccak256Precompile{},
+	PrecompileP256Recover:   p256RecoverPrecompile{},
+	PrecompileP256Verify:    p256VerifyPrecompile{},
+	PrecompileEd25519Verify: ed25519VerifyPrecompile{},
+	PrecompileMerkleVerify:  merkleVerifyPrecompile{},
+}
+
+// RegisterPrecompile 在保留地址上注册预编译合约
+// addr: 保留地址，会覆盖已注册的同地址合约
+func RegisterPrecompile(addr types.Address, p PrecompiledContract) {
+	precompilesLock.Lock()
+	defer precompilesLock.Unlock()
+
+	precompiles[addr] = p
+}
+
+// IsPrecompile 判断地址上是否注册了预编译合约
+func IsPrecompile(addr types.Address) bool {
+	_, ok := lookupPrecompile(addr)
+	return ok
+}
+
+// lookupPrecompile 返回地址上注册的预编译合约
+func lookupPrecompile(addr types.Address) (PrecompiledContract, bool) {
+	precompilesLock.RLock()
+	defer precompilesLock.RUnlock()
+
+	p, ok := precompiles[addr]
+	return p, ok
+}
+
+// runPrecompile 以 gas 为上限执行预编译合约，返回返回数据与剩余 gas
+// gas 不足时返回 ErrOutOfGas；执行出错时消耗全部 gas
+func runPrecompile(p PrecompiledContract, input []byte, gas uint64, algo crypto.HashAlgorithm) ([]byte, uint64, error) {
+	cost := p.RequiredGas(input)
+	if gas < cost {
+		return nil, 0, ErrOutOfGas
+	}
+
+	out, err := p.Run(input, algo)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return out, gas - cost, nil
+}
+
+// 哈希类预编译合约的 gas：固定部分加上按输入长度每 32 字节收取的部分
+const (
+	hashPrecompileBaseGas = 60
+	hashPrecompileWordGas = 12
+)
+
+// wordGas 返回按 32 字节计费的 gas，不足 32 字节的部分按 32 字节计
+func wordGas(n int, perWord uint64) uint64 {
+	return uint64(n+31) / 32 * perWord
+}
+
+// precompileWord 将布尔结果编码为 32 字节的字
+func precompileWord(ok bool) []byte {
+	return serializeWord(new(big.Int).SetUint64(boolToUint(ok)))
+}
+
+// sha256Precompile 返回调用数据的 32 字节 SHA-256 哈希
+type sha256Precompile struct{}
+
+func (sha256Precompile) RequiredGas(input []byte) uint64 {
+	return hashPrecompileBaseGas + wordGas(len(input), hashPrecompileWordGas)
+}
+
+func (sha256Precompile) Run(input []byte, _ crypto.HashAlgorithm) ([]byte, error) {
+	h := sha256.Sum256(input)
+	return h[:], nil
+}
+
+// keccak256Precompile 返回调用数据的 32 字节 Keccak-256 哈希
+type keccak256Precompile struct{}
+
+func (keccak256Precompile) RequiredGas(input []byte) uint64 {
+	return hashPrecompileBaseGas + wordGas(len(input), hashPrecompileWordGas)
+}
+
+func (keccak256Precompile) Run(input []byte, _ crypto.HashAlgorithm) ([]byte, error) {
+	return crypto.Keccak256(input), nil
+}
+
+// p256RecoverPrecompile 从 P-256 签名中恢复签名者地址
+// 输入：摘要(32) || v(32) || r(32) || s(32)，v 为 0 或 1 的字
+// 输出：左侧补 0 的 32 字节地址（按链配置的哈希算法推导）；签名不合法时返回空数据
+type p256RecoverPrecompile struct{}
+
+func (p256RecoverPrecompile) RequiredGas([]byte) uint64 { return 3000 }
+
+func (p256RecoverPrecompile) Run(input []byte, algo crypto.HashAlgorithm) ([]byte, error) {
+	if len(input) != 128 {
+		return nil, fmt.Errorf("%w: p256 recover expects 128 bytes, got %d", ErrPrecompileInput, len(input))
+	}
+
+	v := deserializeWord(input[32:64])
+	if !v.IsUint64() || v.Uint64() > 1 {
+		return []byte{}, nil
+	}
+
+	r, s := deserializeWord(input[64:96]), deserializeWord(input[96:128])
+	pub, err := crypto.RecoverPublicKey(input[:32], r, s, byte(v.Uint64()))
+	if err != nil {
+		return []byte{}, nil
+	}
+
+	return append(make([]byte, 12), pub.AddressWith(algo).ToSlice()...), nil
+}
+
+// p256VerifyPrecompile 校验 P-256 签名
+// 输入：摘要(32) || r(32) || s(32) || 压缩公钥(33)
+// 输出：签名有效时为 1，否则为 0 的字
+type p256VerifyPrecompile struct{}
+
+func (p256VerifyPrecompile) RequiredGas([]byte) uint64 { return 3000 }
+
+func (p256VerifyPrecompile) Run(input []byte, _ crypto.HashAlgorithm) ([]byte, error) {
+	if len(input) != 96+crypto.P256PublicKeyLength {
+		return nil, fmt.Errorf("%w: p256 verify expects %d bytes, got %d", ErrPrecompileInput, 96+crypto.P256PublicKeyLength, len(input))
+	}
+
+	x, y := elliptic.UnmarshalCompressed(elliptic.P256(), input[96:])
+	if x == nil {
+		return precompileWord(false), nil
+	}
+	pub := &ecdsa.PublicKey{Curve: elliptic.P256(), X: x, Y: y}
+	r, s := deserializeWord(input[32:64]), deserializeWord(input[64:96])
+
+	return precompileWord(ecdsa.Verify(pub, input[:32], r, s)), nil
+}
+
+// ed25519VerifyPrecompile 校验 Ed25519 签名
+// 输入：公钥(32) || 签名(64) || 消息
+// 输出：签名有效时为 1，否则为 0 的字
+// 校验时需要哈希整个消息，gas 随输入长度增加
+type ed25519VerifyPrecompile struct{}
+
+func (ed25519VerifyPrecompile) RequiredGas(input []byte) uint64 {
+	return 2000 + wordGas(len(input), hashPrecompileWordGas)
+}
+
+func (ed25519VerifyPrecompile) Run(input []byte, _ crypto.HashAlgorithm) ([]byte, error) {
+	prefix := ed25519.PublicKeySize + ed25519.SignatureSize
+	if len(input) < prefix {
+		return nil, fmt.Errorf("%w: ed25519 verify expects at least %d bytes, got %d", ErrPrecompileInput, prefix, len(input))
+	}
+
+	pub := ed25519.PublicKey(input[:ed25519.PublicKeySize])
+
+	return precompileWord(ed25519.Verify(pub, input[prefix:], input[ed25519.PublicKeySize:prefix])), nil
+}
+
+// merkleVerifyPrecompile 校验 MerkleRoot 规则下、以链配置的哈希算法计算的 Merkle 证明
+// 输入：根(32) || 叶子(32) || path(32) || 自底向上的兄弟节点哈希(32 × k)，path 与证明的含义见 MerkleProof
+// 输出：证明有效时为 1，否则为 0 的字
+// 每个兄弟节点需要一次哈希，gas 随证明长度增加
+type merkleVerifyPrecompile struct{}
+
+func (merkleVerifyPrecompile) RequiredGas(input []byte) uint64 {
+	return 500 + wordGas(len(input), hashPrecompileBaseGas)
+}
+
+func (merkleVerifyPrecompile) Run(input []byte, algo crypto.HashAlgorithm) ([]byte, error) {
+	if len(input) < 96 || len(input)%32 != 0 {
+		return nil, fmt.Errorf("%w: merkle verify expects 96 + 32k bytes, got %d", ErrPrecompileInput, len(input))
+	}
+
+	path := deserializeWord(input[64:96])
+	if !path.IsUint64() {
+		return precompileWord(false), nil
+	}
+
+	proof := make([]types.Hash, 0, (len(input)-96)/32)
+	for i := 96; i < len(input); i += 32 {
+		proof = append(proof, types.HashFromBytes(input[i:i+32]))
+	}
+
+	root, leaf := types.HashFromBytes(input[:32]), types.HashFromBytes(input[32:64])
+
+	return precompileWord(VerifyMerkleProof(algo, root, leaf, proof, path.Uint64())), nil
+}
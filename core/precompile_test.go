@@ -0,0 +1,223 @@
+package core
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/hex"
+	"math/big"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/felixkuang/titanchain/crypto"
+	"github.com/felixkuang/titanchain/types"
+)
+
+// concatBytes 辅助函数：依次拼接字节切片
+func concatBytes(parts ...[]byte) []byte {
+	var b []byte
+	for _, p := range parts {
+		b = append(b, p...)
+	}
+
+	return b
+}
+
+// wordOf 辅助函数：将整数编码为 32 字节的字
+func wordOf(v int64) []byte {
+	return serializeWord(big.NewInt(v))
+}
+
+func TestPrecompileHashes(t *testing.T) {
+	out, err := precompiles[PrecompileSHA256].Run([]byte("abc"), crypto.HashSHA256)
+	assert.Nil(t, err)
+	assert.Equal(t, "ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad", hex.EncodeToString(out))
+
+	out, err = precompiles[PrecompileKeccak256].Run([]byte("abc"), crypto.HashSHA256)
+	assert.Nil(t, err)
+	assert.Equal(t, "4e03657aea45a94fc7d47ba826c8d667c0d1e6e33a64a036ec44f58fa12d6c45", hex.EncodeToString(out))
+}
+
+func TestPrecompileP256(t *testing.T) {
+	privKey := crypto.GeneratePrivateKey()
+	msg := []byte("hello")
+	digest := sha256.Sum256(msg)
+	sig, err := privKey.Sign(msg)
+	assert.Nil(t, err)
+	// 自描述签名为类型标识 || R(32) || S(32)，自描述公钥为类型标识 || 压缩公钥
+	b := sig.ToSlice()
+	r, s := b[1:33], b[33:]
+	pub := privKey.PublicKey().ToSlice()[1:]
+
+	verify := precompiles[PrecompileP256Verify]
+	out, err := verify.Run(concatBytes(digest[:], r, s, pub), crypto.HashSHA256)
+	assert.Nil(t, err)
+	assert.Equal(t, wordOf(1), out)
+	out, err = verify.Run(concatBytes(make([]byte, 32), r, s, pub), crypto.HashSHA256)
+	assert.Nil(t, err)
+	assert.Equal(t, wordOf(0), out)
+	out, err = verify.Run(concatBytes(digest[:], r, s, make([]byte, 33)), crypto.HashSHA256)
+	assert.Nil(t, err)
+	assert.Equal(t, wordOf(0), out)
+	_, err = verify.Run(concatBytes(digest[:], r, s), crypto.HashSHA256)
+	assert.ErrorIs(t, err, ErrPrecompileInput)
+
+	// 两个恢复标识之一恢复出签名者地址
+	rec := precompiles[PrecompileP256Recover]
+	want := append(make([]byte, 12), privKey.PublicKey().Address().ToSlice()...)
+	found := false
+	for v := int64(0); v <= 1; v++ {
+		out, err := rec.Run(concatBytes(digest[:], wordOf(v), r, s), crypto.HashSHA256)
+		assert.Nil(t, err)
+		found = found || string(out) == string(want)
+	}
+	assert.True(t, found)
+
+	out, err = rec.Run(concatBytes(digest[:], wordOf(2), r, s), crypto.HashSHA256)
+	assert.Nil(t, err)
+	assert.Empty(t, out)
+	out, err = rec.Run(concatBytes(digest[:], wordOf(0), wordOf(0), s), crypto.HashSHA256)
+	assert.Nil(t, err)
+	assert.Empty(t, out)
+	_, err = rec.Run(digest[:], crypto.HashSHA256)
+	assert.ErrorIs(t, err, ErrPrecompileInput)
+}
+
+func TestPrecompileEd25519(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(nil)
+	assert.Nil(t, err)
+	msg := []byte("hello")
+	sig := ed25519.Sign(priv, msg)
+
+	verify := precompiles[PrecompileEd25519Verify]
+	out, err := verify.Run(concatBytes(pub, sig, msg), crypto.HashSHA256)
+	assert.Nil(t, err)
+	assert.Equal(t, wordOf(1), out)
+	out, err = verify.Run(concatBytes(pub, sig, []byte("hellO")), crypto.HashSHA256)
+	assert.Nil(t, err)
+	assert.Equal(t, wordOf(0), out)
+	_, err = verify.Run(pub, crypto.HashSHA256)
+	assert.ErrorIs(t, err, ErrPrecompileInput)
+}
+
+func TestPrecompileMerkle(t *testing.T) {
+	leaves := []types.Hash{{0x01}, {0x02}, {0x03}, {0x04}, {0x05}}
+	root := MerkleRoot(crypto.HashSHA256, leaves)
+	proof, path, err := MerkleProof(crypto.HashSHA256, leaves, 2)
+	assert.Nil(t, err)
+
+	input := concatBytes(root[:], leaves[2][:], serializeWord(new(big.Int).SetUint64(path)))
+	for _, h := range proof {
+		input = append(input, h[:]...)
+	}
+
+	verify := precompiles[PrecompileMerkleVerify]
+	out, err := verify.Run(input, crypto.HashSHA256)
+	assert.Nil(t, err)
+	assert.Equal(t, wordOf(1), out)
+
+	bad := append([]byte{}, input...)
+	bad[32] ^= 0xff
+	out, err = verify.Run(bad, crypto.HashSHA256)
+	assert.Nil(t, err)
+	assert.Equal(t, wordOf(0), out)
+
+	_, err = verify.Run(input[:len(input)-1], crypto.HashSHA256)
+	assert.ErrorIs(t, err, ErrPrecompileInput)
+}
+
+// TestPrecompileCall 测试合约通过 InstrStaticCall 调用预编译合约及其 gas 消耗
+func TestPrecompileCall(t *testing.T) {
+	assert.True(t, IsPrecompile(PrecompileSHA256))
+	assert.False(t, IsPrecompile(PrecompileAddress(0x7f)))
+
+	code := []byte{byte(InstrStaticCall), byte(InstrReturnData)}
+	vm := newVMWithStack(types.Address{0x0a}, code, NewState(), addrWord(PrecompileSHA256), big.NewInt(100000), []byte("abc"))
+	assert.Nil(t, vm.Run())
+
+	ret, err := vm.popBytes()
+	assert.Nil(t, err)
+	h := sha256.Sum256([]byte("abc"))
+	assert.Equal(t, h[:], ret)
+	ok, err := vm.popInt()
+	assert.Nil(t, err)
+	assertWord(t, big.NewInt(1), ok)
+	assert.Equal(t, GasCost(InstrStaticCall)+GasCost(InstrReturnData)+precompiles[PrecompileSHA256].RequiredGas([]byte("abc")), vm.GasUsed())
+
+	// 转发的 gas 不足时调用失败并消耗全部转发的 gas
+	vm = newVMWithStack(types.Address{0x0a}, code, NewState(), addrWord(PrecompileSHA256), big.NewInt(59), []byte("abc"))
+	assert.Nil(t, vm.Run())
+	ret, _ = vm.popBytes()
+	assert.Empty(t, ret)
+	ok, _ = vm.popInt()
+	assertWord(t, big.NewInt(0), ok)
+	assert.Equal(t, GasCost(InstrStaticCall)+GasCost(InstrReturnData)+59, vm.GasUsed())
+
+	// 输入不合法时调用失败
+	vm = newVMWithStack(types.Address{0x0a}, code[:1], NewState(), addrWord(PrecompileP256Verify), big.NewInt(100000), []byte("abc"))
+	assert.Nil(t, vm.Run())
+	ok, _ = vm.popInt()
+	assertWord(t, big.NewInt(0), ok)
+}
+
+// TestPrecompileGas 测试哈希类预编译合约按输入长度计费
+func TestPrecompileGas(t *testing.T) {
+	for _, addr := range []types.Address{PrecompileSHA256, PrecompileKeccak256} {
+		p := precompiles[addr]
+		assert.Equal(t, uint64(hashPrecompileBaseGas), p.RequiredGas(nil))
+		assert.Equal(t, uint64(hashPrecompileBaseGas+hashPrecompileWordGas), p.RequiredGas(make([]byte, 32)))
+		assert.Equal(t, uint64(hashPrecompileBaseGas+2*hashPrecompileWordGas), p.RequiredGas(make([]byte, 33)))
+	}
+	assert.Greater(t, precompiles[PrecompileEd25519Verify].RequiredGas(make([]byte, 1024)), precompiles[PrecompileEd25519Verify].RequiredGas(nil))
+	assert.Greater(t, precompiles[PrecompileMerkleVerify].RequiredGas(make([]byte, 96+32*8)), precompiles[PrecompileMerkleVerify].RequiredGas(make([]byte, 96)))
+}
+
+// TestPrecompileTransaction 测试以保留地址为目标的合约调用交易直接执行预编译合约，失败时只有收据失败
+func TestPrecompileTransaction(t *testing.T) {
+	privKey := crypto.GeneratePrivateKey()
+	sender := privKey.PublicKey().Address()
+	bc := newBlockchainWithAlloc(t, sender, 100)
+
+	hashTx := signedTx(t, privKey, &Transaction{Type: TxTypeCall, To: PrecompileSHA256, Value: 1, Data: []byte("abc")})
+	badTx := signedTx(t, privKey, &Transaction{Type: TxTypeCall, Nonce: 1, To: PrecompileP256Verify, Data: []byte("abc")})
+	assert.Nil(t, addBlockWithTxs(t, bc, hashTx, badTx))
+
+	receipt, err := bc.GetReceipt(hashTx.Hash(TxHasher{}))
+	assert.Nil(t, err)
+	assert.Equal(t, ReceiptStatusSuccessful, receipt.Status)
+	assert.Equal(t, precompiles[PrecompileSHA256].RequiredGas([]byte("abc")), receipt.GasUsed)
+	acc, err := bc.contractState.GetAccount(PrecompileSHA256)
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(1), acc.Balance)
+
+	receipt, err = bc.GetReceipt(badTx.Hash(TxHasher{}))
+	assert.Nil(t, err)
+	assert.Equal(t, ReceiptStatusFailed, receipt.Status)
+	assert.Equal(t, bc.Config().VM.GasLimit, receipt.GasUsed)
+
+	res, err := bc.Call(&CallMsg{From: sender, To: PrecompileSHA256, Data: []byte("abc")}, bc.Height())
+	assert.Nil(t, err)
+	h := sha256.Sum256([]byte("abc"))
+	assert.Equal(t, h[:], res.ReturnData)
+}
+
+func TestRegisterPrecompile(t *testing.T) {
+	addr := PrecompileAddress(0x7f)
+	RegisterPrecompile(addr, sha256Precompile{})
+	defer delete(precompiles, addr)
+
+	assert.True(t, IsPrecompile(addr))
+
+	// 注册可以与合约执行并发进行（配合 -race 检查）
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			RegisterPrecompile(addr, sha256Precompile{})
+		}
+	}()
+	for i := 0; i < 100; i++ {
+		assert.True(t, IsPrecompile(PrecompileSHA256))
+	}
+	<-done
+}
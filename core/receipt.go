@@ -0,0 +1,135 @@
+package core
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+
+	"github.com/felixkuang/titanchain/crypto"
+	"github.com/felixkuang/titanchain/types"
+)
+
+// ReceiptStatus 表示交易执行的结果
+type ReceiptStatus uint8
+
+const (
+	// ReceiptStatusFailed 表示合约执行失败，执行产生的状态修改已被撤销
+	ReceiptStatusFailed ReceiptStatus = 0
+	// ReceiptStatusSuccessful 表示交易执行成功
+	ReceiptStatusSuccessful ReceiptStatus = 1
+)
+
+// Log 表示合约执行时通过 InstrLog 指令发出的事件
+type Log struct {
+	Address types.Address // 发出事件的合约地址
+	Topics  []types.Hash  // 事件主题，用于过滤
+	Data    []byte        // 事件数据
+
+	// 以下字段在区块执行后填充，不参与收据哈希
+	BlockHeight uint32     // 所在区块高度
+	TxHash      types.Hash // 所在交易ID
+	TxIndex     uint32     // 所在交易在区块中的序号
+	Index       uint32     // 在区块内所有日志中的序号
+}
+
+// Receipt 表示一笔已上链交易的执行收据
+type Receipt struct {
+	Status          ReceiptStatus // 执行结果
+	GasUsed         uint64        // 执行消耗的 gas
+	Logs            []*Log        // 执行产生的日志，执行失败时为空
+	ContractAddress types.Address // 部署交易创建的合约地址，其他交易为零地址
+
+	// 以下字段在区块执行后填充，不参与收据哈希
+	TxHash      types.Hash // 交易ID
+	BlockHeight uint32     // 所在区块高度
+	TxIndex     uint32     // 交易在区块中的序号
+}
+
+// Bytes 返回收据的规范化编码，只包含执行结果相关的字段
+// 格式：状态 || gas || 合约地址 || 日志数量 || 每条日志（地址 || 主题数量 || 主题 || 数据长度 || 数据），整数均为大端
+func (r *Receipt) Bytes() []byte {
+	buf := &bytes.Buffer{}
+	buf.WriteByte(byte(r.Status))
+	binary.Write(buf, binary.BigEndian, r.GasUsed)
+	buf.Write(r.ContractAddress.ToSlice())
+
+	binary.Write(buf, binary.BigEndian, uint32(len(r.Logs)))
+	for _, l := range r.Logs {
+		buf.Write(l.Address.ToSlice())
+		binary.Write(buf, binary.BigEndian, uint32(len(l.Topics)))
+		for _, topic := range l.Topics {
+			buf.Write(topic.ToSlice())
+		}
+		writeBytes(buf, l.Data)
+	}
+
+	return buf.Bytes()
+}
+
+// Hash 返回收据以 algo 计算的哈希
+func (r *Receipt) Hash(algo crypto.HashAlgorithm) types.Hash {
+	return algo.Sum(r.Bytes())
+}
+
+// ReceiptsRoot 计算收据列表的 Merkle 根，收据顺序与区块中的交易顺序一致
+// algo 为链配置的哈希算法
+func ReceiptsRoot(algo crypto.HashAlgorithm, receipts []*Receipt) types.Hash {
+	leaves := make([]types.Hash, len(receipts))
+	for i, r := range receipts {
+		leaves[i] = r.Hash(algo)
+	}
+
+	return MerkleRoot(algo, leaves)
+}
+
+// MaxLogBlockRange 是一次日志查询最多覆盖的区块数
+const MaxLogBlockRange = 10000
+
+// ErrLogRangeTooLarge 表示日志查询的区块范围超过 MaxLogBlockRange
+var ErrLogRangeTooLarge = errors.New("log block range too large")
+
+// LogFilter 描述日志的过滤条件
+// 地址为空表示不限地址；Topics[i] 为空表示第 i 个主题不限，否则日志的第 i 个主题必须是其中之一
+type LogFilter struct {
+	FromHeight uint32          // 起始区块高度（含）
+	ToHeight   uint32          // 结束区块高度（含）
+	Addresses  []types.Address // 合约地址
+	Topics     [][]types.Hash  // 按位置匹配的主题
+}
+
+// Match 判断日志是否满足过滤条件（不检查区块范围）
+func (f *LogFilter) Match(l *Log) bool {
+	if len(f.Addresses) > 0 {
+		found := false
+		for _, addr := range f.Addresses {
+			if addr == l.Address {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+
+	if len(f.Topics) > len(l.Topics) {
+		return false
+	}
+	for i, options := range f.Topics {
+		if len(options) == 0 {
+			continue
+		}
+		found := false
+		for _, topic := range options {
+			if topic == l.Topics[i] {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,68 @@
+package core
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/felixkuang/titanchain/crypto"
+	"github.com/felixkuang/titanchain/types"
+)
+
+// TestReceiptHash 测试收据哈希只覆盖执行结果字段
+func TestReceiptHash(t *testing.T) {
+	r := &Receipt{
+		Status:  ReceiptStatusSuccessful,
+		GasUsed: 10,
+		Logs:    []*Log{{Address: types.Address{0x01}, Topics: []types.Hash{{0x02}}, Data: []byte("data")}},
+	}
+	h := r.Hash(crypto.HashSHA256)
+
+	// 区块信息不影响哈希
+	r.TxHash = types.Hash{0x03}
+	r.BlockHeight = 5
+	r.Logs[0].Index = 7
+	assert.Equal(t, h, r.Hash(crypto.HashSHA256))
+
+	// 执行结果影响哈希
+	r.Status = ReceiptStatusFailed
+	assert.NotEqual(t, h, r.Hash(crypto.HashSHA256))
+	r.Status = ReceiptStatusSuccessful
+	r.Logs[0].Data = []byte("other")
+	assert.NotEqual(t, h, r.Hash(crypto.HashSHA256))
+}
+
+// TestReceiptsRoot 测试收据根与收据顺序相关
+func TestReceiptsRoot(t *testing.T) {
+	a := &Receipt{Status: ReceiptStatusSuccessful, GasUsed: 1}
+	b := &Receipt{Status: ReceiptStatusFailed, GasUsed: 2}
+
+	assert.Equal(t, MerkleRoot(crypto.HashSHA256, nil), ReceiptsRoot(crypto.HashSHA256, nil))
+	assert.Equal(t, ReceiptsRoot(crypto.HashSHA256, []*Receipt{a, b}), ReceiptsRoot(crypto.HashSHA256, []*Receipt{a, b}))
+	assert.NotEqual(t, ReceiptsRoot(crypto.HashSHA256, []*Receipt{a, b}), ReceiptsRoot(crypto.HashSHA256, []*Receipt{b, a}))
+}
+
+// TestLogFilterMatch 测试按地址与主题过滤日志
+func TestLogFilterMatch(t *testing.T) {
+	l := &Log{Address: types.Address{0x01}, Topics: []types.Hash{{0x0a}, {0x0b}}}
+
+	cases := []struct {
+		name   string
+		filter LogFilter
+		match  bool
+	}{
+		{"empty", LogFilter{}, true},
+		{"address", LogFilter{Addresses: []types.Address{{0x02}, {0x01}}}, true},
+		{"wrong address", LogFilter{Addresses: []types.Address{{0x02}}}, false},
+		{"first topic", LogFilter{Topics: [][]types.Hash{{{0x0a}}}}, true},
+		{"wildcard first topic", LogFilter{Topics: [][]types.Hash{nil, {{0x0c}, {0x0b}}}}, true},
+		{"wrong second topic", LogFilter{Topics: [][]types.Hash{nil, {{0x0c}}}}, false},
+		{"too many topics", LogFilter{Topics: [][]types.Hash{nil, nil, nil}}, false},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			assert.Equal(t, c.match, c.filter.Match(l))
+		})
+	}
+}
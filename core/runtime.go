@@ -0,0 +1,36 @@
+package core
+
+// contractRuntime 是合约运行时的统一接口，栈式虚拟机 VM 与 WASMVM 都实现该接口
+type contractRuntime interface {
+	// Run 执行合约代码
+	Run() error
+	// ReturnData 返回执行给出的返回数据
+	ReturnData() []byte
+	// Logs 返回执行发出的事件
+	Logs() []*Log
+	// GasUsed 返回已消耗的 gas
+	GasUsed() uint64
+	// SetTracer 设置执行追踪钩子
+	SetTracer(t Tracer)
+	// setFrame 设置外部调用深度与是否为只读调用
+	setFrame(depth int, static bool)
+}
+
+// newRuntime 按合约账户的 VMType 创建执行代码的运行时
+func newRuntime(vmType VMType, ctx ExecContext, code []byte, contractState *State, config VMConfig) contractRuntime {
+	if vmType == VMTypeWASM {
+		return NewWASMVM(ctx, code, contractState, config)
+	}
+
+	return NewContractVM(ctx, code, contractState, config)
+}
+
+// ValidateContract 在部署前校验合约代码
+// WASM 模块由 ValidateWASM 校验，其余代码作为栈式字节码由 ValidateCode 校验
+func ValidateContract(code []byte, config VMConfig) error {
+	if CodeVMType(code) == VMTypeWASM {
+		return ValidateWASM(code)
+	}
+
+	return ValidateCode(code, config)
+}
@@ -0,0 +1,65 @@
+package core
+
+import (
+	"fmt"
+
+	"github.com/felixkuang/titanchain/types"
+)
+
+// StakeOp 表示质押交易的操作类型，位于交易 Data 的首字节
+type StakeOp byte
+
+const (
+	// StakeOpStake 将 Value 从余额转入质押
+	StakeOpStake StakeOp = 0x01
+	// StakeOpUnstake 将 Value 从质押转回余额
+	StakeOpUnstake StakeOp = 0x02
+)
+
+// stakeTxHandler 处理质押操作交易
+type stakeTxHandler struct{}
+
+func (stakeTxHandler) Validate(tx *Transaction, config *ChainConfig) error {
+	if len(tx.Data) != 1 {
+		return fmt.Errorf("stake transaction data must be a single operation byte")
+	}
+
+	switch StakeOp(tx.Data[0]) {
+	case StakeOpStake, StakeOpUnstake:
+	default:
+		return fmt.Errorf("unknown stake operation (%d)", tx.Data[0])
+	}
+
+	if tx.To != (types.Address{}) {
+		return fmt.Errorf("stake transaction must not have a recipient")
+	}
+	if tx.Value == 0 {
+		return fmt.Errorf("stake transaction has zero value")
+	}
+
+	return nil
+}
+
+func (stakeTxHandler) Execute(ctx *TxContext, tx *Transaction) error {
+	acc, err := ctx.State.GetAccount(ctx.Sender)
+	if err != nil {
+		return err
+	}
+
+	switch StakeOp(tx.Data[0]) {
+	case StakeOpStake:
+		if acc.Balance < tx.Value {
+			return fmt.Errorf("insufficient balance of (%s) to stake (%d)", ctx.Sender, tx.Value)
+		}
+		acc.Balance -= tx.Value
+		acc.Staked += tx.Value
+	case StakeOpUnstake:
+		if acc.Staked < tx.Value {
+			return fmt.Errorf("insufficient stake of (%s) to unstake (%d)", ctx.Sender, tx.Value)
+		}
+		acc.Staked -= tx.Value
+		acc.Balance += tx.Value
+	}
+
+	return ctx.State.PutAccount(ctx.Sender, acc)
+}
@@ -3,8 +3,17 @@ package core
 import "fmt"
 
 // State 表示区块链的简单状态存储，采用内存中的键值对映射实现。
+// 每次修改都会记入日志，可以通过快照回滚到之前的状态。
 type State struct {
-	data map[string][]byte // 存储状态数据的 map，key 为字符串，value 为字节切片
+	data    map[string][]byte // 存储状态数据的 map，key 为字符串，value 为字节切片
+	journal []journalEntry    // 自上次 Commit 以来的修改日志
+}
+
+// journalEntry 记录一次修改之前的键值，用于回滚
+type journalEntry struct {
+	key     string // 被修改的键
+	prev    []byte // 修改前的值
+	existed bool   // 修改前键是否存在
 }
 
 // NewState 创建一个新的状态存储实例。
@@ -19,6 +28,7 @@ func NewState() *State {
 // k: 键（字节切片），v: 值（字节切片）。
 // 返回 error：写入过程中遇到的错误，正常返回 nil。
 func (s *State) Put(k, v []byte) error {
+	s.record(string(k))
 	s.data[string(k)] = v
 
 	return nil
@@ -28,6 +38,7 @@ func (s *State) Put(k, v []byte) error {
 // k: 待删除的键（字节切片）。
 // 返回 error：删除过程中遇到的错误，正常返回 nil。
 func (s *State) Delete(k []byte) error {
+	s.record(string(k))
 	delete(s.data, string(k))
 
 	return nil
@@ -46,3 +57,45 @@ func (s *State) Get(k []byte) ([]byte, error) {
 
 	return value, nil
 }
+
+// record 在修改键之前记录其原值
+func (s *State) record(key string) {
+	prev, existed := s.data[key]
+	s.journal = append(s.journal, journalEntry{key: key, prev: prev, existed: existed})
+}
+
+// Snapshot 返回当前状态的快照标识，可传给 RevertToSnapshot 撤销之后的所有修改。
+// 快照可以嵌套，回滚外层快照会同时撤销内层快照之后的修改。
+func (s *State) Snapshot() int {
+	return len(s.journal)
+}
+
+// RevertToSnapshot 撤销快照 id 之后的所有修改。
+// id: Snapshot 返回的快照标识，Commit 之后之前的快照全部失效。
+func (s *State) RevertToSnapshot(id int) {
+	for i := len(s.journal) - 1; i >= id; i-- {
+		e := s.journal[i]
+		if e.existed {
+			s.data[e.key] = e.prev
+		} else {
+			delete(s.data, e.key)
+		}
+	}
+	s.journal = s.journal[:id]
+}
+
+// Copy 返回当前状态的独立副本，对副本的修改不影响原状态。
+// 副本不包含修改日志，即不能回滚到原状态的快照。
+func (s *State) Copy() *State {
+	data := make(map[string][]byte, len(s.data))
+	for k, v := range s.data {
+		data[k] = v
+	}
+
+	return &State{data: data}
+}
+
+// Commit 确认所有修改并清空日志，之后无法再回滚到之前的快照。
+func (s *State) Commit() {
+	s.journal = nil
+}
@@ -44,3 +44,40 @@ func TestState_Overwrite(t *testing.T) {
 	assert.Nil(t, err)
 	assert.Equal(t, v2, got)
 }
+
+// TestState_Snapshot 测试嵌套快照的回滚与提交。
+func TestState_Snapshot(t *testing.T) {
+	state := NewState()
+	assert.Nil(t, state.Put([]byte("a"), []byte("1")))
+
+	outer := state.Snapshot()
+	assert.Nil(t, state.Put([]byte("a"), []byte("2")))
+	assert.Nil(t, state.Put([]byte("b"), []byte("1")))
+
+	inner := state.Snapshot()
+	assert.Nil(t, state.Delete([]byte("a")))
+	assert.Nil(t, state.Put([]byte("c"), []byte("1")))
+
+	// 回滚内层快照
+	state.RevertToSnapshot(inner)
+	got, err := state.Get([]byte("a"))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("2"), got)
+	_, err = state.Get([]byte("c"))
+	assert.NotNil(t, err)
+
+	// 回滚外层快照
+	state.RevertToSnapshot(outer)
+	got, err = state.Get([]byte("a"))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("1"), got)
+	_, err = state.Get([]byte("b"))
+	assert.NotNil(t, err)
+
+	// 提交后的修改不再被回滚
+	assert.Nil(t, state.Put([]byte("d"), []byte("1")))
+	state.Commit()
+	state.RevertToSnapshot(state.Snapshot())
+	_, err = state.Get([]byte("d"))
+	assert.Nil(t, err)
+}
@@ -1,24 +1,52 @@
 package core
 
+import (
+	"fmt"
+	"sync"
+)
+
 // Storage 定义了区块存储的接口
 type Storage interface {
 	// Put 将区块保存到存储中
 	// 返回存储过程中可能发生的错误
 	Put(*Block) error
+	// Get 根据高度读取区块
+	// 区块不存在时返回错误
+	Get(height uint32) (*Block, error)
 }
 
 // MemoryStore 实现了基于内存的区块存储
 type MemoryStore struct {
-	// 目前是一个简单的实现，后续会添加实际的存储字段
+	lock   sync.RWMutex
+	blocks map[uint32]*Block // 按高度保存的区块
 }
 
 // NewMemorystore 创建一个新的内存存储实例
 func NewMemorystore() *MemoryStore {
-	return &MemoryStore{}
+	return &MemoryStore{
+		blocks: make(map[uint32]*Block),
+	}
 }
 
-// Put 将区块保存到内存存储中
-// 目前是一个空实现，后续会添加实际的存储逻辑
+// Put 将区块保存到内存存储中，同一高度的区块会被覆盖
 func (s *MemoryStore) Put(b *Block) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.blocks[b.Height] = b
+
 	return nil
 }
+
+// Get 根据高度从内存存储中读取区块
+func (s *MemoryStore) Get(height uint32) (*Block, error) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	b, ok := s.blocks[height]
+	if !ok {
+		return nil, fmt.Errorf("block with height (%d) not found", height)
+	}
+
+	return b, nil
+}
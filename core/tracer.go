@@ -0,0 +1,127 @@
+package core
+
+import (
+	"encoding/hex"
+	"fmt"
+	"math/big"
+
+	"github.com/felixkuang/titanchain/types"
+)
+
+// Tracer 定义了观察虚拟机执行过程的钩子
+// 嵌套调用的被调用方沿用调用者的 Tracer，通过 depth 区分执行帧
+type Tracer interface {
+	// CaptureState 在每条指令扣除 gas 并执行之前调用
+	// stack 是操作数栈的快照，按 Stack.data 中的顺序排列
+	CaptureState(ip int, op Instruction, gas, cost uint64, stack []any, depth int)
+	// CaptureStorage 在当前指令写入或删除合约存储时调用，删除时 value 为 nil
+	CaptureStorage(addr types.Address, key, value []byte)
+	// CaptureEnd 在一个执行帧结束时调用
+	CaptureEnd(depth int, output []byte, gasUsed uint64, err error)
+}
+
+// StructLog 是结构化追踪中的一条指令记录
+type StructLog struct {
+	IP      int               `json:"ip"`
+	Op      string            `json:"op"`
+	Gas     uint64            `json:"gas"`     // 执行前的剩余 gas
+	GasCost uint64            `json:"gasCost"` // 指令本身的 gas 消耗
+	Depth   int               `json:"depth"`
+	Stack   []string          `json:"stack"`
+	Storage map[string]string `json:"storage,omitempty"` // 该指令写入的存储键值，删除的键对应空字符串
+	Error   string            `json:"error,omitempty"`
+}
+
+// ExecutionTrace 是一次交易执行的结构化追踪结果
+type ExecutionTrace struct {
+	Failed      bool         `json:"failed"`
+	GasUsed     uint64       `json:"gasUsed"`
+	ReturnValue string       `json:"returnValue"` // 十六进制编码的返回数据
+	StructLogs  []*StructLog `json:"structLogs"`
+}
+
+// StructLogger 是记录每条指令的 Tracer，结果可直接编码为 JSON
+type StructLogger struct {
+	logs   []*StructLog
+	result ExecutionTrace
+}
+
+// NewStructLogger 创建一个结构化追踪记录器
+func NewStructLogger() *StructLogger {
+	return &StructLogger{
+		logs: []*StructLog{},
+	}
+}
+
+// CaptureState 记录一条指令及执行前的栈
+func (l *StructLogger) CaptureState(ip int, op Instruction, gas, cost uint64, stack []any, depth int) {
+	items := make([]string, len(stack))
+	for i, v := range stack {
+		items[i] = formatStackItem(v)
+	}
+
+	l.logs = append(l.logs, &StructLog{
+		IP:      ip,
+		Op:      op.String(),
+		Gas:     gas,
+		GasCost: cost,
+		Depth:   depth,
+		Stack:   items,
+	})
+}
+
+// CaptureStorage 将存储写入记录到最近一条指令上
+func (l *StructLogger) CaptureStorage(addr types.Address, key, value []byte) {
+	if len(l.logs) == 0 {
+		return
+	}
+
+	last := l.logs[len(l.logs)-1]
+	if last.Storage == nil {
+		last.Storage = make(map[string]string)
+	}
+	last.Storage[hex.EncodeToString(key)] = hex.EncodeToString(value)
+}
+
+// CaptureEnd 记录执行帧的错误；最外层帧结束时记录整体结果
+func (l *StructLogger) CaptureEnd(depth int, output []byte, gasUsed uint64, err error) {
+	if err != nil && len(l.logs) > 0 {
+		if last := l.logs[len(l.logs)-1]; last.Error == "" {
+			last.Error = err.Error()
+		}
+	}
+
+	if depth == 0 {
+		l.result.Failed = err != nil
+		l.result.GasUsed = gasUsed
+		l.result.ReturnValue = hex.EncodeToString(output)
+	}
+}
+
+// StructLogs 返回已记录的指令
+func (l *StructLogger) StructLogs() []*StructLog {
+	return l.logs
+}
+
+// Result 返回完整的追踪结果
+func (l *StructLogger) Result() *ExecutionTrace {
+	res := l.result
+	res.StructLogs = l.logs
+
+	return &res
+}
+
+// formatStackItem 将栈上的值格式化为字符串
+// 整数为 0x 开头的十六进制，单字节与字节切片分别写作 byte(0x..) 与 bytes(0x..)
+func formatStackItem(v any) string {
+	switch v := v.(type) {
+	case *big.Int:
+		return "0x" + v.Text(16)
+	case byte:
+		return fmt.Sprintf("byte(0x%02x)", v)
+	case []byte:
+		return fmt.Sprintf("bytes(0x%s)", hex.EncodeToString(v))
+	default:
+		return fmt.Sprintf("%v", v)
+	}
+}
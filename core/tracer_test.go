@@ -0,0 +1,134 @@
+package core
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"math/big"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/felixkuang/titanchain/crypto"
+	"github.com/felixkuang/titanchain/types"
+)
+
+// counterCode 返回将调用数据作为存储键、对其中的计数加 1 的字节码
+func counterCode() []byte {
+	return []byte{
+		byte(InstrCallData), byte(InstrLoad),
+		1, byte(InstrPushInt), byte(InstrAdd),
+		byte(InstrCallData), byte(InstrSwap), byte(InstrStore),
+	}
+}
+
+func TestStructLogger(t *testing.T) {
+	ctx := ExecContext{Address: types.Address{0x01}, Input: []byte("c")}
+	vm := NewContractVM(ctx, counterCode(), NewState(), DefaultChainConfig().VM)
+	tracer := NewStructLogger()
+	vm.SetTracer(tracer)
+	assert.Nil(t, vm.Run())
+
+	logs := tracer.StructLogs()
+	ops := make([]string, len(logs))
+	for i, l := range logs {
+		ops[i] = l.Op
+	}
+	assert.Equal(t, []string{"CALLDATA", "LOAD", "PUSHINT", "ADD", "CALLDATA", "SWAP", "STORE"}, ops)
+
+	// 每条记录的 gas 为执行前的剩余 gas
+	assert.Equal(t, vm.gasLimit, logs[0].Gas)
+	assert.Equal(t, logs[0].Gas-logs[0].GasCost, logs[1].Gas)
+	assert.Equal(t, 3, logs[2].IP)
+	assert.Equal(t, []string{"0x0", "0x1"}, logs[3].Stack)
+	assert.Equal(t, []string{"0x1", "bytes(0x63)"}, logs[5].Stack)
+
+	// 存储写入记录在 STORE 上
+	value := hex.EncodeToString(append([]byte{storageTagWord}, serializeWord(big.NewInt(1))...))
+	assert.Equal(t, map[string]string{"63": value}, logs[6].Storage)
+	assert.Nil(t, logs[5].Storage)
+
+	res := tracer.Result()
+	assert.False(t, res.Failed)
+	assert.Equal(t, vm.GasUsed(), res.GasUsed)
+
+	b, err := json.Marshal(res)
+	assert.Nil(t, err)
+	assert.Contains(t, string(b), `"op":"STORE"`)
+}
+
+func TestStructLoggerError(t *testing.T) {
+	vm := NewVM([]byte{1, byte(InstrPushInt), byte(InstrRevert)}, NewState())
+	tracer := NewStructLogger()
+	vm.SetTracer(tracer)
+	assert.ErrorIs(t, vm.Run(), ErrExecutionReverted)
+
+	res := tracer.Result()
+	assert.True(t, res.Failed)
+	assert.Equal(t, 2, len(res.StructLogs))
+	assert.Equal(t, ErrExecutionReverted.Error(), res.StructLogs[1].Error)
+}
+
+func TestStructLoggerNestedCall(t *testing.T) {
+	code := append(storeCallValue(), 42, byte(InstrPushInt), byte(InstrReturn))
+	state, caller, callee := setupCall(t, code)
+
+	vm := newVMWithStack(caller, []byte{byte(InstrCall), byte(InstrPop)}, state,
+		addrWord(callee), big.NewInt(10), big.NewInt(100000), []byte("in"))
+	tracer := NewStructLogger()
+	vm.SetTracer(tracer)
+	assert.Nil(t, vm.Run())
+
+	depths := []int{}
+	for _, l := range tracer.StructLogs() {
+		depths = append(depths, l.Depth)
+	}
+	assert.Equal(t, []int{0, 1, 1, 1, 1, 1, 1, 1, 0}, depths)
+
+	// 只有最外层帧的结束决定整体结果
+	res := tracer.Result()
+	assert.False(t, res.Failed)
+	assert.Equal(t, vm.GasUsed(), res.GasUsed)
+	assert.Equal(t, "", res.ReturnValue)
+}
+
+func TestTraceTransaction(t *testing.T) {
+	privKey := crypto.GeneratePrivateKey()
+	sender := privKey.PublicKey().Address()
+	bc := newBlockchainWithAlloc(t, sender, 100)
+
+	deploy := signedTx(t, privKey, &Transaction{Type: TxTypeDeploy, Data: counterCode()})
+	assert.Nil(t, addBlockWithTxs(t, bc, deploy))
+	addr := ContractAddress(crypto.HashSHA256, sender, 0)
+
+	call := func(nonce uint64) *Transaction {
+		return signedTx(t, privKey, &Transaction{Type: TxTypeCall, Nonce: nonce, To: addr, Data: []byte("c")})
+	}
+	first, second, third := call(1), call(2), call(3)
+	assert.Nil(t, addBlockWithTxs(t, bc, first))
+	assert.Nil(t, addBlockWithTxs(t, bc, second, third))
+
+	// 第三笔调用在父状态与同一区块中前一笔调用之后执行，读到的计数为 2
+	tracer := NewStructLogger()
+	receipt, err := bc.TraceTransaction(third.Hash(TxHasher{}), tracer)
+	assert.Nil(t, err)
+
+	stored, err := bc.GetReceipt(third.Hash(TxHasher{}))
+	assert.Nil(t, err)
+	assert.Equal(t, stored.Hash(crypto.HashSHA256), receipt.Hash(crypto.HashSHA256))
+
+	logs := tracer.StructLogs()
+	assert.Equal(t, []string{"0x2"}, logs[2].Stack)
+	value := hex.EncodeToString(append([]byte{storageTagWord}, serializeWord(big.NewInt(3))...))
+	assert.Equal(t, map[string]string{"63": value}, logs[len(logs)-1].Storage)
+	assert.Equal(t, stored.GasUsed, tracer.Result().GasUsed)
+
+	// 重新执行不影响当前状态
+	b, err := bc.contractState.GetStorage(addr, []byte("c"))
+	assert.Nil(t, err)
+	v, err := decodeStorageValue(b)
+	assert.Nil(t, err)
+	assertWord(t, big.NewInt(3), v.(*big.Int))
+
+	_, err = bc.TraceTransaction(types.Hash{0x01}, NewStructLogger())
+	assert.NotNil(t, err)
+}
@@ -2,6 +2,9 @@
 package core
 
 import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
 	"fmt"
 
 	"github.com/felixkuang/titanchain/types"
@@ -9,14 +12,71 @@ import (
 	"github.com/felixkuang/titanchain/crypto"
 )
 
+// txSigningDomain 是交易签名载荷的域分隔前缀
+// 保证交易签名不会与其他类型数据（如区块头）的签名混淆
+const txSigningDomain = "TitanChain Signed Transaction:\n"
+
+// TxType 表示交易类型，作为交易信封的版本标识
+// 不同类型的交易拥有各自的校验与执行逻辑
+type TxType byte
+
+const (
+	// TxTypeLegacy 原始交易，直接将 Data 作为字节码执行
+	// 未携带类型字段的旧编码解码后即为该类型
+	TxTypeLegacy TxType = 0x00
+	// TxTypeTransfer 转账交易，将 Value 从发起者转给 To
+	TxTypeTransfer TxType = 0x01
+	// TxTypeDeploy 合约部署交易，Data 为合约字节码
+	TxTypeDeploy TxType = 0x02
+	// TxTypeCall 合约调用交易，执行 To 地址上的合约
+	TxTypeCall TxType = 0x03
+	// TxTypeStake 质押操作交易，Data 首字节为质押操作
+	TxTypeStake TxType = 0x04
+	// TxTypeGovernance 治理交易，Data 首字节为治理操作
+	TxTypeGovernance TxType = 0x05
+)
+
+// String 返回交易类型的可读名称
+func (t TxType) String() string {
+	switch t {
+	case TxTypeLegacy:
+		return "legacy"
+	case TxTypeTransfer:
+		return "transfer"
+	case TxTypeDeploy:
+		return "deploy"
+	case TxTypeCall:
+		return "call"
+	case TxTypeStake:
+		return "stake"
+	case TxTypeGovernance:
+		return "governance"
+	default:
+		return fmt.Sprintf("unknown(%d)", byte(t))
+	}
+}
+
 // Transaction 表示区块链中的一个交易
-// 包含原始数据、发起者公钥、签名、哈希
+// 包含类型、链ID、序号、接收方、金额、原始数据、发起者公钥、签名
 // 支持签名、哈希、验证、序列化等操作
+// 交易ID与发起者公钥会被缓存，缓存以计算时规范化编码的摘要为键，
+// 字段被直接修改后摘要不再匹配，下次访问时重新计算
 type Transaction struct {
-	Data      []byte            // 交易的原始数据
-	From      []byte            // 交易发起者的公钥
-	Signature *crypto.Signature // 交易的数字签名
-	hash      types.Hash        // 交易哈希缓存
+	Type       TxType        // 交易类型
+	ChainID    uint64        // 交易所属的链ID，防止跨链重放
+	Nonce      uint64        // 发起者的交易序号，防止同链重放
+	To         types.Address // 接收方地址（转账、合约调用）
+	Value      uint64        // 转移的金额
+	ValidAfter uint32        // 交易仅能被打包进高度大于该值的区块，0 表示不限制
+	ValidUntil uint32        // 交易仅能被打包进高度不超过该值的区块，0 表示不限制
+	Data       []byte        // 交易的原始数据
+	From       []byte        // 交易发起者的自描述公钥（类型标识 || 公钥），签名可恢复公钥时为空或与恢复出的公钥相同
+	Signature  []byte        // 交易的自描述签名（类型标识 || 签名）
+
+	cacheKey types.Hash           // 计算缓存时规范化编码 Bytes() 的 SHA256 摘要，覆盖签名载荷、发起者公钥与签名
+	hash     types.Hash           // 缓存的交易ID
+	hashedBy Hasher[*Transaction] // 计算缓存交易ID所用的哈希器，哈希器不同时重新计算
+	from     crypto.PublicKey     // 缓存的发起者公钥
 }
 
 // NewTransaction 创建一个新的交易实例
@@ -27,50 +87,206 @@ func NewTransaction(data []byte) *Transaction {
 	}
 }
 
+// SigningPayload 返回交易的签名载荷
+// 载荷由域分隔前缀、交易类型、链ID、序号以及全部交易字段按固定顺序编码而成，
+// 发起者公钥与签名本身不在载荷之内
+func (tx *Transaction) SigningPayload() []byte {
+	buf := &bytes.Buffer{}
+	buf.WriteString(txSigningDomain)
+	buf.WriteByte(byte(tx.Type))
+	binary.Write(buf, binary.BigEndian, tx.ChainID)
+	binary.Write(buf, binary.BigEndian, tx.Nonce)
+	buf.Write(tx.To[:])
+	binary.Write(buf, binary.BigEndian, tx.Value)
+	binary.Write(buf, binary.BigEndian, tx.ValidAfter)
+	binary.Write(buf, binary.BigEndian, tx.ValidUntil)
+	writeBytes(buf, tx.Data)
+
+	return buf.Bytes()
+}
+
+// SigningHash 返回签名载荷的 SHA256 哈希
+// 同一笔交易无论由谁签名、签名多少次，签名哈希都保持不变
+// 无论链配置何种哈希算法都固定使用 SHA256：各类密钥签名时按自身的算法对载荷求摘要，
+// 签名哈希不参与签名与验签，只作为与链配置无关的稳定标识；交易ID请使用 ChainConfig.TxHasher
+func (tx *Transaction) SigningHash() types.Hash {
+	return sha256.Sum256(tx.SigningPayload())
+}
+
+// Bytes 返回交易的规范化编码
+// 在签名载荷之后依次追加发起者公钥与签名，覆盖交易的全部字段，
+// 用于计算交易ID
+// 签名可以恢复公钥时发起者由签名决定，From 不参与编码，携带与否不改变交易ID
+func (tx *Transaction) Bytes() []byte {
+	buf := bytes.NewBuffer(tx.SigningPayload())
+	if tx.recoverable() {
+		writeBytes(buf, nil)
+	} else {
+		writeBytes(buf, tx.From)
+	}
+	writeBytes(buf, tx.Signature)
+
+	return buf.Bytes()
+}
+
 // Sign 使用给定的私钥对交易进行签名
 // privKey: 用于签名的私钥
+// 签名对象为 SigningPayload 的哈希
+// 签名附带恢复标识（secp256k1）时不再携带发起者公钥，由签名恢复
 // 返回签名过程中可能发生的错误
 func (tx *Transaction) Sign(privKey crypto.PrivateKey) error {
-	sig, err := privKey.Sign(tx.Data)
+	sig, err := privKey.Sign(tx.SigningPayload())
 	if err != nil {
 		return err
 	}
 
-	tx.From = privKey.PublicKey().ToSlice()
-	tx.Signature = sig
+	tx.From = nil
+	if !crypto.IsRecoverable(sig) {
+		tx.From = privKey.PublicKey().ToSlice()
+	}
+	tx.Signature = sig.ToSlice()
 
 	return nil
 }
 
-// Hash 计算并返回交易的哈希值（带缓存）
-// hasher: 哈希器实例
+// Hash 计算并返回交易的哈希值，即交易ID
+// hasher: 哈希器实例，需与链配置的哈希算法一致（见 ChainConfig.TxHasher）
+// 字段未被修改且哈希器相同时返回缓存的值
 func (tx *Transaction) Hash(hasher Hasher[*Transaction]) types.Hash {
-	if tx.hash.IsZero() {
+	if !tx.cacheValid() || tx.hashedBy != hasher {
 		tx.hash = hasher.Hash(tx)
+		tx.hashedBy = hasher
 	}
+
 	return tx.hash
 }
 
 // Verify 验证交易的签名是否有效
-// 检查交易是否包含签名，以及签名是否与公钥和数据匹配
+// 检查交易是否包含签名、签名是否为规范形式，以及签名是否与公钥和数据匹配
 // 返回验证过程中可能发生的错误
 func (tx *Transaction) Verify() error {
-	if tx.Signature == nil {
+	if len(tx.Signature) == 0 {
 		return fmt.Errorf("transaction has no signature")
 	}
 
+	sig, err := crypto.ToSignature(tx.Signature)
+	if err != nil {
+		return err
+	}
+	// 拒绝延展后的签名，保证同一笔交易只有一种合法的签名编码
+	if err := sig.Validate(); err != nil {
+		return fmt.Errorf("transaction signature: %w", err)
+	}
+
+	// 签名可以恢复公钥或未携带公钥时，能从签名中恢复出公钥即说明签名有效；
+	// 同时携带的 From 必须与恢复出的公钥相同，否则翻转恢复标识后的签名也能通过 From 的验证
+	if len(tx.From) == 0 || crypto.IsRecoverable(sig) {
+		signer, err := crypto.RecoverSigner(tx.SigningPayload(), sig)
+		if err != nil {
+			return fmt.Errorf("invalid transaction signature: %w", err)
+		}
+		if len(tx.From) != 0 && !bytes.Equal(tx.From, signer.ToSlice()) {
+			return fmt.Errorf("transaction sender does not match the key recovered from the signature")
+		}
+		return nil
+	}
+
 	publicKey, err := crypto.ToPublicKey(tx.From)
 	if err != nil {
 		return err
 	}
 
-	if !tx.Signature.Verify(publicKey, tx.Data) {
+	if !sig.Verify(publicKey, tx.SigningPayload()) {
 		return fmt.Errorf("invalid transaction signature")
 	}
 
 	return nil
 }
 
+// CheckValidityWindow 检查交易能否被打包进指定高度的区块
+// height: 区块高度
+// hasher: 错误信息中计算交易ID的哈希器，需与链配置的哈希算法一致（见 ChainConfig.TxHasher）
+// 高度不大于 ValidAfter 或超过 ValidUntil 时返回错误
+func (tx *Transaction) CheckValidityWindow(height uint32, hasher TxHasher) error {
+	if height <= tx.ValidAfter {
+		return fmt.Errorf("transaction (%s) is not valid before height (%d) => height (%d)", tx.Hash(hasher), tx.ValidAfter+1, height)
+	}
+	if tx.Expired(height) {
+		return fmt.Errorf("transaction (%s) expired at height (%d) => height (%d)", tx.Hash(hasher), tx.ValidUntil, height)
+	}
+
+	return nil
+}
+
+// Expired 检查交易在指定高度是否已经过期
+// 过期的交易永远无法再被打包
+func (tx *Transaction) Expired(height uint32) bool {
+	return tx.ValidUntil != 0 && height > tx.ValidUntil
+}
+
+// Sender 返回交易发起者的地址
+// 以链配置的哈希算法 algo 由发起者公钥推导：签名可以恢复公钥或 From 为空时从签名中恢复，否则使用 From，
+// 公钥非法或签名无法恢复公钥时返回错误
+func (tx *Transaction) Sender(algo crypto.HashAlgorithm) (types.Address, error) {
+	publicKey, err := tx.signer()
+	if err != nil {
+		return types.Address{}, err
+	}
+
+	return publicKey.AddressWith(algo), nil
+}
+
+// signer 返回交易发起者的公钥，字段未被修改时返回缓存的公钥
+func (tx *Transaction) signer() (crypto.PublicKey, error) {
+	if tx.cacheValid() && tx.from != nil {
+		return tx.from, nil
+	}
+
+	publicKey, err := tx.recoverSigner()
+	if err != nil {
+		return nil, err
+	}
+	tx.from = publicKey
+
+	return publicKey, nil
+}
+
+// recoverSigner 由当前字段计算发起者的公钥，与 Verify 一致：签名可以恢复公钥或 From 为空时从签名中恢复，否则使用 From
+func (tx *Transaction) recoverSigner() (crypto.PublicKey, error) {
+	if len(tx.From) != 0 && !tx.recoverable() {
+		return crypto.ToPublicKey(tx.From)
+	}
+
+	sig, err := crypto.ToSignature(tx.Signature)
+	if err != nil {
+		return nil, err
+	}
+
+	return crypto.RecoverSigner(tx.SigningPayload(), sig)
+}
+
+// cacheValid 检查缓存是否由当前字段计算得到
+// 规范化编码的摘要与缓存的键不同时清空缓存并记录新的键，返回 false
+func (tx *Transaction) cacheValid() bool {
+	key := sha256.Sum256(tx.Bytes())
+	if key == tx.cacheKey {
+		return true
+	}
+
+	tx.cacheKey = key
+	tx.hash = types.Hash{}
+	tx.hashedBy = nil
+	tx.from = nil
+
+	return false
+}
+
+// recoverable 返回交易的签名能否恢复发起者公钥
+func (tx *Transaction) recoverable() bool {
+	sig, err := crypto.ToSignature(tx.Signature)
+	return err == nil && crypto.IsRecoverable(sig)
+}
+
 // Decode 使用指定解码器解码交易
 // dec: 解码器实例
 func (tx *Transaction) Decode(dec Decoder[*Transaction]) error {
@@ -82,3 +298,9 @@ func (tx *Transaction) Decode(dec Decoder[*Transaction]) error {
 func (tx *Transaction) Encode(enc Encoder[*Transaction]) error {
 	return enc.Encode(tx)
 }
+
+// writeBytes 以长度前缀的形式写入字节切片，保证编码无歧义
+func writeBytes(buf *bytes.Buffer, b []byte) {
+	binary.Write(buf, binary.BigEndian, uint64(len(b)))
+	buf.Write(b)
+}
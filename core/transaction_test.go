@@ -2,9 +2,12 @@ package core
 
 import (
 	"bytes"
+	"crypto/elliptic"
+	"math/big"
 	"testing"
 
 	"github.com/felixkuang/titanchain/crypto"
+	"github.com/felixkuang/titanchain/types"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -45,12 +48,307 @@ func TestTxEncodeDecode(t *testing.T) {
 	assert.Equal(t, tx, txDecoded)
 }
 
+// TestVerifyTransactionReplay 测试修改链ID或序号后签名失效，防止交易重放
+func TestVerifyTransactionReplay(t *testing.T) {
+	tx := randomTxWithSignature(t)
+	assert.Nil(t, tx.Verify())
+
+	tx.ChainID = DefaultChainID + 1
+	// 跨链重放，验证应失败
+	assert.NotNil(t, tx.Verify())
+
+	tx.ChainID = DefaultChainID
+	tx.Nonce++
+	// 序号被篡改，验证应失败
+	assert.NotNil(t, tx.Verify())
+}
+
+// TestSigningPayloadDomain 测试签名载荷带有域分隔前缀并区分不同字段
+func TestSigningPayloadDomain(t *testing.T) {
+	tx := &Transaction{ChainID: 1, Data: []byte("foo")}
+	assert.True(t, bytes.HasPrefix(tx.SigningPayload(), []byte(txSigningDomain)))
+
+	other := &Transaction{ChainID: 2, Data: []byte("foo")}
+	assert.NotEqual(t, tx.SigningPayload(), other.SigningPayload())
+}
+
+// TestTxHashCoversSigner 测试相同载荷由不同签名者签名时交易ID不同，签名哈希相同
+func TestTxHashCoversSigner(t *testing.T) {
+	tx1 := &Transaction{ChainID: DefaultChainID, Data: []byte("foo")}
+	tx2 := &Transaction{ChainID: DefaultChainID, Data: []byte("foo")}
+
+	unsigned := tx1.Hash(TxHasher{})
+	assert.Nil(t, tx1.Sign(crypto.GeneratePrivateKey()))
+	assert.Nil(t, tx2.Sign(crypto.GeneratePrivateKey()))
+
+	// 签名后交易ID需要重新计算
+	assert.NotEqual(t, unsigned, tx1.Hash(TxHasher{}))
+	assert.NotEqual(t, tx1.Hash(TxHasher{}), tx2.Hash(TxHasher{}))
+	assert.Equal(t, tx1.SigningHash(), tx2.SigningHash())
+}
+
+// TestCheckValidityWindow 测试交易有效期的边界
+func TestCheckValidityWindow(t *testing.T) {
+	tx := &Transaction{}
+	assert.Nil(t, tx.CheckValidityWindow(1, TxHasher{}))
+	assert.Nil(t, tx.CheckValidityWindow(1000, TxHasher{}))
+
+	tx = &Transaction{ValidAfter: 5, ValidUntil: 10}
+	assert.NotNil(t, tx.CheckValidityWindow(5, TxHasher{}))
+	assert.Nil(t, tx.CheckValidityWindow(6, TxHasher{}))
+	assert.Nil(t, tx.CheckValidityWindow(10, TxHasher{}))
+	assert.NotNil(t, tx.CheckValidityWindow(11, TxHasher{}))
+
+	assert.False(t, tx.Expired(10))
+	assert.True(t, tx.Expired(11))
+}
+
 // randomTxWithSignature 辅助函数：生成带签名的交易
 func randomTxWithSignature(t *testing.T) *Transaction {
 	privKey := crypto.GeneratePrivateKey()
 	tx := &Transaction{
-		Data: []byte("foo"),
+		ChainID: DefaultChainID,
+		Data:    []byte{'f', byte(InstrPushByte), byte(InstrPop)},
 	}
 	assert.Nil(t, tx.Sign(privKey))
 	return tx
 }
+
+// TestTransactionKeyTypes 测试 From 与 Signature 可以携带任意受支持类型的公钥与签名
+func TestTransactionKeyTypes(t *testing.T) {
+	for _, kt := range []crypto.KeyType{crypto.KeyTypeP256, crypto.KeyTypeEd25519, crypto.KeyTypeSecp256k1} {
+		privKey, err := crypto.GenerateKey(kt)
+		assert.Nil(t, err)
+
+		tx := &Transaction{Type: TxTypeTransfer, ChainID: DefaultChainID, To: types.Address{0x01}, Value: 1}
+		assert.Nil(t, tx.Sign(privKey))
+		if kt == crypto.KeyTypeSecp256k1 {
+			// secp256k1 签名可恢复公钥，交易不携带 From
+			assert.Empty(t, tx.From)
+		} else {
+			assert.Equal(t, byte(kt), tx.From[0])
+		}
+		assert.Equal(t, byte(kt), tx.Signature[0])
+		assert.Nil(t, tx.Verify(), kt)
+
+		sender, err := tx.Sender(crypto.HashSHA256)
+		assert.Nil(t, err)
+		assert.Equal(t, privKey.PublicKey().Address(), sender)
+
+		buf := &bytes.Buffer{}
+		assert.Nil(t, tx.Encode(NewGobTxEncoder(buf)))
+		txDecoded := new(Transaction)
+		assert.Nil(t, txDecoded.Decode(NewGobTxDecoder(buf)))
+		assert.Nil(t, txDecoded.Verify(), kt)
+
+		// 签名被截断或替换为其他类型的签名
+		txDecoded.Signature = tx.Signature[:len(tx.Signature)-1]
+		assert.NotNil(t, txDecoded.Verify())
+		otherType := crypto.KeyTypeEd25519
+		if kt == crypto.KeyTypeEd25519 {
+			otherType = crypto.KeyTypeP256
+		}
+		otherKey, err := crypto.GenerateKey(otherType)
+		assert.Nil(t, err)
+		other := &Transaction{Type: TxTypeTransfer, ChainID: DefaultChainID, To: types.Address{0x01}, Value: 1}
+		assert.Nil(t, other.Sign(otherKey))
+		txDecoded.Signature = other.Signature
+		assert.NotNil(t, txDecoded.Verify())
+	}
+}
+
+// malleateP256 返回 P-256 签名的延展变体 (R, n-S)，它满足验证方程但不是规范形式
+func malleateP256(sig []byte) []byte {
+	b := append([]byte{}, sig...)
+	s := new(big.Int).SetBytes(b[33:65])
+	s.Sub(elliptic.P256().Params().N, s)
+	s.FillBytes(b[33:65])
+
+	return b
+}
+
+// TestVerifyTransactionMalleated 测试签名被延展为 high-S 形式的交易验证失败
+func TestVerifyTransactionMalleated(t *testing.T) {
+	privKey := crypto.GeneratePrivateKey()
+	tx := &Transaction{Type: TxTypeTransfer, ChainID: DefaultChainID, To: types.Address{0x01}, Value: 1}
+	assert.Nil(t, tx.Sign(privKey))
+	assert.Nil(t, tx.Verify())
+	assert.Len(t, tx.Signature, 65)
+
+	signature := tx.Signature
+	tx.Signature = malleateP256(signature)
+	assert.ErrorIs(t, tx.Verify(), crypto.ErrNonCanonicalSignature)
+
+	tx.Signature = signature
+	assert.Nil(t, tx.Verify())
+}
+
+// TestVerifyTransactionReencoded 测试签名被重新编码的交易验证失败
+// 每种密钥类型只有一种签名编码，否则同一个签名可以得到不同的交易ID
+func TestVerifyTransactionReencoded(t *testing.T) {
+	privKey := crypto.GeneratePrivateKey()
+	tx := &Transaction{Type: TxTypeTransfer, ChainID: DefaultChainID, To: types.Address{0x01}, Value: 1}
+	assert.Nil(t, tx.Sign(privKey))
+	signature := tx.Signature
+	id := tx.Hash(TxHasher{})
+
+	// P-256 签名后追加恢复标识
+	for v := byte(0); v <= 2; v++ {
+		reencoded := *tx
+		reencoded.Signature = append(append([]byte{}, signature...), v)
+		assert.NotEqual(t, id, reencoded.Hash(TxHasher{}))
+		assert.ErrorIs(t, reencoded.Verify(), crypto.ErrInvalidSignatureEncoding, v)
+	}
+
+	// secp256k1 签名去掉恢复标识，或者恢复标识不是 0 或 1
+	secpKey, err := crypto.GenerateKey(crypto.KeyTypeSecp256k1)
+	assert.Nil(t, err)
+	assert.Nil(t, tx.Sign(secpKey))
+	signature = tx.Signature
+	for _, b := range [][]byte{signature[:len(signature)-1], append(append([]byte{}, signature[:len(signature)-1]...), 2)} {
+		tx.Signature = b
+		assert.ErrorIs(t, tx.Verify(), crypto.ErrInvalidSignatureEncoding)
+	}
+
+	tx.Signature = signature
+	assert.Nil(t, tx.Verify())
+}
+
+// TestTransactionRecoverableSender 测试 secp256k1 交易只携带签名，由签名恢复发起者地址
+func TestTransactionRecoverableSender(t *testing.T) {
+	privKey, err := crypto.GenerateKey(crypto.KeyTypeSecp256k1)
+	assert.Nil(t, err)
+	tx := &Transaction{Type: TxTypeTransfer, ChainID: DefaultChainID, Nonce: 1, To: types.Address{0x01}, Value: 10}
+	assert.Nil(t, tx.Sign(privKey))
+	assert.Empty(t, tx.From)
+	assert.Nil(t, tx.Verify())
+
+	for _, algo := range []crypto.HashAlgorithm{crypto.HashSHA256, crypto.HashKeccak256} {
+		sender, err := tx.Sender(algo)
+		assert.Nil(t, err)
+		assert.Equal(t, privKey.PublicKey().AddressWith(algo), sender)
+	}
+
+	// 重新签名后发起者随之改变
+	signature := tx.Signature
+	otherKey, err := crypto.GenerateKey(crypto.KeyTypeSecp256k1)
+	assert.Nil(t, err)
+	assert.Nil(t, tx.Sign(otherKey))
+	sender, err := tx.Sender(crypto.HashKeccak256)
+	assert.Nil(t, err)
+	assert.Equal(t, otherKey.PublicKey().AddressWith(crypto.HashKeccak256), sender)
+
+	// 解码后的交易同样可以恢复
+	tx.Signature = signature
+	buf := &bytes.Buffer{}
+	assert.Nil(t, tx.Encode(NewGobTxEncoder(buf)))
+	txDecoded := new(Transaction)
+	assert.Nil(t, txDecoded.Decode(NewGobTxDecoder(buf)))
+	assert.Nil(t, txDecoded.Verify())
+	sender, err = txDecoded.Sender(crypto.HashSHA256)
+	assert.Nil(t, err)
+	assert.Equal(t, privKey.PublicKey().Address(), sender)
+
+	// 篡改交易内容后恢复出的是其他地址，不会被当作原发起者
+	tampered := *txDecoded
+	tampered.Value = 1000
+	sender, err = tampered.Sender(crypto.HashSHA256)
+	if err == nil {
+		assert.NotEqual(t, privKey.PublicKey().Address(), sender)
+	}
+}
+
+// TestTransactionRecoverableFrom 测试签名可以恢复公钥时 From 只能为空或与恢复出的公钥相同
+func TestTransactionRecoverableFrom(t *testing.T) {
+	privKey, err := crypto.GenerateKey(crypto.KeyTypeSecp256k1)
+	assert.Nil(t, err)
+	otherKey, err := crypto.GenerateKey(crypto.KeyTypeSecp256k1)
+	assert.Nil(t, err)
+	tx := &Transaction{Type: TxTypeTransfer, ChainID: DefaultChainID, Nonce: 1, To: types.Address{0x01}, Value: 10}
+	assert.Nil(t, tx.Sign(privKey))
+	id := tx.Hash(TxHasher{})
+
+	// 携带相同的公钥时验证通过，交易ID不变
+	withFrom := *tx
+	withFrom.From = privKey.PublicKey().ToSlice()
+	assert.Nil(t, withFrom.Verify())
+	assert.Equal(t, id, withFrom.Hash(TxHasher{}))
+
+	// 携带其他公钥时验证失败，发起者仍由签名决定
+	withFrom.From = otherKey.PublicKey().ToSlice()
+	assert.NotNil(t, withFrom.Verify())
+	sender, err := withFrom.Sender(crypto.HashSHA256)
+	assert.Nil(t, err)
+	assert.Equal(t, privKey.PublicKey().Address(), sender)
+
+	// 翻转恢复标识后恢复出的是其他公钥，与携带的 From 不符
+	withFrom.From = privKey.PublicKey().ToSlice()
+	withFrom.Signature = append([]byte{}, tx.Signature...)
+	withFrom.Signature[len(withFrom.Signature)-1] ^= 1
+	assert.NotNil(t, withFrom.Verify())
+	assert.NotEqual(t, id, withFrom.Hash(TxHasher{}))
+}
+
+// TestTransactionCache 测试交易ID与发起者的缓存在修改字段或复制结构体后失效
+func TestTransactionCache(t *testing.T) {
+	privKey := crypto.GeneratePrivateKey()
+	tx := &Transaction{Type: TxTypeTransfer, ChainID: DefaultChainID, Nonce: 1, To: types.Address{0x01}, Value: 10}
+	assert.Nil(t, tx.Sign(privKey))
+	id := tx.Hash(TxHasher{})
+	sender, err := tx.Sender(crypto.HashSHA256)
+	assert.Nil(t, err)
+	assert.Equal(t, privKey.PublicKey().Address(), sender)
+
+	// 字段未修改时命中缓存；换用其他哈希器时重新计算
+	assert.Equal(t, id, tx.Hash(TxHasher{}))
+	assert.NotEqual(t, id, tx.Hash(TxHasher{Algorithm: crypto.HashKeccak256}))
+	assert.Equal(t, id, tx.Hash(TxHasher{}))
+
+	// 直接修改 From 后发起者随之改变
+	otherKey := crypto.GeneratePrivateKey()
+	tx.From = otherKey.PublicKey().ToSlice()
+	sender, err = tx.Sender(crypto.HashSHA256)
+	assert.Nil(t, err)
+	assert.Equal(t, otherKey.PublicKey().Address(), sender)
+	assert.NotEqual(t, id, tx.Hash(TxHasher{}))
+
+	// 复制后修改字段不影响原交易的缓存
+	copied := *tx
+	copied.Value = 11
+	assert.NotEqual(t, tx.Hash(TxHasher{}), copied.Hash(TxHasher{}))
+
+	// 签名可以恢复公钥时，修改签名载荷中的字段使恢复出的发起者改变
+	recoverKey, err := crypto.GenerateKey(crypto.KeyTypeSecp256k1)
+	assert.Nil(t, err)
+	tx = &Transaction{Type: TxTypeTransfer, ChainID: DefaultChainID, Nonce: 1, To: types.Address{0x01}, Value: 10}
+	assert.Nil(t, tx.Sign(recoverKey))
+	sender, err = tx.Sender(crypto.HashSHA256)
+	assert.Nil(t, err)
+	assert.Equal(t, recoverKey.PublicKey().Address(), sender)
+
+	tx.Value = 11
+	tampered, err := tx.Sender(crypto.HashSHA256)
+	assert.Nil(t, err)
+	assert.NotEqual(t, sender, tampered)
+
+	// 重新签名后发起者为新的签名者
+	otherRecoverKey, err := crypto.GenerateKey(crypto.KeyTypeSecp256k1)
+	assert.Nil(t, err)
+	assert.Nil(t, tx.Sign(otherRecoverKey))
+	sender, err = tx.Sender(crypto.HashSHA256)
+	assert.Nil(t, err)
+	assert.Equal(t, otherRecoverKey.PublicKey().Address(), sender)
+}
+
+// TestTransactionUnrecoverableSender 测试签名不可恢复公钥且未携带 From 的交易被拒绝
+func TestTransactionUnrecoverableSender(t *testing.T) {
+	privKey := crypto.GeneratePrivateKey()
+	tx := &Transaction{Type: TxTypeTransfer, ChainID: DefaultChainID, To: types.Address{0x01}, Value: 1}
+	assert.Nil(t, tx.Sign(privKey))
+	assert.NotEmpty(t, tx.From)
+
+	tx.From = nil
+	assert.ErrorIs(t, tx.Verify(), crypto.ErrUnrecoverableSignature)
+	_, err := tx.Sender(crypto.HashSHA256)
+	assert.ErrorIs(t, err, crypto.ErrUnrecoverableSignature)
+}
@@ -31,7 +31,9 @@ func NewBlockValidator(bc *Blockchain) *BlockValidator {
 // b: 要验证的区块
 // 验证内容包括：
 // 1. 检查区块高度是否已存在
-// 2. 验证区块的签名
+// 2. 检查区块内交易的链ID与本链一致，按交易类型校验格式，并检查交易有效期
+// 3. 检查区块出块者是否属于验证者集合
+// 4. 验证区块的签名
 // 返回验证过程中可能发生的错误
 func (v *BlockValidator) ValidateBlock(b *Block) error {
 	if v.bc.HasBlock(b.Height) {
@@ -39,8 +41,10 @@ func (v *BlockValidator) ValidateBlock(b *Block) error {
 		return ErrBlockKnown
 	}
 
+	config := v.bc.Config()
+
 	if b.Height != v.bc.Height()+1 {
-		return fmt.Errorf("block (%s) with height (%d) is too high => current height (%d)", b.Hash(BlockHasher{}), b.Height, v.bc.Height())
+		return fmt.Errorf("block (%s) with height (%d) is too high => current height (%d)", b.Hash(config.BlockHasher()), b.Height, v.bc.Height())
 	}
 
 	prevHeader, err := v.bc.GetHeader(b.Height - 1)
@@ -48,12 +52,28 @@ func (v *BlockValidator) ValidateBlock(b *Block) error {
 		return err
 	}
 
-	hash := BlockHasher{}.Hash(prevHeader)
+	hash := config.BlockHasher().Hash(prevHeader)
 	if hash != b.PrevBlockHash {
 		return fmt.Errorf("the hash of the previous block (%s) is invalid", b.PrevBlockHash)
 	}
 
-	if err := b.Verify(); err != nil {
+	for _, tx := range b.Transactions {
+		if tx.ChainID != v.bc.ChainID() {
+			return fmt.Errorf("transaction (%s) has chain id (%d) => expected (%d)", tx.Hash(config.TxHasher()), tx.ChainID, v.bc.ChainID())
+		}
+		if err := ValidateTransaction(tx, config); err != nil {
+			return err
+		}
+		if err := tx.CheckValidityWindow(b.Height, config.TxHasher()); err != nil {
+			return err
+		}
+	}
+
+	if !v.bc.IsValidator(b.Validator) {
+		return fmt.Errorf("block (%s) is signed by an unknown validator", b.Hash(config.BlockHasher()))
+	}
+
+	if err := b.Verify(config.Hash); err != nil {
 		return err
 	}
 
@@ -1,25 +1,335 @@
 package core
 
-import "encoding/binary"
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/felixkuang/titanchain/types"
+)
 
 // Instruction 表示虚拟机支持的指令类型。
+// 带立即数的指令，其立即数位于操作码之前，执行到操作码时向前读取立即数。
+// 因此指令边界从字节码末尾向前解码。
+// 多个操作数按列出的顺序入栈，最后一个操作数位于栈顶。
 type Instruction byte
 
 const (
-	// InstrPushInt 表示将数据压入栈的指令。
+	// InstrHalt 表示正常结束执行。
+	InstrHalt Instruction = 0x00
+
+	// InstrPushN 表示将多字节整数压入栈的指令，前置 n 字节大端整数和 1 字节长度 n（1~32），长度紧挨操作码。
+	InstrPushN Instruction = 0x09
+	// InstrPushInt 表示将数据压入栈的指令，前置 1 字节整数立即数。
 	InstrPushInt Instruction = 0x0a // 10
 	// InstrAdd 表示对栈顶两个元素进行加法操作的指令。
 	InstrAdd Instruction = 0x0b // 11
-	// InstrPushByte 表示将单字节数据压入栈的指令。
+	// InstrPushByte 表示将单字节数据压入栈的指令，前置 1 字节立即数。
 	InstrPushByte Instruction = 0x0c
-	// InstrPack 表示将多个字节打包为字节切片的指令。
+	// InstrPack 表示将多个字节打包为字节切片的指令，操作数为 n 个字节和长度 n，按字节入栈顺序打包。
 	InstrPack Instruction = 0x0d
 	// InstrSub 表示对栈顶两个元素进行减法操作的指令。
-	InstrSub   Instruction = 0x0e // 14
+	InstrSub Instruction = 0x0e // 14
+	// InstrStore 以键和值为操作数，写入当前合约的存储。
 	InstrStore Instruction = 0x0f
+
+	// InstrMul 表示乘法。
+	InstrMul Instruction = 0x10
+	// InstrDiv 表示整除，除数为 0 时结果为 0。
+	InstrDiv Instruction = 0x11
+	// InstrMod 表示取模，模数为 0 时结果为 0。
+	InstrMod Instruction = 0x12
+	// InstrExp 表示乘方。
+	InstrExp Instruction = 0x13
+	// InstrLt 表示小于比较，成立时压入 1，否则压入 0。
+	InstrLt Instruction = 0x14
+	// InstrGt 表示大于比较。
+	InstrGt Instruction = 0x15
+	// InstrEq 表示相等比较。
+	InstrEq Instruction = 0x16
+	// InstrAnd 表示按位与。
+	InstrAnd Instruction = 0x17
+	// InstrOr 表示按位或。
+	InstrOr Instruction = 0x18
+	// InstrXor 表示按位异或。
+	InstrXor Instruction = 0x19
+	// InstrNot 表示按位取反。
+	InstrNot Instruction = 0x1a
+	// InstrShl 表示左移，移位数不小于 256 时结果为 0。
+	InstrShl Instruction = 0x1b
+	// InstrShr 表示逻辑右移，移位数不小于 256 时结果为 0。
+	InstrShr Instruction = 0x1c
+	// InstrConcat 以两个值为操作数，将其按入栈顺序拼接为字节切片，整数编码为 32 字节大端整数。
+	InstrConcat Instruction = 0x1d
+
+	// InstrDup 表示复制栈顶元素。
+	InstrDup Instruction = 0x20
+	// InstrSwap 表示交换栈顶两个元素。
+	InstrSwap Instruction = 0x21
+	// InstrPop 表示丢弃栈顶元素。
+	InstrPop Instruction = 0x22
+	// InstrDupN 前置 1 字节立即数 n（n≥1），复制从栈顶数第 n 个元素（1 为栈顶）并压入栈。
+	InstrDupN Instruction = 0x23
+	// InstrSwapN 前置 1 字节立即数 n（n≥1），交换栈顶元素与从栈顶数第 n+1 个元素。
+	InstrSwapN Instruction = 0x24
+
+	// InstrJumpDest 标记一个合法的跳转目标，本身不做任何操作。
+	InstrJumpDest Instruction = 0x30
+	// InstrJump 弹出目标位置并无条件跳转。
+	InstrJump Instruction = 0x31
+	// InstrJumpI 以目标位置和条件为操作数，条件非 0 时跳转。
+	InstrJumpI Instruction = 0x32
+	// InstrCallSub 弹出目标位置，将返回位置压入调用栈后跳转到子程序。
+	InstrCallSub Instruction = 0x33
+	// InstrRetSub 从调用栈弹出返回位置，回到调用处的下一条指令。
+	InstrRetSub Instruction = 0x34
+	// InstrRevert 表示中止执行并回滚。
+	InstrRevert Instruction = 0x35
+	// InstrReturn 弹出返回值并正常结束执行，整数返回值编码为 32 字节大端整数。
+	InstrReturn Instruction = 0x36
+
+	// InstrLoad 弹出键，将当前合约存储中的值压入栈，键不存在时压入 0。
+	InstrLoad Instruction = 0x40
+	// InstrDelete 弹出键，删除当前合约存储中的值。
+	InstrDelete Instruction = 0x41
+
+	// InstrCallDataLoad 弹出偏移量，将调用数据中从该偏移开始的 32 字节作为整数压入栈，越界部分补 0。
+	InstrCallDataLoad Instruction = 0x50
+	// InstrCallDataSize 将调用数据的长度压入栈。
+	InstrCallDataSize Instruction = 0x51
+	// InstrCallData 将完整的调用数据作为字节切片压入栈。
+	InstrCallData Instruction = 0x52
+	// InstrCaller 将调用者地址作为整数压入栈。
+	InstrCaller Instruction = 0x53
+	// InstrCallValue 将随调用转入的金额压入栈。
+	InstrCallValue Instruction = 0x54
+	// InstrAddress 将当前合约地址作为整数压入栈。
+	InstrAddress Instruction = 0x55
+	// InstrHeight 将当前区块高度压入栈。
+	InstrHeight Instruction = 0x56
+	// InstrTimestamp 将当前区块时间戳压入栈。
+	InstrTimestamp Instruction = 0x57
+	// InstrReturnData 将最近一次外部调用的返回数据作为字节切片压入栈。
+	InstrReturnData Instruction = 0x58
+	// InstrCallDataCopy 以偏移量和长度为操作数，将调用数据中对应的字节切片压入栈，越界部分补 0。
+	InstrCallDataCopy Instruction = 0x59
+
+	// InstrCall 以目标地址、转入金额、gas 上限和调用数据为操作数，调用目标合约，成功压入 1，失败压入 0。
+	InstrCall Instruction = 0x60
+	// InstrStaticCall 以目标地址、gas 上限和调用数据为操作数，以只读方式调用目标合约，成功压入 1，失败压入 0。
+	InstrStaticCall Instruction = 0x61
+
+	// InstrLog0 弹出事件数据，发出不带主题的事件。
+	InstrLog0 Instruction = 0x70
+	// InstrLog1 以事件数据和 1 个主题为操作数，发出事件。
+	InstrLog1 Instruction = 0x71
+	// InstrLog2 以事件数据和 2 个主题为操作数，发出事件。
+	InstrLog2 Instruction = 0x72
+	// InstrLog3 以事件数据和 3 个主题为操作数，发出事件。
+	InstrLog3 Instruction = 0x73
+	// InstrLog4 以事件数据和 4 个主题为操作数，发出事件。
+	InstrLog4 Instruction = 0x74
 )
 
-// Stack 表示虚拟机的操作数栈，支持任意类型元素的入栈和出栈操作。
+const (
+	// storageTagWord 表示存储值为 256 位整数
+	storageTagWord byte = 0x01
+	// storageTagBytes 表示存储值为字节切片
+	storageTagBytes byte = 0x02
+)
+
+// maxReturnStackDepth 是子程序调用栈的最大深度
+const maxReturnStackDepth = 1024
+
+// maxBytesLength 是 InstrConcat 与 InstrCallDataCopy 产生的字节切片的最大长度
+const maxBytesLength = 64 * 1024
+
+// copyWordGas 是 InstrConcat 与 InstrCallDataCopy 每产生 32 字节输出额外收取的 gas，
+// 与 WASM 宿主函数的 wasmCopyWordGas 一致
+const copyWordGas = 3
+
+var (
+	// ErrOutOfGas 表示执行过程中 gas 耗尽
+	ErrOutOfGas = errors.New("out of gas")
+	// ErrExecutionReverted 表示合约执行了 InstrRevert
+	ErrExecutionReverted = errors.New("execution reverted")
+	// ErrInvalidJump 表示跳转目标不是合法的 InstrJumpDest
+	ErrInvalidJump = errors.New("invalid jump destination")
+	// ErrReturnStackOverflow 表示子程序调用层数超过上限
+	ErrReturnStackOverflow = errors.New("return stack overflow")
+	// ErrReturnStackUnderflow 表示在没有子程序调用时执行了 InstrRetSub
+	ErrReturnStackUnderflow = errors.New("return stack underflow")
+	// ErrWriteProtection 表示在只读调用中修改了状态
+	ErrWriteProtection = errors.New("write protection")
+	// ErrStackOverflow 表示操作数栈的元素个数超过容量
+	ErrStackOverflow = errors.New("stack overflow")
+	// ErrStackUnderflow 表示从空的操作数栈弹出元素
+	ErrStackUnderflow = errors.New("stack underflow")
+	// ErrInvalidOpcode 表示字节码中出现了虚拟机不支持的操作码
+	ErrInvalidOpcode = errors.New("invalid opcode")
+	// ErrTruncatedImmediate 表示指令的立即数超出了字节码末尾或长度不合法
+	ErrTruncatedImmediate = errors.New("truncated immediate")
+)
+
+// gasTable 记录每条指令的 gas 消耗，未列出的指令消耗 defaultGasCost
+var gasTable = map[Instruction]uint64{
+	InstrHalt:     0,
+	InstrRevert:   0,
+	InstrAdd:      3,
+	InstrSub:      3,
+	InstrLt:       3,
+	InstrGt:       3,
+	InstrEq:       3,
+	InstrAnd:      3,
+	InstrOr:       3,
+	InstrXor:      3,
+	InstrNot:      3,
+	InstrShl:      3,
+	InstrShr:      3,
+	InstrMul:      5,
+	InstrDiv:      5,
+	InstrMod:      5,
+	InstrExp:      10,
+	InstrPack:     3,
+	InstrConcat:   3,
+	InstrJump:     8,
+	InstrJumpI:    10,
+	InstrCallSub:  10,
+	InstrRetSub:   5,
+	InstrStore:    100,
+	InstrLoad:     50,
+	InstrDelete:   50,
+	InstrJumpDest: 1,
+
+	InstrCallDataLoad: 3,
+	InstrCallDataSize: 2,
+	InstrCallData:     3,
+	InstrCallDataCopy: 3,
+	InstrCaller:       2,
+	InstrCallValue:    2,
+	InstrAddress:      2,
+	InstrHeight:       2,
+	InstrTimestamp:    2,
+	InstrReturnData:   2,
+
+	InstrReturn:     0,
+	InstrCall:       40,
+	InstrStaticCall: 40,
+
+	InstrLog0: 20,
+	InstrLog1: 30,
+	InstrLog2: 40,
+	InstrLog3: 50,
+	InstrLog4: 60,
+}
+
+// instructionNames 记录每条指令的助记符
+var instructionNames = map[Instruction]string{
+	InstrHalt:         "HALT",
+	InstrPushN:        "PUSHN",
+	InstrPushInt:      "PUSHINT",
+	InstrAdd:          "ADD",
+	InstrPushByte:     "PUSHBYTE",
+	InstrPack:         "PACK",
+	InstrSub:          "SUB",
+	InstrStore:        "STORE",
+	InstrMul:          "MUL",
+	InstrDiv:          "DIV",
+	InstrMod:          "MOD",
+	InstrExp:          "EXP",
+	InstrLt:           "LT",
+	InstrGt:           "GT",
+	InstrEq:           "EQ",
+	InstrAnd:          "AND",
+	InstrOr:           "OR",
+	InstrXor:          "XOR",
+	InstrNot:          "NOT",
+	InstrShl:          "SHL",
+	InstrShr:          "SHR",
+	InstrConcat:       "CONCAT",
+	InstrDup:          "DUP",
+	InstrSwap:         "SWAP",
+	InstrPop:          "POP",
+	InstrDupN:         "DUPN",
+	InstrSwapN:        "SWAPN",
+	InstrJumpDest:     "JUMPDEST",
+	InstrJump:         "JUMP",
+	InstrJumpI:        "JUMPI",
+	InstrCallSub:      "CALLSUB",
+	InstrRetSub:       "RETSUB",
+	InstrRevert:       "REVERT",
+	InstrReturn:       "RETURN",
+	InstrLoad:         "LOAD",
+	InstrDelete:       "DELETE",
+	InstrCallDataLoad: "CALLDATALOAD",
+	InstrCallDataSize: "CALLDATASIZE",
+	InstrCallData:     "CALLDATA",
+	InstrCaller:       "CALLER",
+	InstrCallValue:    "CALLVALUE",
+	InstrAddress:      "ADDRESS",
+	InstrHeight:       "HEIGHT",
+	InstrTimestamp:    "TIMESTAMP",
+	InstrReturnData:   "RETURNDATA",
+	InstrCallDataCopy: "CALLDATACOPY",
+	InstrCall:         "CALL",
+	InstrStaticCall:   "STATICCALL",
+	InstrLog0:         "LOG0",
+	InstrLog1:         "LOG1",
+	InstrLog2:         "LOG2",
+	InstrLog3:         "LOG3",
+	InstrLog4:         "LOG4",
+}
+
+// String 返回指令的助记符，未知指令返回其十六进制值
+func (i Instruction) String() string {
+	if name, ok := instructionNames[i]; ok {
+		return name
+	}
+
+	return fmt.Sprintf("0x%02x", byte(i))
+}
+
+// IsValid 判断是否为虚拟机支持的指令
+func (i Instruction) IsValid() bool {
+	_, ok := instructionNames[i]
+	return ok
+}
+
+// InstructionByName 根据助记符（不区分大小写）查找指令
+func InstructionByName(name string) (Instruction, bool) {
+	name = strings.ToUpper(name)
+	for instr, n := range instructionNames {
+		if n == name {
+			return instr, true
+		}
+	}
+
+	return 0, false
+}
+
+// defaultGasCost 是未在 gasTable 中列出的指令的 gas 消耗
+const defaultGasCost uint64 = 1
+
+// GasCost 返回指令的 gas 消耗
+func GasCost(instr Instruction) uint64 {
+	if cost, ok := gasTable[instr]; ok {
+		return cost
+	}
+
+	return defaultGasCost
+}
+
+var (
+	// wordBits 是虚拟机整数的位宽
+	wordBits = 256
+	// wordModulus 是 2^256，所有整数运算结果都对其取模
+	wordModulus = new(big.Int).Lsh(big.NewInt(1), uint(wordBits))
+	// wordMask 是 2^256-1，用于截断和按位取反
+	wordMask = new(big.Int).Sub(wordModulus, big.NewInt(1))
+)
+
+// Stack 表示虚拟机的操作数栈（后进先出），支持任意类型元素的入栈和出栈操作。
 type Stack struct {
 	data []any // 存储栈中元素的切片
 	sp   int   // 栈顶指针，指向下一个可用位置
@@ -37,123 +347,754 @@ func NewStack(size int) *Stack {
 
 // Push 将元素 v 压入栈顶。
 // v: 任意类型的待入栈元素。
-func (s *Stack) Push(v any) {
+// 返回 error：栈已满时返回 ErrStackOverflow。
+func (s *Stack) Push(v any) error {
+	if s.sp >= len(s.data) {
+		return ErrStackOverflow
+	}
 	s.data[s.sp] = v
 	s.sp++
+
+	return nil
 }
 
 // Pop 弹出栈顶元素并返回。
-// 返回 any：被弹出的元素。
-func (s *Stack) Pop() any {
-	value := s.data[0]
-	s.data = append(s.data[:0], s.data[1:]...)
+// 返回 any：被弹出的元素；error：栈为空时返回 ErrStackUnderflow。
+func (s *Stack) Pop() (any, error) {
+	if s.sp == 0 {
+		return nil, ErrStackUnderflow
+	}
 	s.sp--
+	value := s.data[s.sp]
+	s.data[s.sp] = nil
+
+	return value, nil
+}
+
+// Len 返回栈中元素的个数。
+func (s *Stack) Len() int {
+	return s.sp
+}
+
+// dup 复制从栈顶数第 n 个元素（1 为栈顶）并压入栈
+func (s *Stack) dup(n int) error {
+	if n > s.sp {
+		return ErrStackUnderflow
+	}
+
+	return s.Push(s.data[s.sp-n])
+}
+
+// swap 交换栈顶元素与从栈顶数第 n+1 个元素
+func (s *Stack) swap(n int) error {
+	if n >= s.sp {
+		return ErrStackUnderflow
+	}
+	s.data[s.sp-1], s.data[s.sp-1-n] = s.data[s.sp-1-n], s.data[s.sp-1]
+
+	return nil
+}
 
-	return value
+// snapshot 返回栈中现有元素的副本
+func (s *Stack) snapshot() []any {
+	return append([]any{}, s.data[:s.sp]...)
+}
+
+// ExecContext 描述合约执行时的环境信息
+type ExecContext struct {
+	Address   types.Address // 当前执行的合约地址，决定存储指令访问的存储空间
+	Caller    types.Address // 调用者地址
+	Value     uint64        // 随调用转入的金额
+	Input     []byte        // 调用数据
+	Height    uint32        // 所在区块高度
+	Timestamp int64         // 所在区块时间戳
 }
 
 // VM 表示一个简单的字节码虚拟机，用于执行智能合约或脚本。
+// 整数为 256 位无符号整数，运算结果对 2^256 取模。
+// 存储指令只能访问 ctx.Address 对应合约的存储空间。
 type VM struct {
 	data          []byte // 待执行的字节码数据
 	ip            int    // 指令指针，指向当前执行的指令位置
 	stack         *Stack
 	contractState *State
+	ctx           ExecContext // 执行环境
+	config        VMConfig    // 虚拟机参数，嵌套调用沿用
+
+	ops         []bool       // 每个位置是否为操作码，其余位置是立即数
+	jumpDests   map[int]bool // 合法的跳转目标位置
+	returnStack []int        // 子程序调用栈，记录调用指令的位置
+	gasLimit    uint64       // 本次执行可用的 gas 上限
+	gas         uint64       // 剩余 gas
+	halted      bool         // 是否已执行 InstrHalt 或 InstrReturn
+
+	depth          int    // 外部调用深度，交易直接调用的合约为 0
+	static         bool   // 是否为只读调用
+	returnData     []byte // 本次执行的返回数据
+	lastReturnData []byte // 最近一次外部调用的返回数据
+	logs           []*Log // 本次执行（含成功的嵌套调用）发出的事件
+
+	tracer Tracer // 执行追踪钩子，为 nil 时不追踪
 }
 
 // NewVM 创建一个新的虚拟机实例，data 为待执行的字节码数据。
 func NewVM(data []byte, contractState *State) *VM {
+	return NewVMWithConfig(data, contractState, DefaultChainConfig().VM)
+}
+
+// NewVMWithConfig 使用给定的虚拟机参数创建虚拟机实例。
+// config: 链配置中的虚拟机参数，如操作数栈容量。
+// 不属于任何合约的字节码使用空的执行环境，即零地址的存储空间。
+func NewVMWithConfig(data []byte, contractState *State, config VMConfig) *VM {
+	return NewContractVM(ExecContext{}, data, contractState, config)
+}
+
+// NewContractVM 创建在给定执行环境中运行合约代码的虚拟机实例。
+// ctx: 执行环境，包括合约地址、调用者、调用数据与区块信息。
+func NewContractVM(ctx ExecContext, data []byte, contractState *State, config VMConfig) *VM {
+	ops := analyzeCode(data)
+
 	return &VM{
 		contractState: contractState,
+		ctx:           ctx,
+		config:        config,
 		data:          data,
 		ip:            0,
-		stack:         NewStack(128),
+		stack:         NewStack(config.StackSize),
+		ops:           ops,
+		jumpDests:     analyzeJumpDests(data, ops),
+		gasLimit:      config.GasLimit,
+		gas:           config.GasLimit,
 	}
 }
 
-// Run 启动虚拟机，顺序执行字节码指令，直到结束或遇到错误。
+// ReturnData 返回执行 InstrReturn 时给出的返回数据
+func (vm *VM) ReturnData() []byte {
+	return vm.returnData
+}
+
+// Logs 返回本次执行发出的事件，失败的嵌套调用发出的事件不包含在内
+func (vm *VM) Logs() []*Log {
+	return vm.logs
+}
+
+// SetTracer 设置执行追踪钩子，嵌套调用沿用同一个 Tracer
+func (vm *VM) SetTracer(t Tracer) {
+	vm.tracer = t
+}
+
+// setFrame 设置外部调用深度与是否为只读调用
+func (vm *VM) setFrame(depth int, static bool) {
+	vm.depth = depth
+	vm.static = static
+}
+
+// GasUsed 返回本次执行已消耗的 gas
+func (vm *VM) GasUsed() uint64 {
+	return vm.gasLimit - vm.gas
+}
+
+// Run 启动虚拟机，顺序执行字节码指令，直到执行完全部字节码、遇到 InstrHalt 或出错。
+// 每条指令执行前先扣除 gas，gas 不足时返回 ErrOutOfGas，因此死循环也会终止。
+// 设置了 Tracer 时，每条指令执行前调用 CaptureState，执行结束时调用 CaptureEnd。
 // 返回 error 表示执行过程中遇到的错误。
 func (vm *VM) Run() error {
-	for {
+	err := vm.run()
+	if vm.tracer != nil {
+		vm.tracer.CaptureEnd(vm.depth, vm.returnData, vm.GasUsed(), err)
+	}
+
+	return err
+}
+
+// run 是 Run 的指令循环
+func (vm *VM) run() error {
+	for vm.ip < len(vm.data) && !vm.halted {
+		// 立即数由其后的操作码读取，不作为指令执行
+		if !vm.ops[vm.ip] {
+			vm.ip++
+			continue
+		}
 		instr := Instruction(vm.data[vm.ip])
 
+		if vm.tracer != nil {
+			vm.tracer.CaptureState(vm.ip, instr, vm.gas, GasCost(instr), vm.stack.snapshot(), vm.depth)
+		}
+
+		if err := vm.useGas(GasCost(instr)); err != nil {
+			return err
+		}
+
 		if err := vm.Exec(instr); err != nil {
 			return err
 		}
 
 		vm.ip++
+	}
 
-		if vm.ip > len(vm.data)-1 {
-			break
-		}
+	return nil
+}
+
+// useGas 扣除 gas，剩余 gas 不足时返回 ErrOutOfGas
+func (vm *VM) useGas(amount uint64) error {
+	if vm.gas < amount {
+		vm.gas = 0
+		return ErrOutOfGas
 	}
+	vm.gas -= amount
 
 	return nil
 }
 
+// useCopyGas 按输出的 32 字节字数扣除复制 gas，须在分配内存之前调用
+func (vm *VM) useCopyGas(n int) error {
+	return vm.useGas(uint64(n+31) / 32 * copyWordGas)
+}
+
 // Exec 执行单条指令，根据指令类型进行相应操作。
 // instr: 当前要执行的指令。
+// 带立即数的指令从操作码之前读取立即数；
+// 跳转指令会将指令指针移动到目标 InstrJumpDest 之前，使其作为下一条指令执行并扣除 gas。
 // 返回 error 表示执行过程中遇到的错误。
 func (vm *VM) Exec(instr Instruction) error {
 	switch instr {
+	case InstrHalt:
+		vm.halted = true
+
+	case InstrRevert:
+		return ErrExecutionReverted
+
+	case InstrReturn:
+		data, err := vm.popBytes()
+		if err != nil {
+			return err
+		}
+		vm.returnData = data
+		vm.halted = true
+
+	case InstrReturnData:
+		return vm.stack.Push(append([]byte{}, vm.lastReturnData...))
+
+	case InstrCall:
+		return vm.execCall(false)
+
+	case InstrLog0, InstrLog1, InstrLog2, InstrLog3, InstrLog4:
+		if vm.static {
+			return ErrWriteProtection
+		}
+
+		topics := make([]types.Hash, instr-InstrLog0)
+		for i := len(topics) - 1; i >= 0; i-- {
+			topic, err := vm.popInt()
+			if err != nil {
+				return err
+			}
+			topics[i] = types.HashFromBytes(serializeWord(topic))
+		}
+
+		data, err := vm.popBytes()
+		if err != nil {
+			return err
+		}
+
+		vm.logs = append(vm.logs, &Log{
+			Address: vm.ctx.Address,
+			Topics:  topics,
+			Data:    append([]byte{}, data...),
+		})
+
+	case InstrStaticCall:
+		return vm.execCall(true)
+
+	case InstrJumpDest:
+
+	case InstrJump:
+		dest, err := vm.popInt()
+		if err != nil {
+			return err
+		}
+		return vm.jump(dest)
+
+	case InstrJumpI:
+		cond, err := vm.popInt()
+		if err != nil {
+			return err
+		}
+		dest, err := vm.popInt()
+		if err != nil {
+			return err
+		}
+		if cond.Sign() != 0 {
+			return vm.jump(dest)
+		}
+
+	case InstrCallSub:
+		dest, err := vm.popInt()
+		if err != nil {
+			return err
+		}
+		if len(vm.returnStack) >= maxReturnStackDepth {
+			return ErrReturnStackOverflow
+		}
+		vm.returnStack = append(vm.returnStack, vm.ip)
+		return vm.jump(dest)
+
+	case InstrRetSub:
+		if len(vm.returnStack) == 0 {
+			return ErrReturnStackUnderflow
+		}
+		vm.ip = vm.returnStack[len(vm.returnStack)-1]
+		vm.returnStack = vm.returnStack[:len(vm.returnStack)-1]
+
 	case InstrStore:
-		var (
-			key             = vm.stack.Pop().([]byte)
-			value           = vm.stack.Pop()
-			serializedValue []byte
-		)
+		if vm.static {
+			return ErrWriteProtection
+		}
 
-		switch v := value.(type) {
-		case int:
-			serializedValue = serializeInt64(int64(v))
-		default:
-			panic("TODO: unknown type")
+		v, err := vm.stack.Pop()
+		if err != nil {
+			return err
+		}
+		value, err := encodeStorageValue(v)
+		if err != nil {
+			return err
 		}
 
-		err := vm.contractState.Put(key, serializedValue)
+		key, err := vm.popKey()
 		if err != nil {
 			return err
 		}
 
+		if err := vm.contractState.PutStorage(vm.ctx.Address, key, value); err != nil {
+			return err
+		}
+		if vm.tracer != nil {
+			vm.tracer.CaptureStorage(vm.ctx.Address, key, value)
+		}
+
+	case InstrLoad:
+		key, err := vm.popKey()
+		if err != nil {
+			return err
+		}
+
+		b, err := vm.contractState.GetStorage(vm.ctx.Address, key)
+		if err != nil {
+			return vm.stack.Push(new(big.Int))
+		}
+
+		value, err := decodeStorageValue(b)
+		if err != nil {
+			return err
+		}
+		return vm.stack.Push(value)
+
+	case InstrDelete:
+		if vm.static {
+			return ErrWriteProtection
+		}
+
+		key, err := vm.popKey()
+		if err != nil {
+			return err
+		}
+
+		if err := vm.contractState.DeleteStorage(vm.ctx.Address, key); err != nil {
+			return err
+		}
+		if vm.tracer != nil {
+			vm.tracer.CaptureStorage(vm.ctx.Address, key, nil)
+		}
+
+	case InstrCallDataLoad:
+		offset, err := vm.popInt()
+		if err != nil {
+			return err
+		}
+
+		word := make([]byte, 32)
+		if offset.IsInt64() && offset.Int64() < int64(len(vm.ctx.Input)) {
+			copy(word, vm.ctx.Input[offset.Int64():])
+		}
+		return vm.stack.Push(new(big.Int).SetBytes(word))
+
+	case InstrCallDataSize:
+		return vm.stack.Push(big.NewInt(int64(len(vm.ctx.Input))))
+
+	case InstrCallData:
+		return vm.stack.Push(append([]byte{}, vm.ctx.Input...))
+
+	case InstrCallDataCopy:
+		length, err := vm.popInt()
+		if err != nil {
+			return err
+		}
+		offset, err := vm.popInt()
+		if err != nil {
+			return err
+		}
+		if !length.IsInt64() || length.Sign() < 0 || length.Int64() > maxBytesLength {
+			return fmt.Errorf("calldatacopy: invalid length (%s)", length)
+		}
+		if err := vm.useCopyGas(int(length.Int64())); err != nil {
+			return err
+		}
+
+		b := make([]byte, length.Int64())
+		if offset.IsInt64() && offset.Int64() < int64(len(vm.ctx.Input)) {
+			copy(b, vm.ctx.Input[offset.Int64():])
+		}
+		return vm.stack.Push(b)
+
+	case InstrCaller:
+		return vm.stack.Push(new(big.Int).SetBytes(vm.ctx.Caller.ToSlice()))
+
+	case InstrCallValue:
+		return vm.stack.Push(new(big.Int).SetUint64(vm.ctx.Value))
+
+	case InstrAddress:
+		return vm.stack.Push(new(big.Int).SetBytes(vm.ctx.Address.ToSlice()))
+
+	case InstrHeight:
+		return vm.stack.Push(new(big.Int).SetUint64(uint64(vm.ctx.Height)))
+
+	case InstrTimestamp:
+		return vm.stack.Push(new(big.Int).SetUint64(uint64(vm.ctx.Timestamp)))
+
 	case InstrPushInt:
-		vm.stack.Push(int(vm.data[vm.ip-1]))
+		b, err := vm.readImmediate(0, 1)
+		if err != nil {
+			return err
+		}
+		return vm.stack.Push(new(big.Int).SetUint64(uint64(b[0])))
+
+	case InstrPushN:
+		n, err := vm.readImmediate(0, 1)
+		if err != nil {
+			return err
+		}
+		if n[0] == 0 || n[0] > 32 {
+			return fmt.Errorf("%w: invalid length (%d)", ErrTruncatedImmediate, n[0])
+		}
+		b, err := vm.readImmediate(1, int(n[0]))
+		if err != nil {
+			return err
+		}
+		return vm.stack.Push(new(big.Int).SetBytes(b))
 
 	case InstrPushByte:
-		vm.stack.Push(byte(vm.data[vm.ip-1]))
+		b, err := vm.readImmediate(0, 1)
+		if err != nil {
+			return err
+		}
+		return vm.stack.Push(b[0])
 
 	case InstrPack:
-		n := vm.stack.Pop().(int)
-		b := make([]byte, n)
+		n, err := vm.popInt()
+		if err != nil {
+			return err
+		}
+		if !n.IsInt64() || n.Int64() > int64(vm.stack.Len()) {
+			return fmt.Errorf("pack: invalid length (%s)", n)
+		}
 
-		for i := 0; i < n; i++ {
-			b[i] = vm.stack.Pop().(byte)
+		// 先弹出的是最后入栈的字节，打包结果按入栈顺序排列
+		b := make([]byte, n.Int64())
+		for i := len(b) - 1; i >= 0; i-- {
+			v, err := vm.stack.Pop()
+			if err != nil {
+				return err
+			}
+			c, ok := v.(byte)
+			if !ok {
+				return fmt.Errorf("pack: operand is not a byte")
+			}
+			b[i] = c
 		}
 
-		vm.stack.Push(b)
+		return vm.stack.Push(b)
 
-	case InstrSub:
-		a := vm.stack.Pop().(int)
-		b := vm.stack.Pop().(int)
-		c := a - b
-		vm.stack.Push(c)
+	case InstrConcat:
+		b, err := vm.popBytes()
+		if err != nil {
+			return err
+		}
+		a, err := vm.popBytes()
+		if err != nil {
+			return err
+		}
+		if len(a)+len(b) > maxBytesLength {
+			return fmt.Errorf("concat: result too long (%d)", len(a)+len(b))
+		}
+		if err := vm.useCopyGas(len(a) + len(b)); err != nil {
+			return err
+		}
 
-	case InstrAdd:
-		a := vm.stack.Pop().(int)
-		b := vm.stack.Pop().(int)
-		c := a + b
-		vm.stack.Push(c)
+		return vm.stack.Push(append(append([]byte{}, a...), b...))
+
+	case InstrDup:
+		v, err := vm.stack.Pop()
+		if err != nil {
+			return err
+		}
+		if err := vm.stack.Push(v); err != nil {
+			return err
+		}
+		return vm.stack.Push(v)
+
+	case InstrSwap:
+		a, err := vm.stack.Pop()
+		if err != nil {
+			return err
+		}
+		b, err := vm.stack.Pop()
+		if err != nil {
+			return err
+		}
+		if err := vm.stack.Push(a); err != nil {
+			return err
+		}
+		return vm.stack.Push(b)
+
+	case InstrPop:
+		_, err := vm.stack.Pop()
+		return err
+
+	case InstrDupN, InstrSwapN:
+		b, err := vm.readImmediate(0, 1)
+		if err != nil {
+			return err
+		}
+		if b[0] == 0 {
+			return fmt.Errorf("%w: invalid depth (0)", ErrTruncatedImmediate)
+		}
+		if instr == InstrDupN {
+			return vm.stack.dup(int(b[0]))
+		}
+		return vm.stack.swap(int(b[0]))
+
+	case InstrNot:
+		a, err := vm.popInt()
+		if err != nil {
+			return err
+		}
+		return vm.stack.Push(new(big.Int).Xor(a, wordMask))
+
+	case InstrAdd, InstrSub, InstrMul, InstrDiv, InstrMod, InstrExp,
+		InstrLt, InstrGt, InstrEq, InstrAnd, InstrOr, InstrXor, InstrShl, InstrShr:
+		b, err := vm.popInt()
+		if err != nil {
+			return err
+		}
+		a, err := vm.popInt()
+		if err != nil {
+			return err
+		}
+		return vm.stack.Push(binaryOp(instr, a, b))
+
+	default:
+		return fmt.Errorf("%w (%s) at position (%d)", ErrInvalidOpcode, instr, vm.ip)
 	}
 
 	return nil
 }
 
-func serializeInt64(value int64) []byte {
-	buf := make([]byte, 8)
+// jump 将指令指针移动到目标位置之前，目标必须是合法的 InstrJumpDest
+// 指令执行后指令指针加 1，因此目标 InstrJumpDest 与顺序执行到达时一样被执行并扣除 gas
+func (vm *VM) jump(dest *big.Int) error {
+	if !dest.IsInt64() || !vm.jumpDests[int(dest.Int64())] {
+		return fmt.Errorf("%w (%s)", ErrInvalidJump, dest)
+	}
+	vm.ip = int(dest.Int64()) - 1
+
+	return nil
+}
+
+// ImmediateSize 返回 pos 处操作码之前的立即数长度，虚拟机、静态校验与反汇编器都按它解码指令边界
+// InstrPushN 的长度包括长度字节本身；长度字节越过字节码开头时只计长度字节。
+// 返回的长度越过字节码开头时，该指令被截断
+func ImmediateSize(data []byte, pos int) int {
+	switch Instruction(data[pos]) {
+	case InstrPushInt, InstrPushByte, InstrDupN, InstrSwapN:
+		return 1
+	case InstrPushN:
+		if pos > 0 {
+			return 1 + int(data[pos-1])
+		}
+		return 1
+	}
+
+	return 0
+}
+
+// analyzeCode 从字节码末尾向前解码指令，标记每个操作码所在的位置
+// 操作码决定其前面立即数的长度，因此解码结果唯一；第一条指令的立即数可能越过字节码开头，即被截断
+func analyzeCode(data []byte) []bool {
+	ops := make([]bool, len(data))
+	for pos := len(data) - 1; pos >= 0; pos -= 1 + ImmediateSize(data, pos) {
+		ops[pos] = true
+	}
+
+	return ops
+}
+
+// analyzeJumpDests 找出所有位于操作码位置上的 InstrJumpDest，
+// 立即数中恰好等于 InstrJumpDest 的字节不是合法的跳转目标
+func analyzeJumpDests(data []byte, ops []bool) map[int]bool {
+	dests := make(map[int]bool)
+	for pos, op := range ops {
+		if op && Instruction(data[pos]) == InstrJumpDest {
+			dests[pos] = true
+		}
+	}
+
+	return dests
+}
+
+// readImmediate 读取当前操作码之前的 n 字节立即数，skip 为立即数末尾与操作码之间相隔的字节数
+// （InstrPushN 的长度字节），立即数越过字节码开头时返回 ErrTruncatedImmediate。
+func (vm *VM) readImmediate(skip, n int) ([]byte, error) {
+	end := vm.ip - skip
+	if end-n < 0 {
+		return nil, fmt.Errorf("%w at position (%d)", ErrTruncatedImmediate, vm.ip)
+	}
+
+	return vm.data[end-n : end], nil
+}
+
+// popKey 弹出一个存储键，存储键必须是字节切片。
+func (vm *VM) popKey() ([]byte, error) {
+	v, err := vm.stack.Pop()
+	if err != nil {
+		return nil, err
+	}
+	key, ok := v.([]byte)
+	if !ok {
+		return nil, fmt.Errorf("storage key is not a byte slice")
+	}
+
+	return key, nil
+}
+
+// popInt 弹出一个整数操作数。
+func (vm *VM) popInt() (*big.Int, error) {
+	x, err := vm.stack.Pop()
+	if err != nil {
+		return nil, err
+	}
+	v, ok := x.(*big.Int)
+	if !ok {
+		return nil, fmt.Errorf("operand is not an integer")
+	}
+
+	return v, nil
+}
+
+// popBytes 弹出一个操作数并转换为字节切片，整数编码为 32 字节大端整数。
+func (vm *VM) popBytes() ([]byte, error) {
+	v, err := vm.stack.Pop()
+	if err != nil {
+		return nil, err
+	}
+
+	return toBytes(v)
+}
+
+// binaryOp 计算二元运算 a op b，其中 a 先入栈，b 位于栈顶。
+// 结果对 2^256 取模；除数或模数为 0 时结果为 0。
+func binaryOp(instr Instruction, a, b *big.Int) *big.Int {
+	c := new(big.Int)
 
-	binary.LittleEndian.PutUint64(buf, uint64(value))
+	switch instr {
+	case InstrAdd:
+		c.Add(a, b)
+	case InstrSub:
+		c.Sub(a, b)
+	case InstrMul:
+		c.Mul(a, b)
+	case InstrDiv:
+		if b.Sign() != 0 {
+			c.Div(a, b)
+		}
+	case InstrMod:
+		if b.Sign() != 0 {
+			c.Mod(a, b)
+		}
+	case InstrExp:
+		c.Exp(a, b, wordModulus)
+	case InstrLt:
+		c.SetUint64(boolToUint(a.Cmp(b) < 0))
+	case InstrGt:
+		c.SetUint64(boolToUint(a.Cmp(b) > 0))
+	case InstrEq:
+		c.SetUint64(boolToUint(a.Cmp(b) == 0))
+	case InstrAnd:
+		c.And(a, b)
+	case InstrOr:
+		c.Or(a, b)
+	case InstrXor:
+		c.Xor(a, b)
+	case InstrShl:
+		if b.Cmp(big.NewInt(int64(wordBits))) < 0 {
+			c.Lsh(a, uint(b.Uint64()))
+		}
+	case InstrShr:
+		if b.Cmp(big.NewInt(int64(wordBits))) < 0 {
+			c.Rsh(a, uint(b.Uint64()))
+		}
+	}
+
+	return c.Mod(c, wordModulus)
+}
+
+// boolToUint 将布尔值转换为 1 或 0。
+func boolToUint(b bool) uint64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// encodeStorageValue 将栈上的值编码为带类型标记的存储值：
+// 整数编码为 storageTagWord + 32 字节大端整数，字节与字节切片编码为 storageTagBytes + 原始字节。
+func encodeStorageValue(v any) ([]byte, error) {
+	switch v := v.(type) {
+	case *big.Int:
+		return append([]byte{storageTagWord}, serializeWord(v)...), nil
+	case []byte:
+		return append([]byte{storageTagBytes}, v...), nil
+	case byte:
+		return []byte{storageTagBytes, v}, nil
+	default:
+		return nil, fmt.Errorf("cannot store value of type %T", v)
+	}
+}
+
+// decodeStorageValue 将存储值还原为栈上的值
+func decodeStorageValue(b []byte) (any, error) {
+	if len(b) == 0 {
+		return nil, fmt.Errorf("empty storage value")
+	}
+
+	switch b[0] {
+	case storageTagWord:
+		if len(b) != 33 {
+			return nil, fmt.Errorf("invalid storage word length (%d)", len(b)-1)
+		}
+		return deserializeWord(b[1:]), nil
+	case storageTagBytes:
+		return append([]byte{}, b[1:]...), nil
+	default:
+		return nil, fmt.Errorf("unknown storage value tag (%d)", b[0])
+	}
+}
 
-	return buf
+// serializeWord 将 256 位整数序列化为 32 字节大端字节切片。
+func serializeWord(value *big.Int) []byte {
+	return value.FillBytes(make([]byte, 32))
 }
 
-func deserializeInt64(b []byte) int64 {
-	return int64(binary.LittleEndian.Uint64(b))
+// deserializeWord 将 32 字节大端字节切片还原为 256 位整数。
+func deserializeWord(b []byte) *big.Int {
+	return new(big.Int).SetBytes(b)
 }
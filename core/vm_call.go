@@ -0,0 +1,156 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/felixkuang/titanchain/types"
+)
+
+// maxCallDepth 是合约之间嵌套调用的最大深度
+const maxCallDepth = 1024
+
+// execCall 执行 InstrCall 或 InstrStaticCall
+// 被调用合约在新的虚拟机帧中执行，与调用者共享状态但拥有独立的栈与 gas。
+// 调用失败（余额不足、超过调用深度、被调用方出错或回滚）时只撤销被调用方的修改，
+// 并向调用者的栈压入 0，调用者继续执行。
+func (vm *VM) execCall(static bool) error {
+	input, err := vm.popBytes()
+	if err != nil {
+		return err
+	}
+
+	gasArg, err := vm.popInt()
+	if err != nil {
+		return err
+	}
+
+	value := new(big.Int)
+	if !static {
+		if value, err = vm.popInt(); err != nil {
+			return err
+		}
+	}
+
+	addrInt, err := vm.popInt()
+	if err != nil {
+		return err
+	}
+	to := wordToAddress(addrInt)
+
+	if value.Sign() != 0 && vm.static {
+		return ErrWriteProtection
+	}
+
+	vm.lastReturnData = nil
+
+	gas := forwardGas(vm.gas, gasArg)
+
+	if vm.depth+1 >= maxCallDepth || !value.IsUint64() {
+		return vm.stack.Push(new(big.Int))
+	}
+
+	vm.gas -= gas
+
+	ctx := ExecContext{
+		Address:   to,
+		Caller:    vm.ctx.Address,
+		Value:     value.Uint64(),
+		Input:     input,
+		Height:    vm.ctx.Height,
+		Timestamp: vm.ctx.Timestamp,
+	}
+
+	returnData, gasLeft, logs, err := callFrame(vm.contractState, vm.config, ctx, gas, vm.depth+1, static || vm.static, vm.tracer)
+	vm.gas += gasLeft
+	vm.lastReturnData = returnData
+	vm.logs = append(vm.logs, logs...)
+
+	return vm.stack.Push(new(big.Int).SetUint64(boolToUint(err == nil)))
+}
+
+// forwardGas 返回外部调用转发给被调用方的 gas
+// 最多转发剩余 gas 的 63/64，保证调用者在被调用方耗尽 gas 后仍能继续执行
+func forwardGas(available uint64, requested *big.Int) uint64 {
+	gas := available - available/64
+	if requested.IsUint64() && requested.Uint64() < gas {
+		gas = requested.Uint64()
+	}
+
+	return gas
+}
+
+// callFrame 在状态快照之上执行一次从 ctx.Caller 到 ctx.Address 的外部调用，
+// 返回被调用方的返回数据、剩余 gas 与发出的事件，depth 为被调用方的调用深度
+// 被调用方按目标账户的 VMType 选择运行时，因此两种运行时的合约可以互相调用。
+// 调用失败时回滚到快照并丢弃事件；除回滚外的错误会消耗全部转发的 gas
+// 目标为预编译合约的保留地址时直接执行预编译合约，消耗其固定的 gas
+func callFrame(contractState *State, config VMConfig, ctx ExecContext, gas uint64, depth int, static bool, tracer Tracer) ([]byte, uint64, []*Log, error) {
+	snapshot := contractState.Snapshot()
+
+	if err := transfer(contractState, ctx.Caller, ctx.Address, ctx.Value); err != nil {
+		contractState.RevertToSnapshot(snapshot)
+		return nil, gas, nil, err
+	}
+
+	if p, ok := lookupPrecompile(ctx.Address); ok {
+		out, gasLeft, err := runPrecompile(p, ctx.Input, gas, config.hash)
+		if tracer != nil {
+			tracer.CaptureEnd(depth, out, gas-gasLeft, err)
+		}
+		if err != nil {
+			contractState.RevertToSnapshot(snapshot)
+			return nil, 0, nil, err
+		}
+		return out, gasLeft, nil, nil
+	}
+
+	// 目标地址上没有合约时视为普通转账
+	code, err := contractState.GetCode(ctx.Address)
+	if err != nil {
+		return nil, gas, nil, nil
+	}
+
+	acc, err := contractState.GetAccount(ctx.Address)
+	if err != nil {
+		contractState.RevertToSnapshot(snapshot)
+		return nil, gas, nil, err
+	}
+
+	config.GasLimit = gas
+
+	callee := newRuntime(acc.VMType, ctx, code, contractState, config)
+	callee.setFrame(depth, static)
+	callee.SetTracer(tracer)
+
+	if err := callee.Run(); err != nil {
+		contractState.RevertToSnapshot(snapshot)
+		if errors.Is(err, ErrExecutionReverted) {
+			return nil, gas - callee.GasUsed(), nil, err
+		}
+		return nil, 0, nil, err
+	}
+
+	return callee.ReturnData(), gas - callee.GasUsed(), callee.Logs(), nil
+}
+
+// wordToAddress 取整数的低 20 字节作为地址
+func wordToAddress(x *big.Int) types.Address {
+	word := serializeWord(x)
+	return types.AddressFromBytes(word[len(word)-20:])
+}
+
+// toBytes 将栈上的值转换为字节切片，整数编码为 32 字节大端整数
+func toBytes(v any) ([]byte, error) {
+	switch v := v.(type) {
+	case []byte:
+		return v, nil
+	case byte:
+		return []byte{v}, nil
+	case *big.Int:
+		return serializeWord(v), nil
+	default:
+		return nil, fmt.Errorf("cannot convert value of type %T to bytes", v)
+	}
+}
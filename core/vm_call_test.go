@@ -0,0 +1,197 @@
+package core
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/felixkuang/titanchain/types"
+)
+
+// addrWord 将地址转换为虚拟机中的整数
+func addrWord(addr types.Address) *big.Int {
+	return new(big.Int).SetBytes(addr.ToSlice())
+}
+
+// storeCallValue 返回将调用金额写入存储键 "k" 的字节码
+func storeCallValue() []byte {
+	return []byte{'k', byte(InstrPushByte), 1, byte(InstrPushInt), byte(InstrPack), byte(InstrCallValue), byte(InstrStore)}
+}
+
+// setupCall 创建调用者与被调用合约，调用者初始余额为 100
+func setupCall(t *testing.T, calleeCode []byte) (*State, types.Address, types.Address) {
+	state := NewState()
+	caller := types.Address{0x0a}
+	callee := types.Address{0x0b}
+
+	assert.Nil(t, state.PutAccount(caller, &Account{Balance: 100}))
+	assert.Nil(t, state.PutCode(callee, calleeCode))
+
+	return state, caller, callee
+}
+
+func TestVMCall(t *testing.T) {
+	code := append(storeCallValue(), 42, byte(InstrPushInt), byte(InstrReturn))
+	state, caller, callee := setupCall(t, code)
+
+	vm := newVMWithStack(caller, []byte{byte(InstrCall), byte(InstrReturnData)}, state,
+		addrWord(callee), big.NewInt(10), big.NewInt(100000), []byte("in"))
+	assert.Nil(t, vm.Run())
+
+	ret, err := vm.popBytes()
+	assert.Nil(t, err)
+	assert.Equal(t, serializeWord(big.NewInt(42)), ret)
+	ok, err := vm.popInt()
+	assert.Nil(t, err)
+	assertWord(t, big.NewInt(1), ok)
+
+	// 金额从调用者转给被调用合约
+	acc, _ := state.GetAccount(caller)
+	assert.Equal(t, uint64(90), acc.Balance)
+	acc, _ = state.GetAccount(callee)
+	assert.Equal(t, uint64(10), acc.Balance)
+
+	// 被调用合约写入自己的存储空间
+	b, err := state.GetStorage(callee, []byte("k"))
+	assert.Nil(t, err)
+	value, _ := decodeStorageValue(b)
+	assertWord(t, big.NewInt(10), value.(*big.Int))
+}
+
+func TestVMCallRevert(t *testing.T) {
+	code := append(storeCallValue(), byte(InstrRevert))
+	state, caller, callee := setupCall(t, code)
+
+	// 调用者先写入自己的存储，再调用会回滚的合约
+	vm := newVMWithStack(caller, []byte{byte(InstrStore), byte(InstrCall)}, state,
+		addrWord(callee), big.NewInt(10), big.NewInt(100000), []byte{}, []byte("a"), big.NewInt(1))
+	assert.Nil(t, vm.Run())
+
+	ok, _ := vm.popInt()
+	assertWord(t, big.NewInt(0), ok)
+
+	// 只撤销被调用方的修改与转账
+	_, err := state.GetStorage(callee, []byte("k"))
+	assert.NotNil(t, err)
+	acc, _ := state.GetAccount(caller)
+	assert.Equal(t, uint64(100), acc.Balance)
+	_, err = state.GetStorage(caller, []byte("a"))
+	assert.Nil(t, err)
+}
+
+func TestVMCallInsufficientBalance(t *testing.T) {
+	state, caller, callee := setupCall(t, []byte{byte(InstrHalt)})
+
+	vm := newVMWithStack(caller, []byte{byte(InstrCall)}, state,
+		addrWord(callee), big.NewInt(1000), big.NewInt(100000), []byte{})
+	assert.Nil(t, vm.Run())
+
+	ok, _ := vm.popInt()
+	assertWord(t, big.NewInt(0), ok)
+	acc, _ := state.GetAccount(callee)
+	assert.Equal(t, uint64(0), acc.Balance)
+}
+
+func TestVMCallWithoutCode(t *testing.T) {
+	state, caller, _ := setupCall(t, nil)
+	to := types.Address{0x0c}
+
+	vm := newVMWithStack(caller, []byte{byte(InstrCall)}, state,
+		addrWord(to), big.NewInt(5), big.NewInt(100000), []byte{})
+	assert.Nil(t, vm.Run())
+
+	ok, _ := vm.popInt()
+	assertWord(t, big.NewInt(1), ok)
+	acc, _ := state.GetAccount(to)
+	assert.Equal(t, uint64(5), acc.Balance)
+}
+
+func TestVMStaticCall(t *testing.T) {
+	state, caller, callee := setupCall(t, append(storeCallValue(), byte(InstrHalt)))
+
+	// 只读调用中写入存储失败
+	vm := newVMWithStack(caller, []byte{byte(InstrStaticCall)}, state,
+		addrWord(callee), big.NewInt(100000), []byte{})
+	assert.Nil(t, vm.Run())
+	ok, _ := vm.popInt()
+	assertWord(t, big.NewInt(0), ok)
+	_, err := state.GetStorage(callee, []byte("k"))
+	assert.NotNil(t, err)
+
+	// 只读调用可以返回数据
+	assert.Nil(t, state.PutCode(callee, []byte{7, byte(InstrPushInt), byte(InstrReturn)}))
+	vm = newVMWithStack(caller, []byte{byte(InstrStaticCall), byte(InstrReturnData)}, state,
+		addrWord(callee), big.NewInt(100000), []byte{})
+	assert.Nil(t, vm.Run())
+	ret, err := vm.popBytes()
+	assert.Nil(t, err)
+	assert.Equal(t, serializeWord(big.NewInt(7)), ret)
+	ok, _ = vm.popInt()
+	assertWord(t, big.NewInt(1), ok)
+}
+
+func TestVMCallGasForwarding(t *testing.T) {
+	// 被调用合约陷入死循环，耗尽转发的 gas
+	state, caller, callee := setupCall(t, []byte{byte(InstrJumpDest), 0, byte(InstrPushInt), byte(InstrJump)})
+
+	vm := newVMWithStack(caller, []byte{byte(InstrCall)}, state,
+		addrWord(callee), big.NewInt(0), wordMask, []byte{})
+	vm.gas, vm.gasLimit = 64000, 64000
+	assert.Nil(t, vm.Run())
+
+	ok, _ := vm.popInt()
+	assertWord(t, big.NewInt(0), ok)
+	// 调用者保留 1/64 的 gas
+	assert.Equal(t, (64000-GasCost(InstrCall))/64, vm.gas)
+
+	// 指定的 gas 上限小于可用 gas 时只转发指定数量
+	vm = newVMWithStack(caller, []byte{byte(InstrCall)}, state,
+		addrWord(callee), big.NewInt(0), big.NewInt(500), []byte{})
+	assert.Nil(t, vm.Run())
+	assert.Equal(t, GasCost(InstrCall)+500, vm.GasUsed())
+}
+
+func TestVMCallDepth(t *testing.T) {
+	state, caller, callee := setupCall(t, []byte{1, byte(InstrPushInt), byte(InstrReturn)})
+
+	vm := newVMWithStack(caller, []byte{byte(InstrCall)}, state,
+		addrWord(callee), big.NewInt(0), big.NewInt(100000), []byte{})
+	vm.depth = maxCallDepth - 1
+	assert.Nil(t, vm.Run())
+
+	ok, _ := vm.popInt()
+	assertWord(t, big.NewInt(0), ok)
+}
+
+func TestVMLogs(t *testing.T) {
+	state, caller, callee := setupCall(t, []byte{byte(InstrCallData), byte(InstrLog0), byte(InstrHalt)})
+
+	// 操作数依次为数据与两个主题
+	vm := newVMWithStack(caller, []byte{byte(InstrLog2)}, state, []byte("data"), big.NewInt(1), big.NewInt(2))
+	assert.Nil(t, vm.Run())
+	assert.Equal(t, 1, len(vm.Logs()))
+	l := vm.Logs()[0]
+	assert.Equal(t, caller, l.Address)
+	assert.Equal(t, []types.Hash{types.HashFromBytes(serializeWord(big.NewInt(1))), types.HashFromBytes(serializeWord(big.NewInt(2)))}, l.Topics)
+	assert.Equal(t, []byte("data"), l.Data)
+
+	// 成功的嵌套调用发出的事件归入调用者
+	vm = newVMWithStack(caller, []byte{byte(InstrCall)}, state,
+		addrWord(callee), big.NewInt(0), big.NewInt(100000), []byte("x"))
+	assert.Nil(t, vm.Run())
+	assert.Equal(t, 1, len(vm.Logs()))
+	assert.Equal(t, callee, vm.Logs()[0].Address)
+
+	// 回滚的嵌套调用发出的事件被丢弃
+	assert.Nil(t, state.PutCode(callee, []byte{byte(InstrCallData), byte(InstrLog0), byte(InstrRevert)}))
+	vm = newVMWithStack(caller, []byte{byte(InstrCall)}, state,
+		addrWord(callee), big.NewInt(0), big.NewInt(100000), []byte("x"))
+	assert.Nil(t, vm.Run())
+	assert.Equal(t, 0, len(vm.Logs()))
+
+	// 只读调用中不能发出事件
+	vm = newVMWithStack(caller, []byte{byte(InstrLog0)}, state, []byte("x"))
+	vm.static = true
+	assert.ErrorIs(t, vm.Run(), ErrWriteProtection)
+}
@@ -1,33 +1,506 @@
 package core
 
 import (
+	"math/big"
 	"testing"
 
+	"github.com/felixkuang/titanchain/types"
 	"github.com/stretchr/testify/assert"
 )
 
 func TestStack(t *testing.T) {
-	s := NewStack(128)
+	s := NewStack(2)
 
-	s.Push(1)
-	s.Push(2)
+	assert.Nil(t, s.Push(1))
+	assert.Nil(t, s.Push(2))
+	assert.ErrorIs(t, s.Push(3), ErrStackOverflow)
+	assert.Equal(t, 2, s.Len())
 
-	value := s.Pop()
-	assert.Equal(t, value, 1)
+	// 后进先出
+	value, err := s.Pop()
+	assert.Nil(t, err)
+	assert.Equal(t, 2, value)
+
+	value, err = s.Pop()
+	assert.Nil(t, err)
+	assert.Equal(t, 1, value)
 
-	value = s.Pop()
-	assert.Equal(t, value, 2)
+	_, err = s.Pop()
+	assert.ErrorIs(t, err, ErrStackUnderflow)
+}
+
+func TestVMStackErrors(t *testing.T) {
+	// 空栈上执行二元运算
+	err := NewVM([]byte{1, byte(InstrPushInt), byte(InstrAdd)}, NewState()).Run()
+	assert.ErrorIs(t, err, ErrStackUnderflow)
+
+	err = NewVM([]byte{byte(InstrPop)}, NewState()).Run()
+	assert.ErrorIs(t, err, ErrStackUnderflow)
+
+	// 不断复制栈顶直到超过容量
+	data := []byte{1, byte(InstrPushInt), byte(InstrJumpDest), byte(InstrDup), 2, byte(InstrPushInt), byte(InstrJump)}
+	vm := NewVMWithConfig(data, NewState(), VMConfig{StackSize: 16, GasLimit: 1_000_000})
+	assert.ErrorIs(t, vm.Run(), ErrStackOverflow)
+	assert.Equal(t, 16, vm.stack.Len())
 }
 
 func TestVM(t *testing.T) {
-	data := []byte{0x03, 0x0a, 0x46, 0x0c, 0x4f, 0x0c, 0x4f, 0x0c, 0x0d, 0x05, 0x0a, 0x0f}
+	data := []byte{0x46, 0x0c, 0x4f, 0x0c, 0x4f, 0x0c, 0x03, 0x0a, 0x0d, 0x05, 0x0a, 0x0f}
 	contractState := NewState()
 	vm := NewVM(data, contractState)
 
 	assert.Nil(t, vm.Run())
 
-	valueBytes, err := contractState.Get([]byte("FOO"))
-	value := deserializeInt64(valueBytes)
+	valueBytes, err := contractState.GetStorage(types.Address{}, []byte("FOO"))
+	assert.Nil(t, err)
+	value, err := decodeStorageValue(valueBytes)
+	assert.Nil(t, err)
+	assertWord(t, big.NewInt(5), value.(*big.Int))
+}
+
+func TestVMCopyGas(t *testing.T) {
+	config := DefaultChainConfig().VM
+	copyCode := func(length ...byte) []byte {
+		code := []byte{0, byte(InstrPushInt)}
+		code = append(code, length...)
+		return append(code, byte(len(length)), byte(InstrPushN), byte(InstrCallDataCopy))
+	}
+
+	// 按输出长度每 32 字节收费，不足 32 字节按 32 字节计
+	short := NewContractVM(ExecContext{}, copyCode(0x00, 0x00, 0x01), NewState(), config)
+	assert.Nil(t, short.Run())
+	long := NewContractVM(ExecContext{}, copyCode(0x01, 0x00, 0x00), NewState(), config)
+	assert.Nil(t, long.Run())
+	assert.Equal(t, uint64(maxBytesLength/32-1)*copyWordGas, long.GasUsed()-short.GasUsed())
+
+	// gas 不足以支付复制时在分配之前失败
+	limited := config
+	limited.GasLimit = long.GasUsed() - 1
+	vm := NewContractVM(ExecContext{}, copyCode(0x01, 0x00, 0x00), NewState(), limited)
+	assert.ErrorIs(t, vm.Run(), ErrOutOfGas)
+	assert.Equal(t, 0, vm.stack.Len())
+
+	// 拼接同样按结果长度收费
+	a := make([]byte, 1000)
+	b := make([]byte, 1000)
+	vm = newVMWithStack(types.Address{}, []byte{byte(InstrConcat)}, NewState(), a, b)
+	assert.Nil(t, vm.Run())
+	assert.Equal(t, GasCost(InstrConcat)+uint64(2000+31)/32*copyWordGas, vm.GasUsed())
+}
+
+// newVMWithStack 创建执行 addr 处代码的虚拟机，并按顺序预先压入栈元素
+func newVMWithStack(addr types.Address, data []byte, state *State, items ...any) *VM {
+	vm := NewContractVM(ExecContext{Address: addr}, data, state, DefaultChainConfig().VM)
+	for _, item := range items {
+		vm.stack.Push(item)
+	}
+
+	return vm
+}
+
+func TestVMStorage(t *testing.T) {
+	state := NewState()
+	addrA := types.Address{0x0a}
+	addrB := types.Address{0x0b}
+	key := []byte("k")
+
+	// 合约 A 写入整数 7
+	vm := newVMWithStack(addrA, []byte{byte(InstrStore)}, state, key, big.NewInt(7))
+	assert.Nil(t, vm.Run())
+
+	// 合约 A 读回整数
+	vm = newVMWithStack(addrA, []byte{byte(InstrLoad)}, state, key)
+	assert.Nil(t, vm.Run())
+	v, err := vm.popInt()
+	assert.Nil(t, err)
+	assertWord(t, big.NewInt(7), v)
+
+	// 合约 B 读不到合约 A 的存储，得到 0
+	vm = newVMWithStack(addrB, []byte{byte(InstrLoad)}, state, key)
+	assert.Nil(t, vm.Run())
+	v, err = vm.popInt()
+	assert.Nil(t, err)
+	assertWord(t, big.NewInt(0), v)
+
+	// 删除后读到 0
+	vm = newVMWithStack(addrA, []byte{byte(InstrDelete)}, state, key)
+	assert.Nil(t, vm.Run())
+	_, err = state.GetStorage(addrA, key)
+	assert.NotNil(t, err)
+
+	vm = newVMWithStack(addrA, []byte{byte(InstrLoad)}, state, key)
+	assert.Nil(t, vm.Run())
+	v, err = vm.popInt()
+	assert.Nil(t, err)
+	assertWord(t, big.NewInt(0), v)
+}
+
+func TestVMStorageBytes(t *testing.T) {
+	state := NewState()
+	addr := types.Address{0x0a}
+
+	// 值为字节切片
+	vm := newVMWithStack(addr, []byte{byte(InstrStore)}, state, []byte("k"), []byte("hi"))
+	assert.Nil(t, vm.Run())
+
+	vm = newVMWithStack(addr, []byte{byte(InstrLoad)}, state, []byte("k"))
+	assert.Nil(t, vm.Run())
+	v, err := vm.popBytes()
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("hi"), v)
+
+	// 单个字节按长度为 1 的字节切片存储
+	data := []byte{0x2a, byte(InstrPushByte), byte(InstrStore)}
+	vm = newVMWithStack(addr, data, state, []byte("b"))
+	assert.Nil(t, vm.Run())
+
+	b, err := state.GetStorage(addr, []byte("b"))
+	assert.Nil(t, err)
+	value, err := decodeStorageValue(b)
+	assert.Nil(t, err)
+	assert.Equal(t, []byte{0x2a}, value)
+}
+
+func TestVMStorageInvalidKey(t *testing.T) {
+	data := []byte{1, byte(InstrPushInt), 2, byte(InstrPushInt), byte(InstrStore)}
+	assert.NotNil(t, NewVM(data, NewState()).Run())
+
+	data = []byte{1, byte(InstrPushInt), byte(InstrLoad)}
+	assert.NotNil(t, NewVM(data, NewState()).Run())
+}
+
+// pushWord 生成将整数 x 压栈的 InstrPushN 字节码
+func pushWord(x *big.Int) []byte {
+	b := x.Bytes()
+	if len(b) == 0 {
+		b = []byte{0x00}
+	}
+
+	return append(b, byte(len(b)), byte(InstrPushN))
+}
+
+// word 将十六进制或十进制字符串解析为整数
+func word(s string) *big.Int {
+	x, ok := new(big.Int).SetString(s, 0)
+	if !ok {
+		panic("invalid word " + s)
+	}
+
+	return x
+}
+
+// runProgram 执行字节码并返回栈上唯一的结果
+func runProgram(t *testing.T, data []byte) *big.Int {
+	vm := NewVM(data, NewState())
+	assert.Nil(t, vm.Run())
+	assert.Equal(t, 1, vm.stack.sp)
+
+	v, err := vm.popInt()
+	assert.Nil(t, err)
+
+	return v
+}
+
+// assertWord 按数值比较两个整数
+func assertWord(t *testing.T, want, got *big.Int) {
+	t.Helper()
+	assert.Equal(t, want.String(), got.String())
+}
+
+func TestVMBinaryOps(t *testing.T) {
+	max := "0xffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffff"
+	high := "0x8000000000000000000000000000000000000000000000000000000000000000"
+
+	cases := []struct {
+		name  string
+		instr Instruction
+		a, b  string
+		want  string
+	}{
+		{"add", InstrAdd, "2", "3", "5"},
+		{"add overflow wraps", InstrAdd, max, "1", "0"},
+		{"add max+max", InstrAdd, max, max, "0xfffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffe"},
+		{"sub", InstrSub, "10", "4", "6"},
+		{"sub underflow wraps", InstrSub, "0", "1", max},
+		{"sub equal", InstrSub, max, max, "0"},
+		{"mul", InstrMul, "6", "7", "42"},
+		{"mul overflow wraps", InstrMul, high, "2", "0"},
+		{"mul max*max", InstrMul, max, max, "1"},
+		{"div", InstrDiv, "10", "3", "3"},
+		{"div by zero", InstrDiv, "10", "0", "0"},
+		{"div max", InstrDiv, max, max, "1"},
+		{"mod", InstrMod, "10", "3", "1"},
+		{"mod by zero", InstrMod, "10", "0", "0"},
+		{"mod larger divisor", InstrMod, "3", "10", "3"},
+		{"exp", InstrExp, "2", "10", "1024"},
+		{"exp zero exponent", InstrExp, "0", "0", "1"},
+		{"exp 2^255", InstrExp, "2", "255", high},
+		{"exp overflow wraps", InstrExp, "2", "256", "0"},
+		{"lt true", InstrLt, "1", "2", "1"},
+		{"lt false", InstrLt, "2", "1", "0"},
+		{"lt equal", InstrLt, "2", "2", "0"},
+		{"lt is unsigned", InstrLt, high, "1", "0"},
+		{"gt true", InstrGt, "2", "1", "1"},
+		{"gt false", InstrGt, "1", "2", "0"},
+		{"gt equal", InstrGt, "2", "2", "0"},
+		{"gt is unsigned", InstrGt, max, "0", "1"},
+		{"eq true", InstrEq, max, max, "1"},
+		{"eq false", InstrEq, "1", "2", "0"},
+		{"and", InstrAnd, "0xf0f0", "0xff00", "0xf000"},
+		{"and max", InstrAnd, max, "0x1234", "0x1234"},
+		{"or", InstrOr, "0xf0f0", "0x0f00", "0xfff0"},
+		{"or zero", InstrOr, "0", "0", "0"},
+		{"xor", InstrXor, "0xff00", "0x0ff0", "0xf0f0"},
+		{"xor self", InstrXor, max, max, "0"},
+		{"shl", InstrShl, "1", "8", "256"},
+		{"shl truncates", InstrShl, max, "4", "0xfffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffff0"},
+		{"shl 255", InstrShl, "1", "255", high},
+		{"shl 256", InstrShl, "1", "256", "0"},
+		{"shl huge", InstrShl, "1", max, "0"},
+		{"shr", InstrShr, "256", "8", "1"},
+		{"shr is logical", InstrShr, high, "255", "1"},
+		{"shr 256", InstrShr, max, "256", "0"},
+		{"shr huge", InstrShr, max, max, "0"},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			data := append(pushWord(word(c.a)), pushWord(word(c.b))...)
+			data = append(data, byte(c.instr))
+
+			assertWord(t, word(c.want), runProgram(t, data))
+		})
+	}
+}
+
+func TestVMNot(t *testing.T) {
+	cases := []struct {
+		a, want string
+	}{
+		{"0", "0xffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffff"},
+		{"0xffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffff", "0"},
+		{"1", "0xfffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffe"},
+	}
+
+	for _, c := range cases {
+		data := append(pushWord(word(c.a)), byte(InstrNot))
+		assertWord(t, word(c.want), runProgram(t, data))
+	}
+}
+
+func TestVMStackOps(t *testing.T) {
+	// dup 后相加：3 + 3
+	data := []byte{3, byte(InstrPushInt), byte(InstrDup), byte(InstrAdd)}
+	assertWord(t, big.NewInt(6), runProgram(t, data))
+
+	// swap 交换操作数顺序：10 - 4 变为 4 - 10
+	data = []byte{10, byte(InstrPushInt), 4, byte(InstrPushInt), byte(InstrSwap), byte(InstrSub)}
+	assertWord(t, new(big.Int).Sub(wordModulus, big.NewInt(6)), runProgram(t, data))
+
+	// pop 丢弃栈顶元素
+	data = []byte{1, byte(InstrPushInt), 2, byte(InstrPushInt), byte(InstrPop)}
+	assertWord(t, big.NewInt(1), runProgram(t, data))
+
+	// dupn 2 复制从栈顶数第 2 个元素：[7 8] -> [7 8 7]，再计算 7 + (8 - 7)
+	data = []byte{7, byte(InstrPushInt), 8, byte(InstrPushInt), 2, byte(InstrDupN), byte(InstrSub), byte(InstrAdd)}
+	assertWord(t, big.NewInt(8), runProgram(t, data))
+
+	// swapn 2 交换栈顶与从栈顶数第 3 个元素：[7 8 9] -> [9 8 7]，再计算 9 - (8 - 7)
+	data = []byte{7, byte(InstrPushInt), 8, byte(InstrPushInt), 9, byte(InstrPushInt), 2, byte(InstrSwapN), byte(InstrSub), byte(InstrSub)}
+	assertWord(t, big.NewInt(8), runProgram(t, data))
+
+	for _, code := range [][]byte{
+		{1, byte(InstrPushInt), 2, byte(InstrDupN)},
+		{1, byte(InstrPushInt), 2, byte(InstrPushInt), 2, byte(InstrSwapN)},
+		{1, byte(InstrPushInt), 0, byte(InstrDupN)},
+	} {
+		assert.NotNil(t, NewVM(code, NewState()).Run())
+	}
+}
+
+func TestVMPushN(t *testing.T) {
+	data := []byte{0x01, 0x00, 2, byte(InstrPushN)}
+	assertWord(t, big.NewInt(256), runProgram(t, data))
+
+	// 长度不合法
+	vm := NewVM([]byte{33, byte(InstrPushN)}, NewState())
+	assert.NotNil(t, vm.Run())
+
+	// 立即数被截断
+	vm = NewVM([]byte{0x01, 4, byte(InstrPushN)}, NewState())
+	assert.NotNil(t, vm.Run())
+
+	vm = NewVM([]byte{byte(InstrPushInt)}, NewState())
+	assert.NotNil(t, vm.Run())
+}
+
+func TestVMInvalidOpcode(t *testing.T) {
+	err := NewVM([]byte{1, byte(InstrPushInt), 0xee}, NewState()).Run()
+	assert.ErrorIs(t, err, ErrInvalidOpcode)
+}
+
+func TestVMTypeMismatch(t *testing.T) {
+	data := []byte{1, byte(InstrPushByte), 1, byte(InstrPushInt), byte(InstrAdd)}
+	vm := NewVM(data, NewState())
+	assert.NotNil(t, vm.Run())
+}
+
+func TestVMJumpI(t *testing.T) {
+	// 计数器从 5 递减到 0 的循环
+	data := []byte{
+		5, byte(InstrPushInt), // 0
+		byte(InstrJumpDest),   // 2
+		1, byte(InstrPushInt), // 3
+		byte(InstrSub),        // 5
+		byte(InstrDup),        // 6
+		2, byte(InstrPushInt), // 7
+		byte(InstrSwap),  // 9
+		byte(InstrJumpI), // 10
+	}
+	vm := NewVM(data, NewState())
+	assert.Nil(t, vm.Run())
+
+	v, err := vm.popInt()
+	assert.Nil(t, err)
+	assert.Equal(t, int64(0), v.Int64())
+
+	// 每次进入循环（包括跳转到达）都执行并扣除 InstrJumpDest 的 gas
+	loop := GasCost(InstrJumpDest) + GasCost(InstrPushInt) + GasCost(InstrSub) + GasCost(InstrDup) +
+		GasCost(InstrPushInt) + GasCost(InstrSwap) + GasCost(InstrJumpI)
+	assert.Equal(t, GasCost(InstrPushInt)+5*loop, vm.GasUsed())
+}
+
+func TestVMJump(t *testing.T) {
+	// 跳过中间的 push
+	data := []byte{
+		6, byte(InstrPushInt), // 0
+		byte(InstrJump),       // 2
+		9, byte(InstrPushInt), // 3
+		byte(InstrHalt),       // 5
+		byte(InstrJumpDest),   // 6
+		1, byte(InstrPushInt), // 7
+	}
+	assertWord(t, big.NewInt(1), runProgram(t, data))
+}
+
+func TestVMInvalidJump(t *testing.T) {
+	cases := map[string][]byte{
+		"not a jumpdest":    {3, byte(InstrPushInt), byte(InstrJump), 1, byte(InstrPushInt)},
+		"inside immediate":  {3, byte(InstrPushInt), byte(InstrJump), byte(InstrJumpDest), byte(InstrPushInt)},
+		"out of range":      {200, byte(InstrPushInt), byte(InstrJump)},
+		"conditional taken": {0, byte(InstrPushInt), 1, byte(InstrPushInt), byte(InstrJumpI)},
+	}
+
+	for name, data := range cases {
+		t.Run(name, func(t *testing.T) {
+			err := NewVM(data, NewState()).Run()
+			assert.ErrorIs(t, err, ErrInvalidJump)
+		})
+	}
+}
+
+func TestVMCallSub(t *testing.T) {
+	data := []byte{
+		6, byte(InstrPushInt), // 0
+		byte(InstrCallSub),    // 2
+		7, byte(InstrPushInt), // 3
+		byte(InstrHalt),       // 5
+		byte(InstrJumpDest),   // 6
+		1, byte(InstrPushInt), // 7
+		byte(InstrRetSub), // 9
+	}
+	vm := NewVM(data, NewState())
+	assert.Nil(t, vm.Run())
+	assert.Equal(t, 2, vm.stack.sp)
+	assert.Equal(t, 0, len(vm.returnStack))
+
+	a, _ := vm.popInt()
+	b, _ := vm.popInt()
+	assert.Equal(t, int64(7), a.Int64())
+	assert.Equal(t, int64(1), b.Int64())
+
+	err := NewVM([]byte{byte(InstrRetSub)}, NewState()).Run()
+	assert.ErrorIs(t, err, ErrReturnStackUnderflow)
+}
+
+func TestVMHaltAndRevert(t *testing.T) {
+	data := []byte{1, byte(InstrPushInt), byte(InstrHalt), 2, byte(InstrPushInt)}
+	assertWord(t, big.NewInt(1), runProgram(t, data))
+
+	data = []byte{1, byte(InstrPushInt), byte(InstrRevert), 2, byte(InstrPushInt)}
+	assert.ErrorIs(t, NewVM(data, NewState()).Run(), ErrExecutionReverted)
+}
+
+func TestVMOutOfGas(t *testing.T) {
+	// 死循环
+	data := []byte{byte(InstrJumpDest), 0, byte(InstrPushInt), byte(InstrJump)}
+	vm := NewVMWithConfig(data, NewState(), VMConfig{StackSize: 128, GasLimit: 1000})
+	assert.ErrorIs(t, vm.Run(), ErrOutOfGas)
+	assert.Equal(t, uint64(1000), vm.GasUsed())
+
+	// gas 恰好足够
+	data = []byte{1, byte(InstrPushInt), 2, byte(InstrPushInt), byte(InstrAdd)}
+	vm = NewVMWithConfig(data, NewState(), VMConfig{StackSize: 128, GasLimit: 5})
+	assert.Nil(t, vm.Run())
+
+	vm = NewVMWithConfig(data, NewState(), VMConfig{StackSize: 128, GasLimit: 4})
+	assert.ErrorIs(t, vm.Run(), ErrOutOfGas)
+}
+
+func TestVMCallData(t *testing.T) {
+	input := make([]byte, 40)
+	for i := range input {
+		input[i] = byte(i + 1)
+	}
+	ctx := ExecContext{Input: input}
+	config := DefaultChainConfig().VM
+
+	// 偏移 8 开始恰好读满 32 字节
+	vm := NewContractVM(ctx, []byte{8, byte(InstrPushInt), byte(InstrCallDataLoad)}, NewState(), config)
+	assert.Nil(t, vm.Run())
+	v, _ := vm.popInt()
+	assertWord(t, new(big.Int).SetBytes(input[8:40]), v)
+
+	// 越界部分补 0
+	vm = NewContractVM(ctx, []byte{39, byte(InstrPushInt), byte(InstrCallDataLoad)}, NewState(), config)
+	assert.Nil(t, vm.Run())
+	v, _ = vm.popInt()
+	word := make([]byte, 32)
+	word[0] = input[39]
+	assertWord(t, new(big.Int).SetBytes(word), v)
+
+	vm = NewContractVM(ctx, []byte{200, byte(InstrPushInt), byte(InstrCallDataLoad)}, NewState(), config)
+	assert.Nil(t, vm.Run())
+	v, _ = vm.popInt()
+	assertWord(t, big.NewInt(0), v)
+
+	vm = NewContractVM(ctx, []byte{byte(InstrCallData)}, NewState(), config)
+	assert.Nil(t, vm.Run())
+	b, err := vm.popBytes()
+	assert.Nil(t, err)
+	assert.Equal(t, input, b)
+}
+
+func TestVMCallDataCopyAndConcat(t *testing.T) {
+	input := []byte{0x01, 0x02, 0x03, 0x04}
+	ctx := ExecContext{Input: input}
+	config := DefaultChainConfig().VM
+
+	// 从偏移 2 复制 4 字节，越界部分补 0
+	vm := NewContractVM(ctx, []byte{2, byte(InstrPushInt), 4, byte(InstrPushInt), byte(InstrCallDataCopy)}, NewState(), config)
+	assert.Nil(t, vm.Run())
+	b, err := vm.popBytes()
+	assert.Nil(t, err)
+	assert.Equal(t, []byte{0x03, 0x04, 0x00, 0x00}, b)
+
+	vm = NewContractVM(ctx, []byte{0, byte(InstrPushInt), 0x01, 0x00, 0x01, 3, byte(InstrPushN), byte(InstrCallDataCopy)}, NewState(), config)
+	assert.NotNil(t, vm.Run())
+
+	// 按入栈顺序拼接，整数编码为 32 字节
+	vm = newVMWithStack(types.Address{}, []byte{byte(InstrConcat), byte(InstrConcat)}, NewState(),
+		[]byte("ab"), byte('c'), big.NewInt(1))
+	assert.Nil(t, vm.Run())
+	b, err = vm.popBytes()
 	assert.Nil(t, err)
-	assert.Equal(t, value, int64(5))
+	assert.Equal(t, append([]byte("abc"), serializeWord(big.NewInt(1))...), b)
 }
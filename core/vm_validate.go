@@ -0,0 +1,330 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+// CodeIssue 描述字节码静态校验发现的一个问题
+type CodeIssue struct {
+	Pos int         // 问题指令在字节码中的位置
+	Op  Instruction // 问题指令
+	Err error       // 问题类型，如 ErrInvalidOpcode、ErrInvalidJump、ErrStackUnderflow
+}
+
+func (i CodeIssue) String() string {
+	return fmt.Sprintf("position %d (%s): %s", i.Pos, i.Op, i.Err)
+}
+
+// CodeError 是字节码静态校验失败时返回的错误，包含发现的全部问题
+type CodeError struct {
+	Issues []CodeIssue
+}
+
+func (e *CodeError) Error() string {
+	msgs := make([]string, len(e.Issues))
+	for i, issue := range e.Issues {
+		msgs[i] = issue.String()
+	}
+
+	return fmt.Sprintf("invalid code: %s", strings.Join(msgs, "; "))
+}
+
+// Is 使 errors.Is 可以按问题类型匹配，如 errors.Is(err, ErrInvalidJump)
+func (e *CodeError) Is(target error) bool {
+	for _, issue := range e.Issues {
+		if errors.Is(issue.Err, target) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// stackEffect 记录指令弹出与压入的操作数个数
+type stackEffect struct {
+	pops   int
+	pushes int
+}
+
+// stackEffects 记录指令的栈效果，InstrPack 还需弹出与长度操作数相等个数的字节，
+// InstrDupN 与 InstrSwapN 的栈效果由立即数决定
+var stackEffects = map[Instruction]stackEffect{
+	InstrPushN: {0, 1}, InstrPushInt: {0, 1}, InstrPushByte: {0, 1},
+	InstrAdd: {2, 1}, InstrSub: {2, 1}, InstrMul: {2, 1}, InstrDiv: {2, 1}, InstrMod: {2, 1}, InstrExp: {2, 1},
+	InstrLt: {2, 1}, InstrGt: {2, 1}, InstrEq: {2, 1},
+	InstrAnd: {2, 1}, InstrOr: {2, 1}, InstrXor: {2, 1}, InstrShl: {2, 1}, InstrShr: {2, 1},
+	InstrNot: {1, 1}, InstrPack: {1, 1}, InstrConcat: {2, 1},
+	InstrDup: {1, 2}, InstrSwap: {2, 2}, InstrPop: {1, 0}, InstrDupN: {0, 0}, InstrSwapN: {0, 0},
+	InstrJump: {1, 0}, InstrJumpI: {2, 0}, InstrCallSub: {1, 0},
+	InstrReturn: {1, 0},
+	InstrStore:  {2, 0}, InstrLoad: {1, 1}, InstrDelete: {1, 0},
+	InstrCallDataLoad: {1, 1}, InstrCallDataSize: {0, 1}, InstrCallData: {0, 1}, InstrCallDataCopy: {2, 1},
+	InstrCaller: {0, 1}, InstrCallValue: {0, 1}, InstrAddress: {0, 1},
+	InstrHeight: {0, 1}, InstrTimestamp: {0, 1}, InstrReturnData: {0, 1},
+	InstrCall: {4, 1}, InstrStaticCall: {3, 1},
+	InstrLog0: {1, 0}, InstrLog1: {2, 0}, InstrLog2: {3, 0}, InstrLog3: {4, 0}, InstrLog4: {5, 0},
+}
+
+// ValidateCode 在部署前对字节码做静态校验，发现问题时返回 *CodeError
+// 1. 逐条扫描指令，拒绝未知操作码与被截断或长度不合法的立即数
+// 2. 从入口沿控制流模拟栈深度，拒绝必然发生的栈下溢、超过 config.StackSize 的栈溢出，
+// 以及目标为常量但不是合法 InstrJumpDest 的跳转
+// 栈深度只在能静态确定时检查：经不同路径到达同一位置且深度不同、动态跳转目标、
+// 子程序返回之后的代码都不做栈检查，由虚拟机在运行时检查。config.StackSize 为 0 时不检查栈溢出
+func ValidateCode(code []byte, config VMConfig) error {
+	issues := scanCode(code)
+	if len(issues) == 0 {
+		issues = newCodeAnalyzer(code, config.StackSize).run()
+	}
+	if len(issues) > 0 {
+		return &CodeError{Issues: issues}
+	}
+
+	return nil
+}
+
+// scanCode 逐条扫描指令，返回未知操作码与立即数问题
+func scanCode(code []byte) []CodeIssue {
+	var issues []CodeIssue
+
+	for pos, isOp := range analyzeCode(code) {
+		if !isOp {
+			continue
+		}
+		op := Instruction(code[pos])
+
+		if !op.IsValid() {
+			issues = append(issues, CodeIssue{Pos: pos, Op: op, Err: ErrInvalidOpcode})
+			continue
+		}
+
+		if op == InstrPushN && pos > 0 && (code[pos-1] == 0 || code[pos-1] > 32) {
+			issues = append(issues, CodeIssue{Pos: pos, Op: op, Err: fmt.Errorf("%w: invalid length (%d)", ErrTruncatedImmediate, code[pos-1])})
+			continue
+		}
+
+		if (op == InstrDupN || op == InstrSwapN) && pos > 0 && code[pos-1] == 0 {
+			issues = append(issues, CodeIssue{Pos: pos, Op: op, Err: fmt.Errorf("%w: invalid depth (0)", ErrTruncatedImmediate)})
+			continue
+		}
+
+		if pos-ImmediateSize(code, pos) < 0 {
+			issues = append(issues, CodeIssue{Pos: pos, Op: op, Err: ErrTruncatedImmediate})
+		}
+	}
+
+	return issues
+}
+
+// absStack 是静态分析中的抽象操作数栈，nil 元素表示值未知，known 为 false 时栈深度未知
+type absStack struct {
+	items []*big.Int
+	known bool
+}
+
+// codeAnalyzer 沿控制流模拟栈深度
+type codeAnalyzer struct {
+	code      []byte
+	stackSize int
+	ops       []bool // 每个位置是否为操作码
+	jumpDests map[int]bool
+	visited   map[int]*absStack // 每个分析入口已分析过的抽象栈
+	queue     []int             // 待分析的入口位置
+	issues    []CodeIssue
+}
+
+func newCodeAnalyzer(code []byte, stackSize int) *codeAnalyzer {
+	ops := analyzeCode(code)
+
+	return &codeAnalyzer{
+		code:      code,
+		stackSize: stackSize,
+		ops:       ops,
+		jumpDests: analyzeJumpDests(code, ops),
+		visited:   make(map[int]*absStack),
+	}
+}
+
+// run 从入口开始分析，返回发现的问题
+func (a *codeAnalyzer) run() []CodeIssue {
+	a.enqueue(0, &absStack{known: true})
+
+	for len(a.queue) > 0 {
+		pos := a.queue[0]
+		a.queue = a.queue[1:]
+
+		a.block(pos, a.visited[pos].clone())
+	}
+
+	return a.issues
+}
+
+// enqueue 将到达 pos 的抽象栈加入待分析队列
+// 已分析过的位置以相同深度再次到达时不再分析；深度不同时以未知深度重新分析一次
+func (a *codeAnalyzer) enqueue(pos int, s *absStack) {
+	if pos >= len(a.code) {
+		return
+	}
+
+	if prev, ok := a.visited[pos]; ok {
+		if !prev.known || (s.known && len(s.items) == len(prev.items)) {
+			return
+		}
+		s = &absStack{}
+	}
+
+	a.visited[pos] = s.clone()
+	a.queue = append(a.queue, pos)
+}
+
+// report 记录一个问题
+func (a *codeAnalyzer) report(pos int, err error) {
+	a.issues = append(a.issues, CodeIssue{Pos: pos, Op: Instruction(a.code[pos]), Err: err})
+}
+
+// block 从入口 start 开始顺序分析指令，直到路径结束或转入其他入口
+// 每个 InstrJumpDest 都是一个入口，顺序执行到达时与跳转到达时一样合并栈深度
+func (a *codeAnalyzer) block(start int, s *absStack) {
+	for pos := start; pos < len(a.code); pos++ {
+		// 立即数字节属于其后的操作码
+		if !a.ops[pos] {
+			continue
+		}
+		op := Instruction(a.code[pos])
+
+		if op == InstrJumpDest && pos != start {
+			a.enqueue(pos, s)
+			return
+		}
+
+		switch op {
+		case InstrHalt, InstrRevert, InstrRetSub:
+			return
+		}
+
+		effect, ok := stackEffects[op]
+		if !ok {
+			continue
+		}
+		if op == InstrPack {
+			// 长度已知时弹出长度与对应个数的字节，否则之后的栈深度未知
+			if n := s.peek(0); s.known && n != nil && n.IsInt64() {
+				effect.pops += int(n.Int64())
+			} else {
+				s.known = false
+			}
+		}
+		// InstrDupN n 视为弹出 n 个元素后压入 n+1 个，InstrSwapN n 视为弹出并压入 n+1 个
+		switch op {
+		case InstrDupN:
+			n := int(a.code[pos-1])
+			effect = stackEffect{n, n + 1}
+		case InstrSwapN:
+			n := int(a.code[pos-1])
+			effect = stackEffect{n + 1, n + 1}
+		}
+
+		if s.known && len(s.items) < effect.pops {
+			a.report(pos, ErrStackUnderflow)
+			return
+		}
+
+		var dest *big.Int
+		switch op {
+		case InstrJump, InstrCallSub:
+			dest = s.peek(0)
+		case InstrJumpI:
+			dest = s.peek(1)
+		}
+		if dest != nil && (!dest.IsInt64() || !a.jumpDests[int(dest.Int64())]) {
+			a.report(pos, fmt.Errorf("%w (%s)", ErrInvalidJump, dest))
+			return
+		}
+
+		// 跟踪整数常量经过入栈、复制与交换后的位置，以便检查跳转目标
+		pushed := make([]*big.Int, effect.pushes)
+		switch op {
+		case InstrPushInt, InstrPushN:
+			pushed[0] = a.immediate(pos)
+		case InstrDup:
+			pushed[0], pushed[1] = s.peek(0), s.peek(0)
+		case InstrSwap:
+			pushed[0], pushed[1] = s.peek(0), s.peek(1)
+		case InstrDupN, InstrSwapN:
+			for i := range effect.pops {
+				pushed[i] = s.peek(effect.pops - 1 - i)
+			}
+			if op == InstrDupN {
+				pushed[effect.pops] = pushed[0]
+			} else {
+				last := len(pushed) - 1
+				pushed[0], pushed[last] = pushed[last], pushed[0]
+			}
+		}
+		s.apply(effect.pops, pushed)
+
+		if s.known && a.stackSize > 0 && len(s.items) > a.stackSize {
+			a.report(pos, ErrStackOverflow)
+			return
+		}
+
+		switch op {
+		case InstrReturn:
+			return
+		case InstrJump:
+			if dest != nil {
+				a.enqueue(int(dest.Int64()), s)
+			}
+			return
+		case InstrJumpI:
+			if dest != nil {
+				a.enqueue(int(dest.Int64()), s.clone())
+			}
+		case InstrCallSub:
+			if dest != nil {
+				a.enqueue(int(dest.Int64()), s.clone())
+			}
+			// 子程序对栈深度的影响未知
+			s = &absStack{}
+		}
+	}
+}
+
+// immediate 返回 pos 处整数入栈指令的立即数
+func (a *codeAnalyzer) immediate(pos int) *big.Int {
+	n := ImmediateSize(a.code, pos)
+	if Instruction(a.code[pos]) == InstrPushN {
+		return new(big.Int).SetBytes(a.code[pos-n : pos-1])
+	}
+
+	return new(big.Int).SetBytes(a.code[pos-n : pos])
+}
+
+// peek 返回从栈顶数第 i 个元素的值，深度未知或值未知时返回 nil
+func (s *absStack) peek(i int) *big.Int {
+	if !s.known || i >= len(s.items) {
+		return nil
+	}
+
+	return s.items[len(s.items)-1-i]
+}
+
+// apply 弹出 pops 个元素后按顺序压入 pushed，nil 表示值未知
+func (s *absStack) apply(pops int, pushed []*big.Int) {
+	if !s.known {
+		return
+	}
+
+	s.items = append(s.items[:len(s.items)-pops], pushed...)
+}
+
+// clone 返回抽象栈的副本
+func (s *absStack) clone() *absStack {
+	return &absStack{
+		items: append([]*big.Int{}, s.items...),
+		known: s.known,
+	}
+}
@@ -0,0 +1,110 @@
+package core
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// codeIssues 辅助函数：校验字节码并返回发现的问题
+func codeIssues(t *testing.T, code []byte, config VMConfig) []CodeIssue {
+	err := ValidateCode(code, config)
+	if err == nil {
+		return nil
+	}
+
+	var codeErr *CodeError
+	assert.True(t, errors.As(err, &codeErr))
+
+	return codeErr.Issues
+}
+
+func TestValidateCodeValid(t *testing.T) {
+	config := DefaultChainConfig().VM
+
+	programs := map[string][]byte{
+		"store":   {0x46, 0x0c, 0x4f, 0x0c, 0x4f, 0x0c, 0x03, 0x0a, 0x0d, 0x05, 0x0a, 0x0f},
+		"counter": counterCode(),
+		"loop": {
+			5, byte(InstrPushInt), byte(InstrJumpDest), 1, byte(InstrPushInt), byte(InstrSub),
+			byte(InstrDup), 2, byte(InstrPushInt), byte(InstrSwap), byte(InstrJumpI),
+		},
+		"callsub": {
+			6, byte(InstrPushInt), byte(InstrCallSub), 7, byte(InstrPushInt), byte(InstrHalt),
+			byte(InstrJumpDest), 1, byte(InstrPushInt), byte(InstrRetSub),
+		},
+		// 栈在循环中增长，深度无法静态确定，交由运行时检查
+		"growing loop": {
+			1, byte(InstrPushInt), byte(InstrJumpDest), byte(InstrDup), 2, byte(InstrPushInt), byte(InstrJump),
+		},
+		// dupn 与 swapn 移动跳转目标后仍能检查
+		"dupn jump": {
+			8, byte(InstrPushInt), 1, byte(InstrPushInt), 2, byte(InstrDupN), 2, byte(InstrSwapN),
+			byte(InstrJumpDest), byte(InstrPop), byte(InstrPop), byte(InstrJump), byte(InstrJumpDest),
+		},
+		// 动态跳转目标不做检查
+		"dynamic jump": {byte(InstrCallData), 0, byte(InstrPushInt), byte(InstrCallDataLoad), byte(InstrJump)},
+		"empty":        {},
+	}
+
+	for name, code := range programs {
+		t.Run(name, func(t *testing.T) {
+			assert.Nil(t, ValidateCode(code, config))
+		})
+	}
+}
+
+func TestValidateCodeErrors(t *testing.T) {
+	config := VMConfig{StackSize: 2}
+
+	cases := []struct {
+		name string
+		code []byte
+		pos  int
+		err  error
+	}{
+		{"unknown opcode", []byte{1, byte(InstrPushInt), 0xee}, 2, ErrInvalidOpcode},
+		{"truncated push", []byte{byte(InstrPushInt)}, 0, ErrTruncatedImmediate},
+		{"truncated pushn", []byte{0x01, 4, byte(InstrPushN)}, 2, ErrTruncatedImmediate},
+		{"invalid pushn length", []byte{0, byte(InstrPushN), byte(InstrPop)}, 1, ErrTruncatedImmediate},
+		{"underflow", []byte{1, byte(InstrPushInt), byte(InstrAdd)}, 2, ErrStackUnderflow},
+		{"dupn underflow", []byte{1, byte(InstrPushInt), 2, byte(InstrDupN)}, 3, ErrStackUnderflow},
+		{"swapn underflow", []byte{1, byte(InstrPushInt), 1, byte(InstrSwapN)}, 3, ErrStackUnderflow},
+		{"invalid dupn depth", []byte{1, byte(InstrPushInt), 0, byte(InstrDupN)}, 3, ErrTruncatedImmediate},
+		{"underflow after pack", []byte{'a', byte(InstrPushByte), 2, byte(InstrPushInt), byte(InstrPack)}, 4, ErrStackUnderflow},
+		{"overflow", []byte{1, byte(InstrPushInt), byte(InstrDup), byte(InstrDup)}, 3, ErrStackOverflow},
+		{"jump not to jumpdest", []byte{3, byte(InstrPushInt), byte(InstrJump), byte(InstrHalt)}, 2, ErrInvalidJump},
+		{"jump into immediate", []byte{3, byte(InstrPushInt), byte(InstrJump), byte(InstrJumpDest), byte(InstrPushInt)}, 2, ErrInvalidJump},
+		{"conditional jump", []byte{9, byte(InstrPushInt), byte(InstrCallValue), byte(InstrJumpI)}, 3, ErrInvalidJump},
+		// 只有经过分支才能到达的问题
+		{"underflow in branch", []byte{
+			6, byte(InstrPushInt), byte(InstrCallValue), byte(InstrJumpI), byte(InstrHalt), byte(InstrHalt),
+			byte(InstrJumpDest), byte(InstrPop),
+		}, 7, ErrStackUnderflow},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			issues := codeIssues(t, c.code, config)
+			if !assert.Equal(t, 1, len(issues)) {
+				return
+			}
+			assert.Equal(t, c.pos, issues[0].Pos)
+			assert.ErrorIs(t, issues[0].Err, c.err)
+			assert.ErrorIs(t, ValidateCode(c.code, config), c.err)
+		})
+	}
+}
+
+func TestValidateCodeReport(t *testing.T) {
+	// 报告全部未知操作码与截断问题
+	err := ValidateCode([]byte{byte(InstrPushByte), 0xee, byte(InstrAdd), 0xef}, DefaultChainConfig().VM)
+	assert.NotNil(t, err)
+	assert.Equal(t, "invalid code: position 0 (PUSHBYTE): truncated immediate; position 1 (0xee): invalid opcode; "+
+		"position 3 (0xef): invalid opcode", err.Error())
+
+	// 栈容量为 0 时不检查栈溢出
+	code := []byte{1, byte(InstrPushInt), byte(InstrDup), byte(InstrDup)}
+	assert.Nil(t, ValidateCode(code, VMConfig{}))
+}
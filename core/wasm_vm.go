@@ -0,0 +1,504 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/felixkuang/titanchain/types"
+	"github.com/felixkuang/titanchain/wasm"
+)
+
+const (
+	// wasmEntry 是 WASM 合约的入口函数，签名为 () -> ()
+	wasmEntry = "main"
+	// addressSize 与 hashSize 是地址与事件主题在线性内存中的字节数
+	addressSize = len(types.Address{})
+	hashSize    = len(types.Hash{})
+
+	// wasmCodeByteGas 是每次执行前解码、校验、注入计量与实例化模块时每字节代码消耗的 gas
+	wasmCodeByteGas = 1
+	// wasmMemoryPageGas 是实例化时分配每页初始线性内存消耗的 gas
+	wasmMemoryPageGas = 256
+	// wasmCopyWordGas 是宿主函数在线性内存与执行环境之间每复制 32 字节消耗的 gas
+	wasmCopyWordGas = 3
+)
+
+// ErrInvalidWASM 表示部署的 WASM 合约不合法
+var ErrInvalidWASM = errors.New("invalid wasm contract")
+
+// wasmHostTypes 记录 WASM 合约可以从 "env" 模块导入的宿主函数及其签名
+// 指针与长度均为 i32，指向合约的线性内存；地址为 20 字节，事件主题为 32 字节
+var wasmHostTypes = map[string]wasm.FuncType{
+	// storage_get(keyPtr, keyLen, valPtr, valCap) 读取存储，键不存在时返回 -1，
+	// 否则返回值的长度，并将值的前 valCap 个字节写入 valPtr
+	"storage_get": {Params: []wasm.ValueType{wasm.I32, wasm.I32, wasm.I32, wasm.I32}, Results: []wasm.ValueType{wasm.I32}},
+	// storage_put(keyPtr, keyLen, valPtr, valLen) 写入存储
+	"storage_put": {Params: []wasm.ValueType{wasm.I32, wasm.I32, wasm.I32, wasm.I32}},
+	// storage_delete(keyPtr, keyLen) 删除存储
+	"storage_delete": {Params: []wasm.ValueType{wasm.I32, wasm.I32}},
+	// caller(ptr) 写入调用者地址
+	"caller": {Params: []wasm.ValueType{wasm.I32}},
+	// address(ptr) 写入当前合约地址
+	"address": {Params: []wasm.ValueType{wasm.I32}},
+	// call_value() 返回随调用转入的金额
+	"call_value": {Results: []wasm.ValueType{wasm.I64}},
+	// input_size() 返回调用数据的长度
+	"input_size": {Results: []wasm.ValueType{wasm.I32}},
+	// input_copy(ptr) 写入完整的调用数据
+	"input_copy": {Params: []wasm.ValueType{wasm.I32}},
+	// block_height() 返回当前区块高度
+	"block_height": {Results: []wasm.ValueType{wasm.I64}},
+	// block_timestamp() 返回当前区块时间戳
+	"block_timestamp": {Results: []wasm.ValueType{wasm.I64}},
+	// log(topicsPtr, topicCount, dataPtr, dataLen) 发出带 0~4 个主题的事件
+	"log": {Params: []wasm.ValueType{wasm.I32, wasm.I32, wasm.I32, wasm.I32}},
+	// call(addrPtr, value, gas, inPtr, inLen) 调用目标合约，成功返回 1，失败返回 0
+	"call": {Params: []wasm.ValueType{wasm.I32, wasm.I64, wasm.I64, wasm.I32, wasm.I32}, Results: []wasm.ValueType{wasm.I32}},
+	// static_call(addrPtr, gas, inPtr, inLen) 以只读方式调用目标合约
+	"static_call": {Params: []wasm.ValueType{wasm.I32, wasm.I64, wasm.I32, wasm.I32}, Results: []wasm.ValueType{wasm.I32}},
+	// return_data_size() 返回最近一次外部调用的返回数据长度
+	"return_data_size": {Results: []wasm.ValueType{wasm.I32}},
+	// return_data_copy(ptr) 写入最近一次外部调用的返回数据
+	"return_data_copy": {Params: []wasm.ValueType{wasm.I32}},
+	// set_return(ptr, len) 设置本次执行的返回数据
+	"set_return": {Params: []wasm.ValueType{wasm.I32, wasm.I32}},
+	// revert() 中止执行并回滚
+	"revert": {},
+}
+
+// ValidateWASM 在部署前校验 WASM 合约，不合法时返回包装了 ErrInvalidWASM 的错误
+// 模块须能被 wasm.Decode 解码，只能从 "env" 导入 wasmHostTypes 中的宿主函数，
+// 且须导出签名为 () -> () 的入口函数 main
+func ValidateWASM(code []byte) error {
+	m, err := wasm.Decode(code)
+	if err != nil {
+		return fmt.Errorf("%w: %s", ErrInvalidWASM, err)
+	}
+
+	for _, imp := range m.Imports {
+		t, ok := wasmHostTypes[imp.Name]
+		if imp.Module != wasm.HostModule || !ok {
+			return fmt.Errorf("%w: unknown import (%s.%s)", ErrInvalidWASM, imp.Module, imp.Name)
+		}
+		if !t.Equal(m.Types[imp.Type]) {
+			return fmt.Errorf("%w: import (%s.%s) has type %s, want %s", ErrInvalidWASM, imp.Module, imp.Name, m.Types[imp.Type], t)
+		}
+	}
+
+	idx, ok := m.ExportedFunc(wasmEntry)
+	if !ok {
+		return fmt.Errorf("%w: no exported function (%s)", ErrInvalidWASM, wasmEntry)
+	}
+	if t, err := m.FuncType(idx); err != nil || !t.Equal(wasm.FuncType{}) {
+		return fmt.Errorf("%w: function (%s) must take no arguments and return nothing", ErrInvalidWASM, wasmEntry)
+	}
+
+	return nil
+}
+
+// WASMVM 在 WASM 运行时中执行合约，与栈式虚拟机 VM 共享状态、gas 与外部调用规则
+// 执行前向模块注入 gas 计量，合约通过宿主函数访问存储与执行环境；宿主函数的固定 gas 与对应的栈式指令相同，
+// 另按复制的数据长度收取 wasmCopyWordGas。
+// 设置了 Tracer 时只记录存储写入与执行结束，不记录单条 WASM 指令
+type WASMVM struct {
+	code          []byte
+	contractState *State
+	ctx           ExecContext
+	config        VMConfig
+
+	gasLimit uint64
+	gas      uint64
+
+	depth          int
+	static         bool
+	returnData     []byte
+	lastReturnData []byte
+	logs           []*Log
+
+	tracer Tracer
+}
+
+// NewWASMVM 创建在给定执行环境中运行 WASM 合约的实例
+func NewWASMVM(ctx ExecContext, code []byte, contractState *State, config VMConfig) *WASMVM {
+	return &WASMVM{
+		code:          code,
+		contractState: contractState,
+		ctx:           ctx,
+		config:        config,
+		gasLimit:      config.GasLimit,
+		gas:           config.GasLimit,
+	}
+}
+
+// ReturnData 返回合约通过 set_return 设置的返回数据
+func (vm *WASMVM) ReturnData() []byte {
+	return vm.returnData
+}
+
+// Logs 返回本次执行发出的事件，失败的嵌套调用发出的事件不包含在内
+func (vm *WASMVM) Logs() []*Log {
+	return vm.logs
+}
+
+// SetTracer 设置执行追踪钩子，嵌套调用沿用同一个 Tracer
+func (vm *WASMVM) SetTracer(t Tracer) {
+	vm.tracer = t
+}
+
+// setFrame 设置外部调用深度与是否为只读调用
+func (vm *WASMVM) setFrame(depth int, static bool) {
+	vm.depth = depth
+	vm.static = static
+}
+
+// GasUsed 返回本次执行已消耗的 gas
+func (vm *WASMVM) GasUsed() uint64 {
+	return vm.gasLimit - vm.gas
+}
+
+// Run 解码模块、注入 gas 计量并实例化，然后调用入口函数 main
+// 解码与实例化之前先按代码长度与初始内存页数扣除 gas
+func (vm *WASMVM) Run() error {
+	err := vm.run()
+	if vm.tracer != nil {
+		vm.tracer.CaptureEnd(vm.depth, vm.returnData, vm.GasUsed(), err)
+	}
+
+	return err
+}
+
+func (vm *WASMVM) run() error {
+	if err := vm.useGas(uint64(len(vm.code)) * wasmCodeByteGas); err != nil {
+		return err
+	}
+
+	m, err := wasm.Decode(vm.code)
+	if err != nil {
+		return err
+	}
+	if m.Memory != nil {
+		if err := vm.useGas(uint64(m.Memory.Min) * wasmMemoryPageGas); err != nil {
+			return err
+		}
+	}
+
+	m, err = wasm.InjectGas(m, nil)
+	if err != nil {
+		return err
+	}
+
+	inst, err := wasm.Instantiate(m, vm.hostFuncs())
+	if err != nil {
+		return err
+	}
+
+	_, err = inst.Invoke(wasmEntry)
+	return err
+}
+
+// useGas 扣除 gas，剩余 gas 不足时返回 ErrOutOfGas
+func (vm *WASMVM) useGas(amount uint64) error {
+	if vm.gas < amount {
+		vm.gas = 0
+		return ErrOutOfGas
+	}
+	vm.gas -= amount
+
+	return nil
+}
+
+// useCopyGas 扣除宿主函数复制 n 字节数据的 gas，不足 32 字节的部分按 32 字节计
+func (vm *WASMVM) useCopyGas(n uint64) error {
+	return vm.useGas((n + 31) / 32 * wasmCopyWordGas)
+}
+
+// hostFunc 是宿主函数的实现
+type hostFunc func(inst *wasm.Instance, args []uint64) ([]uint64, error)
+
+// hostFuncs 返回本次执行可供模块导入的宿主函数，包括注入的 gas 计量函数
+func (vm *WASMVM) hostFuncs() map[string]wasm.HostFunc {
+	fns := map[string]hostFunc{
+		"storage_get":      vm.storageGet,
+		"storage_put":      vm.storagePut,
+		"storage_delete":   vm.storageDelete,
+		"caller":           vm.writeAddress(func() types.Address { return vm.ctx.Caller }, InstrCaller),
+		"address":          vm.writeAddress(func() types.Address { return vm.ctx.Address }, InstrAddress),
+		"call_value":       vm.value(func() uint64 { return vm.ctx.Value }, InstrCallValue),
+		"input_size":       vm.value(func() uint64 { return uint64(len(vm.ctx.Input)) }, InstrCallDataSize),
+		"input_copy":       vm.copyOut(func() []byte { return vm.ctx.Input }, InstrCallData),
+		"block_height":     vm.value(func() uint64 { return uint64(vm.ctx.Height) }, InstrHeight),
+		"block_timestamp":  vm.value(func() uint64 { return uint64(vm.ctx.Timestamp) }, InstrTimestamp),
+		"log":              vm.log,
+		"call":             vm.call,
+		"static_call":      vm.staticCall,
+		"return_data_size": vm.value(func() uint64 { return uint64(len(vm.lastReturnData)) }, InstrReturnData),
+		"return_data_copy": vm.copyOut(func() []byte { return vm.lastReturnData }, InstrReturnData),
+		"set_return":       vm.setReturn,
+		"revert":           vm.revert,
+	}
+
+	host := make(map[string]wasm.HostFunc, len(fns)+1)
+	for name, fn := range fns {
+		host[name] = wasm.HostFunc{Type: wasmHostTypes[name], Fn: fn}
+	}
+	host[wasm.GasFunc] = wasm.HostFunc{
+		Type: wasm.FuncType{Params: []wasm.ValueType{wasm.I64}},
+		Fn: func(inst *wasm.Instance, args []uint64) ([]uint64, error) {
+			return nil, vm.useGas(args[0])
+		},
+	}
+
+	return host
+}
+
+// readMemory 读取线性内存中由指针与长度参数描述的数据
+func readMemory(inst *wasm.Instance, ptr, n uint64) ([]byte, error) {
+	return inst.ReadMemory(uint32(ptr), uint32(n))
+}
+
+func (vm *WASMVM) storageGet(inst *wasm.Instance, args []uint64) ([]uint64, error) {
+	if err := vm.useGas(GasCost(InstrLoad)); err != nil {
+		return nil, err
+	}
+	if err := vm.useCopyGas(args[1]); err != nil {
+		return nil, err
+	}
+
+	key, err := readMemory(inst, args[0], args[1])
+	if err != nil {
+		return nil, err
+	}
+
+	value, err := vm.contractState.GetStorage(vm.ctx.Address, key)
+	if err != nil {
+		return []uint64{uint64(^uint32(0))}, nil
+	}
+
+	if n := uint64(len(value)); n < args[3] {
+		args[3] = n
+	}
+	if err := vm.useCopyGas(args[3]); err != nil {
+		return nil, err
+	}
+	if err := inst.WriteMemory(uint32(args[2]), value[:args[3]]); err != nil {
+		return nil, err
+	}
+
+	return []uint64{uint64(len(value))}, nil
+}
+
+func (vm *WASMVM) storagePut(inst *wasm.Instance, args []uint64) ([]uint64, error) {
+	if vm.static {
+		return nil, ErrWriteProtection
+	}
+	if err := vm.useGas(GasCost(InstrStore)); err != nil {
+		return nil, err
+	}
+	if err := vm.useCopyGas(args[1] + args[3]); err != nil {
+		return nil, err
+	}
+
+	key, err := readMemory(inst, args[0], args[1])
+	if err != nil {
+		return nil, err
+	}
+	value, err := readMemory(inst, args[2], args[3])
+	if err != nil {
+		return nil, err
+	}
+
+	if err := vm.contractState.PutStorage(vm.ctx.Address, key, value); err != nil {
+		return nil, err
+	}
+	if vm.tracer != nil {
+		vm.tracer.CaptureStorage(vm.ctx.Address, key, value)
+	}
+
+	return nil, nil
+}
+
+func (vm *WASMVM) storageDelete(inst *wasm.Instance, args []uint64) ([]uint64, error) {
+	if vm.static {
+		return nil, ErrWriteProtection
+	}
+	if err := vm.useGas(GasCost(InstrDelete)); err != nil {
+		return nil, err
+	}
+	if err := vm.useCopyGas(args[1]); err != nil {
+		return nil, err
+	}
+
+	key, err := readMemory(inst, args[0], args[1])
+	if err != nil {
+		return nil, err
+	}
+
+	if err := vm.contractState.DeleteStorage(vm.ctx.Address, key); err != nil {
+		return nil, err
+	}
+	if vm.tracer != nil {
+		vm.tracer.CaptureStorage(vm.ctx.Address, key, nil)
+	}
+
+	return nil, nil
+}
+
+// writeAddress 返回将地址写入 ptr 的宿主函数，gas 与指令 instr 相同
+func (vm *WASMVM) writeAddress(addr func() types.Address, instr Instruction) hostFunc {
+	return func(inst *wasm.Instance, args []uint64) ([]uint64, error) {
+		if err := vm.useGas(GasCost(instr)); err != nil {
+			return nil, err
+		}
+
+		a := addr()
+		return nil, inst.WriteMemory(uint32(args[0]), a[:])
+	}
+}
+
+// value 返回一个整数值的宿主函数，gas 与指令 instr 相同
+func (vm *WASMVM) value(v func() uint64, instr Instruction) hostFunc {
+	return func(inst *wasm.Instance, args []uint64) ([]uint64, error) {
+		if err := vm.useGas(GasCost(instr)); err != nil {
+			return nil, err
+		}
+
+		return []uint64{v()}, nil
+	}
+}
+
+// copyOut 返回将数据写入 ptr 的宿主函数，固定 gas 与指令 instr 相同，另按数据长度计费
+func (vm *WASMVM) copyOut(data func() []byte, instr Instruction) hostFunc {
+	return func(inst *wasm.Instance, args []uint64) ([]uint64, error) {
+		if err := vm.useGas(GasCost(instr)); err != nil {
+			return nil, err
+		}
+		b := data()
+		if err := vm.useCopyGas(uint64(len(b))); err != nil {
+			return nil, err
+		}
+
+		return nil, inst.WriteMemory(uint32(args[0]), b)
+	}
+}
+
+func (vm *WASMVM) log(inst *wasm.Instance, args []uint64) ([]uint64, error) {
+	if vm.static {
+		return nil, ErrWriteProtection
+	}
+
+	n := args[1]
+	if n > 4 {
+		return nil, fmt.Errorf("too many log topics (%d)", n)
+	}
+	if err := vm.useGas(GasCost(InstrLog0 + Instruction(n))); err != nil {
+		return nil, err
+	}
+	if err := vm.useCopyGas(n*uint64(hashSize) + args[3]); err != nil {
+		return nil, err
+	}
+
+	b, err := readMemory(inst, args[0], n*uint64(hashSize))
+	if err != nil {
+		return nil, err
+	}
+	topics := make([]types.Hash, n)
+	for i := range topics {
+		topics[i] = types.HashFromBytes(b[i*hashSize : (i+1)*hashSize])
+	}
+
+	data, err := readMemory(inst, args[2], args[3])
+	if err != nil {
+		return nil, err
+	}
+
+	vm.logs = append(vm.logs, &Log{
+		Address: vm.ctx.Address,
+		Topics:  topics,
+		Data:    data,
+	})
+
+	return nil, nil
+}
+
+func (vm *WASMVM) call(inst *wasm.Instance, args []uint64) ([]uint64, error) {
+	return vm.execCall(inst, args[0], args[1], args[2], args[3], args[4], false)
+}
+
+func (vm *WASMVM) staticCall(inst *wasm.Instance, args []uint64) ([]uint64, error) {
+	return vm.execCall(inst, args[0], 0, args[1], args[2], args[3], true)
+}
+
+// execCall 执行外部调用，规则与栈式虚拟机的 InstrCall、InstrStaticCall 相同
+func (vm *WASMVM) execCall(inst *wasm.Instance, addrPtr, value, gasArg, inPtr, inLen uint64, static bool) ([]uint64, error) {
+	instr := InstrCall
+	if static {
+		instr = InstrStaticCall
+	}
+	if err := vm.useGas(GasCost(instr)); err != nil {
+		return nil, err
+	}
+	if err := vm.useCopyGas(inLen); err != nil {
+		return nil, err
+	}
+
+	if value != 0 && vm.static {
+		return nil, ErrWriteProtection
+	}
+
+	b, err := readMemory(inst, addrPtr, uint64(addressSize))
+	if err != nil {
+		return nil, err
+	}
+	input, err := readMemory(inst, inPtr, inLen)
+	if err != nil {
+		return nil, err
+	}
+
+	vm.lastReturnData = nil
+
+	gas := forwardGas(vm.gas, new(big.Int).SetUint64(gasArg))
+
+	if vm.depth+1 >= maxCallDepth {
+		return []uint64{0}, nil
+	}
+
+	vm.gas -= gas
+
+	ctx := ExecContext{
+		Address:   types.AddressFromBytes(b),
+		Caller:    vm.ctx.Address,
+		Value:     value,
+		Input:     input,
+		Height:    vm.ctx.Height,
+		Timestamp: vm.ctx.Timestamp,
+	}
+
+	returnData, gasLeft, logs, err := callFrame(vm.contractState, vm.config, ctx, gas, vm.depth+1, static || vm.static, vm.tracer)
+	vm.gas += gasLeft
+	vm.lastReturnData = returnData
+	vm.logs = append(vm.logs, logs...)
+
+	return []uint64{boolToUint(err == nil)}, nil
+}
+
+func (vm *WASMVM) setReturn(inst *wasm.Instance, args []uint64) ([]uint64, error) {
+	if err := vm.useGas(GasCost(InstrReturn)); err != nil {
+		return nil, err
+	}
+	if err := vm.useCopyGas(args[1]); err != nil {
+		return nil, err
+	}
+
+	data, err := readMemory(inst, args[0], args[1])
+	if err != nil {
+		return nil, err
+	}
+	vm.returnData = data
+
+	return nil, nil
+}
+
+func (vm *WASMVM) revert(inst *wasm.Instance, args []uint64) ([]uint64, error) {
+	return nil, ErrExecutionReverted
+}
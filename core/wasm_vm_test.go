@@ -0,0 +1,293 @@
+package core
+
+import (
+	"encoding/binary"
+	"math/big"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/felixkuang/titanchain/crypto"
+	"github.com/felixkuang/titanchain/types"
+	"github.com/felixkuang/titanchain/wasm"
+)
+
+// wasmContract 创建按顺序导入宿主函数 imports、以 body 为 main 函数体的 WASM 合约
+// 宿主函数的函数索引即其在 imports 中的位置
+func wasmContract(imports []string, body []byte, data ...wasm.DataSegment) []byte {
+	m := &wasm.Module{Memory: &wasm.Limits{Min: 1}, Data: data}
+
+	typeIndex := func(t wasm.FuncType) uint32 {
+		for i, existing := range m.Types {
+			if existing.Equal(t) {
+				return uint32(i)
+			}
+		}
+		m.Types = append(m.Types, t)
+		return uint32(len(m.Types) - 1)
+	}
+
+	for _, name := range imports {
+		m.Imports = append(m.Imports, wasm.Import{Module: wasm.HostModule, Name: name, Type: typeIndex(wasmHostTypes[name])})
+	}
+	m.Funcs = []uint32{typeIndex(wasm.FuncType{})}
+	m.Exports = []wasm.Export{{Name: wasmEntry, Kind: wasm.ExternFunc, Index: uint32(len(imports))}}
+	m.Codes = []wasm.Code{{Body: body}}
+
+	return m.Encode()
+}
+
+// wasmCode 拼接 WASM 指令并以 end 结束
+func wasmCode(parts ...[]byte) []byte {
+	var code []byte
+	for _, p := range parts {
+		code = append(code, p...)
+	}
+
+	return append(code, 0x0b)
+}
+
+func i32Const(v int32) []byte {
+	return wasm.AppendS64([]byte{0x41}, int64(v))
+}
+
+func i64Const(v int64) []byte {
+	return wasm.AppendS64([]byte{0x42}, v)
+}
+
+func callFunc(idx uint32) []byte {
+	return wasm.AppendU32([]byte{0x10}, idx)
+}
+
+// wasmCounter 返回将调用数据作为存储键、对其中的 8 字节小端计数加 1 的 WASM 合约
+func wasmCounter() []byte {
+	const inputSize, inputCopy, storageGet, storagePut = 0, 1, 2, 3
+
+	return wasmContract([]string{"input_size", "input_copy", "storage_get", "storage_put"}, wasmCode(
+		i32Const(0), callFunc(inputCopy),
+		i32Const(0), callFunc(inputSize), i32Const(256), i32Const(8), callFunc(storageGet), []byte{0x1a},
+		i32Const(256), i32Const(256), []byte{0x29, 3, 0}, i64Const(1), []byte{0x7c, 0x37, 3, 0},
+		i32Const(0), callFunc(inputSize), i32Const(256), i32Const(8), callFunc(storagePut),
+	))
+}
+
+// counterValue 返回合约存储中的小端计数
+func counterValue(t *testing.T, state *State, addr types.Address, key []byte) uint64 {
+	b, err := state.GetStorage(addr, key)
+	assert.Nil(t, err)
+	if !assert.Len(t, b, 8) {
+		return 0
+	}
+
+	return binary.LittleEndian.Uint64(b)
+}
+
+func TestWASMHostEnv(t *testing.T) {
+	const caller, blockHeight, callValue, log, setReturn = 0, 1, 2, 3, 4
+	topic := types.Hash{0x01, 0x02}
+
+	code := wasmContract([]string{"caller", "block_height", "call_value", "log", "set_return"}, wasmCode(
+		i32Const(0), callFunc(caller),
+		i32Const(32), callFunc(blockHeight), []byte{0x37, 3, 0},
+		i32Const(40), callFunc(callValue), []byte{0x37, 3, 0},
+		i32Const(64), i32Const(1), i32Const(0), i32Const(20), callFunc(log),
+		i32Const(0), i32Const(48), callFunc(setReturn),
+	), wasm.DataSegment{Offset: 64, Data: topic[:]})
+
+	ctx := ExecContext{Address: types.Address{0x01}, Caller: types.Address{0x0c}, Value: 7, Height: 9}
+	vm := NewWASMVM(ctx, code, NewState(), DefaultChainConfig().VM)
+	assert.Nil(t, vm.Run())
+
+	ret := vm.ReturnData()
+	assert.Equal(t, ctx.Caller.ToSlice(), ret[:20])
+	assert.Equal(t, uint64(9), binary.LittleEndian.Uint64(ret[32:40]))
+	assert.Equal(t, uint64(7), binary.LittleEndian.Uint64(ret[40:48]))
+
+	assert.Equal(t, []*Log{{Address: ctx.Address, Topics: []types.Hash{topic}, Data: ctx.Caller.ToSlice()}}, vm.Logs())
+	assert.Greater(t, vm.GasUsed(), GasCost(InstrLog1))
+
+	// 只读调用中不能发出事件
+	vm = NewWASMVM(ctx, code, NewState(), DefaultChainConfig().VM)
+	vm.setFrame(1, true)
+	assert.ErrorIs(t, vm.Run(), ErrWriteProtection)
+}
+
+func TestWASMGas(t *testing.T) {
+	config := DefaultChainConfig().VM
+	config.GasLimit = 1000
+
+	// 死循环在 gas 耗尽时终止
+	loop := wasmContract(nil, wasmCode([]byte{0x03, 0x40, 0x0c, 0, 0x0b}))
+	vm := NewWASMVM(ExecContext{}, loop, NewState(), config)
+	assert.ErrorIs(t, vm.Run(), ErrOutOfGas)
+	assert.Equal(t, config.GasLimit, vm.GasUsed())
+
+	revert := wasmContract([]string{"revert"}, wasmCode(callFunc(0)))
+	vm = NewWASMVM(ExecContext{}, revert, NewState(), config)
+	assert.ErrorIs(t, vm.Run(), ErrExecutionReverted)
+	assert.Less(t, vm.GasUsed(), config.GasLimit)
+
+	// 宿主函数按对应的栈式指令计费
+	state := NewState()
+	vm = NewWASMVM(ExecContext{Address: types.Address{0x01}, Input: []byte("c")}, wasmCounter(), state, DefaultChainConfig().VM)
+	assert.Nil(t, vm.Run())
+	assert.Greater(t, vm.GasUsed(), GasCost(InstrLoad)+GasCost(InstrStore))
+	assert.Equal(t, uint64(1), counterValue(t, state, types.Address{0x01}, []byte("c")))
+
+	// 解码与分配内存之前按代码长度与初始内存页数计费
+	config.GasLimit = uint64(len(revert)) - 1
+	vm = NewWASMVM(ExecContext{}, revert, NewState(), config)
+	assert.ErrorIs(t, vm.Run(), ErrOutOfGas)
+	m, err := wasm.Decode(revert)
+	assert.Nil(t, err)
+	m.Memory.Min = wasm.MaxPages
+	bigMemory := m.Encode()
+	config.GasLimit = uint64(len(bigMemory)) + wasm.MaxPages*wasmMemoryPageGas - 1
+	vm = NewWASMVM(ExecContext{}, bigMemory, NewState(), config)
+	assert.ErrorIs(t, vm.Run(), ErrOutOfGas)
+	assert.Equal(t, config.GasLimit, vm.GasUsed())
+
+	// 宿主函数另按复制的数据长度计费
+	setReturn := func(n int32) uint64 {
+		vm := NewWASMVM(ExecContext{}, wasmContract([]string{"set_return"}, wasmCode(i32Const(0), i32Const(n), callFunc(0))), NewState(), DefaultChainConfig().VM)
+		assert.Nil(t, vm.Run())
+		return vm.GasUsed()
+	}
+	assert.Equal(t, setReturn(128)+28*wasmCopyWordGas, setReturn(1024))
+}
+
+func TestWASMCallStackContract(t *testing.T) {
+	code := append(storeCallValue(), 42, byte(InstrPushInt), byte(InstrReturn))
+	state, caller, callee := setupCall(t, code)
+
+	// 调用栈式合约，返回 [调用结果][被调用方的返回数据]
+	const call, returnDataSize, returnDataCopy, setReturn = 0, 1, 2, 3
+	wasmCaller := wasmContract([]string{"call", "return_data_size", "return_data_copy", "set_return"}, wasmCode(
+		i32Const(63),
+		i32Const(0), i64Const(10), i64Const(100000), i32Const(32), i32Const(2), callFunc(call),
+		[]byte{0x3a, 0, 0},
+		i32Const(64), callFunc(returnDataCopy),
+		i32Const(63), callFunc(returnDataSize), i32Const(1), []byte{0x6a}, callFunc(setReturn),
+	), wasm.DataSegment{Offset: 0, Data: callee.ToSlice()}, wasm.DataSegment{Offset: 32, Data: []byte("in")})
+
+	vm := NewWASMVM(ExecContext{Address: caller}, wasmCaller, state, DefaultChainConfig().VM)
+	assert.Nil(t, vm.Run())
+
+	ret := vm.ReturnData()
+	assert.Equal(t, byte(1), ret[0])
+	assertWord(t, big.NewInt(42), new(big.Int).SetBytes(ret[1:]))
+
+	b, err := state.GetStorage(callee, []byte("k"))
+	assert.Nil(t, err)
+	v, err := decodeStorageValue(b)
+	assert.Nil(t, err)
+	assertWord(t, big.NewInt(10), v.(*big.Int))
+	acc, err := state.GetAccount(caller)
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(90), acc.Balance)
+}
+
+func TestStackCallWASMContract(t *testing.T) {
+	state, caller, callee := setupCall(t, wasmCounter())
+	assert.Nil(t, state.PutAccount(callee, &Account{VMType: VMTypeWASM}))
+
+	vm := newVMWithStack(caller, []byte{byte(InstrCall)}, state,
+		addrWord(callee), big.NewInt(0), big.NewInt(100000), []byte("c"))
+	assert.Nil(t, vm.Run())
+	res, err := vm.stack.Pop()
+	assert.Nil(t, err)
+	assertWord(t, big.NewInt(1), res.(*big.Int))
+	assert.Equal(t, uint64(1), counterValue(t, state, callee, []byte("c")))
+
+	// 只读调用中写入存储失败，修改被撤销
+	vm = newVMWithStack(caller, []byte{byte(InstrStaticCall)}, state,
+		addrWord(callee), big.NewInt(100000), []byte("c"))
+	assert.Nil(t, vm.Run())
+	res, err = vm.stack.Pop()
+	assert.Nil(t, err)
+	assertWord(t, big.NewInt(0), res.(*big.Int))
+	assert.Equal(t, uint64(1), counterValue(t, state, callee, []byte("c")))
+}
+
+func TestValidateWASM(t *testing.T) {
+	config := DefaultChainConfig().VM
+	assert.Nil(t, ValidateContract(wasmCounter(), config))
+
+	entry := func(m *wasm.Module) *wasm.Module {
+		m.Exports = []wasm.Export{{Name: wasmEntry, Kind: wasm.ExternFunc, Index: uint32(len(m.Imports))}}
+		return m
+	}
+	invalid := map[string][]byte{
+		"truncated": wasmCounter()[:20],
+		"float":     wasmContract(nil, []byte{0x43, 0, 0, 0, 0, 0x1a, 0x0b}),
+		"underflow": wasmContract(nil, []byte{0x1a, 0x0b}),
+		"type":      wasmContract(nil, wasmCode(i32Const(1), i64Const(1), []byte{0x7c, 0x1a})),
+		"unknown import": entry(&wasm.Module{
+			Types:   []wasm.FuncType{{}},
+			Imports: []wasm.Import{{Module: wasm.HostModule, Name: "selfdestruct", Type: 0}},
+			Funcs:   []uint32{0},
+			Codes:   []wasm.Code{{Body: []byte{0x0b}}},
+		}).Encode(),
+		"gas import": entry(&wasm.Module{
+			Types:   []wasm.FuncType{{}, {Params: []wasm.ValueType{wasm.I64}}},
+			Imports: []wasm.Import{{Module: wasm.HostModule, Name: wasm.GasFunc, Type: 1}},
+			Funcs:   []uint32{0},
+			Codes:   []wasm.Code{{Body: []byte{0x0b}}},
+		}).Encode(),
+		"import type": entry(&wasm.Module{
+			Types:   []wasm.FuncType{{}},
+			Imports: []wasm.Import{{Module: wasm.HostModule, Name: "caller", Type: 0}},
+			Funcs:   []uint32{0},
+			Codes:   []wasm.Code{{Body: []byte{0x0b}}},
+		}).Encode(),
+		"no main": (&wasm.Module{
+			Types: []wasm.FuncType{{}},
+			Funcs: []uint32{0},
+			Codes: []wasm.Code{{Body: []byte{0x0b}}},
+		}).Encode(),
+		"main type": entry(&wasm.Module{
+			Types: []wasm.FuncType{{Params: []wasm.ValueType{wasm.I32}}},
+			Funcs: []uint32{0},
+			Codes: []wasm.Code{{Body: []byte{0x0b}}},
+		}).Encode(),
+	}
+	for name, code := range invalid {
+		assert.ErrorIs(t, ValidateContract(code, config), ErrInvalidWASM, name)
+	}
+}
+
+func TestDeployAndCallWASMTransaction(t *testing.T) {
+	privKey := crypto.GeneratePrivateKey()
+	sender := privKey.PublicKey().Address()
+	bc := newBlockchainWithAlloc(t, sender, 100)
+
+	deploy := signedTx(t, privKey, &Transaction{Type: TxTypeDeploy, Data: wasmCounter(), Value: 5})
+	assert.Nil(t, addBlockWithTxs(t, bc, deploy))
+
+	addr := ContractAddress(crypto.HashSHA256, sender, 0)
+	acc := getAccount(t, bc, addr)
+	assert.Equal(t, VMTypeWASM, acc.VMType)
+	assert.Equal(t, uint64(5), acc.Balance)
+
+	call := func(nonce uint64) *Transaction {
+		return signedTx(t, privKey, &Transaction{Type: TxTypeCall, Nonce: nonce, To: addr, Data: []byte("c")})
+	}
+	first, second := call(1), call(2)
+	assert.Nil(t, addBlockWithTxs(t, bc, first, second))
+	assert.Equal(t, uint64(2), counterValue(t, bc.contractState, addr, []byte("c")))
+
+	receipt, err := bc.GetReceipt(second.Hash(TxHasher{}))
+	assert.Nil(t, err)
+	assert.Equal(t, ReceiptStatusSuccessful, receipt.Status)
+	assert.Greater(t, receipt.GasUsed, uint64(0))
+
+	// 栈式合约部署后仍为 VMTypeStack
+	stack := signedTx(t, privKey, &Transaction{Type: TxTypeDeploy, Nonce: 3, Data: counterCode()})
+	assert.Nil(t, addBlockWithTxs(t, bc, stack))
+	assert.Equal(t, VMTypeStack, getAccount(t, bc, ContractAddress(crypto.HashSHA256, sender, 3)).VMType)
+
+	// 未通过校验的 WASM 模块不能部署
+	bad := signedTx(t, privKey, &Transaction{Type: TxTypeDeploy, Nonce: 4, Data: wasmCounter()[:20]})
+	assert.ErrorIs(t, ValidateTransaction(bad, bc.Config()), ErrInvalidWASM)
+	assert.NotNil(t, addBlockWithTxs(t, bc, bad))
+}
@@ -0,0 +1,24 @@
+package crypto
+
+import (
+	"hash"
+
+	"golang.org/x/crypto/blake2b"
+)
+
+// NewBlake2b256 创建一个不带密钥、输出 256 位的 BLAKE2b 哈希实例（RFC 7693）
+func NewBlake2b256() hash.Hash {
+	// 不带密钥时不会返回错误
+	h, _ := blake2b.New256(nil)
+	return h
+}
+
+// Blake2b256 计算给定数据依次拼接后的 BLAKE2b-256 哈希
+func Blake2b256(data ...[]byte) []byte {
+	h := NewBlake2b256()
+	for _, b := range data {
+		h.Write(b)
+	}
+
+	return h.Sum(nil)
+}
@@ -0,0 +1,89 @@
+package crypto
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+
+	"github.com/felixkuang/titanchain/types"
+)
+
+// ed25519PrivateKey 封装了 Ed25519 私钥
+type ed25519PrivateKey struct {
+	key ed25519.PrivateKey
+}
+
+// generateEd25519Key 使用安全的随机数生成器生成 Ed25519 私钥
+func generateEd25519Key() (PrivateKey, error) {
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+
+	return ed25519PrivateKey{key: key}, nil
+}
+
+// toEd25519PrivateKey 从 32 字节的种子还原私钥
+func toEd25519PrivateKey(b []byte) (PrivateKey, error) {
+	if len(b) != ed25519.SeedSize {
+		return nil, ErrInvalidPrivateKey
+	}
+
+	return ed25519PrivateKey{key: ed25519.NewKeyFromSeed(b)}, nil
+}
+
+func (k ed25519PrivateKey) Type() KeyType {
+	return KeyTypeEd25519
+}
+
+// Sign 直接对数据进行 Ed25519 签名，算法内部自带哈希
+func (k ed25519PrivateKey) Sign(data []byte) (Signature, error) {
+	return ed25519Signature(ed25519.Sign(k.key, data)), nil
+}
+
+func (k ed25519PrivateKey) PublicKey() PublicKey {
+	return ed25519PublicKey{key: k.key.Public().(ed25519.PublicKey)}
+}
+
+// ToSlice 返回类型标识与 32 字节种子
+func (k ed25519PrivateKey) ToSlice() []byte {
+	return withKeyType(KeyTypeEd25519, k.key.Seed())
+}
+
+// ed25519PublicKey 封装了 Ed25519 公钥
+type ed25519PublicKey struct {
+	key ed25519.PublicKey
+}
+
+// toEd25519PublicKey 从 32 字节的公钥还原
+func toEd25519PublicKey(b []byte) (PublicKey, error) {
+	if len(b) != ed25519.PublicKeySize {
+		return nil, ErrInvalidPublicKey
+	}
+
+	return ed25519PublicKey{key: ed25519.PublicKey(append([]byte{}, b...))}, nil
+}
+
+func (k ed25519PublicKey) Type() KeyType {
+	return KeyTypeEd25519
+}
+
+func (k ed25519PublicKey) ToSlice() []byte {
+	return withKeyType(KeyTypeEd25519, k.key)
+}
+
+func (k ed25519PublicKey) Verify(data []byte, sig Signature) bool {
+	s, ok := sig.(ed25519Signature)
+	if !ok || len(s) != ed25519.SignatureSize {
+		return false
+	}
+
+	return ed25519.Verify(k.key, data, s)
+}
+
+func (k ed25519PublicKey) Address() types.Address {
+	return k.AddressWith(HashSHA256)
+}
+
+func (k ed25519PublicKey) AddressWith(algo HashAlgorithm) types.Address {
+	return publicKeyAddress(k, algo)
+}
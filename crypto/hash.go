@@ -0,0 +1,65 @@
+package crypto
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"hash"
+
+	"github.com/felixkuang/titanchain/types"
+)
+
+// HashAlgorithm 表示链上使用的 256 位哈希算法，在链配置中以名称表示
+// 零值等同于 HashSHA256，保证未配置算法的链与之前保持一致
+type HashAlgorithm string
+
+const (
+	// HashSHA256 是 SHA-256，默认算法
+	HashSHA256 HashAlgorithm = "sha256"
+	// HashKeccak256 是以太坊使用的 Keccak-256
+	HashKeccak256 HashAlgorithm = "keccak256"
+	// HashBlake2b256 是输出 256 位的 BLAKE2b
+	HashBlake2b256 HashAlgorithm = "blake2b256"
+)
+
+// Validate 检查算法名称是否受支持
+func (a HashAlgorithm) Validate() error {
+	switch a {
+	case "", HashSHA256, HashKeccak256, HashBlake2b256:
+		return nil
+	default:
+		return fmt.Errorf("unknown hash algorithm (%s)", string(a))
+	}
+}
+
+// String 返回算法名称，零值返回 sha256
+func (a HashAlgorithm) String() string {
+	if a == "" {
+		return string(HashSHA256)
+	}
+
+	return string(a)
+}
+
+// New 创建算法对应的哈希实例，未知算法会 panic，使用前应先通过 Validate 校验
+func (a HashAlgorithm) New() hash.Hash {
+	switch a {
+	case "", HashSHA256:
+		return sha256.New()
+	case HashKeccak256:
+		return NewKeccak256()
+	case HashBlake2b256:
+		return NewBlake2b256()
+	default:
+		panic(fmt.Sprintf("unknown hash algorithm (%s)", string(a)))
+	}
+}
+
+// Sum 计算给定数据依次拼接后的哈希
+func (a HashAlgorithm) Sum(data ...[]byte) types.Hash {
+	h := a.New()
+	for _, b := range data {
+		h.Write(b)
+	}
+
+	return types.HashFromBytes(h.Sum(nil))
+}
@@ -0,0 +1,68 @@
+package crypto
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBlake2b256(t *testing.T) {
+	seq := make([]byte, 512)
+	for i := range seq {
+		seq[i] = byte(i)
+	}
+
+	vectors := []struct {
+		msg  []byte
+		want string
+	}{
+		{nil, "0e5751c026e543b2e8ab2eb06099daa1d1e5df47778f7787faab45cdf12fe3a8"},
+		{[]byte("abc"), "bddd813c634239723171ef3fee98579b94964e3bb1cb3e427262c8c068d52319"},
+		{bytes.Repeat([]byte("a"), 127), "59e2f1aba240f20aa591016f5ef429990bc9c2131dcd0d30f0ffd75ed18f317d"},
+		{bytes.Repeat([]byte("a"), 128), "ae2aa48507885c4c950fb809b2076f959cde9f8ea6da260d9a3587df33dac450"},
+		{bytes.Repeat([]byte("a"), 129), "2f64744a6de0d2c0b56e64cf6e29a5aaa255010d415d51c75ccc82f73dccd865"},
+		{seq, "540b20132d8aeae54057cb69c24f95d26a1c472cc700dd450defe9bb796d4f14"},
+	}
+	for _, v := range vectors {
+		assert.Equal(t, v.want, hex.EncodeToString(Blake2b256(v.msg)), len(v.msg))
+
+		// 按 1 字节分段写入，结果相同
+		h := NewBlake2b256()
+		for i := range v.msg {
+			h.Write(v.msg[i : i+1])
+		}
+		assert.Equal(t, v.want, hex.EncodeToString(h.Sum(nil)), len(v.msg))
+	}
+}
+
+// TestHashAlgorithms 同一输入在三种算法下的测试向量
+func TestHashAlgorithms(t *testing.T) {
+	vectors := map[HashAlgorithm]string{
+		"":             "ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad",
+		HashSHA256:     "ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad",
+		HashKeccak256:  "4e03657aea45a94fc7d47ba826c8d667c0d1e6e33a64a036ec44f58fa12d6c45",
+		HashBlake2b256: "bddd813c634239723171ef3fee98579b94964e3bb1cb3e427262c8c068d52319",
+	}
+	for algo, want := range vectors {
+		assert.Nil(t, algo.Validate())
+		assert.Equal(t, want, algo.Sum([]byte("ab"), []byte("c")).String(), algo.String())
+		assert.Equal(t, 32, algo.New().Size())
+	}
+
+	assert.Equal(t, "sha256", HashAlgorithm("").String())
+	assert.NotNil(t, HashAlgorithm("md5").Validate())
+	assert.Panics(t, func() { HashAlgorithm("md5").New() })
+}
+
+// TestAddressWith 不同算法推导出不同的地址，SHA256 与 Address 一致
+func TestAddressWith(t *testing.T) {
+	pub := GeneratePrivateKey().PublicKey()
+	assert.Equal(t, pub.Address(), pub.AddressWith(HashSHA256))
+	assert.NotEqual(t, pub.AddressWith(HashSHA256), pub.AddressWith(HashKeccak256))
+	assert.NotEqual(t, pub.AddressWith(HashKeccak256), pub.AddressWith(HashBlake2b256))
+
+	h := HashKeccak256.Sum(pub.ToSlice())
+	assert.Equal(t, h[12:], pub.AddressWith(HashKeccak256).ToSlice())
+}
@@ -0,0 +1,22 @@
+package crypto
+
+import (
+	"hash"
+
+	"golang.org/x/crypto/sha3"
+)
+
+// NewKeccak256 创建一个 Keccak-256 哈希实例（以太坊使用的原始 Keccak 填充，而不是 FIPS 202 SHA3-256）
+func NewKeccak256() hash.Hash {
+	return sha3.NewLegacyKeccak256()
+}
+
+// Keccak256 计算给定数据依次拼接后的 Keccak-256 哈希
+func Keccak256(data ...[]byte) []byte {
+	h := NewKeccak256()
+	for _, b := range data {
+		h.Write(b)
+	}
+
+	return h.Sum(nil)
+}
@@ -0,0 +1,44 @@
+package crypto
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestKeccak256(t *testing.T) {
+	vectors := map[string]string{
+		"":    "c5d2460186f7233c927e7db2dcc703c0e500b653ca82273b7bfad8045d85a470",
+		"abc": "4e03657aea45a94fc7d47ba826c8d667c0d1e6e33a64a036ec44f58fa12d6c45",
+		"The quick brown fox jumps over the lazy dog": "4d741b6f1eb29cb2a9b9911c82f56fa8d73b04959d3d9d222895df6c0b28aa15",
+	}
+	for msg, want := range vectors {
+		assert.Equal(t, want, hex.EncodeToString(Keccak256([]byte(msg))), msg)
+	}
+}
+
+func TestKeccak256Incremental(t *testing.T) {
+	msg := bytes.Repeat([]byte("titanchain"), 50)
+	want := Keccak256(msg)
+
+	// 按不同长度分段写入，结果与一次写入相同
+	for _, step := range []int{1, 7, 135, 136, 137} {
+		h := NewKeccak256()
+		for i := 0; i < len(msg); i += step {
+			h.Write(msg[i:min(i+step, len(msg))])
+		}
+		assert.Equal(t, want, h.Sum(nil), step)
+	}
+
+	// Sum 不影响继续写入，Reset 之后重新开始
+	h := NewKeccak256()
+	h.Write(msg[:100])
+	h.Sum(nil)
+	h.Write(msg[100:])
+	assert.Equal(t, want, h.Sum(nil))
+	h.Reset()
+	assert.Equal(t, Keccak256(nil), h.Sum(nil))
+	assert.Equal(t, Keccak256(msg[:10], msg[10:]), want)
+}
@@ -2,114 +2,173 @@
 package crypto
 
 import (
-	"crypto/ecdsa"
-	"crypto/elliptic"
-	"crypto/rand"
-	"crypto/sha256"
 	"errors"
-	"math/big"
+	"fmt"
 
 	"github.com/felixkuang/titanchain/types"
 )
 
 var (
-	ErrInvalidPublicKey = errors.New("invalid public key length")
+	ErrInvalidPublicKey  = errors.New("invalid public key")
+	ErrInvalidPrivateKey = errors.New("invalid private key")
+	ErrUnknownKeyType    = errors.New("unknown key type")
 )
 
+// KeyType 标识密钥与签名所使用的算法
+// 序列化后的公钥、私钥与签名都以类型标识作为第一个字节，因此可以自描述地还原
+type KeyType byte
+
 const (
-	PublicKeyLength = 33
+	// KeyTypeP256 是 NIST P-256 曲线上的 ECDSA，默认的密钥类型
+	KeyTypeP256 KeyType = 0x01
+	// KeyTypeEd25519 是 Ed25519 签名
+	KeyTypeEd25519 KeyType = 0x02
+	// KeyTypeSecp256k1 是 secp256k1 曲线上的 ECDSA
+	KeyTypeSecp256k1 KeyType = 0x03
 )
 
-// PrivateKey 封装了ECDSA私钥
-type PrivateKey struct {
-	key *ecdsa.PrivateKey // 底层ECDSA私钥
+// String 返回密钥类型的名称
+func (t KeyType) String() string {
+	switch t {
+	case KeyTypeP256:
+		return "p256"
+	case KeyTypeEd25519:
+		return "ed25519"
+	case KeyTypeSecp256k1:
+		return "secp256k1"
+	default:
+		return fmt.Sprintf("unknown(%d)", byte(t))
+	}
 }
 
-// Sign 使用私钥对数据进行签名
-// 参数：
-//   - data: 要签名的数据
-//
-// 返回：
-//   - 签名对象和可能的错误
-func (k PrivateKey) Sign(data []byte) (*Signature, error) {
-	r, s, err := ecdsa.Sign(rand.Reader, k.key, data)
-	if err != nil {
-		return nil, err
+// ParseKeyType 按名称查找密钥类型，名称与 String 的结果一致
+func ParseKeyType(name string) (KeyType, error) {
+	for _, t := range []KeyType{KeyTypeP256, KeyTypeEd25519, KeyTypeSecp256k1} {
+		if t.String() == name {
+			return t, nil
+		}
 	}
 
-	return &Signature{
-		R: r,
-		S: s,
-	}, nil
+	return 0, fmt.Errorf("%w (%s)", ErrUnknownKeyType, name)
 }
 
-// GeneratePrivateKey 生成一个新的私钥
-// 使用P256曲线和安全的随机数生成器
+// PrivateKey 是各类型私钥的统一接口
+type PrivateKey interface {
+	// Type 返回密钥类型
+	Type() KeyType
+	// PublicKey 返回对应的公钥
+	PublicKey() PublicKey
+	// Sign 对数据进行签名；ECDSA 类型对数据的 SHA256 摘要签名，Ed25519 直接对数据签名
+	Sign(data []byte) (Signature, error)
+	// ToSlice 返回自描述的序列化结果：类型标识 || 私钥
+	ToSlice() []byte
+}
+
+// PublicKey 是各类型公钥的统一接口
+type PublicKey interface {
+	// Type 返回密钥类型
+	Type() KeyType
+	// ToSlice 返回自描述的序列化结果：类型标识 || 公钥（ECDSA 为压缩格式）
+	ToSlice() []byte
+	// Verify 验证签名是否为对应私钥对数据的有效签名，签名类型与公钥类型不同时返回 false
+	Verify(data []byte, sig Signature) bool
+	// Address 使用 SHA256 从公钥生成地址，等价于 AddressWith(HashSHA256)
+	Address() types.Address
+	// AddressWith 使用指定的哈希算法从公钥生成地址
+	AddressWith(algo HashAlgorithm) types.Address
+}
+
+// Signature 是各类型签名的统一接口
+type Signature interface {
+	// Type 返回签名所属的密钥类型
+	Type() KeyType
+	// ToSlice 返回自描述的序列化结果：类型标识 || 签名
+	ToSlice() []byte
+	// Verify 验证签名是否有效，等价于 pubKey.Verify(data, sig)
+	Verify(pubKey PublicKey, data []byte) bool
+	// Validate 检查签名是否为规范形式，非规范签名返回 ErrNonCanonicalSignature
+	Validate() error
+}
+
+// GeneratePrivateKey 生成一个新的 P-256 私钥
+// 使用安全的随机数生成器
 func GeneratePrivateKey() PrivateKey {
-	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	key, err := GenerateKey(KeyTypeP256)
 	if err != nil {
 		panic(err)
 	}
 
-	return PrivateKey{
-		key: key,
-	}
+	return key
 }
 
-// PublicKey 从私钥中获取对应的公钥
-func (k PrivateKey) PublicKey() PublicKey {
-	return PublicKey{
-		Key: &k.key.PublicKey,
+// GenerateKey 生成一个指定类型的新私钥
+func GenerateKey(t KeyType) (PrivateKey, error) {
+	switch t {
+	case KeyTypeP256:
+		return generateP256Key()
+	case KeyTypeEd25519:
+		return generateEd25519Key()
+	case KeyTypeSecp256k1:
+		return generateSecp256k1Key()
+	default:
+		return nil, fmt.Errorf("%w (%d)", ErrUnknownKeyType, byte(t))
 	}
 }
 
-// PublicKey 封装了ECDSA公钥
-type PublicKey struct {
-	Key *ecdsa.PublicKey // 底层ECDSA公钥
-}
+// ToPrivateKey 从自描述的字节切片还原私钥
+// 参数：
+//   - b: PrivateKey.ToSlice 的结果
+//
+// 返回：
+//   - 还原后的私钥和错误信息
+func ToPrivateKey(b []byte) (PrivateKey, error) {
+	if len(b) == 0 {
+		return nil, ErrInvalidPrivateKey
+	}
 
-// ToSlice 将公钥转换为字节切片（压缩格式）
-// 使用elliptic.MarshalCompressed进行编码，便于网络传输和存储
-func (k PublicKey) ToSlice() []byte {
-	return elliptic.MarshalCompressed(elliptic.P256(), k.Key.X, k.Key.Y)
+	switch KeyType(b[0]) {
+	case KeyTypeP256:
+		return toP256PrivateKey(b[1:])
+	case KeyTypeEd25519:
+		return toEd25519PrivateKey(b[1:])
+	case KeyTypeSecp256k1:
+		return toSecp256k1PrivateKey(b[1:])
+	default:
+		return nil, fmt.Errorf("%w (%d)", ErrUnknownKeyType, b[0])
+	}
 }
 
-// ToPublicKey 从压缩字节切片还原公钥
+// ToPublicKey 从自描述的字节切片还原公钥
 // 参数：
-//   - b: 压缩格式的公钥字节切片
+//   - b: PublicKey.ToSlice 的结果
 //
 // 返回：
-//   - 还原后的PublicKey对象和错误信息
+//   - 还原后的公钥和错误信息
 func ToPublicKey(b []byte) (PublicKey, error) {
-	if len(b) != PublicKeyLength {
-		return PublicKey{}, ErrInvalidPublicKey
+	if len(b) == 0 {
+		return nil, ErrInvalidPublicKey
 	}
-	x, y := elliptic.UnmarshalCompressed(elliptic.P256(), b)
-	if x == nil || y == nil {
-		return PublicKey{}, ErrInvalidPublicKey
+
+	switch KeyType(b[0]) {
+	case KeyTypeP256:
+		return toP256PublicKey(b[1:])
+	case KeyTypeEd25519:
+		return toEd25519PublicKey(b[1:])
+	case KeyTypeSecp256k1:
+		return toSecp256k1PublicKey(b[1:])
+	default:
+		return nil, fmt.Errorf("%w (%d)", ErrUnknownKeyType, b[0])
 	}
-	return PublicKey{Key: &ecdsa.PublicKey{Curve: elliptic.P256(), X: x, Y: y}}, nil
 }
 
-// Address 从公钥生成地址
-// 使用公钥的SHA256哈希的最后20字节作为地址
-func (k PublicKey) Address() types.Address {
-	h := sha256.Sum256(k.ToSlice())
+// publicKeyAddress 取自描述公钥的哈希的最后20字节作为地址
+// 类型标识参与哈希，不同类型的公钥不会推导出相同的地址
+func publicKeyAddress(k PublicKey, algo HashAlgorithm) types.Address {
+	h := algo.Sum(k.ToSlice())
 	return types.AddressFromBytes(h[len(h)-20:])
 }
 
-// Signature 表示ECDSA签名
-type Signature struct {
-	S, R *big.Int // 签名的两个组成部分
-}
-
-// Verify 验证签名是否有效
-// 参数：
-//   - pubKey: 用于验证的公钥
-//   - data: 原始数据
-//
-// 返回：
-//   - 签名是否有效
-func (sig Signature) Verify(pubKey PublicKey, data []byte) bool {
-	return ecdsa.Verify(pubKey.Key, data, sig.R, sig.S)
+// withKeyType 返回以类型标识开头的序列化结果
+func withKeyType(t KeyType, b []byte) []byte {
+	return append([]byte{byte(t)}, b...)
 }
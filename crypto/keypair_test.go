@@ -84,10 +84,11 @@ func TestKeypairSignTamperedMessage(t *testing.T) {
 //   - 能否正常生成私钥，并从私钥导出公钥
 func TestGeneratePrivateKeyAndPublicKey(t *testing.T) {
 	privKey := GeneratePrivateKey()
-	assert.NotNil(t, privKey.key, "生成的私钥不应为nil")
+	assert.Equal(t, KeyTypeP256, privKey.Type(), "默认生成P256私钥")
+	assert.NotNil(t, privKey.(p256PrivateKey).key, "生成的私钥不应为nil")
 
 	pubKey := privKey.PublicKey()
-	assert.NotNil(t, pubKey.Key, "导出的公钥不应为nil")
+	assert.NotNil(t, pubKey.(p256PublicKey).key, "导出的公钥不应为nil")
 }
 
 // TestPublicKeyToSliceAndToPublicKey 测试公钥序列化与反序列化（压缩格式）
@@ -98,13 +99,13 @@ func TestPublicKeyToSliceAndToPublicKey(t *testing.T) {
 	privKey := GeneratePrivateKey()
 	pubKey := privKey.PublicKey()
 	pubBytes := pubKey.ToSlice()
-	assert.Equal(t, PublicKeyLength, len(pubBytes), "公钥压缩后长度应为33字节")
+	assert.Equal(t, 1+P256PublicKeyLength, len(pubBytes), "公钥压缩后长度应为类型标识加33字节")
 
 	// 反序列化
 	newPubKey, err := ToPublicKey(pubBytes)
 	assert.Nil(t, err, "公钥反序列化应无错误")
-	assert.Equal(t, pubKey.Key.X, newPubKey.Key.X, "反序列化后X坐标应一致")
-	assert.Equal(t, pubKey.Key.Y, newPubKey.Key.Y, "反序列化后Y坐标应一致")
+	assert.Equal(t, pubKey.(p256PublicKey).key.X, newPubKey.(p256PublicKey).key.X, "反序列化后X坐标应一致")
+	assert.Equal(t, pubKey.(p256PublicKey).key.Y, newPubKey.(p256PublicKey).key.Y, "反序列化后Y坐标应一致")
 
 	// 错误长度
 	_, err = ToPublicKey([]byte{0x01, 0x02, 0x03})
@@ -132,6 +133,6 @@ func TestSignatureNilFields(t *testing.T) {
 	pubKey := privKey.PublicKey()
 	msg := []byte("test")
 
-	sig := &Signature{R: &big.Int{}, S: &big.Int{}}
+	sig := &ecdsaSignature{keyType: KeyTypeP256, R: &big.Int{}, S: &big.Int{}}
 	assert.False(t, sig.Verify(pubKey, msg), "Signature字段为nil时验证应失败")
 }
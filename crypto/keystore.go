@@ -0,0 +1,224 @@
+package crypto
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+const (
+	// keystoreVersion 是 keystore 文件格式的版本
+	keystoreVersion = 1
+	// keystoreCipher 是加密私钥所用的算法
+	keystoreCipher = "aes-256-gcm"
+	// keystoreKDF 是由口令派生加密密钥所用的算法
+	keystoreKDF = "scrypt"
+	// keystoreKeyLength 是派生的 AES-256 密钥字节数
+	keystoreKeyLength = 32
+	// keystoreSaltLength 是 scrypt 盐的字节数
+	keystoreSaltLength = 32
+)
+
+var (
+	// ErrInvalidPassword 表示口令错误（或密文被篡改），无法解密私钥
+	ErrInvalidPassword = errors.New("could not decrypt key with given password")
+	// ErrInvalidKeystore 表示 keystore 文件格式不合法
+	ErrInvalidKeystore = errors.New("invalid keystore")
+)
+
+// ScryptParams 是 keystore 派生加密密钥所用的 scrypt 参数，占用内存约为 128·R·N 字节
+type ScryptParams struct {
+	N int // CPU/内存开销，2 的幂
+	R int // 分组大小
+	P int // 并行度
+}
+
+var (
+	// StandardScryptParams 是 SaveKey 使用的参数，约占用 256MB 内存
+	StandardScryptParams = ScryptParams{N: 1 << 18, R: 8, P: 1}
+	// LightScryptParams 适用于内存受限的环境与测试，约占用 4MB 内存
+	LightScryptParams = ScryptParams{N: 1 << 12, R: 8, P: 6}
+)
+
+// keystoreJSON 是 keystore 文件的 JSON 结构
+// 私钥以自描述编码（见 PrivateKey.ToSlice）加密，公钥明文保存，便于不解密时识别账户
+type keystoreJSON struct {
+	Version   int            `json:"version"`
+	KeyType   string         `json:"keyType"`
+	PublicKey string         `json:"publicKey"` // 十六进制的自描述公钥
+	Crypto    keystoreCrypto `json:"crypto"`
+}
+
+// keystoreCrypto 记录解密私钥所需的参数
+type keystoreCrypto struct {
+	Cipher     string         `json:"cipher"`
+	CipherText string         `json:"ciphertext"` // 十六进制，包含 GCM 认证标签
+	Nonce      string         `json:"nonce"`
+	KDF        string         `json:"kdf"`
+	KDFParams  keystoreScrypt `json:"kdfparams"`
+}
+
+// keystoreScrypt 是 scrypt 参数与盐
+type keystoreScrypt struct {
+	N     int    `json:"n"`
+	R     int    `json:"r"`
+	P     int    `json:"p"`
+	DKLen int    `json:"dklen"`
+	Salt  string `json:"salt"`
+}
+
+// EncryptKey 使用口令加密私钥，返回 keystore 的 JSON 编码
+// 参数：
+//   - key: 任意类型的私钥
+//   - password: 口令
+//   - params: scrypt 参数
+//
+// 返回：
+//   - keystore JSON 与错误信息
+func EncryptKey(key PrivateKey, password string, params ScryptParams) ([]byte, error) {
+	salt := make([]byte, keystoreSaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+
+	derived, err := scrypt([]byte(password), salt, params.N, params.R, params.P, keystoreKeyLength)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := newKeystoreAEAD(derived)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+
+	pubKey := key.PublicKey().ToSlice()
+	ks := keystoreJSON{
+		Version:   keystoreVersion,
+		KeyType:   key.Type().String(),
+		PublicKey: hex.EncodeToString(pubKey),
+		Crypto: keystoreCrypto{
+			Cipher: keystoreCipher,
+			// 公钥作为附加认证数据，明文部分被篡改时解密失败
+			CipherText: hex.EncodeToString(aead.Seal(nil, nonce, key.ToSlice(), pubKey)),
+			Nonce:      hex.EncodeToString(nonce),
+			KDF:        keystoreKDF,
+			KDFParams: keystoreScrypt{
+				N:     params.N,
+				R:     params.R,
+				P:     params.P,
+				DKLen: keystoreKeyLength,
+				Salt:  hex.EncodeToString(salt),
+			},
+		},
+	}
+
+	return json.MarshalIndent(ks, "", "  ")
+}
+
+// DecryptKey 使用口令解密 keystore JSON，还原私钥
+// 口令错误时返回 ErrInvalidPassword，格式不合法时返回包装了 ErrInvalidKeystore 的错误
+func DecryptKey(data []byte, password string) (PrivateKey, error) {
+	var ks keystoreJSON
+	if err := json.Unmarshal(data, &ks); err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidKeystore, err)
+	}
+	if ks.Version != keystoreVersion {
+		return nil, fmt.Errorf("%w: unsupported version (%d)", ErrInvalidKeystore, ks.Version)
+	}
+	if ks.Crypto.Cipher != keystoreCipher || ks.Crypto.KDF != keystoreKDF {
+		return nil, fmt.Errorf("%w: unsupported cipher (%s) or kdf (%s)", ErrInvalidKeystore, ks.Crypto.Cipher, ks.Crypto.KDF)
+	}
+
+	params := ks.Crypto.KDFParams
+	if params.DKLen != keystoreKeyLength {
+		return nil, fmt.Errorf("%w: derived key length (%d)", ErrInvalidKeystore, params.DKLen)
+	}
+	pubKey, err1 := hex.DecodeString(ks.PublicKey)
+	cipherText, err2 := hex.DecodeString(ks.Crypto.CipherText)
+	nonce, err3 := hex.DecodeString(ks.Crypto.Nonce)
+	salt, err4 := hex.DecodeString(params.Salt)
+	if err := errors.Join(err1, err2, err3, err4); err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidKeystore, err)
+	}
+
+	derived, err := scrypt([]byte(password), salt, params.N, params.R, params.P, params.DKLen)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidKeystore, err)
+	}
+	aead, err := newKeystoreAEAD(derived)
+	if err != nil {
+		return nil, err
+	}
+	if len(nonce) != aead.NonceSize() {
+		return nil, fmt.Errorf("%w: nonce has %d bytes", ErrInvalidKeystore, len(nonce))
+	}
+
+	plain, err := aead.Open(nil, nonce, cipherText, pubKey)
+	if err != nil {
+		return nil, ErrInvalidPassword
+	}
+	key, err := ToPrivateKey(plain)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidKeystore, err)
+	}
+	if !bytes.Equal(key.PublicKey().ToSlice(), pubKey) {
+		return nil, fmt.Errorf("%w: public key does not match private key", ErrInvalidKeystore)
+	}
+
+	return key, nil
+}
+
+// SaveKey 使用口令加密私钥并写入 keystore 文件
+// 使用 StandardScryptParams，文件权限为 0600；先写入临时文件再重命名，避免留下不完整的文件
+func SaveKey(path string, key PrivateKey, password string) error {
+	data, err := EncryptKey(key, password, StandardScryptParams)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
+
+// LoadKey 读取 keystore 文件并使用口令解密私钥
+func LoadKey(path string, password string) (PrivateKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return DecryptKey(data, password)
+}
+
+// newKeystoreAEAD 由派生密钥创建 AES-256-GCM 实例
+func newKeystoreAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,127 @@
+package crypto
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestKeystoreEncryptDecrypt 测试各类型私钥加密后可以用同一口令解密
+func TestKeystoreEncryptDecrypt(t *testing.T) {
+	for _, kt := range keyTypes {
+		privKey, err := GenerateKey(kt)
+		assert.Nil(t, err)
+
+		data, err := EncryptKey(privKey, "secret", LightScryptParams)
+		assert.Nil(t, err)
+		assert.NotContains(t, string(data), string(privKey.ToSlice()))
+
+		restored, err := DecryptKey(data, "secret")
+		assert.Nil(t, err)
+		assert.Equal(t, privKey.ToSlice(), restored.ToSlice())
+		assert.Equal(t, kt, restored.Type())
+
+		_, err = DecryptKey(data, "Secret")
+		assert.ErrorIs(t, err, ErrInvalidPassword)
+	}
+}
+
+// TestKeystoreFormat 测试 keystore 的 JSON 字段，每次加密使用不同的盐与随机数
+func TestKeystoreFormat(t *testing.T) {
+	privKey, err := GenerateKey(KeyTypeSecp256k1)
+	assert.Nil(t, err)
+	a, err := EncryptKey(privKey, "secret", LightScryptParams)
+	assert.Nil(t, err)
+	b, err := EncryptKey(privKey, "secret", LightScryptParams)
+	assert.Nil(t, err)
+
+	var ksA, ksB keystoreJSON
+	assert.Nil(t, json.Unmarshal(a, &ksA))
+	assert.Nil(t, json.Unmarshal(b, &ksB))
+	assert.Equal(t, 1, ksA.Version)
+	assert.Equal(t, "secp256k1", ksA.KeyType)
+	assert.Equal(t, "aes-256-gcm", ksA.Crypto.Cipher)
+	assert.Equal(t, "scrypt", ksA.Crypto.KDF)
+	assert.Equal(t, LightScryptParams.N, ksA.Crypto.KDFParams.N)
+	assert.Equal(t, ksA.PublicKey, ksB.PublicKey)
+	assert.NotEqual(t, ksA.Crypto.KDFParams.Salt, ksB.Crypto.KDFParams.Salt)
+	assert.NotEqual(t, ksA.Crypto.Nonce, ksB.Crypto.Nonce)
+	assert.NotEqual(t, ksA.Crypto.CipherText, ksB.Crypto.CipherText)
+}
+
+// TestKeystoreTampered 测试被篡改或格式不合法的 keystore
+func TestKeystoreTampered(t *testing.T) {
+	privKey := GeneratePrivateKey()
+	data, err := EncryptKey(privKey, "secret", LightScryptParams)
+	assert.Nil(t, err)
+
+	tamper := func(f func(ks *keystoreJSON)) []byte {
+		var ks keystoreJSON
+		assert.Nil(t, json.Unmarshal(data, &ks))
+		f(&ks)
+		b, err := json.Marshal(ks)
+		assert.Nil(t, err)
+		return b
+	}
+
+	// 替换明文公钥或修改密文时认证失败
+	otherKey := GeneratePrivateKey()
+	_, err = DecryptKey(tamper(func(ks *keystoreJSON) {
+		ks.PublicKey = hex.EncodeToString(otherKey.PublicKey().ToSlice())
+	}), "secret")
+	assert.ErrorIs(t, err, ErrInvalidPassword)
+	_, err = DecryptKey(tamper(func(ks *keystoreJSON) {
+		c := []byte(ks.Crypto.CipherText)
+		if c[0] == '0' {
+			c[0] = '1'
+		} else {
+			c[0] = '0'
+		}
+		ks.Crypto.CipherText = string(c)
+	}), "secret")
+	assert.ErrorIs(t, err, ErrInvalidPassword)
+
+	invalid := [][]byte{
+		[]byte("not json"),
+		tamper(func(ks *keystoreJSON) { ks.Version = 2 }),
+		tamper(func(ks *keystoreJSON) { ks.Crypto.Cipher = "aes-128-ctr" }),
+		tamper(func(ks *keystoreJSON) { ks.Crypto.KDF = "pbkdf2" }),
+		tamper(func(ks *keystoreJSON) { ks.Crypto.KDFParams.DKLen = 16 }),
+		tamper(func(ks *keystoreJSON) { ks.Crypto.KDFParams.N = 1000 }),
+		tamper(func(ks *keystoreJSON) { ks.Crypto.KDFParams.N = 1 << 30 }),
+		tamper(func(ks *keystoreJSON) { ks.Crypto.Nonce = "00" }),
+		tamper(func(ks *keystoreJSON) { ks.Crypto.KDFParams.Salt = "zz" }),
+	}
+	for _, b := range invalid {
+		_, err := DecryptKey(b, "secret")
+		assert.ErrorIs(t, err, ErrInvalidKeystore, string(b))
+	}
+}
+
+// TestSaveLoadKey 测试 keystore 文件的写入与读取
+func TestSaveLoadKey(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "validator.json")
+	privKey, err := GenerateKey(KeyTypeEd25519)
+	assert.Nil(t, err)
+
+	assert.Nil(t, SaveKey(path, privKey, "secret"))
+	info, err := os.Stat(path)
+	assert.Nil(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+	entries, err := os.ReadDir(filepath.Dir(path))
+	assert.Nil(t, err)
+	assert.Len(t, entries, 1, "临时文件应被重命名")
+
+	restored, err := LoadKey(path, "secret")
+	assert.Nil(t, err)
+	assert.Equal(t, privKey.ToSlice(), restored.ToSlice())
+
+	_, err = LoadKey(path, "wrong")
+	assert.ErrorIs(t, err, ErrInvalidPassword)
+	_, err = LoadKey(filepath.Join(t.TempDir(), "missing.json"), "secret")
+	assert.ErrorIs(t, err, os.ErrNotExist)
+}
@@ -0,0 +1,186 @@
+package crypto
+
+import (
+	"encoding/hex"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var keyTypes = []KeyType{KeyTypeP256, KeyTypeEd25519, KeyTypeSecp256k1}
+
+// TestKeyTypesSignVerify 测试各类型密钥的签名、验证与序列化往返
+func TestKeyTypesSignVerify(t *testing.T) {
+	msg := []byte("hello world")
+
+	for _, kt := range keyTypes {
+		privKey, err := GenerateKey(kt)
+		assert.Nil(t, err)
+		assert.Equal(t, kt, privKey.Type())
+		pubKey := privKey.PublicKey()
+		assert.Equal(t, kt, pubKey.Type())
+
+		sig, err := privKey.Sign(msg)
+		assert.Nil(t, err)
+		assert.Equal(t, kt, sig.Type())
+		assert.True(t, sig.Verify(pubKey, msg), kt)
+		assert.True(t, pubKey.Verify(msg, sig), kt)
+		assert.False(t, sig.Verify(pubKey, []byte("hello world!")), kt)
+
+		// 序列化结果以类型标识开头，还原后与原值一致
+		for _, b := range [][]byte{privKey.ToSlice(), pubKey.ToSlice(), sig.ToSlice()} {
+			assert.Equal(t, byte(kt), b[0])
+		}
+		restoredPriv, err := ToPrivateKey(privKey.ToSlice())
+		assert.Nil(t, err)
+		assert.Equal(t, pubKey.ToSlice(), restoredPriv.PublicKey().ToSlice())
+		restoredPub, err := ToPublicKey(pubKey.ToSlice())
+		assert.Nil(t, err)
+		assert.Equal(t, pubKey.Address(), restoredPub.Address())
+		restoredSig, err := ToSignature(sig.ToSlice())
+		assert.Nil(t, err)
+		assert.True(t, restoredSig.Verify(restoredPub, msg), kt)
+	}
+}
+
+// TestKeyTypesMismatch 测试签名只能由同类型、对应的公钥验证，不同类型的公钥推导出不同的地址
+func TestKeyTypesMismatch(t *testing.T) {
+	msg := []byte("hello world")
+	addrs := map[string]bool{}
+
+	for _, kt := range keyTypes {
+		privKey, err := GenerateKey(kt)
+		assert.Nil(t, err)
+		sig, err := privKey.Sign(msg)
+		assert.Nil(t, err)
+		addrs[privKey.PublicKey().Address().String()] = true
+
+		for _, other := range keyTypes {
+			otherKey, err := GenerateKey(other)
+			assert.Nil(t, err)
+			assert.False(t, sig.Verify(otherKey.PublicKey(), msg), "%s signature verified by %s key", kt, other)
+		}
+
+		// 类型标识被改写为其他曲线时，原编码不合法；按另一曲线的格式重新编码后签名无效
+		if kt != KeyTypeEd25519 {
+			other := KeyTypeP256 + KeyTypeSecp256k1 - kt
+			b := sig.ToSlice()
+			b[0] = byte(other)
+			_, err := ToSignature(b)
+			assert.ErrorIs(t, err, ErrInvalidSignatureEncoding)
+
+			b = b[:1+ecdsaSignatureLength]
+			if other == KeyTypeSecp256k1 {
+				b = append(b, 0)
+			}
+			forged, err := ToSignature(b)
+			assert.Nil(t, err)
+			assert.False(t, forged.Verify(privKey.PublicKey(), msg))
+		}
+	}
+
+	assert.Len(t, addrs, len(keyTypes))
+}
+
+// TestKeyTypesInvalidEncoding 测试非法的序列化结果
+func TestKeyTypesInvalidEncoding(t *testing.T) {
+	_, err := GenerateKey(0x7f)
+	assert.ErrorIs(t, err, ErrUnknownKeyType)
+
+	for _, b := range [][]byte{nil, {0x7f, 0x01}} {
+		_, err = ToPrivateKey(b)
+		assert.NotNil(t, err)
+		_, err = ToPublicKey(b)
+		assert.NotNil(t, err)
+		_, err = ToSignature(b)
+		assert.NotNil(t, err)
+	}
+
+	for _, kt := range keyTypes {
+		// 缺少最后一个字节
+		privKey, err := GenerateKey(kt)
+		assert.Nil(t, err)
+		_, err = ToPrivateKey(privKey.ToSlice()[:32])
+		assert.NotNil(t, err, kt)
+		pub := privKey.PublicKey().ToSlice()
+		_, err = ToPublicKey(pub[:len(pub)-1])
+		assert.NotNil(t, err, kt)
+		sig, err := privKey.Sign([]byte("x"))
+		assert.Nil(t, err)
+		_, err = ToSignature(sig.ToSlice()[:64])
+		assert.ErrorIs(t, err, ErrInvalidSignatureEncoding, kt)
+	}
+
+	// 私钥标量为 0 或不小于曲线阶
+	for _, kt := range []KeyType{KeyTypeP256, KeyTypeSecp256k1} {
+		_, err := ToPrivateKey(append([]byte{byte(kt)}, make([]byte, 32)...))
+		assert.ErrorIs(t, err, ErrInvalidPrivateKey)
+		ff := make([]byte, 32)
+		for i := range ff {
+			ff[i] = 0xff
+		}
+		_, err = ToPrivateKey(append([]byte{byte(kt)}, ff...))
+		assert.ErrorIs(t, err, ErrInvalidPrivateKey)
+	}
+
+	// x 坐标不在 secp256k1 曲线上（x = 5 时 x³ + 7 不是二次剩余）
+	notOnCurve := append([]byte{byte(KeyTypeSecp256k1), 0x02}, make([]byte, 31)...)
+	notOnCurve = append(notOnCurve, 0x05)
+	_, err = ToPublicKey(notOnCurve)
+	assert.ErrorIs(t, err, ErrInvalidPublicKey)
+}
+
+// TestSecp256k1Vectors 测试 secp256k1 与 OpenSSL 生成的密钥、签名互通
+func TestSecp256k1Vectors(t *testing.T) {
+	// 私钥 1 的公钥为基点 G
+	one := append([]byte{byte(KeyTypeSecp256k1)}, make([]byte, 31)...)
+	one = append(one, 0x01)
+	privKey, err := ToPrivateKey(one)
+	assert.Nil(t, err)
+	assert.Equal(t, "0302"+"79be667ef9dcbbac55a06295ce870b07029bfcdb2dce28d959f2815b16f81798", hex.EncodeToString(privKey.PublicKey().ToSlice()))
+
+	// 由 openssl ecparam -name secp256k1 -genkey 生成的密钥与 openssl dgst -sha256 -sign 得到的签名
+	privBytes, _ := hex.DecodeString("03" + "42169f15949abf1db408fb3e3b361f21e8bc25cf1d6f2251f2b46d5231920204")
+	privKey, err = ToPrivateKey(privBytes)
+	assert.Nil(t, err)
+	assert.Equal(t, "03"+"0232e79192cc1b283b958fd8063144b3d1b0ad39567fc881ce71a217adae07a96d", hex.EncodeToString(privKey.PublicKey().ToSlice()))
+
+	// OpenSSL 不做 low-S 规范化，这个签名的 S 大于 n/2，规范化为 n-S（恢复标识随之翻转为 1）后才能通过验证
+	// OpenSSL 不输出恢复标识，这里按 secp256k1 签名的编码补上
+	sigBytes, _ := hex.DecodeString("03" +
+		"87f3d2e3f7192e3f825a0a26ab4d1ab620e97b0702593fbaf7508a0a7575fb84" +
+		"e7489dc851ce0e442976395af481b8207004180892efc275c720e1301e2ddb92" + "00")
+	sig, err := ToSignature(sigBytes)
+	assert.Nil(t, err)
+	assert.ErrorIs(t, sig.Validate(), ErrNonCanonicalSignature)
+	assert.False(t, sig.Verify(privKey.PublicKey(), []byte("hello titanchain")))
+
+	sigBytes, _ = hex.DecodeString("03" +
+		"87f3d2e3f7192e3f825a0a26ab4d1ab620e97b0702593fbaf7508a0a7575fb84" +
+		"18b76237ae31f1bbd689c6a50b7e47de4aaac4de1c58ddc5f8b17d5cb20865af" + "01")
+	sig, err = ToSignature(sigBytes)
+	assert.Nil(t, err)
+	assert.Nil(t, sig.Validate())
+	assert.True(t, sig.Verify(privKey.PublicKey(), []byte("hello titanchain")))
+	assert.False(t, sig.Verify(privKey.PublicKey(), []byte("hello titanchaiN")))
+
+	// 随机数按 RFC 6979 确定性地生成，同一私钥对同一数据的签名不变
+	sig1, err := privKey.Sign([]byte("hello titanchain"))
+	assert.Nil(t, err)
+	sig2, err := privKey.Sign([]byte("hello titanchain"))
+	assert.Nil(t, err)
+	assert.Equal(t, sig1.ToSlice(), sig2.ToSlice())
+	assert.True(t, sig1.Verify(privKey.PublicKey(), []byte("hello titanchain")))
+}
+
+// TestParseKeyType 测试按名称查找密钥类型
+func TestParseKeyType(t *testing.T) {
+	for _, kt := range keyTypes {
+		parsed, err := ParseKeyType(kt.String())
+		assert.Nil(t, err)
+		assert.Equal(t, kt, parsed)
+	}
+
+	_, err := ParseKeyType("rsa")
+	assert.ErrorIs(t, err, ErrUnknownKeyType)
+}
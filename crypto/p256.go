@@ -0,0 +1,127 @@
+package crypto
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"math/big"
+
+	"github.com/felixkuang/titanchain/types"
+)
+
+const (
+	// P256PublicKeyLength 是 P-256 压缩公钥的字节数，不含类型标识
+	P256PublicKeyLength = 33
+	// p256PrivateKeyLength 是 P-256 私钥标量的字节数
+	p256PrivateKeyLength = 32
+)
+
+// p256PrivateKey 封装了 P-256 曲线上的 ECDSA 私钥
+type p256PrivateKey struct {
+	key *ecdsa.PrivateKey // 底层ECDSA私钥
+}
+
+// generateP256Key 使用P256曲线和安全的随机数生成器生成私钥
+func generateP256Key() (PrivateKey, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+
+	return p256PrivateKey{key: key}, nil
+}
+
+// toP256PrivateKey 从 32 字节的私钥标量还原私钥
+func toP256PrivateKey(b []byte) (PrivateKey, error) {
+	if len(b) != p256PrivateKeyLength {
+		return nil, ErrInvalidPrivateKey
+	}
+
+	curve := elliptic.P256()
+	d := new(big.Int).SetBytes(b)
+	if d.Sign() == 0 || d.Cmp(curve.Params().N) >= 0 {
+		return nil, ErrInvalidPrivateKey
+	}
+	x, y := curve.ScalarBaseMult(b)
+
+	return p256PrivateKey{key: &ecdsa.PrivateKey{PublicKey: ecdsa.PublicKey{Curve: curve, X: x, Y: y}, D: d}}, nil
+}
+
+func (k p256PrivateKey) Type() KeyType {
+	return KeyTypeP256
+}
+
+// Sign 使用私钥对数据进行签名
+// 数据先经过 SHA256 哈希，再对摘要进行 ECDSA 签名，结果规范化为 low-S 形式
+func (k p256PrivateKey) Sign(data []byte) (Signature, error) {
+	digest := sha256.Sum256(data)
+
+	r, s, err := ecdsa.Sign(rand.Reader, k.key, digest[:])
+	if err != nil {
+		return nil, err
+	}
+
+	return newECDSASignature(KeyTypeP256, r, s, 0), nil
+}
+
+// PublicKey 从私钥中获取对应的公钥
+func (k p256PrivateKey) PublicKey() PublicKey {
+	return p256PublicKey{key: &k.key.PublicKey}
+}
+
+// ToSlice 返回类型标识与 32 字节的私钥标量
+func (k p256PrivateKey) ToSlice() []byte {
+	b := make([]byte, 1+p256PrivateKeyLength)
+	b[0] = byte(KeyTypeP256)
+	k.key.D.FillBytes(b[1:])
+
+	return b
+}
+
+// p256PublicKey 封装了 P-256 曲线上的 ECDSA 公钥
+type p256PublicKey struct {
+	key *ecdsa.PublicKey // 底层ECDSA公钥
+}
+
+// toP256PublicKey 从压缩字节切片还原公钥
+func toP256PublicKey(b []byte) (PublicKey, error) {
+	if len(b) != P256PublicKeyLength {
+		return nil, ErrInvalidPublicKey
+	}
+	x, y := elliptic.UnmarshalCompressed(elliptic.P256(), b)
+	if x == nil || y == nil {
+		return nil, ErrInvalidPublicKey
+	}
+
+	return p256PublicKey{key: &ecdsa.PublicKey{Curve: elliptic.P256(), X: x, Y: y}}, nil
+}
+
+func (k p256PublicKey) Type() KeyType {
+	return KeyTypeP256
+}
+
+// ToSlice 返回类型标识与压缩格式的公钥
+// 使用elliptic.MarshalCompressed进行编码，便于网络传输和存储
+func (k p256PublicKey) ToSlice() []byte {
+	return withKeyType(KeyTypeP256, elliptic.MarshalCompressed(elliptic.P256(), k.key.X, k.key.Y))
+}
+
+// Verify 与 Sign 一致，先对原始数据进行 SHA256 哈希再验证，非规范签名视为无效
+func (k p256PublicKey) Verify(data []byte, sig Signature) bool {
+	s, ok := sig.(*ecdsaSignature)
+	if !ok || s.keyType != KeyTypeP256 || s.Validate() != nil {
+		return false
+	}
+
+	digest := sha256.Sum256(data)
+	return ecdsa.Verify(k.key, digest[:], s.R, s.S)
+}
+
+func (k p256PublicKey) Address() types.Address {
+	return k.AddressWith(HashSHA256)
+}
+
+func (k p256PublicKey) AddressWith(algo HashAlgorithm) types.Address {
+	return publicKeyAddress(k, algo)
+}
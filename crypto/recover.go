@@ -0,0 +1,127 @@
+package crypto
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/sha256"
+	"errors"
+	"math/big"
+
+	secp256k1ecdsa "github.com/decred/dcrd/dcrec/secp256k1/v4/ecdsa"
+)
+
+var (
+	// ErrInvalidSignature 表示签名不合法，无法从中恢复公钥
+	ErrInvalidSignature = errors.New("invalid signature")
+	// ErrUnrecoverableSignature 表示签名没有附带恢复标识，无法从中恢复公钥
+	ErrUnrecoverableSignature = errors.New("signature is not recoverable")
+)
+
+// IsRecoverable 判断签名是否附带恢复标识，即能否由 RecoverSigner 恢复签名者公钥
+func IsRecoverable(sig Signature) bool {
+	s, ok := sig.(*ecdsaSignature)
+	return ok && s.recoverable()
+}
+
+// RecoverSigner 从附带恢复标识的签名（secp256k1）中恢复签名者的公钥
+// 与 Sign 一致，先对原始数据进行 SHA256 哈希再恢复
+// 参数：
+//   - data: 原始数据
+//   - sig: 附带恢复标识的规范签名
+//
+// 返回：
+//   - 恢复得到的公钥，满足 sig.Verify(pubKey, data)
+//   - 签名没有恢复标识时返回 ErrUnrecoverableSignature，签名非规范或不合法时返回对应错误
+func RecoverSigner(data []byte, sig Signature) (PublicKey, error) {
+	if !IsRecoverable(sig) {
+		return nil, ErrUnrecoverableSignature
+	}
+	if err := sig.Validate(); err != nil {
+		return nil, err
+	}
+
+	s := sig.(*ecdsaSignature)
+	digest := sha256.Sum256(data)
+
+	return recoverSecp256k1PublicKey(digest[:], s.R, s.S, s.V)
+}
+
+// recoverSecp256k1PublicKey 从 secp256k1 ECDSA 签名中恢复签名者的公钥
+// 由 secp256k1 库的 RecoverCompact 完成，恢复后会以得到的公钥验证签名
+func recoverSecp256k1PublicKey(digest []byte, r, s *big.Int, v byte) (PublicKey, error) {
+	if v > 1 || r.Sign() <= 0 || s.Sign() <= 0 || r.Cmp(secp256k1N) >= 0 || s.Cmp(secp256k1N) >= 0 {
+		return nil, ErrInvalidSignature
+	}
+
+	compact := make([]byte, recoverableSignatureLength)
+	compact[0] = secp256k1CompactRecoveryCode + v
+	r.FillBytes(compact[1:33])
+	s.FillBytes(compact[33:65])
+	key, _, err := secp256k1ecdsa.RecoverCompact(compact, digest)
+	if err != nil {
+		return nil, ErrInvalidSignature
+	}
+
+	return secp256k1PublicKey{key: key}, nil
+}
+
+// RecoverPublicKey 从 P-256 ECDSA 签名中恢复签名者的公钥
+// digest: 被签名的摘要，与 Sign 一致时为数据的 SHA256 哈希
+// r, s: 签名的两个组成部分；v: 恢复标识，签名点 R 的 y 坐标为偶数时为 0，奇数时为 1
+// 恢复得到的公钥满足 ecdsa.Verify(pub, digest, r, s)；签名不合法时返回 ErrInvalidSignature
+func RecoverPublicKey(digest []byte, r, s *big.Int, v byte) (PublicKey, error) {
+	curve := elliptic.P256()
+	params := curve.Params()
+
+	if v > 1 || r.Sign() <= 0 || s.Sign() <= 0 || r.Cmp(params.N) >= 0 || s.Cmp(params.N) >= 0 {
+		return nil, ErrInvalidSignature
+	}
+
+	// 由 x 坐标 r 解出 R 的 y 坐标：y² = x³ - 3x + b，p ≡ 3 (mod 4) 时平方根为 (y²)^((p+1)/4)
+	x := new(big.Int).Set(r)
+	ySquared := new(big.Int).Exp(x, big.NewInt(3), params.P)
+	ySquared.Sub(ySquared, new(big.Int).Mul(x, big.NewInt(3)))
+	ySquared.Add(ySquared, params.B)
+	ySquared.Mod(ySquared, params.P)
+	exp := new(big.Int).Add(params.P, big.NewInt(1))
+	exp.Rsh(exp, 2)
+	y := new(big.Int).Exp(ySquared, exp, params.P)
+	if y.Bit(0) != uint(v) {
+		y.Sub(params.P, y)
+	}
+	if !curve.IsOnCurve(x, y) {
+		return nil, ErrInvalidSignature
+	}
+
+	// Q = r⁻¹(sR - eG)
+	rInv := new(big.Int).ModInverse(r, params.N)
+	e := hashToInt(digest, params.N)
+	u1 := new(big.Int).Mul(e, rInv)
+	u1.Neg(u1).Mod(u1, params.N)
+	u2 := new(big.Int).Mul(s, rInv)
+	u2.Mod(u2, params.N)
+
+	x1, y1 := curve.ScalarBaseMult(u1.Bytes())
+	x2, y2 := curve.ScalarMult(x, y, u2.Bytes())
+	qx, qy := curve.Add(x1, y1, x2, y2)
+	if !curve.IsOnCurve(qx, qy) {
+		return nil, ErrInvalidSignature
+	}
+
+	return p256PublicKey{key: &ecdsa.PublicKey{Curve: curve, X: qx, Y: qy}}, nil
+}
+
+// hashToInt 按 ECDSA 的规则将摘要转换为整数：超过曲线阶位数的部分被截去
+func hashToInt(digest []byte, n *big.Int) *big.Int {
+	orderBytes := (n.BitLen() + 7) / 8
+	if len(digest) > orderBytes {
+		digest = digest[:orderBytes]
+	}
+
+	e := new(big.Int).SetBytes(digest)
+	if excess := len(digest)*8 - n.BitLen(); excess > 0 {
+		e.Rsh(e, uint(excess))
+	}
+
+	return e
+}
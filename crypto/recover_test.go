@@ -0,0 +1,131 @@
+package crypto
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"math/big"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRecoverPublicKey(t *testing.T) {
+	privKey := GeneratePrivateKey()
+	msg := []byte("hello world")
+	digest := sha256.Sum256(msg)
+
+	for i := 0; i < 10; i++ {
+		signature, err := privKey.Sign(msg)
+		assert.Nil(t, err)
+		sig := signature.(*ecdsaSignature)
+
+		// 两个恢复标识中恰有一个恢复出签名者的公钥
+		matches := 0
+		for v := byte(0); v <= 1; v++ {
+			pub, err := RecoverPublicKey(digest[:], sig.R, sig.S, v)
+			if err != nil {
+				continue
+			}
+			if pub.Address() == privKey.PublicKey().Address() {
+				matches++
+			}
+		}
+		assert.Equal(t, 1, matches)
+	}
+}
+
+func TestRecoverPublicKeyInvalid(t *testing.T) {
+	privKey := GeneratePrivateKey()
+	signature, err := privKey.Sign([]byte("hello world"))
+	assert.Nil(t, err)
+	sig := signature.(*ecdsaSignature)
+	digest := sha256.Sum256([]byte("hello world"))
+	n := privKey.(p256PrivateKey).key.Curve.Params().N
+
+	cases := []struct {
+		r, s *big.Int
+		v    byte
+	}{
+		{sig.R, sig.S, 2},
+		{big.NewInt(0), sig.S, 0},
+		{sig.R, big.NewInt(0), 0},
+		{n, sig.S, 0},
+		{sig.R, new(big.Int).Add(sig.S, n), 0},
+	}
+	for _, c := range cases {
+		_, err := RecoverPublicKey(digest[:], c.r, c.s, c.v)
+		assert.ErrorIs(t, err, ErrInvalidSignature)
+	}
+}
+
+// TestRecoverSigner 测试从 secp256k1 签名中恢复签名者公钥
+func TestRecoverSigner(t *testing.T) {
+	privKey, err := GenerateKey(KeyTypeSecp256k1)
+	assert.Nil(t, err)
+	msg := []byte("hello world")
+
+	for i := 0; i < 10; i++ {
+		sig, err := privKey.Sign(msg)
+		assert.Nil(t, err)
+		assert.True(t, IsRecoverable(sig))
+
+		// 经过序列化往返后仍能恢复出签名者公钥
+		restored, err := ToSignature(sig.ToSlice())
+		assert.Nil(t, err)
+		pub, err := RecoverSigner(msg, restored)
+		assert.Nil(t, err)
+		assert.Equal(t, privKey.PublicKey().ToSlice(), pub.ToSlice())
+
+		// 数据不同时恢复出其他公钥
+		pub, err = RecoverSigner([]byte("hello world!"), restored)
+		if err == nil {
+			assert.NotEqual(t, privKey.PublicKey().ToSlice(), pub.ToSlice())
+		}
+	}
+
+	// OpenSSL 测试向量（见 TestSecp256k1Vectors）规范化后的签名，恢复标识为 1
+	sigBytes, _ := hex.DecodeString("03" +
+		"87f3d2e3f7192e3f825a0a26ab4d1ab620e97b0702593fbaf7508a0a7575fb84" +
+		"18b76237ae31f1bbd689c6a50b7e47de4aaac4de1c58ddc5f8b17d5cb20865af" + "01")
+	sig, err := ToSignature(sigBytes)
+	assert.Nil(t, err)
+	pub, err := RecoverSigner([]byte("hello titanchain"), sig)
+	assert.Nil(t, err)
+	assert.Equal(t, "03"+"0232e79192cc1b283b958fd8063144b3d1b0ad39567fc881ce71a217adae07a96d", hex.EncodeToString(pub.ToSlice()))
+}
+
+// TestRecoverSignerInvalid 测试无法恢复公钥的签名
+func TestRecoverSignerInvalid(t *testing.T) {
+	msg := []byte("hello world")
+
+	// P-256 与 Ed25519 的签名不附带恢复标识
+	for _, kt := range []KeyType{KeyTypeP256, KeyTypeEd25519} {
+		privKey, err := GenerateKey(kt)
+		assert.Nil(t, err)
+		sig, err := privKey.Sign(msg)
+		assert.Nil(t, err)
+		assert.False(t, IsRecoverable(sig))
+		_, err = RecoverSigner(msg, sig)
+		assert.ErrorIs(t, err, ErrUnrecoverableSignature)
+	}
+
+	privKey, err := GenerateKey(KeyTypeSecp256k1)
+	assert.Nil(t, err)
+	sig, err := privKey.Sign(msg)
+	assert.Nil(t, err)
+
+	// 延展后的 high-S 签名与非法恢复标识
+	b := sig.ToSlice()
+	s := new(big.Int).SetBytes(b[33:65])
+	new(big.Int).Sub(secp256k1N, s).FillBytes(b[33:65])
+	b[65] ^= 1
+	forged, err := ToSignature(b)
+	assert.Nil(t, err)
+	_, err = RecoverSigner(msg, forged)
+	assert.ErrorIs(t, err, ErrNonCanonicalSignature)
+
+	b = sig.ToSlice()
+	b[65] = 2
+	_, err = ToSignature(b)
+	assert.ErrorIs(t, err, ErrInvalidSignatureEncoding)
+}
@@ -0,0 +1,42 @@
+package crypto
+
+import (
+	"errors"
+
+	xscrypt "golang.org/x/crypto/scrypt"
+)
+
+const (
+	// maxScryptMemory 是 scrypt 参数允许使用的最大内存（字节），防止恶意 keystore 文件耗尽内存
+	maxScryptMemory = 1 << 30
+	// maxScryptWork 是 N·r·p 允许的最大值，约为 StandardScryptParams 的两倍，防止恶意 keystore 文件耗尽 CPU
+	maxScryptWork = 1 << 22
+)
+
+// scrypt 按 RFC 7914 由口令派生密钥，由 golang.org/x/crypto/scrypt 实现
+// 参数：
+//   - password, salt: 口令与盐
+//   - n: CPU/内存开销，必须是大于 1 的 2 的幂
+//   - r: 分组大小；p: 并行度
+//   - keyLen: 派生密钥的字节数
+//
+// 返回：
+//   - 派生密钥，参数不合法或开销超过上限时返回错误
+//
+// 占用内存约为 128·r·n 字节，计算量与 N·r·p 成正比
+func scrypt(password, salt []byte, n, r, p, keyLen int) ([]byte, error) {
+	if n <= 1 || n&(n-1) != 0 {
+		return nil, errors.New("scrypt: N must be a power of 2 greater than 1")
+	}
+	if r <= 0 || p <= 0 || uint64(r)*uint64(p) >= 1<<30 {
+		return nil, errors.New("scrypt: invalid r or p")
+	}
+	if uint64(n)*uint64(r) > maxScryptMemory/128 || uint64(p)*uint64(r) > maxScryptMemory/128 {
+		return nil, errors.New("scrypt: parameters require too much memory")
+	}
+	if uint64(n)*uint64(r)*uint64(p) > maxScryptWork {
+		return nil, errors.New("scrypt: parameters require too much work")
+	}
+
+	return xscrypt.Key(password, salt, n, r, p, keyLen)
+}
@@ -0,0 +1,35 @@
+package crypto
+
+import (
+	"encoding/hex"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestScrypt 测试 RFC 7914 第 12 节的测试向量
+func TestScrypt(t *testing.T) {
+	cases := []struct {
+		password, salt string
+		n, r, p        int
+		want           string
+	}{
+		{"", "", 16, 1, 1, "77d6576238657b203b19ca42c18a0497f16b4844e3074ae8dfdffa3fede21442fcd0069ded0948f8326a753a0fc81f17e8d3e0fb2e0d3628cf35e20c38d18906"},
+		{"password", "NaCl", 1024, 8, 16, "fdbabe1c9d3472007856e7190d01e9fe7c6ad7cbc8237830e77376634b3731622eaf30d92e22a3886ff109279d9830dac727afb94a83ee6d8360cbdfa2cc0640"},
+		{"pleaseletmein", "SodiumChloride", 16384, 8, 1, "7023bdcb3afd7348461c06cd81fd38ebfda8fbba904f8e3ea9b543f6545da1f2d5432955613f0fcf62d49705242a9af9e61e85dc0d651e40dfcf017b45575887"},
+	}
+
+	for _, c := range cases {
+		key, err := scrypt([]byte(c.password), []byte(c.salt), c.n, c.r, c.p, 64)
+		assert.Nil(t, err)
+		assert.Equal(t, c.want, hex.EncodeToString(key))
+	}
+}
+
+// TestScryptInvalidParams 测试不合法、占用内存过大与计算量过大的参数
+func TestScryptInvalidParams(t *testing.T) {
+	for _, c := range [][3]int{{0, 8, 1}, {1, 8, 1}, {1000, 8, 1}, {16, 0, 1}, {16, 8, 0}, {1 << 30, 8, 1}, {1 << 18, 8, 4}, {1 << 10, 8, 1 << 10}} {
+		_, err := scrypt([]byte("x"), []byte("y"), c[0], c[1], c[2], 32)
+		assert.NotNil(t, err, c)
+	}
+}
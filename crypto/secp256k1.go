@@ -0,0 +1,136 @@
+package crypto
+
+import (
+	"crypto/sha256"
+	"errors"
+	"math/big"
+
+	"github.com/decred/dcrd/dcrec/secp256k1/v4"
+	"github.com/decred/dcrd/dcrec/secp256k1/v4/ecdsa"
+	"github.com/felixkuang/titanchain/types"
+)
+
+const (
+	// Secp256k1PublicKeyLength 是 secp256k1 压缩公钥的字节数，不含类型标识
+	Secp256k1PublicKeyLength = 33
+	// secp256k1PrivateKeyLength 是 secp256k1 私钥标量的字节数
+	secp256k1PrivateKeyLength = 32
+	// secp256k1CompactRecoveryCode 是 secp256k1 库紧凑签名首字节的偏移：27 + 4（压缩公钥）
+	secp256k1CompactRecoveryCode = 27 + 4
+)
+
+// secp256k1N 是 secp256k1 曲线的阶
+var secp256k1N = secp256k1.S256().Params().N
+
+// secp256k1PrivateKey 是 secp256k1 曲线上的 ECDSA 私钥
+// 曲线运算由 github.com/decred/dcrd/dcrec/secp256k1 以常数时间实现
+type secp256k1PrivateKey struct {
+	key *secp256k1.PrivateKey
+}
+
+// generateSecp256k1Key 使用安全的随机数生成器生成私钥
+func generateSecp256k1Key() (PrivateKey, error) {
+	key, err := secp256k1.GeneratePrivateKey()
+	if err != nil {
+		return nil, err
+	}
+
+	return secp256k1PrivateKey{key: key}, nil
+}
+
+// toSecp256k1PrivateKey 从 32 字节的私钥标量还原私钥，标量须满足 1 ≤ d < n
+func toSecp256k1PrivateKey(b []byte) (PrivateKey, error) {
+	if len(b) != secp256k1PrivateKeyLength {
+		return nil, ErrInvalidPrivateKey
+	}
+
+	var d secp256k1.ModNScalar
+	if overflow := d.SetByteSlice(b); overflow || d.IsZero() {
+		return nil, ErrInvalidPrivateKey
+	}
+
+	return secp256k1PrivateKey{key: secp256k1.NewPrivateKey(&d)}, nil
+}
+
+func (k secp256k1PrivateKey) Type() KeyType {
+	return KeyTypeSecp256k1
+}
+
+// Sign 对数据的 SHA256 摘要进行 ECDSA 签名，随机数按 RFC 6979 由私钥与摘要确定性地生成，
+// 结果为 low-S 形式；签名附带恢复标识，可以由 RecoverSigner 恢复出公钥
+func (k secp256k1PrivateKey) Sign(data []byte) (Signature, error) {
+	digest := sha256.Sum256(data)
+	compact := ecdsa.SignCompact(k.key, digest[:], true)
+
+	// 恢复标识的第 0 位是签名点 y 坐标的奇偶性，第 1 位表示签名点的 x 坐标不小于 n；
+	// 后者的概率可以忽略，出现时无法用 0 或 1 表示，直接返回错误
+	code := compact[0] - secp256k1CompactRecoveryCode
+	if code > 1 {
+		return nil, errors.New("secp256k1: signature point x coordinate overflows curve order")
+	}
+	r := new(big.Int).SetBytes(compact[1:33])
+	s := new(big.Int).SetBytes(compact[33:65])
+
+	return newECDSASignature(KeyTypeSecp256k1, r, s, code), nil
+}
+
+func (k secp256k1PrivateKey) PublicKey() PublicKey {
+	return secp256k1PublicKey{key: k.key.PubKey()}
+}
+
+// ToSlice 返回类型标识与 32 字节的私钥标量
+func (k secp256k1PrivateKey) ToSlice() []byte {
+	return withKeyType(KeyTypeSecp256k1, k.key.Serialize())
+}
+
+// secp256k1PublicKey 是 secp256k1 曲线上的 ECDSA 公钥
+type secp256k1PublicKey struct {
+	key *secp256k1.PublicKey
+}
+
+// toSecp256k1PublicKey 从压缩字节切片还原公钥
+func toSecp256k1PublicKey(b []byte) (PublicKey, error) {
+	if len(b) != Secp256k1PublicKeyLength {
+		return nil, ErrInvalidPublicKey
+	}
+
+	key, err := secp256k1.ParsePubKey(b)
+	if err != nil {
+		return nil, ErrInvalidPublicKey
+	}
+
+	return secp256k1PublicKey{key: key}, nil
+}
+
+func (k secp256k1PublicKey) Type() KeyType {
+	return KeyTypeSecp256k1
+}
+
+// ToSlice 返回类型标识与压缩格式的公钥：0x02/0x03（y 的奇偶性）|| x(32)
+func (k secp256k1PublicKey) ToSlice() []byte {
+	return withKeyType(KeyTypeSecp256k1, k.key.SerializeCompressed())
+}
+
+// Verify 与 Sign 一致，先对原始数据进行 SHA256 哈希再验证，非规范签名视为无效
+func (k secp256k1PublicKey) Verify(data []byte, sig Signature) bool {
+	s, ok := sig.(*ecdsaSignature)
+	if !ok || s.keyType != KeyTypeSecp256k1 || s.Validate() != nil {
+		return false
+	}
+
+	// Validate 已保证 1 ≤ R < n、1 ≤ S ≤ n/2
+	var r, sv secp256k1.ModNScalar
+	r.SetByteSlice(s.R.Bytes())
+	sv.SetByteSlice(s.S.Bytes())
+	digest := sha256.Sum256(data)
+
+	return ecdsa.NewSignature(&r, &sv).Verify(digest[:], k.key)
+}
+
+func (k secp256k1PublicKey) Address() types.Address {
+	return k.AddressWith(HashSHA256)
+}
+
+func (k secp256k1PublicKey) AddressWith(algo HashAlgorithm) types.Address {
+	return publicKeyAddress(k, algo)
+}
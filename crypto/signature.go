@@ -0,0 +1,194 @@
+package crypto
+
+import (
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"errors"
+	"fmt"
+	"math/big"
+)
+
+var (
+	ErrInvalidSignatureEncoding = errors.New("invalid signature encoding")
+	ErrNonCanonicalSignature    = errors.New("non-canonical signature")
+)
+
+const (
+	// ecdsaSignatureLength 是 ECDSA 签名去掉类型标识后的字节数：R 与 S 各 32 字节
+	ecdsaSignatureLength = 64
+	// recoverableSignatureLength 是附带恢复标识的 ECDSA 签名的字节数：R(32) || S(32) || V(1)
+	recoverableSignatureLength = 65
+)
+
+// ed25519Order 是 Ed25519 基点的阶 L = 2^252 + 27742317777372353535851937790883648493
+var ed25519Order, _ = new(big.Int).SetString("1000000000000000000000000000000014def9dea2f79cd65812631a5cf5d3ed", 16)
+
+// ecdsaCurveOrder 返回 ECDSA 密钥类型对应曲线的阶
+func ecdsaCurveOrder(t KeyType) *big.Int {
+	if t == KeyTypeSecp256k1 {
+		return secp256k1N
+	}
+
+	return elliptic.P256().Params().N
+}
+
+// ecdsaSignature 表示 P-256 或 secp256k1 的 ECDSA 签名
+// 对任意有效签名 (R, S)，(R, n-S) 同样有效；规范形式要求 S ≤ n/2（low-S），
+// 使同一笔交易只有一种合法的签名编码
+// secp256k1 签名总是附带恢复标识，P-256 签名总是不带
+type ecdsaSignature struct {
+	keyType KeyType  // 签名所属的曲线
+	R, S    *big.Int // 签名的两个组成部分
+	V       byte     // 恢复标识（仅 secp256k1）：签名点 R 的 y 坐标为偶数时为 0，奇数时为 1
+}
+
+// newECDSASignature 创建规范形式的签名：S 大于 n/2 时替换为 n-S，
+// 对应的签名点取反，恢复标识随之翻转
+func newECDSASignature(t KeyType, r, s *big.Int, v byte) *ecdsaSignature {
+	n := ecdsaCurveOrder(t)
+	if s.Cmp(new(big.Int).Rsh(n, 1)) > 0 {
+		s = new(big.Int).Sub(n, s)
+		v ^= 1
+	}
+
+	return &ecdsaSignature{keyType: t, R: r, S: s, V: v}
+}
+
+// recoverable 返回签名是否附带恢复标识
+func (sig *ecdsaSignature) recoverable() bool {
+	return sig.keyType == KeyTypeSecp256k1
+}
+
+func (sig *ecdsaSignature) Type() KeyType {
+	return sig.keyType
+}
+
+// ToSlice 返回类型标识 || R(32) || S(32)，secp256k1 签名再追加 V(1)
+func (sig *ecdsaSignature) ToSlice() []byte {
+	size := ecdsaSignatureLength
+	if sig.recoverable() {
+		size = recoverableSignatureLength
+	}
+
+	b := make([]byte, 1+size)
+	b[0] = byte(sig.keyType)
+	if sig.R != nil && sig.R.Sign() >= 0 && sig.R.BitLen() <= 256 {
+		sig.R.FillBytes(b[1:33])
+	}
+	if sig.S != nil && sig.S.Sign() >= 0 && sig.S.BitLen() <= 256 {
+		sig.S.FillBytes(b[33:65])
+	}
+	if sig.recoverable() {
+		b[65] = sig.V
+	}
+
+	return b
+}
+
+// Validate 检查签名是否为规范形式：1 ≤ R < n，1 ≤ S ≤ n/2，恢复标识为 0 或 1
+func (sig *ecdsaSignature) Validate() error {
+	n := ecdsaCurveOrder(sig.keyType)
+	if sig.R == nil || sig.S == nil || sig.R.Sign() <= 0 || sig.S.Sign() <= 0 || sig.R.Cmp(n) >= 0 {
+		return fmt.Errorf("%w: %s signature component out of range", ErrNonCanonicalSignature, sig.keyType)
+	}
+	if sig.S.Cmp(new(big.Int).Rsh(n, 1)) > 0 {
+		return fmt.Errorf("%w: %s signature has high S", ErrNonCanonicalSignature, sig.keyType)
+	}
+	if sig.recoverable() && sig.V > 1 {
+		return fmt.Errorf("%w: %s signature has recovery id (%d)", ErrNonCanonicalSignature, sig.keyType, sig.V)
+	}
+
+	return nil
+}
+
+// Verify 验证签名是否有效
+// 与 Sign 一致，先对原始数据进行 SHA256 哈希再验证
+// 参数：
+//   - pubKey: 用于验证的公钥
+//   - data: 原始数据
+//
+// 返回：
+//   - 签名是否有效
+func (sig *ecdsaSignature) Verify(pubKey PublicKey, data []byte) bool {
+	return pubKey.Verify(data, sig)
+}
+
+// ed25519Signature 表示 64 字节的 Ed25519 签名
+type ed25519Signature []byte
+
+func (sig ed25519Signature) Type() KeyType {
+	return KeyTypeEd25519
+}
+
+func (sig ed25519Signature) ToSlice() []byte {
+	return withKeyType(KeyTypeEd25519, sig)
+}
+
+func (sig ed25519Signature) Verify(pubKey PublicKey, data []byte) bool {
+	return pubKey.Verify(data, sig)
+}
+
+// Validate 检查签名长度以及签名中的标量 S 是否小于 L（RFC 8032 要求拒绝 S ≥ L 的签名）
+func (sig ed25519Signature) Validate() error {
+	if len(sig) != ed25519.SignatureSize {
+		return fmt.Errorf("%w: ed25519 signature has %d bytes", ErrInvalidSignatureEncoding, len(sig))
+	}
+
+	// S 以小端序存放在签名的后 32 字节
+	le := sig[32:]
+	be := make([]byte, len(le))
+	for i := range le {
+		be[len(le)-1-i] = le[i]
+	}
+	if new(big.Int).SetBytes(be).Cmp(ed25519Order) >= 0 {
+		return fmt.Errorf("%w: ed25519 signature scalar is not reduced", ErrNonCanonicalSignature)
+	}
+
+	return nil
+}
+
+// ToSignature 从自描述的字节切片还原签名
+// 每种密钥类型只接受一种编码：P-256 为 R(32) || S(32)，secp256k1 为 R(32) || S(32) || V(1) 且 V 为 0 或 1，
+// Ed25519 为 64 字节，使同一个签名不能以其他编码出现在交易中
+// 只检查编码，不检查签名是否为规范形式，需要时调用 Signature.Validate
+// 参数：
+//   - b: Signature.ToSlice 的结果
+//
+// 返回：
+//   - 还原后的签名和错误信息
+func ToSignature(b []byte) (Signature, error) {
+	if len(b) == 0 {
+		return nil, ErrInvalidSignatureEncoding
+	}
+
+	t := KeyType(b[0])
+	switch t {
+	case KeyTypeP256, KeyTypeSecp256k1:
+		size := ecdsaSignatureLength
+		if t == KeyTypeSecp256k1 {
+			size = recoverableSignatureLength
+		}
+		if len(b) != 1+size {
+			return nil, fmt.Errorf("%w: %s signature has %d bytes", ErrInvalidSignatureEncoding, t, len(b)-1)
+		}
+		sig := &ecdsaSignature{
+			keyType: t,
+			R:       new(big.Int).SetBytes(b[1:33]),
+			S:       new(big.Int).SetBytes(b[33:65]),
+		}
+		if t == KeyTypeSecp256k1 {
+			if b[65] > 1 {
+				return nil, fmt.Errorf("%w: %s signature has recovery id (%d)", ErrInvalidSignatureEncoding, t, b[65])
+			}
+			sig.V = b[65]
+		}
+		return sig, nil
+	case KeyTypeEd25519:
+		if len(b) != 1+ed25519.SignatureSize {
+			return nil, fmt.Errorf("%w: %s signature has %d bytes", ErrInvalidSignatureEncoding, t, len(b)-1)
+		}
+		return ed25519Signature(append([]byte{}, b[1:]...)), nil
+	default:
+		return nil, fmt.Errorf("%w (%d)", ErrUnknownKeyType, b[0])
+	}
+}
@@ -0,0 +1,118 @@
+package crypto
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// malleate 返回 ECDSA 签名的延展变体 (R, n-S)，它在数学上同样满足验证方程
+func malleate(sig Signature) []byte {
+	s := sig.(*ecdsaSignature)
+	b := sig.ToSlice()
+	new(big.Int).Sub(ecdsaCurveOrder(s.keyType), s.S).FillBytes(b[33:65])
+
+	return b
+}
+
+// TestSignatureLowS 测试签名结果总是 low-S 的规范形式，且编码为固定长度
+// secp256k1 签名附带恢复标识，为 65 字节
+func TestSignatureLowS(t *testing.T) {
+	for _, kt := range []KeyType{KeyTypeP256, KeyTypeSecp256k1} {
+		privKey, err := GenerateKey(kt)
+		assert.Nil(t, err)
+		half := new(big.Int).Rsh(ecdsaCurveOrder(kt), 1)
+		size := ecdsaSignatureLength
+		if kt == KeyTypeSecp256k1 {
+			size = recoverableSignatureLength
+		}
+
+		// 随机数使一半左右的原始签名为 high-S，多签几次覆盖两种情况
+		for i := 0; i < 16; i++ {
+			sig, err := privKey.Sign([]byte{byte(i)})
+			assert.Nil(t, err)
+			assert.Nil(t, sig.Validate())
+			assert.True(t, sig.(*ecdsaSignature).S.Cmp(half) <= 0, kt)
+			assert.Len(t, sig.ToSlice(), 1+size)
+		}
+	}
+}
+
+// TestSignatureMalleated 测试延展后的 high-S 签名被拒绝
+func TestSignatureMalleated(t *testing.T) {
+	msg := []byte("hello world")
+
+	for _, kt := range []KeyType{KeyTypeP256, KeyTypeSecp256k1} {
+		privKey, err := GenerateKey(kt)
+		assert.Nil(t, err)
+		sig, err := privKey.Sign(msg)
+		assert.Nil(t, err)
+
+		forged, err := ToSignature(malleate(sig))
+		assert.Nil(t, err, "延展签名的编码本身合法")
+		assert.ErrorIs(t, forged.Validate(), ErrNonCanonicalSignature, kt)
+		assert.False(t, forged.Verify(privKey.PublicKey(), msg), kt)
+		assert.True(t, sig.Verify(privKey.PublicKey(), msg), kt)
+	}
+
+	// Ed25519：S 加上基点的阶 L 后验证方程不变，但 S 不再是约简后的标量
+	privKey, err := GenerateKey(KeyTypeEd25519)
+	assert.Nil(t, err)
+	sig, err := privKey.Sign(msg)
+	assert.Nil(t, err)
+	assert.Nil(t, sig.Validate())
+
+	b := sig.ToSlice()
+	carry := 0
+	order := ed25519Order.FillBytes(make([]byte, 32))
+	for i := 0; i < 32; i++ {
+		sum := int(b[33+i]) + int(order[31-i]) + carry
+		b[33+i] = byte(sum)
+		carry = sum >> 8
+	}
+	forged, err := ToSignature(b)
+	assert.Nil(t, err)
+	assert.ErrorIs(t, forged.Validate(), ErrNonCanonicalSignature)
+	assert.False(t, forged.Verify(privKey.PublicKey(), msg))
+}
+
+// TestSignatureOutOfRange 测试 R、S 为 0 或不小于曲线阶以及恢复标识非法的签名
+func TestSignatureOutOfRange(t *testing.T) {
+	for _, kt := range []KeyType{KeyTypeP256, KeyTypeSecp256k1} {
+		privKey, err := GenerateKey(kt)
+		assert.Nil(t, err)
+		sig, err := privKey.Sign([]byte("x"))
+		assert.Nil(t, err)
+		n := ecdsaCurveOrder(kt)
+
+		zeroR := sig.ToSlice()
+		copy(zeroR[1:33], make([]byte, 32))
+		bigR := sig.ToSlice()
+		n.FillBytes(bigR[1:33])
+		zeroS := sig.ToSlice()
+		copy(zeroS[33:65], make([]byte, 32))
+
+		for _, b := range [][]byte{zeroR, bigR, zeroS} {
+			forged, err := ToSignature(b)
+			assert.Nil(t, err)
+			assert.ErrorIs(t, forged.Validate(), ErrNonCanonicalSignature, kt)
+			assert.False(t, forged.Verify(privKey.PublicKey(), []byte("x")), kt)
+		}
+
+		// 每种曲线只有一种编码：P-256 不能附带恢复标识，secp256k1 必须附带且只能为 0 或 1
+		rs := sig.ToSlice()[: 1+ecdsaSignatureLength : 1+ecdsaSignatureLength]
+		if kt == KeyTypeP256 {
+			_, err = ToSignature(append(rs, 0))
+			assert.ErrorIs(t, err, ErrInvalidSignatureEncoding)
+		} else {
+			_, err = ToSignature(rs)
+			assert.ErrorIs(t, err, ErrInvalidSignatureEncoding)
+			_, err = ToSignature(append(rs, 2))
+			assert.ErrorIs(t, err, ErrInvalidSignatureEncoding)
+		}
+
+		_, err = ToSignature(append(rs, 0, 0))
+		assert.ErrorIs(t, err, ErrInvalidSignatureEncoding)
+	}
+}
@@ -4,11 +4,14 @@ package main
 import (
 	"bytes"
 	"encoding/gob"
+	"flag"
 	"fmt"
+	"github.com/felixkuang/titanchain/asm"
 	"github.com/felixkuang/titanchain/core"
 	"github.com/felixkuang/titanchain/crypto"
 	"github.com/felixkuang/titanchain/network"
 	"log"
+	"os"
 	"time"
 )
 
@@ -18,7 +21,46 @@ var transports = []network.Transport{
 	//network.NewLocalTransport(network.LocalTransportOpts{Addr: "REMOTE_C"}),
 }
 
+// genesis 是所有示例节点共享的创世配置
+var genesis = core.DefaultGenesis()
+
+// apiListenAddr 是本地节点 JSON-RPC 服务的监听地址
+var apiListenAddr string
+
+// validatorKey 是本地验证者的私钥，启动时由 -keystore 指定的 keystore 文件解密得到
+// 口令只在解密时使用，不保存在全局变量中；未指定 keystore 时为验证者生成一个临时私钥
+var validatorKey crypto.PrivateKey
+
 func main() {
+	if ok, err := runCommand(os.Args[1:]); ok {
+		if err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	genesisPath := flag.String("genesis", "", "path to a JSON or YAML genesis file")
+	flag.StringVar(&apiListenAddr, "api", "", "listen address of the JSON-RPC server, e.g. :8545")
+	keystorePath := flag.String("keystore", "", "path to the keystore file of the validator key (see the keygen command)")
+	passwordFile := flag.String("password-file", "", "path to a file containing the keystore password")
+	flag.Parse()
+
+	if *keystorePath != "" {
+		privKey, err := loadValidatorKey(*keystorePath, *passwordFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+		validatorKey = privKey
+	}
+
+	if *genesisPath != "" {
+		g, err := core.LoadGenesis(*genesisPath)
+		if err != nil {
+			log.Fatal(err)
+		}
+		genesis = g
+	}
+
 	initRemoteServers(transports)
 	localNode := transports[0]
 	trLate := network.NewLocalTransport(network.LocalTransportOpts{Addr: "LATE_NODE"})
@@ -36,29 +78,36 @@ func main() {
 
 	go func() {
 		time.Sleep(7 * time.Second)
-		lateServer := makeServer(string(trLate.Addr()), trLate, nil)
+		lateServer := makeServer(string(trLate.Addr()), trLate, false)
 		go lateServer.Start()
 	}()
 
-	privKey := crypto.GeneratePrivateKey()
-	localServer := makeServer("LOCAL", localNode, &privKey)
+	localServer := makeServer("LOCAL", localNode, true)
 	localServer.Start()
 }
 
 func initRemoteServers(trs []network.Transport) {
 	for i := 0; i < len(trs); i++ {
 		id := fmt.Sprintf("REMOTE_%d", i)
-		s := makeServer(id, trs[i], nil)
+		s := makeServer(id, trs[i], false)
 		go s.Start()
 	}
 }
 
-func makeServer(id string, tr network.Transport, pk *crypto.PrivateKey) *network.Server {
+func makeServer(id string, tr network.Transport, validator bool) *network.Server {
 	opts := network.ServerOpts{
 		Transport:  tr,
-		PrivateKey: pk,
 		ID:         id,
 		Transports: transports,
+		Genesis:    genesis,
+	}
+	// 只有本地验证者节点对外提供 JSON-RPC 服务
+	if validator {
+		opts.APIListenAddr = apiListenAddr
+		opts.PrivateKey = validatorKey
+		if opts.PrivateKey == nil {
+			opts.PrivateKey = crypto.GeneratePrivateKey()
+		}
 	}
 
 	s, err := network.NewServer(opts)
@@ -69,6 +118,26 @@ func makeServer(id string, tr network.Transport, pk *crypto.PrivateKey) *network
 	return s
 }
 
+// loadValidatorKey 读取口令文件并解密 keystore 文件中的验证者私钥
+// 未指定口令文件时使用空口令
+func loadValidatorKey(keystorePath, passwordFile string) (crypto.PrivateKey, error) {
+	var password string
+	if passwordFile != "" {
+		p, err := readPassword(passwordFile)
+		if err != nil {
+			return nil, err
+		}
+		password = p
+	}
+
+	privKey, err := crypto.LoadKey(keystorePath, password)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load validator key from keystore (%s): %w", keystorePath, err)
+	}
+
+	return privKey, nil
+}
+
 func sendGetStatusMessage(tr network.Transport, to network.NetAddr) error {
 	var (
 		getStatusMsg = new(network.GetStatusMessage)
@@ -83,15 +152,29 @@ func sendGetStatusMessage(tr network.Transport, to network.NetAddr) error {
 	return tr.SendMessage(to, msg.Bytes())
 }
 
+// storeProgram 是示例交易执行的程序：将 5 写入键 "FOO"
+const storeProgram = `
+    PUSHBYTE 'F'
+    PUSHBYTE 'O'
+    PUSHBYTE 'O'
+    PUSHINT 3
+    PACK
+    PUSH 5
+    STORE
+`
+
 // sendTransaction 构造并发送一笔交易到指定节点
 // tr: 发送方传输层
 // to: 目标节点地址
 // 返回发送过程中的错误
 func sendTransaction(tr network.Transport, to network.NetAddr) error {
 	privKey := crypto.GeneratePrivateKey()
-	//data := []byte{0x02, 0x0a, 0x02, 0x0a, 0x0b}
-	data := []byte{0x03, 0x0a, 0x46, 0x0c, 0x4f, 0x0c, 0x4f, 0x0c, 0x0d, 0x05, 0x0a, 0x0f}
+	data, err := asm.Assemble(storeProgram)
+	if err != nil {
+		return err
+	}
 	tx := core.NewTransaction(data)
+	tx.ChainID = genesis.Config.ChainID
 	tx.Sign(privKey)
 	buf := &bytes.Buffer{}
 	if err := tx.Encode(core.NewGobTxEncoder(buf)); err != nil {
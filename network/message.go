@@ -1,5 +1,7 @@
 package network
 
+import "github.com/felixkuang/titanchain/types"
+
 type GetBlocksMessage struct {
 	From uint32
 	// If To is 0 the maximum blocks will be returned.
@@ -21,6 +23,8 @@ type GetStatusMessage struct{}
 //	ID: 节点唯一标识
 //	Version: 节点软件版本号
 //	CurrentHeight: 当前区块高度
+//	ChainID: 节点所在链的链ID
+//	GenesisHash: 节点创世区块哈希
 type StatusMessage struct {
 	// 节点唯一标识
 	ID string
@@ -28,4 +32,8 @@ type StatusMessage struct {
 	Version uint32
 	// 当前区块高度
 	CurrentHeight uint32
+	// 链ID，不同链的节点不会互相同步
+	ChainID uint64
+	// 创世区块哈希，用于确认双方共享同一创世配置
+	GenesisHash types.Hash
 }
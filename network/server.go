@@ -6,12 +6,12 @@ import (
 	"encoding/gob"
 	"fmt"
 	"os"
+	"sync"
 	"time"
 
-	"github.com/felixkuang/titanchain/types"
-
 	"github.com/go-kit/log"
 
+	"github.com/felixkuang/titanchain/api"
 	"github.com/felixkuang/titanchain/core"
 
 	"github.com/felixkuang/titanchain/crypto"
@@ -24,14 +24,18 @@ var defaultBlockTime = 5 * time.Second
 // ServerOpts 定义了服务器的配置选项
 // 包括传输层、出块时间、私钥、RPC解码与处理器等
 type ServerOpts struct {
-	ID            string
-	Transport     Transport
-	Logger        log.Logger
-	RPCDecodeFunc RPCDecodeFunc      // RPC消息解码函数
-	RPCProcessor  RPCProcessor       // RPC消息处理器
-	Transports    []Transport        // 传输层实例列表
-	BlockTime     time.Duration      // 出块间隔
-	PrivateKey    *crypto.PrivateKey // 节点私钥（为空则非验证者）
+	ID               string
+	Transport        Transport
+	Logger           log.Logger
+	RPCDecodeFunc    RPCDecodeFunc     // RPC消息解码函数
+	RPCProcessor     RPCProcessor      // RPC消息处理器
+	Transports       []Transport       // 传输层实例列表
+	BlockTime        time.Duration     // 出块间隔
+	PrivateKey       crypto.PrivateKey // 节点私钥，支持任意密钥类型（为空则非验证者）
+	Genesis          *core.Genesis     // 创世配置（为空则使用默认配置）
+	APIListenAddr    string            // JSON-RPC 服务监听地址（为空则不启动）
+	KeystorePath     string            // 验证者私钥的 keystore 文件路径（PrivateKey 为空时从中加载私钥）
+	KeystorePassword string            // 解密 keystore 文件的口令，只在 NewServer 中使用，不保存在 Server 中（调用方持有的字符串无法被清零）
 }
 
 // Server 实现了区块链网络服务器
@@ -44,11 +48,18 @@ type Server struct {
 	isValidator bool          // 是否为验证者节点
 	rpcCh       chan RPC      // RPC消息通道，用于接收网络消息
 	quitCh      chan struct{} // 退出信号通道，用于优雅关闭服务器
+	stopOnce    sync.Once     // 保证退出信号通道只关闭一次
 }
 
 // NewServer 创建一个新的服务器实例
 // opts: 服务器配置选项
 func NewServer(opts ServerOpts) (*Server, error) {
+	if opts.Genesis == nil {
+		opts.Genesis = core.DefaultGenesis()
+	}
+	if opts.BlockTime == time.Duration(0) {
+		opts.BlockTime = time.Duration(opts.Genesis.Config.Consensus.BlockTime) * time.Millisecond
+	}
 	if opts.BlockTime == time.Duration(0) {
 		opts.BlockTime = defaultBlockTime
 	}
@@ -59,15 +70,23 @@ func NewServer(opts ServerOpts) (*Server, error) {
 		opts.Logger = log.NewLogfmtLogger(os.Stderr)
 		opts.Logger = log.With(opts.Logger, "addr", opts.Transport.Addr())
 	}
+	if opts.PrivateKey == nil && opts.KeystorePath != "" {
+		privKey, err := crypto.LoadKey(opts.KeystorePath, opts.KeystorePassword)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load validator key from keystore (%s): %w", opts.KeystorePath, err)
+		}
+		opts.PrivateKey = privKey
+	}
+	opts.KeystorePassword = ""
 
-	chain, err := core.NewBlockchain(opts.Logger, genesisBlock())
+	chain, err := core.NewBlockchainFromGenesis(opts.Logger, opts.Genesis)
 	if err != nil {
 		return nil, err
 	}
 	s := &Server{
 		ServerOpts:  opts,
 		chain:       chain,
-		mempool:     NewTxPool(1000),
+		mempool:     NewTxPool(1000, chain.Config().TxHasher()),
 		isValidator: opts.PrivateKey != nil,
 		rpcCh:       make(chan RPC),         // 创建RPC消息通道
 		quitCh:      make(chan struct{}, 1), // 创建带缓冲的退出信号通道
@@ -82,6 +101,16 @@ func NewServer(opts ServerOpts) (*Server, error) {
 		go s.validatorLoop()
 	}
 
+	go s.evictionLoop()
+
+	if s.APIListenAddr != "" {
+		go func() {
+			if err := api.NewServer(s.Logger, s.chain).Start(s.APIListenAddr); err != nil {
+				s.Logger.Log("error", "JSON-RPC server stopped", "err", err)
+			}
+		}()
+	}
+
 	s.boostrapNodes()
 
 	return s, nil
@@ -114,6 +143,14 @@ free:
 	s.Logger.Log("msg", "Server is shutting down")
 }
 
+// Stop 关闭服务器：Start 返回，出块与过期交易清理的后台循环退出
+// 可重复调用
+func (s *Server) Stop() {
+	s.stopOnce.Do(func() {
+		close(s.quitCh)
+	})
+}
+
 func (s *Server) boostrapNodes() {
 	for _, tr := range s.Transports {
 		if s.Transport.Addr() != tr.Addr() {
@@ -130,16 +167,39 @@ func (s *Server) boostrapNodes() {
 	}
 }
 
+// validatorLoop 按出块周期创建新区块，收到退出信号后返回
 func (s *Server) validatorLoop() {
 	ticker := time.NewTicker(s.BlockTime)
+	defer ticker.Stop()
 
 	s.Logger.Log("msg", "Starting validator loop", "blockTime", s.BlockTime)
 
 	for {
-		<-ticker.C
-		err := s.createNewBlock()
-		if err != nil {
-			s.Logger.Log("error", err).Error()
+		select {
+		case <-ticker.C:
+			if err := s.createNewBlock(); err != nil {
+				s.Logger.Log("error", err)
+			}
+		case <-s.quitCh:
+			return
+		}
+	}
+}
+
+// evictionLoop 定期移除交易池中已经过期的交易
+// 每个出块周期检查一次，以下一个待打包区块的高度为准；收到退出信号后返回
+func (s *Server) evictionLoop() {
+	ticker := time.NewTicker(s.BlockTime)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if n := s.mempool.EvictExpired(s.chain.Height() + 1); n > 0 {
+				s.Logger.Log("msg", "evicted expired transactions", "count", n)
+			}
+		case <-s.quitCh:
+			return
 		}
 	}
 }
@@ -165,7 +225,6 @@ func (s *Server) ProcessMessage(msg *DecodedMessage) error {
 }
 
 func (s *Server) processGetBlocksMessage(from NetAddr, data *GetBlocksMessage) error {
-	panic("here")
 	fmt.Printf("got get blocks message => %+v\n", data)
 
 	return nil
@@ -206,7 +265,16 @@ func (s *Server) broadcast(payload []byte) error {
 // from: 发送方网络地址
 // data: 状态消息内容
 // 主要用于节点间同步当前区块高度和节点ID
+// 对方的链ID或创世区块哈希与本节点不一致时拒绝同步
 func (s *Server) processStatusMessage(from NetAddr, data *StatusMessage) error {
+	if data.ChainID != s.chain.ChainID() {
+		return fmt.Errorf("peer %s is on chain (%d) => our chain (%d)", from, data.ChainID, s.chain.ChainID())
+	}
+
+	if data.GenesisHash != s.chain.GenesisHash() {
+		return fmt.Errorf("peer %s has genesis (%s) => our genesis (%s)", from, data.GenesisHash, s.chain.GenesisHash())
+	}
+
 	if data.CurrentHeight <= s.chain.Height() {
 		s.Logger.Log("msg", "cannot sync blockHeight to low", "ourHeight", s.chain.Height(), "theirHeight", data.CurrentHeight, "addr", from)
 		return nil
@@ -238,6 +306,8 @@ func (s *Server) processGetStatusMessage(from NetAddr, data *GetStatusMessage) e
 	statusMessage := &StatusMessage{
 		CurrentHeight: s.chain.Height(),
 		ID:            s.ID,
+		ChainID:       s.chain.ChainID(),
+		GenesisHash:   s.chain.GenesisHash(),
 	}
 
 	buf := new(bytes.Buffer)
@@ -286,20 +356,36 @@ func (s *Server) broadcastBlock(b *core.Block) error {
 // processTransaction 处理收到的交易，验证签名并加入交易池
 // tx: 交易指针
 // 1. 检查是否已存在
-// 2. 设置首次见到时间戳
+// 2. 检查链ID、交易格式、有效期，验证签名，并在当前状态上检查发起者的序号与余额
 // 3. 日志记录并异步广播
 // 4. 加入交易池
 func (s *Server) processTransaction(tx *core.Transaction) error {
-	hash := tx.Hash(core.TxHasher{})
+	hash := tx.Hash(s.chain.Config().TxHasher())
 
 	if s.mempool.Contains(hash) {
 		return nil
 	}
 
+	if tx.ChainID != s.chain.ChainID() {
+		return fmt.Errorf("transaction (%s) has chain id (%d) => our chain (%d)", hash, tx.ChainID, s.chain.ChainID())
+	}
+
+	if err := core.ValidateTransaction(tx, s.chain.Config()); err != nil {
+		return err
+	}
+
+	if err := tx.CheckValidityWindow(s.chain.Height()+1, s.chain.Config().TxHasher()); err != nil {
+		return err
+	}
+
 	if err := tx.Verify(); err != nil {
 		return err
 	}
 
+	if err := s.chain.CheckTransaction(tx); err != nil {
+		return err
+	}
+
 	//s.Logger.Log(
 	//	"msg", "adding new tx to mempool",
 	//	"hash", hash,
@@ -344,7 +430,7 @@ func (s *Server) initTransports() {
 	}
 }
 
-// createNewBlock 创建新区块（简化实现，实际应包含打包交易、签名等）
+// createNewBlock 创建新区块：从交易池选出交易逐笔试执行，跳过不合法的交易，签名后入链并广播
 func (s *Server) createNewBlock() error {
 	currentHeader, err := s.chain.GetHeader(s.chain.Height())
 	if err != nil {
@@ -355,14 +441,28 @@ func (s *Server) createNewBlock() error {
 	// Later on when we know the internal structure of our transaction
 	// we will implement some kind of complexity function to determine how
 	// many transactions can be included in a block.
-	txx := s.mempool.Pending()
+	// Transactions outside of their validity window for the new height are
+	// left out so they can not invalidate the block.
+	height := currentHeader.Height + 1
+	hasher := s.chain.Config().TxHasher()
+	txx := []*core.Transaction{}
+	for _, tx := range s.mempool.Pending() {
+		if tx.CheckValidityWindow(height, hasher) == nil {
+			txx = append(txx, tx)
+		}
+	}
 
-	block, err := core.NewBlockFromPrevHeader(currentHeader, txx)
+	// 不合法的交易（序号不符、余额不足等）被跳过，并从交易池中移除，
+	// 避免它们每次出块都被重新选中
+	block, rejected, err := s.chain.BuildBlock(currentHeader, txx)
 	if err != nil {
 		return err
 	}
+	for _, tx := range rejected {
+		s.mempool.Remove(tx.Hash(s.chain.Config().TxHasher()))
+	}
 
-	if err := block.Sign(*s.PrivateKey); err != nil {
+	if err := block.Sign(s.PrivateKey); err != nil {
 		return err
 	}
 
@@ -383,17 +483,3 @@ func (s *Server) createNewBlock() error {
 
 	return nil
 }
-
-// genesisBlock 生成创世区块
-// 返回一个初始化的区块指针，包含默认头部信息
-func genesisBlock() *core.Block {
-	header := &core.Header{
-		Version:   1,
-		DataHash:  types.Hash{},
-		Height:    0,
-		Timestamp: 000000,
-	}
-
-	b, _ := core.NewBlock(header, nil)
-	return b
-}
@@ -0,0 +1,182 @@
+package network
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/felixkuang/titanchain/core"
+	"github.com/felixkuang/titanchain/crypto"
+	"github.com/felixkuang/titanchain/types"
+	"github.com/felixkuang/titanchain/util"
+)
+
+// newTestServer 辅助函数：创建一个非验证者的测试服务器
+func newTestServer(t *testing.T, genesis *core.Genesis) *Server {
+	tr := NewLocalTransport(LocalTransportOpts{Addr: "LOCAL"})
+	s, err := NewServer(ServerOpts{
+		ID:        "LOCAL",
+		Transport: tr,
+		Logger:    log.NewNopLogger(),
+		Genesis:   genesis,
+	})
+	assert.Nil(t, err)
+
+	return s
+}
+
+// TestStatusMessageGenesisMismatch 测试握手时拒绝链ID或创世区块不一致的节点
+func TestStatusMessageGenesisMismatch(t *testing.T) {
+	s := newTestServer(t, core.DefaultGenesis())
+
+	other := core.DefaultGenesis()
+	other.Config.ChainID = 99
+	assert.NotNil(t, s.processStatusMessage("REMOTE", &StatusMessage{
+		ChainID:     other.Config.ChainID,
+		GenesisHash: s.chain.GenesisHash(),
+	}))
+
+	assert.NotNil(t, s.processStatusMessage("REMOTE", &StatusMessage{
+		ChainID:     s.chain.ChainID(),
+		GenesisHash: types.Hash{0x01},
+	}))
+
+	// 链ID和创世区块一致，且对方高度不高于本节点时无需同步
+	assert.Nil(t, s.processStatusMessage("REMOTE", &StatusMessage{
+		ChainID:     s.chain.ChainID(),
+		GenesisHash: s.chain.GenesisHash(),
+	}))
+}
+
+// TestProcessTransactionValidityWindow 测试交易池拒绝不在有效期内的交易
+func TestProcessTransactionValidityWindow(t *testing.T) {
+	s := newTestServer(t, core.DefaultGenesis())
+	privKey := crypto.GeneratePrivateKey()
+
+	tx := util.NewRandomTransaction(10)
+	tx.ValidAfter = 10
+	assert.Nil(t, tx.Sign(privKey))
+	assert.NotNil(t, s.processTransaction(tx))
+
+	tx = util.NewRandomTransaction(10)
+	tx.ValidUntil = 1
+	assert.Nil(t, tx.Sign(privKey))
+	assert.Nil(t, s.processTransaction(tx))
+	assert.True(t, s.mempool.Contains(tx.Hash(core.TxHasher{})))
+}
+
+// TestProcessTransactionInvalidCode 测试交易池拒绝合约代码未通过静态校验的部署交易
+func TestProcessTransactionInvalidCode(t *testing.T) {
+	s := newTestServer(t, core.DefaultGenesis())
+	privKey := crypto.GeneratePrivateKey()
+
+	tx := &core.Transaction{Type: core.TxTypeDeploy, ChainID: core.DefaultChainID, Data: []byte{byte(core.InstrPushInt)}}
+	assert.Nil(t, tx.Sign(privKey))
+	assert.ErrorIs(t, s.processTransaction(tx), core.ErrTruncatedImmediate)
+	assert.False(t, s.mempool.Contains(tx.Hash(core.TxHasher{})))
+
+	tx = &core.Transaction{Type: core.TxTypeDeploy, ChainID: core.DefaultChainID, Data: []byte{byte(core.InstrCallData), byte(core.InstrLog0)}}
+	assert.Nil(t, tx.Sign(privKey))
+	assert.Nil(t, s.processTransaction(tx))
+}
+
+// TestProcessTransactionAccountState 测试交易池按当前状态拒绝序号已被使用或余额不足的交易
+func TestProcessTransactionAccountState(t *testing.T) {
+	privKey := crypto.GeneratePrivateKey()
+	genesis := core.DefaultGenesis()
+	genesis.Alloc[privKey.PublicKey().Address()] = core.GenesisAccount{Balance: 100}
+	s := newTestServer(t, genesis)
+
+	tx := &core.Transaction{Type: core.TxTypeTransfer, ChainID: core.DefaultChainID, To: types.Address{0x01}, Value: 1000}
+	assert.Nil(t, tx.Sign(privKey))
+	assert.NotNil(t, s.processTransaction(tx))
+	assert.False(t, s.mempool.Contains(tx.Hash(core.TxHasher{})))
+
+	tx = &core.Transaction{Type: core.TxTypeTransfer, ChainID: core.DefaultChainID, To: types.Address{0x01}, Value: 100}
+	assert.Nil(t, tx.Sign(privKey))
+	assert.Nil(t, s.processTransaction(tx))
+}
+
+// TestCreateNewBlockEvictsInvalid 测试出块时跳过不合法的待打包交易并将其移出交易池
+func TestCreateNewBlockEvictsInvalid(t *testing.T) {
+	privKey := crypto.GeneratePrivateKey()
+	genesis := core.DefaultGenesis()
+	genesis.Alloc[privKey.PublicKey().Address()] = core.GenesisAccount{Balance: 100}
+	s := newTestServer(t, genesis)
+	s.PrivateKey = crypto.GeneratePrivateKey()
+
+	ok := &core.Transaction{Type: core.TxTypeTransfer, ChainID: core.DefaultChainID, To: types.Address{0x01}, Value: 40}
+	assert.Nil(t, ok.Sign(privKey))
+	// 入池时合法、打包时已不合法的交易（例如被同一发起者的其他交易花光了余额）
+	bad := &core.Transaction{Type: core.TxTypeTransfer, ChainID: core.DefaultChainID, Nonce: 1, To: types.Address{0x01}, Value: 100}
+	assert.Nil(t, bad.Sign(privKey))
+	s.mempool.Add(ok)
+	s.mempool.Add(bad)
+
+	assert.Nil(t, s.createNewBlock())
+	assert.Equal(t, uint32(1), s.chain.Height())
+	assert.False(t, s.mempool.Contains(bad.Hash(core.TxHasher{})))
+	assert.Equal(t, 0, s.mempool.PendingCount())
+
+	// 交易池中不再有不合法的交易，后续出块不受影响
+	assert.Nil(t, s.createNewBlock())
+	assert.Equal(t, uint32(2), s.chain.Height())
+}
+
+// TestServerStop 测试关闭服务器后 Start 返回，且可重复关闭
+func TestServerStop(t *testing.T) {
+	tr := NewLocalTransport(LocalTransportOpts{Addr: "LOCAL"})
+	s, err := NewServer(ServerOpts{
+		ID:         "LOCAL",
+		Transport:  tr,
+		Logger:     log.NewNopLogger(),
+		PrivateKey: crypto.GeneratePrivateKey(),
+		BlockTime:  time.Millisecond,
+	})
+	assert.Nil(t, err)
+
+	done := make(chan struct{})
+	go func() {
+		s.Start()
+		close(done)
+	}()
+
+	s.Stop()
+	s.Stop()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("server did not stop")
+	}
+}
+
+// TestServerKeystore 测试从 keystore 文件加载验证者私钥
+func TestServerKeystore(t *testing.T) {
+	privKey, err := crypto.GenerateKey(crypto.KeyTypeSecp256k1)
+	assert.Nil(t, err)
+	data, err := crypto.EncryptKey(privKey, "secret", crypto.LightScryptParams)
+	assert.Nil(t, err)
+	path := filepath.Join(t.TempDir(), "validator.json")
+	assert.Nil(t, os.WriteFile(path, data, 0600))
+
+	opts := ServerOpts{
+		ID:               "LOCAL",
+		Transport:        NewLocalTransport(LocalTransportOpts{Addr: "LOCAL"}),
+		Logger:           log.NewNopLogger(),
+		KeystorePath:     path,
+		KeystorePassword: "wrong",
+	}
+	_, err = NewServer(opts)
+	assert.ErrorIs(t, err, crypto.ErrInvalidPassword)
+
+	opts.KeystorePassword = "secret"
+	s, err := NewServer(opts)
+	assert.Nil(t, err)
+	assert.True(t, s.isValidator)
+	assert.Equal(t, privKey.ToSlice(), s.PrivateKey.ToSlice())
+	assert.Empty(t, s.KeystorePassword)
+}
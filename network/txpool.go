@@ -12,20 +12,24 @@ import (
 // all: 所有交易的有序集合
 // pending: 待打包的交易集合
 // maxLength: 交易池最大容量，超出时自动移除最早交易
+// hasher: 计算交易ID的哈希器，需与链配置的哈希算法一致
 type TxPool struct {
-	all       *TxSortedMap // 所有交易的有序集合
-	pending   *TxSortedMap // 待打包的交易集合
-	maxLength int          // 交易池最大容量
+	all       *TxSortedMap  // 所有交易的有序集合
+	pending   *TxSortedMap  // 待打包的交易集合
+	maxLength int           // 交易池最大容量
+	hasher    core.TxHasher // 交易哈希器
 }
 
-// NewTxPool 创建一个新的交易池实例
+// NewTxPool 创建一个以指定哈希器计算交易ID的交易池实例
 // maxLength: 交易池最大容量
+// hasher: 交易哈希器，需与链配置的哈希算法一致（见 ChainConfig.TxHasher）
 // 返回新建的 TxPool 指针
-func NewTxPool(maxLength int) *TxPool {
+func NewTxPool(maxLength int, hasher core.TxHasher) *TxPool {
 	return &TxPool{
-		all:       NewTxSortedMap(),
-		pending:   NewTxSortedMap(),
+		all:       NewTxSortedMap(hasher),
+		pending:   NewTxSortedMap(hasher),
 		maxLength: maxLength,
+		hasher:    hasher,
 	}
 }
 
@@ -35,10 +39,10 @@ func (p *TxPool) Add(tx *core.Transaction) {
 	// 如果池已满，移除最早的交易
 	if p.all.Count() == p.maxLength {
 		oldest := p.all.First()
-		p.all.Remove(oldest.Hash(core.TxHasher{}))
+		p.all.Remove(oldest.Hash(p.hasher))
 	}
 
-	if !p.all.Contains(tx.Hash(core.TxHasher{})) {
+	if !p.all.Contains(tx.Hash(p.hasher)) {
 		p.all.Add(tx)
 		p.pending.Add(tx)
 	}
@@ -56,6 +60,30 @@ func (p *TxPool) Pending() []*core.Transaction {
 	return p.pending.txx.Data
 }
 
+// EvictExpired 移除在指定高度已经过期的交易
+// height: 下一个待打包区块的高度
+// 返回被移除的交易数量
+func (p *TxPool) EvictExpired(height uint32) int {
+	expired := p.all.Filter(func(tx *core.Transaction) bool {
+		return tx.Expired(height)
+	})
+
+	for _, tx := range expired {
+		hash := tx.Hash(p.hasher)
+		p.all.Remove(hash)
+		p.pending.Remove(hash)
+	}
+
+	return len(expired)
+}
+
+// Remove 从交易池中移除指定哈希的交易，包括待打包的交易
+// hash: 交易哈希
+func (p *TxPool) Remove(hash types.Hash) {
+	p.all.Remove(hash)
+	p.pending.Remove(hash)
+}
+
 // ClearPending 清空所有待打包的交易
 func (p *TxPool) ClearPending() {
 	p.pending.Clear()
@@ -71,17 +99,20 @@ func (p *TxPool) PendingCount() int {
 // lock: 读写锁，保证并发安全
 // lookup: 哈希到交易的映射
 // txx: 交易列表，保持插入顺序
+// hasher: 计算交易哈希的哈希器
 type TxSortedMap struct {
 	lock   sync.RWMutex
 	lookup map[types.Hash]*core.Transaction
 	txx    *types.List[*core.Transaction]
+	hasher core.TxHasher
 }
 
-// NewTxSortedMap 创建一个新的 TxSortedMap 实例
-func NewTxSortedMap() *TxSortedMap {
+// NewTxSortedMap 创建一个以指定哈希器计算交易哈希的 TxSortedMap 实例
+func NewTxSortedMap(hasher core.TxHasher) *TxSortedMap {
 	return &TxSortedMap{
 		lookup: make(map[types.Hash]*core.Transaction),
 		txx:    types.NewList[*core.Transaction](),
+		hasher: hasher,
 	}
 }
 
@@ -91,7 +122,7 @@ func (t *TxSortedMap) First() *core.Transaction {
 	defer t.lock.RUnlock()
 
 	first := t.txx.Get(0)
-	return t.lookup[first.Hash(core.TxHasher{})]
+	return t.lookup[first.Hash(t.hasher)]
 }
 
 // Get 根据哈希获取交易指针
@@ -107,7 +138,7 @@ func (t *TxSortedMap) Get(h types.Hash) *core.Transaction {
 // Add 添加一笔交易到映射中，自动去重
 // tx: 要添加的交易指针
 func (t *TxSortedMap) Add(tx *core.Transaction) {
-	hash := tx.Hash(core.TxHasher{})
+	hash := tx.Hash(t.hasher)
 
 	t.lock.Lock()
 	defer t.lock.Unlock()
@@ -128,6 +159,22 @@ func (t *TxSortedMap) Remove(h types.Hash) {
 	delete(t.lookup, h)
 }
 
+// Filter 按插入顺序返回所有满足条件的交易
+// fn: 过滤条件，返回 true 的交易会被选中
+func (t *TxSortedMap) Filter(fn func(*core.Transaction) bool) []*core.Transaction {
+	t.lock.RLock()
+	defer t.lock.RUnlock()
+
+	txx := []*core.Transaction{}
+	for _, tx := range t.txx.Data {
+		if fn(tx) {
+			txx = append(txx, tx)
+		}
+	}
+
+	return txx
+}
+
 // Count 返回当前映射中的交易数量
 func (t *TxSortedMap) Count() int {
 	t.lock.RLock()
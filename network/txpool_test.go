@@ -6,11 +6,12 @@ import (
 	"github.com/felixkuang/titanchain/util"
 
 	"github.com/felixkuang/titanchain/core"
+	"github.com/felixkuang/titanchain/crypto"
 	"github.com/stretchr/testify/assert"
 )
 
 func TestTxMaxLength(t *testing.T) {
-	p := NewTxPool(1)
+	p := NewTxPool(1, core.TxHasher{})
 	p.Add(util.NewRandomTransaction(10))
 	assert.Equal(t, 1, p.all.Count())
 
@@ -24,7 +25,7 @@ func TestTxMaxLength(t *testing.T) {
 }
 
 func TestTxPoolAdd(t *testing.T) {
-	p := NewTxPool(11)
+	p := NewTxPool(11, core.TxHasher{})
 	n := 10
 
 	for i := 1; i <= n; i++ {
@@ -41,7 +42,7 @@ func TestTxPoolAdd(t *testing.T) {
 
 func TestTxPoolMaxLength(t *testing.T) {
 	maxLen := 10
-	p := NewTxPool(maxLen)
+	p := NewTxPool(maxLen, core.TxHasher{})
 	n := 100
 	txx := []*core.Transaction{}
 
@@ -62,8 +63,51 @@ func TestTxPoolMaxLength(t *testing.T) {
 	}
 }
 
+func TestTxPoolSamePayloadDifferentSigners(t *testing.T) {
+	p := NewTxPool(10, core.TxHasher{})
+	data := util.RandomBytes(32)
+
+	tx1 := core.NewTransaction(data)
+	tx2 := core.NewTransaction(data)
+	assert.Nil(t, tx1.Sign(crypto.GeneratePrivateKey()))
+	assert.Nil(t, tx2.Sign(crypto.GeneratePrivateKey()))
+
+	p.Add(tx1)
+	p.Add(tx2)
+	assert.Equal(t, 2, p.PendingCount())
+	assert.True(t, p.Contains(tx2.Hash(core.TxHasher{})))
+}
+
+func TestTxPoolEvictExpired(t *testing.T) {
+	p := NewTxPool(10, core.TxHasher{})
+
+	expiring := util.NewRandomTransaction(10)
+	expiring.ValidUntil = 5
+	p.Add(expiring)
+	p.Add(util.NewRandomTransaction(10))
+
+	assert.Equal(t, 0, p.EvictExpired(5))
+	assert.Equal(t, 1, p.EvictExpired(6))
+	assert.False(t, p.Contains(expiring.Hash(core.TxHasher{})))
+	assert.Equal(t, 1, p.PendingCount())
+	assert.Equal(t, 1, p.all.Count())
+}
+
+func TestTxPoolRemove(t *testing.T) {
+	p := NewTxPool(10, core.TxHasher{})
+
+	tx := util.NewRandomTransaction(10)
+	p.Add(tx)
+	p.Add(util.NewRandomTransaction(10))
+
+	p.Remove(tx.Hash(core.TxHasher{}))
+	assert.False(t, p.Contains(tx.Hash(core.TxHasher{})))
+	assert.Equal(t, 1, p.PendingCount())
+	assert.Equal(t, 1, p.all.Count())
+}
+
 func TestTxSortedMapFirst(t *testing.T) {
-	m := NewTxSortedMap()
+	m := NewTxSortedMap(core.TxHasher{})
 	first := util.NewRandomTransaction(100)
 	m.Add(first)
 	m.Add(util.NewRandomTransaction(10))
@@ -74,7 +118,7 @@ func TestTxSortedMapFirst(t *testing.T) {
 }
 
 func TestTxSortedMapAdd(t *testing.T) {
-	m := NewTxSortedMap()
+	m := NewTxSortedMap(core.TxHasher{})
 	n := 100
 
 	for i := 0; i < n; i++ {
@@ -96,7 +140,7 @@ func TestTxSortedMapAdd(t *testing.T) {
 }
 
 func TestTxSortedMapRemove(t *testing.T) {
-	m := NewTxSortedMap()
+	m := NewTxSortedMap(core.TxHasher{})
 
 	tx := util.NewRandomTransaction(100)
 	m.Add(tx)
@@ -4,6 +4,7 @@ package types
 import (
 	"encoding/hex"
 	"fmt"
+	"strings"
 )
 
 // Address 表示一个20字节（160位）的区块链地址
@@ -44,3 +45,33 @@ func AddressFromBytes(b []byte) Address {
 
 	return Address(value)
 }
+
+// AddressFromHex 从十六进制字符串解析地址，允许可选的 0x 前缀
+func AddressFromHex(s string) (Address, error) {
+	b, err := hex.DecodeString(strings.TrimPrefix(s, "0x"))
+	if err != nil {
+		return Address{}, err
+	}
+	if len(b) != 20 {
+		return Address{}, fmt.Errorf("given address %s with length %d should be 20", s, len(b))
+	}
+
+	return AddressFromBytes(b), nil
+}
+
+// MarshalText 实现 encoding.TextMarshaler，以十六进制形式序列化地址
+// 便于地址在 JSON/YAML 中作为字段值或 map 键使用
+func (a Address) MarshalText() ([]byte, error) {
+	return []byte(a.String()), nil
+}
+
+// UnmarshalText 实现 encoding.TextUnmarshaler，从十六进制文本解析地址
+func (a *Address) UnmarshalText(text []byte) error {
+	addr, err := AddressFromHex(string(text))
+	if err != nil {
+		return err
+	}
+	*a = addr
+
+	return nil
+}
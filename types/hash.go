@@ -4,6 +4,7 @@ package types
 import (
 	"encoding/hex"
 	"fmt"
+	"strings"
 )
 
 // Hash 表示一个32字节（256位）的哈希值
@@ -47,3 +48,22 @@ func HashFromBytes(b []byte) Hash {
 	}
 	return Hash(value)
 }
+
+// MarshalText 实现 encoding.TextMarshaler，以十六进制形式序列化哈希
+func (h Hash) MarshalText() ([]byte, error) {
+	return []byte(h.String()), nil
+}
+
+// UnmarshalText 实现 encoding.TextUnmarshaler，从十六进制文本解析哈希
+func (h *Hash) UnmarshalText(text []byte) error {
+	b, err := hex.DecodeString(strings.TrimPrefix(string(text), "0x"))
+	if err != nil {
+		return err
+	}
+	if len(b) != 32 {
+		return fmt.Errorf("invalid hash length: %d", len(b))
+	}
+	*h = HashFromBytes(b)
+
+	return nil
+}
@@ -28,9 +28,21 @@ func RandomHash() types.Hash {
 
 // NewRandomTransaction 创建一个未签名的随机交易
 // size: 交易数据长度
-// 返回新的 Transaction 实例
+// 返回新的 Transaction 实例，链ID为默认链ID
+// 交易数据是能通过静态校验的字节码：若干条压入随机字节后弹出的指令，不足三字节的部分以 JUMPDEST 填充
 func NewRandomTransaction(size int) *core.Transaction {
-	return core.NewTransaction(RandomBytes(size))
+	data := make([]byte, 0, size)
+	for len(data) < size%3 {
+		data = append(data, byte(core.InstrJumpDest))
+	}
+	for _, b := range RandomBytes(size / 3) {
+		data = append(data, b, byte(core.InstrPushByte), byte(core.InstrPop))
+	}
+
+	tx := core.NewTransaction(data)
+	tx.ChainID = core.DefaultChainID
+
+	return tx
 }
 
 // NewRandomTransactionWithSignature 创建一个带签名的随机交易
@@ -55,7 +67,7 @@ func NewRandomBlock(t *testing.T, height uint32, prevBlockHash types.Hash) *core
 	}
 	b, err := core.NewBlock(header, []*core.Transaction{tx})
 	assert.Nil(t, err)
-	dataHash, err := core.CalculateDataHash(b.Transactions)
+	dataHash, err := core.CalculateDataHash(crypto.HashSHA256, b.Transactions)
 	assert.Nil(t, err)
 	b.Header.DataHash = dataHash
 
@@ -0,0 +1,190 @@
+package wasm
+
+// writer 按 WASM 二进制格式写入字节序列
+type writer struct {
+	b []byte
+}
+
+func (w *writer) byte(b byte) {
+	w.b = append(w.b, b)
+}
+
+func (w *writer) u32(v uint32) {
+	w.b = AppendU32(w.b, v)
+}
+
+func (w *writer) bytes(b []byte) {
+	w.u32(uint32(len(b)))
+	w.b = append(w.b, b...)
+}
+
+func (w *writer) name(s string) {
+	w.bytes([]byte(s))
+}
+
+func (w *writer) valueTypes(types []ValueType) {
+	w.u32(uint32(len(types)))
+	for _, t := range types {
+		w.byte(byte(t))
+	}
+}
+
+func (w *writer) constExpr(t ValueType, v uint64) {
+	if t == I64 {
+		w.byte(opI64Const)
+		w.b = AppendS64(w.b, int64(v))
+	} else {
+		w.byte(opI32Const)
+		w.b = AppendS64(w.b, int64(int32(uint32(v))))
+	}
+	w.byte(opEnd)
+}
+
+// section 写入一个段，内容为空时不写入
+func (w *writer) section(id byte, n int, fn func(s *writer)) {
+	if n == 0 {
+		return
+	}
+	s := &writer{}
+	s.u32(uint32(n))
+	fn(s)
+	w.byte(id)
+	w.bytes(s.b)
+}
+
+// AppendU32 以无符号 LEB128 编码追加 v
+func AppendU32(b []byte, v uint32) []byte {
+	for {
+		c := byte(v & 0x7f)
+		v >>= 7
+		if v != 0 {
+			c |= 0x80
+		}
+		b = append(b, c)
+		if v == 0 {
+			return b
+		}
+	}
+}
+
+// AppendS64 以有符号 LEB128 编码追加 v
+func AppendS64(b []byte, v int64) []byte {
+	for {
+		c := byte(v & 0x7f)
+		v >>= 7
+		if (v == 0 && c&0x40 == 0) || (v == -1 && c&0x40 != 0) {
+			return append(b, c)
+		}
+		b = append(b, c|0x80)
+	}
+}
+
+// Encode 将模块编码为 WASM 二进制格式
+func (m *Module) Encode() []byte {
+	w := &writer{}
+	w.b = append(w.b, magic...)
+	w.b = append(w.b, version...)
+
+	w.section(sectionType, len(m.Types), func(s *writer) {
+		for _, t := range m.Types {
+			s.byte(0x60)
+			s.valueTypes(t.Params)
+			s.valueTypes(t.Results)
+		}
+	})
+
+	w.section(sectionImport, len(m.Imports), func(s *writer) {
+		for _, imp := range m.Imports {
+			s.name(imp.Module)
+			s.name(imp.Name)
+			s.byte(ExternFunc)
+			s.u32(imp.Type)
+		}
+	})
+
+	w.section(sectionFunction, len(m.Funcs), func(s *writer) {
+		for _, t := range m.Funcs {
+			s.u32(t)
+		}
+	})
+
+	if m.Memory != nil {
+		w.section(sectionMemory, 1, func(s *writer) {
+			if m.Memory.HasMax {
+				s.byte(1)
+				s.u32(m.Memory.Min)
+				s.u32(m.Memory.Max)
+			} else {
+				s.byte(0)
+				s.u32(m.Memory.Min)
+			}
+		})
+	}
+
+	w.section(sectionGlobal, len(m.Globals), func(s *writer) {
+		for _, g := range m.Globals {
+			s.byte(byte(g.Type))
+			if g.Mutable {
+				s.byte(1)
+			} else {
+				s.byte(0)
+			}
+			s.constExpr(g.Type, g.Init)
+		}
+	})
+
+	w.section(sectionExport, len(m.Exports), func(s *writer) {
+		for _, e := range m.Exports {
+			s.name(e.Name)
+			s.byte(e.Kind)
+			s.u32(e.Index)
+		}
+	})
+
+	if m.Start != nil {
+		w.byte(sectionStart)
+		w.bytes(AppendU32(nil, *m.Start))
+	}
+
+	w.section(sectionCode, len(m.Codes), func(s *writer) {
+		for _, c := range m.Codes {
+			s.bytes(encodeCode(c))
+		}
+	})
+
+	w.section(sectionData, len(m.Data), func(s *writer) {
+		for _, d := range m.Data {
+			s.u32(0)
+			s.constExpr(I32, uint64(d.Offset))
+			s.bytes(d.Data)
+		}
+	})
+
+	return w.b
+}
+
+// encodeCode 编码函数体，相邻的同类型局部变量合并为一组
+func encodeCode(c Code) []byte {
+	type group struct {
+		n uint32
+		t ValueType
+	}
+	var groups []group
+	for _, t := range c.Locals {
+		if len(groups) > 0 && groups[len(groups)-1].t == t {
+			groups[len(groups)-1].n++
+		} else {
+			groups = append(groups, group{1, t})
+		}
+	}
+
+	w := &writer{}
+	w.u32(uint32(len(groups)))
+	for _, g := range groups {
+		w.u32(g.n)
+		w.byte(byte(g.t))
+	}
+	w.b = append(w.b, c.Body...)
+
+	return w.b
+}
@@ -0,0 +1,146 @@
+package wasm
+
+import "fmt"
+
+// gas 计量函数从 "env" 模块导入，签名为 (i64) -> ()
+const (
+	HostModule = "env"
+	GasFunc    = "gas"
+)
+
+// CostFunc 返回一条指令的 gas 消耗
+type CostFunc func(op byte) uint64
+
+// DefaultCost 是默认的指令 gas 表
+// 只标记块结构的 block、loop、else、end 与 nop 不计费，访问内存与函数调用较贵，其余指令为 1
+func DefaultCost(op byte) uint64 {
+	switch {
+	case op == opBlock || op == opLoop || op == opElse || op == opEnd || op == opNop:
+		return 0
+	case op == opMemoryGrow:
+		return 100
+	case op == opCall:
+		return 5
+	case isMemory(op):
+		return 3
+	default:
+		return 1
+	}
+}
+
+// endsSegment 判断指令是否结束一段顺序执行的指令
+func endsSegment(op byte) bool {
+	switch op {
+	case opBlock, opLoop, opIf, opElse, opEnd, opBr, opBrIf, opBrTable, opReturn, opCall, opUnreachable:
+		return true
+	default:
+		return false
+	}
+}
+
+// InjectGas 返回注入了 gas 计量的模块副本，cost 为 nil 时使用 DefaultCost
+// 模块新增导入 env.gas，每段顺序执行的指令之前插入 i64.const <该段 gas>; call $gas。
+// 段在控制流指令与函数调用之后结束，因此执行任何指令之前都已为其所在的段付费，
+// 提前跳出时多付的部分不退还。新增的导入排在原有导入之后，模块内函数的索引依次加 1
+func InjectGas(m *Module, cost CostFunc) (*Module, error) {
+	if cost == nil {
+		cost = DefaultCost
+	}
+
+	for _, imp := range m.Imports {
+		if imp.Module == HostModule && imp.Name == GasFunc {
+			return nil, fmt.Errorf("%w: module imports %s.%s", ErrInvalidModule, HostModule, GasFunc)
+		}
+	}
+
+	out := *m
+	gasIdx := uint32(len(m.Imports))
+	gasType := FuncType{Params: []ValueType{I64}}
+
+	out.Types = append([]FuncType{}, m.Types...)
+	typeIdx := uint32(len(out.Types))
+	for i, t := range out.Types {
+		if t.Equal(gasType) {
+			typeIdx = uint32(i)
+			break
+		}
+	}
+	if typeIdx == uint32(len(out.Types)) {
+		out.Types = append(out.Types, gasType)
+	}
+
+	out.Imports = append(append([]Import{}, m.Imports...), Import{Module: HostModule, Name: GasFunc, Type: typeIdx})
+
+	shift := func(idx uint32) uint32 {
+		if idx >= gasIdx {
+			return idx + 1
+		}
+		return idx
+	}
+
+	out.Exports = make([]Export, len(m.Exports))
+	for i, e := range m.Exports {
+		if e.Kind == ExternFunc {
+			e.Index = shift(e.Index)
+		}
+		out.Exports[i] = e
+	}
+	if m.Start != nil {
+		start := shift(*m.Start)
+		out.Start = &start
+	}
+
+	out.Codes = make([]Code, len(m.Codes))
+	for i, c := range m.Codes {
+		body, err := injectBody(c.Body, gasIdx, cost, shift)
+		if err != nil {
+			return nil, fmt.Errorf("function %d: %w", len(m.Imports)+i, err)
+		}
+		out.Codes[i] = Code{Locals: c.Locals, Body: body}
+	}
+
+	return &out, nil
+}
+
+// injectBody 在函数体每段顺序执行的指令之前插入 gas 计费，并重写函数调用的索引
+func injectBody(body []byte, gasIdx uint32, cost CostFunc, shift func(uint32) uint32) ([]byte, error) {
+	var (
+		out     []byte
+		segment []byte
+		total   uint64
+		r       = &reader{b: body}
+	)
+
+	flush := func() {
+		if total > 0 {
+			out = append(out, opI64Const)
+			out = AppendS64(out, int64(total))
+			out = append(out, opCall)
+			out = AppendU32(out, gasIdx)
+		}
+		out = append(out, segment...)
+		segment, total = nil, 0
+	}
+
+	for r.len() > 0 {
+		in, err := decodeInstr(r)
+		if err != nil {
+			return nil, err
+		}
+
+		if in.op == opCall {
+			segment = append(segment, opCall)
+			segment = AppendU32(segment, shift(uint32(in.imm)))
+		} else {
+			segment = append(segment, body[in.pos:r.pos]...)
+		}
+		total += cost(in.op)
+
+		if endsSegment(in.op) {
+			flush()
+		}
+	}
+	flush()
+
+	return out, nil
+}
@@ -0,0 +1,685 @@
+package wasm
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"math/bits"
+)
+
+const (
+	// PageSize 是线性内存一页的字节数
+	PageSize = 64 * 1024
+	// MaxPages 是线性内存的最大页数，模块声明的上限更小时以模块为准
+	MaxPages = 16
+	// maxCallDepth 是实例内函数调用的最大深度
+	maxCallDepth = 1024
+	// maxStackSize 是操作数栈的最大元素个数
+	maxStackSize = 64 * 1024
+	// maxLocals 是一个函数的最大局部变量个数
+	maxLocals = 4096
+)
+
+var (
+	// ErrUnreachable 表示执行了 unreachable 指令
+	ErrUnreachable = errors.New("wasm: unreachable executed")
+	// ErrDivideByZero 表示整数除以零
+	ErrDivideByZero = errors.New("wasm: integer divide by zero")
+	// ErrIntegerOverflow 表示有符号整数除法溢出
+	ErrIntegerOverflow = errors.New("wasm: integer overflow")
+	// ErrOutOfBounds 表示访问了线性内存范围之外的地址
+	ErrOutOfBounds = errors.New("wasm: out of bounds memory access")
+	// ErrStackExhausted 表示调用深度或操作数栈超过上限
+	ErrStackExhausted = errors.New("wasm: call stack exhausted")
+	// ErrStackUnderflow 表示操作数栈中的值不足
+	ErrStackUnderflow = errors.New("wasm: operand stack underflow")
+	// ErrUnknownImport 表示导入的函数没有对应的宿主函数或签名不符
+	ErrUnknownImport = errors.New("wasm: unknown import")
+	// ErrExportNotFound 表示调用的导出函数不存在
+	ErrExportNotFound = errors.New("wasm: export not found")
+)
+
+// HostFunc 是由宿主实现、供模块导入的函数
+// args 按参数顺序排列，i32 值占低 32 位；返回的错误会终止整个执行并由 Invoke 原样返回
+type HostFunc struct {
+	Type FuncType
+	Fn   func(inst *Instance, args []uint64) ([]uint64, error)
+}
+
+// trap 是执行中止时携带错误的 panic 值，在 Invoke 中恢复
+type trap struct {
+	err error
+}
+
+// label 是控制栈中的一个块
+type label struct {
+	height int // 进入块时操作数栈的高度
+	arity  int // 跳转到该块时保留的值个数
+	result int // 块正常结束时保留的值个数
+	cont   int // 跳转到该块时继续执行的指令下标
+}
+
+// Instance 是模块的一个实例，持有线性内存、全局变量与操作数栈
+// 实例不可重入：宿主函数不能在执行过程中再次调用同一实例的 Invoke
+type Instance struct {
+	module   *Module
+	funcs    [][]instr
+	host     []HostFunc
+	memory   []byte
+	maxPages uint32
+	globals  []uint64
+	stack    []uint64
+	base     int // 当前函数的操作数在栈中的起始位置，函数不能弹出其下方的值
+	depth    int
+}
+
+// Instantiate 创建模块的实例
+// 导入函数只能来自 "env" 模块，从 host 中按名称解析；之后写入数据段并执行起始函数
+func Instantiate(m *Module, host map[string]HostFunc) (*Instance, error) {
+	inst := &Instance{
+		module:   m,
+		maxPages: MaxPages,
+	}
+
+	for _, imp := range m.Imports {
+		h, ok := host[imp.Name]
+		if imp.Module != HostModule || !ok {
+			return nil, fmt.Errorf("%w: %s.%s", ErrUnknownImport, imp.Module, imp.Name)
+		}
+		if !h.Type.Equal(m.Types[imp.Type]) {
+			return nil, fmt.Errorf("%w: %s.%s has type %s, want %s", ErrUnknownImport, imp.Module, imp.Name, m.Types[imp.Type], h.Type)
+		}
+		inst.host = append(inst.host, h)
+	}
+
+	for i := range m.Funcs {
+		code, err := compileFunc(m, i)
+		if err != nil {
+			return nil, err
+		}
+		inst.funcs = append(inst.funcs, code)
+	}
+
+	if m.Memory != nil {
+		if m.Memory.HasMax && m.Memory.Max < inst.maxPages {
+			inst.maxPages = m.Memory.Max
+		}
+		if m.Memory.Min > inst.maxPages {
+			return nil, fmt.Errorf("%w: memory of %d pages exceeds limit", ErrUnsupported, m.Memory.Min)
+		}
+		inst.memory = make([]byte, int(m.Memory.Min)*PageSize)
+	}
+
+	for _, g := range m.Globals {
+		inst.globals = append(inst.globals, g.Init)
+	}
+
+	for _, d := range m.Data {
+		if err := inst.WriteMemory(d.Offset, d.Data); err != nil {
+			return nil, err
+		}
+	}
+
+	if m.Start != nil {
+		if _, err := inst.call(*m.Start, nil); err != nil {
+			return nil, err
+		}
+	}
+
+	return inst, nil
+}
+
+// Invoke 以 args 为参数调用导出函数，返回函数的结果
+func (inst *Instance) Invoke(name string, args ...uint64) ([]uint64, error) {
+	idx, ok := inst.module.ExportedFunc(name)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrExportNotFound, name)
+	}
+
+	t, err := inst.module.FuncType(idx)
+	if err != nil {
+		return nil, err
+	}
+	if len(args) != len(t.Params) {
+		return nil, fmt.Errorf("wasm: %s takes %d arguments, got %d", name, len(t.Params), len(args))
+	}
+
+	return inst.call(idx, args)
+}
+
+// Memory 返回线性内存，内存增长后之前返回的切片不再有效
+func (inst *Instance) Memory() []byte {
+	return inst.memory
+}
+
+// ReadMemory 返回线性内存中 [ptr, ptr+n) 的副本
+func (inst *Instance) ReadMemory(ptr, n uint32) ([]byte, error) {
+	if uint64(ptr)+uint64(n) > uint64(len(inst.memory)) {
+		return nil, ErrOutOfBounds
+	}
+
+	return append([]byte{}, inst.memory[ptr:ptr+n]...), nil
+}
+
+// WriteMemory 将 data 写入线性内存 ptr 处
+func (inst *Instance) WriteMemory(ptr uint32, data []byte) error {
+	if uint64(ptr)+uint64(len(data)) > uint64(len(inst.memory)) {
+		return ErrOutOfBounds
+	}
+	copy(inst.memory[ptr:], data)
+
+	return nil
+}
+
+// call 执行函数并将执行中止转换为错误
+func (inst *Instance) call(idx uint32, args []uint64) (results []uint64, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			t, ok := r.(trap)
+			if !ok {
+				panic(r)
+			}
+			err = t.err
+		}
+		inst.stack = inst.stack[:0]
+		inst.base = 0
+		inst.depth = 0
+	}()
+
+	inst.stack = append(inst.stack[:0], args...)
+	inst.invoke(idx)
+
+	return append([]uint64{}, inst.stack...), nil
+}
+
+// fail 中止执行
+func fail(err error) {
+	panic(trap{err: err})
+}
+
+func (inst *Instance) push(v uint64) {
+	if len(inst.stack) >= maxStackSize {
+		fail(ErrStackExhausted)
+	}
+	inst.stack = append(inst.stack, v)
+}
+
+func (inst *Instance) pop() uint64 {
+	if len(inst.stack) <= inst.base {
+		fail(ErrStackUnderflow)
+	}
+	v := inst.stack[len(inst.stack)-1]
+	inst.stack = inst.stack[:len(inst.stack)-1]
+
+	return v
+}
+
+// unwind 保留栈顶的 n 个值，丢弃它们下方高于 height 的值
+func (inst *Instance) unwind(height, n int) {
+	if height < inst.base || len(inst.stack) < height+n {
+		fail(ErrStackUnderflow)
+	}
+	copy(inst.stack[height:], inst.stack[len(inst.stack)-n:])
+	inst.stack = inst.stack[:height+n]
+}
+
+// invoke 调用函数，参数位于栈顶，返回时结果替换参数
+func (inst *Instance) invoke(idx uint32) {
+	numImports := uint32(len(inst.module.Imports))
+	if idx >= numImports {
+		inst.exec(int(idx - numImports))
+		return
+	}
+
+	h := inst.host[idx]
+	n := len(h.Type.Params)
+	if len(inst.stack)-inst.base < n {
+		fail(ErrStackUnderflow)
+	}
+	args := append([]uint64{}, inst.stack[len(inst.stack)-n:]...)
+	inst.stack = inst.stack[:len(inst.stack)-n]
+
+	results, err := h.Fn(inst, args)
+	if err != nil {
+		fail(err)
+	}
+	if len(results) != len(h.Type.Results) {
+		fail(fmt.Errorf("%w: %s returned %d values", ErrUnknownImport, inst.module.Imports[idx].Name, len(results)))
+	}
+	for i, v := range results {
+		if h.Type.Results[i] == I32 {
+			v = uint64(uint32(v))
+		}
+		inst.push(v)
+	}
+}
+
+// exec 执行模块内定义的第 i 个函数
+func (inst *Instance) exec(i int) {
+	if inst.depth >= maxCallDepth {
+		fail(ErrStackExhausted)
+	}
+	inst.depth++
+
+	m := inst.module
+	t := m.Types[m.Funcs[i]]
+	code := inst.funcs[i]
+
+	numParams := len(t.Params)
+	if len(inst.stack)-inst.base < numParams {
+		fail(ErrStackUnderflow)
+	}
+	locals := make([]uint64, numParams+len(m.Codes[i].Locals))
+	copy(locals, inst.stack[len(inst.stack)-numParams:])
+	inst.stack = inst.stack[:len(inst.stack)-numParams]
+
+	base := len(inst.stack)
+	callerBase := inst.base
+	inst.base = base
+	numResults := len(t.Results)
+	labels := []label{{height: base, arity: numResults, result: numResults, cont: len(code)}}
+
+	branch := func(pc *int, d int) {
+		l := labels[len(labels)-1-d]
+		inst.unwind(l.height, l.arity)
+		labels = labels[:len(labels)-1-d]
+		*pc = l.cont - 1
+	}
+
+	for pc := 0; pc < len(code); pc++ {
+		in := &code[pc]
+
+		switch op := in.op; {
+		case op == opUnreachable:
+			fail(ErrUnreachable)
+
+		case op == opNop:
+
+		case op == opBlock:
+			labels = append(labels, label{height: len(inst.stack), arity: int(in.imm), result: int(in.imm), cont: in.end + 1})
+
+		case op == opLoop:
+			labels = append(labels, label{height: len(inst.stack), arity: 0, result: int(in.imm), cont: pc})
+
+		case op == opIf:
+			cond := uint32(inst.pop())
+			labels = append(labels, label{height: len(inst.stack), arity: int(in.imm), result: int(in.imm), cont: in.end + 1})
+			if cond == 0 {
+				if in.els >= 0 {
+					pc = in.els
+				} else {
+					pc = in.end - 1
+				}
+			}
+
+		case op == opElse:
+			// then 分支执行完毕，跳到 end 结束块
+			pc = in.end - 1
+
+		case op == opEnd:
+			l := labels[len(labels)-1]
+			labels = labels[:len(labels)-1]
+			inst.unwind(l.height, l.result)
+
+		case op == opBr:
+			branch(&pc, int(in.imm))
+
+		case op == opBrIf:
+			if uint32(inst.pop()) != 0 {
+				branch(&pc, int(in.imm))
+			}
+
+		case op == opBrTable:
+			d := uint64(uint32(inst.pop()))
+			if d >= uint64(len(in.table)-1) {
+				d = uint64(len(in.table) - 1)
+			}
+			branch(&pc, int(in.table[d]))
+
+		case op == opReturn:
+			inst.unwind(base, numResults)
+			pc = len(code)
+
+		case op == opCall:
+			inst.invoke(uint32(in.imm))
+
+		case op == opDrop:
+			inst.pop()
+
+		case op == opSelect:
+			cond := uint32(inst.pop())
+			b, a := inst.pop(), inst.pop()
+			if cond != 0 {
+				inst.push(a)
+			} else {
+				inst.push(b)
+			}
+
+		case op == opLocalGet:
+			inst.push(locals[in.imm])
+
+		case op == opLocalSet:
+			locals[in.imm] = inst.pop()
+
+		case op == opLocalTee:
+			v := inst.pop()
+			locals[in.imm] = v
+			inst.push(v)
+
+		case op == opGlobalGet:
+			inst.push(inst.globals[in.imm])
+
+		case op == opGlobalSet:
+			inst.globals[in.imm] = inst.pop()
+
+		case op == opMemorySize:
+			inst.push(uint64(len(inst.memory) / PageSize))
+
+		case op == opMemoryGrow:
+			n := uint64(uint32(inst.pop()))
+			pages := uint64(len(inst.memory) / PageSize)
+			if pages+n > uint64(inst.maxPages) {
+				inst.push(uint64(math.MaxUint32))
+			} else {
+				inst.memory = append(inst.memory, make([]byte, n*PageSize)...)
+				inst.push(pages)
+			}
+
+		case isMemory(op):
+			inst.memoryOp(in)
+
+		case op == opI32Const || op == opI64Const:
+			inst.push(in.imm)
+
+		default:
+			inst.numeric(op)
+		}
+	}
+
+	inst.unwind(base, numResults)
+	inst.base = callerBase
+	inst.depth--
+}
+
+// memoryOp 执行内存读写指令
+func (inst *Instance) memoryOp(in *instr) {
+	var (
+		size  uint64
+		value uint64
+		store = in.op >= opI32Store && in.op <= opI64Store32
+	)
+	switch in.op {
+	case opI32Load8S, opI32Load8U, opI64Load8S, opI64Load8U, opI32Store8, opI64Store8:
+		size = 1
+	case opI32Load16S, opI32Load16U, opI64Load16S, opI64Load16U, opI32Store16, opI64Store16:
+		size = 2
+	case opI32Load, opI64Load32S, opI64Load32U, opI32Store, opI64Store32:
+		size = 4
+	default:
+		size = 8
+	}
+
+	if store {
+		value = inst.pop()
+	}
+	addr := uint64(uint32(inst.pop())) + in.imm
+	if addr+size > uint64(len(inst.memory)) {
+		fail(ErrOutOfBounds)
+	}
+	mem := inst.memory[addr : addr+size]
+
+	if store {
+		switch size {
+		case 1:
+			mem[0] = byte(value)
+		case 2:
+			binary.LittleEndian.PutUint16(mem, uint16(value))
+		case 4:
+			binary.LittleEndian.PutUint32(mem, uint32(value))
+		default:
+			binary.LittleEndian.PutUint64(mem, value)
+		}
+		return
+	}
+
+	switch in.op {
+	case opI32Load8S:
+		value = uint64(uint32(int32(int8(mem[0]))))
+	case opI64Load8S:
+		value = uint64(int64(int8(mem[0])))
+	case opI32Load8U, opI64Load8U:
+		value = uint64(mem[0])
+	case opI32Load16S:
+		value = uint64(uint32(int32(int16(binary.LittleEndian.Uint16(mem)))))
+	case opI64Load16S:
+		value = uint64(int64(int16(binary.LittleEndian.Uint16(mem))))
+	case opI32Load16U, opI64Load16U:
+		value = uint64(binary.LittleEndian.Uint16(mem))
+	case opI64Load32S:
+		value = uint64(int64(int32(binary.LittleEndian.Uint32(mem))))
+	case opI32Load, opI64Load32U:
+		value = uint64(binary.LittleEndian.Uint32(mem))
+	default:
+		value = binary.LittleEndian.Uint64(mem)
+	}
+	inst.push(value)
+}
+
+// numeric 执行整数比较、运算与类型转换指令
+func (inst *Instance) numeric(op byte) {
+	switch {
+	case op == opI32Eqz:
+		inst.push(boolValue(uint32(inst.pop()) == 0))
+	case op == opI64Eqz:
+		inst.push(boolValue(inst.pop() == 0))
+	case op == opI32WrapI64 || op == opI64ExtendU:
+		inst.push(uint64(uint32(inst.pop())))
+	case op == opI64ExtendS:
+		inst.push(uint64(int64(int32(uint32(inst.pop())))))
+	case op >= opI32Clz && op <= 0x69:
+		v := uint32(inst.pop())
+		inst.push(uint64(i32Unary(op, v)))
+	case op >= opI64Clz && op <= 0x7b:
+		inst.push(i64Unary(op, inst.pop()))
+	case op > opI32Eqz && op <= opI32GeU:
+		b, a := uint32(inst.pop()), uint32(inst.pop())
+		inst.push(boolValue(i32Compare(op, a, b)))
+	case op > opI64Eqz && op <= opI64GeU:
+		b, a := inst.pop(), inst.pop()
+		inst.push(boolValue(i64Compare(op, a, b)))
+	case op > 0x69 && op <= opI32Rotr:
+		b, a := uint32(inst.pop()), uint32(inst.pop())
+		inst.push(uint64(i32Binary(op, a, b)))
+	case op > 0x7b && op <= opI64Rotr:
+		b, a := inst.pop(), inst.pop()
+		inst.push(i64Binary(op, a, b))
+	default:
+		fail(fmt.Errorf("%w: opcode (0x%02x)", ErrUnsupported, op))
+	}
+}
+
+func boolValue(b bool) uint64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+func i32Unary(op byte, v uint32) uint32 {
+	switch op {
+	case 0x67:
+		return uint32(bits.LeadingZeros32(v))
+	case 0x68:
+		return uint32(bits.TrailingZeros32(v))
+	default:
+		return uint32(bits.OnesCount32(v))
+	}
+}
+
+func i64Unary(op byte, v uint64) uint64 {
+	switch op {
+	case 0x79:
+		return uint64(bits.LeadingZeros64(v))
+	case 0x7a:
+		return uint64(bits.TrailingZeros64(v))
+	default:
+		return uint64(bits.OnesCount64(v))
+	}
+}
+
+func i32Compare(op byte, a, b uint32) bool {
+	switch op {
+	case 0x46:
+		return a == b
+	case 0x47:
+		return a != b
+	case 0x48:
+		return int32(a) < int32(b)
+	case 0x49:
+		return a < b
+	case 0x4a:
+		return int32(a) > int32(b)
+	case 0x4b:
+		return a > b
+	case 0x4c:
+		return int32(a) <= int32(b)
+	case 0x4d:
+		return a <= b
+	case 0x4e:
+		return int32(a) >= int32(b)
+	default:
+		return a >= b
+	}
+}
+
+func i64Compare(op byte, a, b uint64) bool {
+	switch op {
+	case 0x51:
+		return a == b
+	case 0x52:
+		return a != b
+	case 0x53:
+		return int64(a) < int64(b)
+	case 0x54:
+		return a < b
+	case 0x55:
+		return int64(a) > int64(b)
+	case 0x56:
+		return a > b
+	case 0x57:
+		return int64(a) <= int64(b)
+	case 0x58:
+		return a <= b
+	case 0x59:
+		return int64(a) >= int64(b)
+	default:
+		return a >= b
+	}
+}
+
+func i32Binary(op byte, a, b uint32) uint32 {
+	switch op {
+	case 0x6a:
+		return a + b
+	case 0x6b:
+		return a - b
+	case 0x6c:
+		return a * b
+	case 0x6d:
+		if b == 0 {
+			fail(ErrDivideByZero)
+		}
+		if int32(a) == math.MinInt32 && int32(b) == -1 {
+			fail(ErrIntegerOverflow)
+		}
+		return uint32(int32(a) / int32(b))
+	case 0x6e:
+		if b == 0 {
+			fail(ErrDivideByZero)
+		}
+		return a / b
+	case 0x6f:
+		if b == 0 {
+			fail(ErrDivideByZero)
+		}
+		if int32(b) == -1 {
+			return 0
+		}
+		return uint32(int32(a) % int32(b))
+	case 0x70:
+		if b == 0 {
+			fail(ErrDivideByZero)
+		}
+		return a % b
+	case 0x71:
+		return a & b
+	case 0x72:
+		return a | b
+	case 0x73:
+		return a ^ b
+	case 0x74:
+		return a << (b % 32)
+	case 0x75:
+		return uint32(int32(a) >> (b % 32))
+	case 0x76:
+		return a >> (b % 32)
+	case 0x77:
+		return bits.RotateLeft32(a, int(b%32))
+	default:
+		return bits.RotateLeft32(a, -int(b%32))
+	}
+}
+
+func i64Binary(op byte, a, b uint64) uint64 {
+	switch op {
+	case 0x7c:
+		return a + b
+	case 0x7d:
+		return a - b
+	case 0x7e:
+		return a * b
+	case 0x7f:
+		if b == 0 {
+			fail(ErrDivideByZero)
+		}
+		if int64(a) == math.MinInt64 && int64(b) == -1 {
+			fail(ErrIntegerOverflow)
+		}
+		return uint64(int64(a) / int64(b))
+	case 0x80:
+		if b == 0 {
+			fail(ErrDivideByZero)
+		}
+		return a / b
+	case 0x81:
+		if b == 0 {
+			fail(ErrDivideByZero)
+		}
+		if int64(b) == -1 {
+			return 0
+		}
+		return uint64(int64(a) % int64(b))
+	case 0x82:
+		if b == 0 {
+			fail(ErrDivideByZero)
+		}
+		return a % b
+	case 0x83:
+		return a & b
+	case 0x84:
+		return a | b
+	case 0x85:
+		return a ^ b
+	case 0x86:
+		return a << (b % 64)
+	case 0x87:
+		return uint64(int64(a) >> (b % 64))
+	case 0x88:
+		return a >> (b % 64)
+	case 0x89:
+		return bits.RotateLeft64(a, int(b%64))
+	default:
+		return bits.RotateLeft64(a, -int(b%64))
+	}
+}
@@ -0,0 +1,496 @@
+// Package wasm 实现了一个纯 Go 的 WebAssembly 解释器，用作 TitanChain 的第二种合约运行时
+// 只支持合约需要的子集：i32/i64 整数指令、线性内存、全局变量与从 "env" 模块导入的宿主函数，
+// 不支持浮点数、表与间接调用
+package wasm
+
+import (
+	"errors"
+	"fmt"
+)
+
+// magic 与 version 是 WASM 二进制模块的文件头
+var (
+	magic   = []byte{0x00, 0x61, 0x73, 0x6d}
+	version = []byte{0x01, 0x00, 0x00, 0x00}
+)
+
+var (
+	// ErrInvalidModule 表示模块的二进制编码不合法
+	ErrInvalidModule = errors.New("invalid wasm module")
+	// ErrUnsupported 表示模块使用了解释器不支持的特性
+	ErrUnsupported = errors.New("unsupported wasm feature")
+)
+
+// ValueType 表示 WASM 值类型
+type ValueType byte
+
+const (
+	// I32 表示 32 位整数
+	I32 ValueType = 0x7f
+	// I64 表示 64 位整数
+	I64 ValueType = 0x7e
+)
+
+func (t ValueType) String() string {
+	switch t {
+	case I32:
+		return "i32"
+	case I64:
+		return "i64"
+	default:
+		return fmt.Sprintf("0x%02x", byte(t))
+	}
+}
+
+// 段 ID
+const (
+	sectionCustom   byte = 0
+	sectionType     byte = 1
+	sectionImport   byte = 2
+	sectionFunction byte = 3
+	sectionTable    byte = 4
+	sectionMemory   byte = 5
+	sectionGlobal   byte = 6
+	sectionExport   byte = 7
+	sectionStart    byte = 8
+	sectionElement  byte = 9
+	sectionCode     byte = 10
+	sectionData     byte = 11
+)
+
+// 导入与导出的类型
+const (
+	// ExternFunc 表示函数
+	ExternFunc byte = 0x00
+	// ExternMemory 表示线性内存
+	ExternMemory byte = 0x02
+	// ExternGlobal 表示全局变量
+	ExternGlobal byte = 0x03
+)
+
+// FuncType 表示函数签名
+type FuncType struct {
+	Params  []ValueType
+	Results []ValueType
+}
+
+// Equal 判断两个函数签名是否相同
+func (t FuncType) Equal(o FuncType) bool {
+	if len(t.Params) != len(o.Params) || len(t.Results) != len(o.Results) {
+		return false
+	}
+	for i := range t.Params {
+		if t.Params[i] != o.Params[i] {
+			return false
+		}
+	}
+	for i := range t.Results {
+		if t.Results[i] != o.Results[i] {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (t FuncType) String() string {
+	return fmt.Sprintf("%v -> %v", t.Params, t.Results)
+}
+
+// Import 表示一个导入的函数，只支持函数导入
+type Import struct {
+	Module string
+	Name   string
+	Type   uint32 // 函数签名在类型段中的索引
+}
+
+// Export 表示一个导出项
+type Export struct {
+	Name  string
+	Kind  byte // ExternFunc、ExternMemory 或 ExternGlobal
+	Index uint32
+}
+
+// Limits 表示线性内存的页数范围，每页 64KiB
+type Limits struct {
+	Min    uint32
+	Max    uint32
+	HasMax bool
+}
+
+// Global 表示一个全局变量，初始值只能是常量
+type Global struct {
+	Type    ValueType
+	Mutable bool
+	Init    uint64
+}
+
+// Code 表示一个函数的局部变量与函数体
+type Code struct {
+	Locals []ValueType // 除参数外的局部变量
+	Body   []byte      // 函数体指令，以 end 结尾
+}
+
+// DataSegment 表示在实例化时写入线性内存的数据
+type DataSegment struct {
+	Offset uint32
+	Data   []byte
+}
+
+// Module 表示解码后的 WASM 模块
+// 函数索引空间中导入函数在前，模块内定义的函数在后
+type Module struct {
+	Types   []FuncType
+	Imports []Import
+	Funcs   []uint32 // 模块内定义的函数的签名索引
+	Memory  *Limits
+	Globals []Global
+	Exports []Export
+	Start   *uint32
+	Codes   []Code
+	Data    []DataSegment
+}
+
+// IsWASM 判断字节码是否以 WASM 模块文件头开始
+func IsWASM(b []byte) bool {
+	return len(b) >= len(magic) && string(b[:len(magic)]) == string(magic)
+}
+
+// FuncType 返回函数索引对应的函数签名
+func (m *Module) FuncType(idx uint32) (FuncType, error) {
+	var typeIdx uint32
+	switch {
+	case idx < uint32(len(m.Imports)):
+		typeIdx = m.Imports[idx].Type
+	case idx-uint32(len(m.Imports)) < uint32(len(m.Funcs)):
+		typeIdx = m.Funcs[idx-uint32(len(m.Imports))]
+	default:
+		return FuncType{}, fmt.Errorf("%w: function index (%d) out of range", ErrInvalidModule, idx)
+	}
+
+	if typeIdx >= uint32(len(m.Types)) {
+		return FuncType{}, fmt.Errorf("%w: type index (%d) out of range", ErrInvalidModule, typeIdx)
+	}
+
+	return m.Types[typeIdx], nil
+}
+
+// ExportedFunc 返回导出函数的函数索引
+func (m *Module) ExportedFunc(name string) (uint32, bool) {
+	for _, e := range m.Exports {
+		if e.Kind == ExternFunc && e.Name == name {
+			return e.Index, true
+		}
+	}
+
+	return 0, false
+}
+
+// Decode 解码 WASM 二进制模块并检查函数体中的指令
+// 使用了不支持的段或指令时返回 ErrUnsupported
+func Decode(b []byte) (*Module, error) {
+	if !IsWASM(b) || len(b) < 8 || string(b[4:8]) != string(version) {
+		return nil, fmt.Errorf("%w: bad header", ErrInvalidModule)
+	}
+
+	m := &Module{}
+	r := &reader{b: b, pos: 8}
+	last := byte(0)
+
+	for r.len() > 0 {
+		id, err := r.byte()
+		if err != nil {
+			return nil, err
+		}
+		size, err := r.u32()
+		if err != nil {
+			return nil, err
+		}
+		payload, err := r.bytes(int(size))
+		if err != nil {
+			return nil, err
+		}
+
+		if id != sectionCustom {
+			if id <= last {
+				return nil, fmt.Errorf("%w: section (%d) out of order", ErrInvalidModule, id)
+			}
+			last = id
+		}
+
+		sr := &reader{b: payload}
+		if err := m.decodeSection(id, sr); err != nil {
+			return nil, err
+		}
+		if sr.len() != 0 {
+			return nil, fmt.Errorf("%w: section (%d) has trailing bytes", ErrInvalidModule, id)
+		}
+	}
+
+	if len(m.Funcs) != len(m.Codes) {
+		return nil, fmt.Errorf("%w: function and code section sizes differ", ErrInvalidModule)
+	}
+
+	if err := m.validate(); err != nil {
+		return nil, err
+	}
+
+	return m, nil
+}
+
+// decodeSection 解码一个段的内容
+func (m *Module) decodeSection(id byte, r *reader) error {
+	switch id {
+	case sectionCustom:
+		r.pos = len(r.b)
+		return nil
+
+	case sectionType:
+		return r.vec(func() error {
+			form, err := r.byte()
+			if err != nil {
+				return err
+			}
+			if form != 0x60 {
+				return fmt.Errorf("%w: bad function type form (0x%02x)", ErrInvalidModule, form)
+			}
+			params, err := r.valueTypes()
+			if err != nil {
+				return err
+			}
+			results, err := r.valueTypes()
+			if err != nil {
+				return err
+			}
+			if len(results) > 1 {
+				return fmt.Errorf("%w: multiple results", ErrUnsupported)
+			}
+			m.Types = append(m.Types, FuncType{Params: params, Results: results})
+			return nil
+		})
+
+	case sectionImport:
+		return r.vec(func() error {
+			mod, err := r.name()
+			if err != nil {
+				return err
+			}
+			name, err := r.name()
+			if err != nil {
+				return err
+			}
+			kind, err := r.byte()
+			if err != nil {
+				return err
+			}
+			if kind != ExternFunc {
+				return fmt.Errorf("%w: import of kind (%d)", ErrUnsupported, kind)
+			}
+			typeIdx, err := r.u32()
+			if err != nil {
+				return err
+			}
+			m.Imports = append(m.Imports, Import{Module: mod, Name: name, Type: typeIdx})
+			return nil
+		})
+
+	case sectionFunction:
+		return r.vec(func() error {
+			typeIdx, err := r.u32()
+			if err != nil {
+				return err
+			}
+			m.Funcs = append(m.Funcs, typeIdx)
+			return nil
+		})
+
+	case sectionMemory:
+		return r.vec(func() error {
+			if m.Memory != nil {
+				return fmt.Errorf("%w: multiple memories", ErrUnsupported)
+			}
+			limits, err := r.limits()
+			if err != nil {
+				return err
+			}
+			m.Memory = limits
+			return nil
+		})
+
+	case sectionGlobal:
+		return r.vec(func() error {
+			t, err := r.valueType()
+			if err != nil {
+				return err
+			}
+			mut, err := r.byte()
+			if err != nil {
+				return err
+			}
+			init, err := r.constExpr(t)
+			if err != nil {
+				return err
+			}
+			m.Globals = append(m.Globals, Global{Type: t, Mutable: mut == 1, Init: init})
+			return nil
+		})
+
+	case sectionExport:
+		return r.vec(func() error {
+			name, err := r.name()
+			if err != nil {
+				return err
+			}
+			kind, err := r.byte()
+			if err != nil {
+				return err
+			}
+			if kind != ExternFunc && kind != ExternMemory && kind != ExternGlobal {
+				return fmt.Errorf("%w: export of kind (%d)", ErrUnsupported, kind)
+			}
+			idx, err := r.u32()
+			if err != nil {
+				return err
+			}
+			m.Exports = append(m.Exports, Export{Name: name, Kind: kind, Index: idx})
+			return nil
+		})
+
+	case sectionStart:
+		idx, err := r.u32()
+		if err != nil {
+			return err
+		}
+		m.Start = &idx
+		return nil
+
+	case sectionCode:
+		return r.vec(func() error {
+			size, err := r.u32()
+			if err != nil {
+				return err
+			}
+			body, err := r.bytes(int(size))
+			if err != nil {
+				return err
+			}
+			code, err := decodeCode(body)
+			if err != nil {
+				return err
+			}
+			m.Codes = append(m.Codes, code)
+			return nil
+		})
+
+	case sectionData:
+		return r.vec(func() error {
+			flags, err := r.u32()
+			if err != nil {
+				return err
+			}
+			if flags != 0 {
+				return fmt.Errorf("%w: data segment flags (%d)", ErrUnsupported, flags)
+			}
+			offset, err := r.constExpr(I32)
+			if err != nil {
+				return err
+			}
+			n, err := r.u32()
+			if err != nil {
+				return err
+			}
+			data, err := r.bytes(int(n))
+			if err != nil {
+				return err
+			}
+			m.Data = append(m.Data, DataSegment{Offset: uint32(offset), Data: data})
+			return nil
+		})
+
+	case sectionTable, sectionElement:
+		return fmt.Errorf("%w: tables", ErrUnsupported)
+
+	default:
+		return fmt.Errorf("%w: unknown section (%d)", ErrInvalidModule, id)
+	}
+}
+
+// decodeCode 解码函数体：局部变量声明与指令
+func decodeCode(body []byte) (Code, error) {
+	r := &reader{b: body}
+	var code Code
+
+	err := r.vec(func() error {
+		n, err := r.u32()
+		if err != nil {
+			return err
+		}
+		t, err := r.valueType()
+		if err != nil {
+			return err
+		}
+		if n > maxLocals || len(code.Locals)+int(n) > maxLocals {
+			return fmt.Errorf("%w: too many locals", ErrUnsupported)
+		}
+		for i := uint32(0); i < n; i++ {
+			code.Locals = append(code.Locals, t)
+		}
+		return nil
+	})
+	if err != nil {
+		return Code{}, err
+	}
+
+	code.Body = body[r.pos:]
+	if len(code.Body) == 0 || code.Body[len(code.Body)-1] != opEnd {
+		return Code{}, fmt.Errorf("%w: function body does not end with end", ErrInvalidModule)
+	}
+
+	return code, nil
+}
+
+// validate 检查索引范围与函数体指令
+func (m *Module) validate() error {
+	for _, imp := range m.Imports {
+		if imp.Type >= uint32(len(m.Types)) {
+			return fmt.Errorf("%w: import (%s.%s) has bad type index", ErrInvalidModule, imp.Module, imp.Name)
+		}
+	}
+	for _, t := range m.Funcs {
+		if t >= uint32(len(m.Types)) {
+			return fmt.Errorf("%w: function has bad type index (%d)", ErrInvalidModule, t)
+		}
+	}
+
+	numFuncs := uint32(len(m.Imports) + len(m.Funcs))
+	for _, e := range m.Exports {
+		switch e.Kind {
+		case ExternFunc:
+			if e.Index >= numFuncs {
+				return fmt.Errorf("%w: export (%s) has bad function index", ErrInvalidModule, e.Name)
+			}
+		case ExternMemory:
+			if m.Memory == nil || e.Index != 0 {
+				return fmt.Errorf("%w: export (%s) has bad memory index", ErrInvalidModule, e.Name)
+			}
+		case ExternGlobal:
+			if e.Index >= uint32(len(m.Globals)) {
+				return fmt.Errorf("%w: export (%s) has bad global index", ErrInvalidModule, e.Name)
+			}
+		}
+	}
+	if m.Start != nil && *m.Start >= numFuncs {
+		return fmt.Errorf("%w: bad start function index", ErrInvalidModule)
+	}
+	if len(m.Data) > 0 && m.Memory == nil {
+		return fmt.Errorf("%w: data segment without memory", ErrInvalidModule)
+	}
+
+	for i := range m.Codes {
+		if _, err := compileFunc(m, i); err != nil {
+			return fmt.Errorf("function %d: %w", len(m.Imports)+i, err)
+		}
+	}
+
+	return nil
+}
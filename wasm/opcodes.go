@@ -0,0 +1,276 @@
+package wasm
+
+import "fmt"
+
+// 支持的操作码
+const (
+	opUnreachable  byte = 0x00
+	opNop          byte = 0x01
+	opBlock        byte = 0x02
+	opLoop         byte = 0x03
+	opIf           byte = 0x04
+	opElse         byte = 0x05
+	opEnd          byte = 0x0b
+	opBr           byte = 0x0c
+	opBrIf         byte = 0x0d
+	opBrTable      byte = 0x0e
+	opReturn       byte = 0x0f
+	opCall         byte = 0x10
+	opDrop         byte = 0x1a
+	opSelect       byte = 0x1b
+	opLocalGet     byte = 0x20
+	opLocalSet     byte = 0x21
+	opLocalTee     byte = 0x22
+	opGlobalGet    byte = 0x23
+	opGlobalSet    byte = 0x24
+	opI32Load      byte = 0x28
+	opI64Load      byte = 0x29
+	opI32Load8S    byte = 0x2c
+	opI32Load8U    byte = 0x2d
+	opI32Load16S   byte = 0x2e
+	opI32Load16U   byte = 0x2f
+	opI64Load8S    byte = 0x30
+	opI64Load8U    byte = 0x31
+	opI64Load16S   byte = 0x32
+	opI64Load16U   byte = 0x33
+	opI64Load32S   byte = 0x34
+	opI64Load32U   byte = 0x35
+	opI32Store     byte = 0x36
+	opI64Store     byte = 0x37
+	opI32Store8    byte = 0x3a
+	opI32Store16   byte = 0x3b
+	opI64Store8    byte = 0x3c
+	opI64Store16   byte = 0x3d
+	opI64Store32   byte = 0x3e
+	opMemorySize   byte = 0x3f
+	opMemoryGrow   byte = 0x40
+	opI32Const     byte = 0x41
+	opI64Const     byte = 0x42
+	opI32Eqz       byte = 0x45
+	opI32GeU       byte = 0x4f
+	opI64Eqz       byte = 0x50
+	opI64GeU       byte = 0x5a
+	opI32Clz       byte = 0x67
+	opI32Rotr      byte = 0x78
+	opI64Clz       byte = 0x79
+	opI64Rotr      byte = 0x8a
+	opI32WrapI64   byte = 0xa7
+	opI64ExtendS   byte = 0xac
+	opI64ExtendU   byte = 0xad
+	blockTypeEmpty byte = 0x40
+)
+
+// instr 是预先解码的一条指令
+type instr struct {
+	op     byte
+	imm    uint64    // 索引、常量、内存偏移量或块的结果个数
+	result ValueType // block、loop 与 if 的结果类型，没有结果时为 0
+	table  []uint32  // br_table 的跳转表，最后一项为默认目标
+	pos    int       // 指令在函数体中的字节位置
+	end    int       // block、loop、if 与 else 对应的 end 的指令下标
+	els    int       // if 对应的 else 的指令下标，没有 else 时为 -1
+}
+
+// isNumeric 判断操作码是否为没有立即数的整数运算指令
+func isNumeric(op byte) bool {
+	return (op >= opI32Eqz && op <= opI64GeU) ||
+		(op >= opI32Clz && op <= opI64Rotr) ||
+		op == opI32WrapI64 || op == opI64ExtendS || op == opI64ExtendU
+}
+
+// isMemory 判断操作码是否为访问线性内存的指令
+func isMemory(op byte) bool {
+	return (op >= opI32Load && op <= opI64Load) ||
+		(op >= opI32Load8S && op <= opI64Store) ||
+		(op >= opI32Store8 && op <= opMemoryGrow)
+}
+
+// decodeInstr 从 r 中解码一条指令及其立即数
+func decodeInstr(r *reader) (instr, error) {
+	in := instr{pos: r.pos, els: -1}
+
+	op, err := r.byte()
+	if err != nil {
+		return in, err
+	}
+	in.op = op
+
+	switch {
+	case op == opBlock || op == opLoop || op == opIf:
+		bt, err := r.byte()
+		if err != nil {
+			return in, err
+		}
+		switch bt {
+		case blockTypeEmpty:
+		case byte(I32), byte(I64):
+			in.imm = 1
+			in.result = ValueType(bt)
+		default:
+			return in, fmt.Errorf("%w: block type (0x%02x)", ErrUnsupported, bt)
+		}
+
+	case op == opBr || op == opBrIf || op == opCall ||
+		(op >= opLocalGet && op <= opGlobalSet):
+		v, err := r.u32()
+		if err != nil {
+			return in, err
+		}
+		in.imm = uint64(v)
+
+	case op == opBrTable:
+		err := r.vec(func() error {
+			v, err := r.u32()
+			in.table = append(in.table, v)
+			return err
+		})
+		if err != nil {
+			return in, err
+		}
+		v, err := r.u32()
+		if err != nil {
+			return in, err
+		}
+		in.table = append(in.table, v)
+
+	case op == opMemorySize || op == opMemoryGrow:
+		if b, err := r.byte(); err != nil || b != 0 {
+			return in, fmt.Errorf("%w: bad memory index", ErrInvalidModule)
+		}
+
+	case isMemory(op):
+		// 对齐提示只影响性能，忽略
+		if _, err := r.u32(); err != nil {
+			return in, err
+		}
+		v, err := r.u32()
+		if err != nil {
+			return in, err
+		}
+		in.imm = uint64(v)
+
+	case op == opI32Const:
+		v, err := r.s32()
+		if err != nil {
+			return in, err
+		}
+		in.imm = uint64(uint32(v))
+
+	case op == opI64Const:
+		v, err := r.s64()
+		if err != nil {
+			return in, err
+		}
+		in.imm = uint64(v)
+
+	case op == opUnreachable || op == opNop || op == opElse || op == opEnd ||
+		op == opReturn || op == opDrop || op == opSelect || isNumeric(op):
+
+	default:
+		return in, fmt.Errorf("%w: opcode (0x%02x)", ErrUnsupported, op)
+	}
+
+	return in, nil
+}
+
+// compileFunc 解码模块内定义的第 i 个函数的函数体，匹配块结构并检查索引，
+// 然后由 validateFunc 检查操作数类型与栈高度
+func compileFunc(m *Module, i int) ([]instr, error) {
+	t := m.Types[m.Funcs[i]]
+	numLocals := uint64(len(t.Params) + len(m.Codes[i].Locals))
+	numFuncs := uint64(len(m.Imports) + len(m.Funcs))
+
+	var (
+		code  []instr
+		open  []int // 尚未结束的块的指令下标，-1 表示函数体本身
+		r     = &reader{b: m.Codes[i].Body}
+		ended bool
+	)
+	open = append(open, -1)
+
+	for r.len() > 0 {
+		if ended {
+			return nil, fmt.Errorf("%w: code after function end", ErrInvalidModule)
+		}
+
+		in, err := decodeInstr(r)
+		if err != nil {
+			return nil, err
+		}
+		idx := len(code)
+
+		switch op := in.op; {
+		case op == opBlock || op == opLoop || op == opIf:
+			open = append(open, idx)
+
+		case op == opElse:
+			top := open[len(open)-1]
+			if top < 0 || code[top].op != opIf || code[top].els >= 0 {
+				return nil, fmt.Errorf("%w: else without if", ErrInvalidModule)
+			}
+			code[top].els = idx
+			open = append(open, idx)
+
+		case op == opEnd:
+			top := open[len(open)-1]
+			open = open[:len(open)-1]
+			if top >= 0 && code[top].op == opElse {
+				code[top].end = idx
+				top = open[len(open)-1]
+				open = open[:len(open)-1]
+			}
+			if top >= 0 {
+				code[top].end = idx
+			}
+			ended = len(open) == 0
+
+		case op == opBr || op == opBrIf:
+			if in.imm >= uint64(len(open)) {
+				return nil, fmt.Errorf("%w: branch depth (%d) out of range", ErrInvalidModule, in.imm)
+			}
+
+		case op == opBrTable:
+			for _, d := range in.table {
+				if uint64(d) >= uint64(len(open)) {
+					return nil, fmt.Errorf("%w: branch depth (%d) out of range", ErrInvalidModule, d)
+				}
+			}
+
+		case op == opCall:
+			if in.imm >= numFuncs {
+				return nil, fmt.Errorf("%w: function index (%d) out of range", ErrInvalidModule, in.imm)
+			}
+
+		case op >= opLocalGet && op <= opLocalTee:
+			if in.imm >= numLocals {
+				return nil, fmt.Errorf("%w: local index (%d) out of range", ErrInvalidModule, in.imm)
+			}
+
+		case op == opGlobalGet || op == opGlobalSet:
+			if in.imm >= uint64(len(m.Globals)) {
+				return nil, fmt.Errorf("%w: global index (%d) out of range", ErrInvalidModule, in.imm)
+			}
+			if op == opGlobalSet && !m.Globals[in.imm].Mutable {
+				return nil, fmt.Errorf("%w: global (%d) is immutable", ErrInvalidModule, in.imm)
+			}
+
+		case isMemory(op):
+			if m.Memory == nil {
+				return nil, fmt.Errorf("%w: memory access without memory", ErrInvalidModule)
+			}
+		}
+
+		code = append(code, in)
+	}
+
+	if !ended {
+		return nil, fmt.Errorf("%w: function body not terminated", ErrInvalidModule)
+	}
+
+	locals := append(append([]ValueType{}, t.Params...), m.Codes[i].Locals...)
+	if err := validateFunc(m, t, locals, code); err != nil {
+		return nil, err
+	}
+
+	return code, nil
+}
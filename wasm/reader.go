@@ -0,0 +1,219 @@
+package wasm
+
+import (
+	"fmt"
+	"unicode/utf8"
+)
+
+// reader 按 WASM 二进制格式读取字节序列
+type reader struct {
+	b   []byte
+	pos int
+}
+
+// len 返回剩余未读的字节数
+func (r *reader) len() int {
+	return len(r.b) - r.pos
+}
+
+func (r *reader) byte() (byte, error) {
+	if r.pos >= len(r.b) {
+		return 0, fmt.Errorf("%w: unexpected end", ErrInvalidModule)
+	}
+	b := r.b[r.pos]
+	r.pos++
+
+	return b, nil
+}
+
+func (r *reader) bytes(n int) ([]byte, error) {
+	if n < 0 || n > r.len() {
+		return nil, fmt.Errorf("%w: unexpected end", ErrInvalidModule)
+	}
+	b := r.b[r.pos : r.pos+n]
+	r.pos += n
+
+	return b, nil
+}
+
+// uleb 读取最多 bits 位的无符号 LEB128 整数
+func (r *reader) uleb(bits uint) (uint64, error) {
+	var (
+		v     uint64
+		shift uint
+	)
+	for {
+		b, err := r.byte()
+		if err != nil {
+			return 0, err
+		}
+		if shift >= bits || (shift+7 > bits && uint64(b&0x7f)>>(bits-shift) != 0) {
+			return 0, fmt.Errorf("%w: integer too large", ErrInvalidModule)
+		}
+		v |= uint64(b&0x7f) << shift
+		shift += 7
+		if b&0x80 == 0 {
+			return v, nil
+		}
+	}
+}
+
+// sleb 读取最多 bits 位的有符号 LEB128 整数
+func (r *reader) sleb(bits uint) (int64, error) {
+	var (
+		v     int64
+		shift uint
+		b     byte
+		err   error
+	)
+	for {
+		b, err = r.byte()
+		if err != nil {
+			return 0, err
+		}
+		if shift >= bits {
+			return 0, fmt.Errorf("%w: integer too large", ErrInvalidModule)
+		}
+		v |= int64(b&0x7f) << shift
+		shift += 7
+		if b&0x80 == 0 {
+			break
+		}
+	}
+	if shift < 64 && b&0x40 != 0 {
+		v |= -1 << shift
+	}
+
+	return v, nil
+}
+
+func (r *reader) u32() (uint32, error) {
+	v, err := r.uleb(32)
+	return uint32(v), err
+}
+
+func (r *reader) s32() (int32, error) {
+	v, err := r.sleb(32)
+	return int32(v), err
+}
+
+func (r *reader) s64() (int64, error) {
+	return r.sleb(64)
+}
+
+// name 读取以长度为前缀的 UTF-8 字符串
+func (r *reader) name() (string, error) {
+	n, err := r.u32()
+	if err != nil {
+		return "", err
+	}
+	b, err := r.bytes(int(n))
+	if err != nil {
+		return "", err
+	}
+	if !utf8.Valid(b) {
+		return "", fmt.Errorf("%w: invalid utf-8 name", ErrInvalidModule)
+	}
+
+	return string(b), nil
+}
+
+// vec 读取元素个数，并对每个元素调用 fn
+func (r *reader) vec(fn func() error) error {
+	n, err := r.u32()
+	if err != nil {
+		return err
+	}
+	for i := uint32(0); i < n; i++ {
+		if err := fn(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (r *reader) valueType() (ValueType, error) {
+	b, err := r.byte()
+	if err != nil {
+		return 0, err
+	}
+	switch t := ValueType(b); t {
+	case I32, I64:
+		return t, nil
+	default:
+		return 0, fmt.Errorf("%w: value type (0x%02x)", ErrUnsupported, b)
+	}
+}
+
+func (r *reader) valueTypes() ([]ValueType, error) {
+	var types []ValueType
+	err := r.vec(func() error {
+		t, err := r.valueType()
+		if err != nil {
+			return err
+		}
+		types = append(types, t)
+		return nil
+	})
+
+	return types, err
+}
+
+func (r *reader) limits() (*Limits, error) {
+	flag, err := r.byte()
+	if err != nil {
+		return nil, err
+	}
+	if flag > 1 {
+		return nil, fmt.Errorf("%w: limits flag (%d)", ErrUnsupported, flag)
+	}
+	min, err := r.u32()
+	if err != nil {
+		return nil, err
+	}
+	l := &Limits{Min: min}
+	if flag == 1 {
+		if l.Max, err = r.u32(); err != nil {
+			return nil, err
+		}
+		if l.Max < l.Min {
+			return nil, fmt.Errorf("%w: memory max below min", ErrInvalidModule)
+		}
+		l.HasMax = true
+	}
+
+	return l, nil
+}
+
+// constExpr 读取由单条常量指令与 end 组成的初始化表达式
+func (r *reader) constExpr(t ValueType) (uint64, error) {
+	op, err := r.byte()
+	if err != nil {
+		return 0, err
+	}
+
+	var v uint64
+	switch {
+	case op == opI32Const && t == I32:
+		n, err := r.s32()
+		if err != nil {
+			return 0, err
+		}
+		v = uint64(uint32(n))
+	case op == opI64Const && t == I64:
+		n, err := r.s64()
+		if err != nil {
+			return 0, err
+		}
+		v = uint64(n)
+	default:
+		return 0, fmt.Errorf("%w: constant expression (0x%02x)", ErrUnsupported, op)
+	}
+
+	if end, err := r.byte(); err != nil || end != opEnd {
+		return 0, fmt.Errorf("%w: constant expression not terminated", ErrInvalidModule)
+	}
+
+	return v, nil
+}
@@ -0,0 +1,341 @@
+package wasm
+
+import "fmt"
+
+// unknownType 表示不可达代码中类型任意的操作数
+const unknownType ValueType = 0
+
+// ctrlFrame 是类型检查时控制栈中的一个块
+type ctrlFrame struct {
+	op          byte
+	results     []ValueType // 块结束时的结果类型
+	height      int         // 进入块时操作数栈的高度
+	unreachable bool        // 块中其余的指令是否不可达
+}
+
+// labelTypes 返回跳转到该块时需要的操作数类型，跳转到 loop 回到块的开头，不带操作数
+func (f *ctrlFrame) labelTypes() []ValueType {
+	if f.op == opLoop {
+		return nil
+	}
+
+	return f.results
+}
+
+// funcValidator 按规范附录中的验证算法检查函数体的操作数类型与栈高度
+type funcValidator struct {
+	vals  []ValueType
+	ctrls []ctrlFrame
+}
+
+func (v *funcValidator) push(t ValueType) {
+	v.vals = append(v.vals, t)
+}
+
+func (v *funcValidator) pushVals(ts []ValueType) {
+	v.vals = append(v.vals, ts...)
+}
+
+// pop 弹出一个操作数，不能弹出当前块入口以下的值；块的其余部分不可达时返回 unknownType
+func (v *funcValidator) pop() (ValueType, error) {
+	f := &v.ctrls[len(v.ctrls)-1]
+	if len(v.vals) == f.height {
+		if f.unreachable {
+			return unknownType, nil
+		}
+		return 0, fmt.Errorf("%w: operand stack underflow", ErrInvalidModule)
+	}
+	t := v.vals[len(v.vals)-1]
+	v.vals = v.vals[:len(v.vals)-1]
+
+	return t, nil
+}
+
+// popExpect 弹出一个类型为 want 的操作数，want 为 unknownType 时接受任意类型
+func (v *funcValidator) popExpect(want ValueType) (ValueType, error) {
+	t, err := v.pop()
+	if err != nil {
+		return 0, err
+	}
+	if t == unknownType {
+		return want, nil
+	}
+	if want != unknownType && t != want {
+		return 0, fmt.Errorf("%w: type mismatch: expected %s, got %s", ErrInvalidModule, want, t)
+	}
+
+	return t, nil
+}
+
+// popVals 按逆序弹出类型依次为 ts 的操作数
+func (v *funcValidator) popVals(ts []ValueType) error {
+	for i := len(ts) - 1; i >= 0; i-- {
+		if _, err := v.popExpect(ts[i]); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (v *funcValidator) pushCtrl(op byte, results []ValueType) {
+	v.ctrls = append(v.ctrls, ctrlFrame{op: op, results: results, height: len(v.vals)})
+}
+
+// popCtrl 结束当前块，块结束时操作数栈上须恰好是块的结果
+func (v *funcValidator) popCtrl() (ctrlFrame, error) {
+	f := v.ctrls[len(v.ctrls)-1]
+	if err := v.popVals(f.results); err != nil {
+		return f, err
+	}
+	if len(v.vals) != f.height {
+		return f, fmt.Errorf("%w: %d extra values on operand stack at block end", ErrInvalidModule, len(v.vals)-f.height)
+	}
+	v.ctrls = v.ctrls[:len(v.ctrls)-1]
+
+	return f, nil
+}
+
+// setUnreachable 丢弃当前块中的操作数，块的其余部分不可达
+func (v *funcValidator) setUnreachable() {
+	f := &v.ctrls[len(v.ctrls)-1]
+	v.vals = v.vals[:f.height]
+	f.unreachable = true
+}
+
+// validateFunc 检查预先解码的函数体中每条指令的操作数类型，以及块结束、跳转与返回时的栈高度
+// 块结构与索引范围已由 compileFunc 检查；通过检查的函数在运行时不会发生操作数栈下溢
+func validateFunc(m *Module, t FuncType, locals []ValueType, code []instr) error {
+	v := &funcValidator{}
+	v.pushCtrl(opBlock, t.Results)
+
+	for pc, in := range code {
+		if err := v.step(m, t, locals, in); err != nil {
+			return fmt.Errorf("instruction %d (0x%02x): %w", pc, in.op, err)
+		}
+	}
+
+	return nil
+}
+
+// step 检查一条指令
+func (v *funcValidator) step(m *Module, t FuncType, locals []ValueType, in instr) error {
+	switch op := in.op; {
+	case op == opUnreachable:
+		v.setUnreachable()
+
+	case op == opNop:
+
+	case op == opBlock || op == opLoop:
+		v.pushCtrl(op, blockResults(in))
+
+	case op == opIf:
+		if _, err := v.popExpect(I32); err != nil {
+			return err
+		}
+		v.pushCtrl(op, blockResults(in))
+
+	case op == opElse:
+		f, err := v.popCtrl()
+		if err != nil {
+			return err
+		}
+		v.pushCtrl(opElse, f.results)
+
+	case op == opEnd:
+		f, err := v.popCtrl()
+		if err != nil {
+			return err
+		}
+		if f.op == opIf && len(f.results) > 0 {
+			return fmt.Errorf("%w: if with results has no else", ErrInvalidModule)
+		}
+		v.pushVals(f.results)
+
+	case op == opBr:
+		if err := v.popVals(v.label(in.imm)); err != nil {
+			return err
+		}
+		v.setUnreachable()
+
+	case op == opBrIf:
+		if _, err := v.popExpect(I32); err != nil {
+			return err
+		}
+		types := v.label(in.imm)
+		if err := v.popVals(types); err != nil {
+			return err
+		}
+		v.pushVals(types)
+
+	case op == opBrTable:
+		if _, err := v.popExpect(I32); err != nil {
+			return err
+		}
+		def := v.label(uint64(in.table[len(in.table)-1]))
+		for _, d := range in.table[:len(in.table)-1] {
+			types := v.label(uint64(d))
+			if len(types) != len(def) {
+				return fmt.Errorf("%w: br_table targets have different arity", ErrInvalidModule)
+			}
+			if err := v.popVals(types); err != nil {
+				return err
+			}
+			v.pushVals(types)
+		}
+		if err := v.popVals(def); err != nil {
+			return err
+		}
+		v.setUnreachable()
+
+	case op == opReturn:
+		if err := v.popVals(t.Results); err != nil {
+			return err
+		}
+		v.setUnreachable()
+
+	case op == opCall:
+		ft, err := m.FuncType(uint32(in.imm))
+		if err != nil {
+			return err
+		}
+		if err := v.popVals(ft.Params); err != nil {
+			return err
+		}
+		v.pushVals(ft.Results)
+
+	case op == opDrop:
+		if _, err := v.pop(); err != nil {
+			return err
+		}
+
+	case op == opSelect:
+		if _, err := v.popExpect(I32); err != nil {
+			return err
+		}
+		t1, err := v.pop()
+		if err != nil {
+			return err
+		}
+		t2, err := v.popExpect(t1)
+		if err != nil {
+			return err
+		}
+		v.push(t2)
+
+	case op == opLocalGet:
+		v.push(locals[in.imm])
+
+	case op == opLocalSet:
+		if _, err := v.popExpect(locals[in.imm]); err != nil {
+			return err
+		}
+
+	case op == opLocalTee:
+		if _, err := v.popExpect(locals[in.imm]); err != nil {
+			return err
+		}
+		v.push(locals[in.imm])
+
+	case op == opGlobalGet:
+		v.push(m.Globals[in.imm].Type)
+
+	case op == opGlobalSet:
+		if _, err := v.popExpect(m.Globals[in.imm].Type); err != nil {
+			return err
+		}
+
+	case op == opMemorySize:
+		v.push(I32)
+
+	case op == opMemoryGrow:
+		if _, err := v.popExpect(I32); err != nil {
+			return err
+		}
+		v.push(I32)
+
+	case isMemory(op):
+		vt, store := memoryType(op)
+		if store {
+			if _, err := v.popExpect(vt); err != nil {
+				return err
+			}
+		}
+		if _, err := v.popExpect(I32); err != nil {
+			return err
+		}
+		if !store {
+			v.push(vt)
+		}
+
+	case op == opI32Const:
+		v.push(I32)
+
+	case op == opI64Const:
+		v.push(I64)
+
+	default:
+		params, result := numericType(op)
+		if err := v.popVals(params); err != nil {
+			return err
+		}
+		v.push(result)
+	}
+
+	return nil
+}
+
+// label 返回跳转到深度为 d 的块时需要的操作数类型
+func (v *funcValidator) label(d uint64) []ValueType {
+	return v.ctrls[len(v.ctrls)-1-int(d)].labelTypes()
+}
+
+// blockResults 返回 block、loop 与 if 的结果类型
+func blockResults(in instr) []ValueType {
+	if in.imm == 0 {
+		return nil
+	}
+
+	return []ValueType{in.result}
+}
+
+// memoryType 返回内存读写指令读出或写入的值类型，以及是否为写入
+func memoryType(op byte) (ValueType, bool) {
+	switch {
+	case op == opI32Load || (op >= opI32Load8S && op <= opI32Load16U):
+		return I32, false
+	case op <= opI64Load32U:
+		return I64, false
+	case op == opI32Store || op == opI32Store8 || op == opI32Store16:
+		return I32, true
+	default:
+		return I64, true
+	}
+}
+
+// numericType 返回整数运算指令的操作数类型与结果类型
+func numericType(op byte) ([]ValueType, ValueType) {
+	switch {
+	case op == opI32Eqz:
+		return []ValueType{I32}, I32
+	case op > opI32Eqz && op <= opI32GeU:
+		return []ValueType{I32, I32}, I32
+	case op == opI64Eqz:
+		return []ValueType{I64}, I32
+	case op > opI64Eqz && op <= opI64GeU:
+		return []ValueType{I64, I64}, I32
+	case op >= opI32Clz && op <= 0x69:
+		return []ValueType{I32}, I32
+	case op > 0x69 && op <= opI32Rotr:
+		return []ValueType{I32, I32}, I32
+	case op >= opI64Clz && op <= 0x7b:
+		return []ValueType{I64}, I64
+	case op > 0x7b && op <= opI64Rotr:
+		return []ValueType{I64, I64}, I64
+	case op == opI32WrapI64:
+		return []ValueType{I64}, I32
+	default:
+		// i64.extend_i32_s 与 i64.extend_i32_u
+		return []ValueType{I32}, I64
+	}
+}
@@ -0,0 +1,350 @@
+package wasm
+
+import (
+	"errors"
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var (
+	i32Func = FuncType{Params: []ValueType{I32}, Results: []ValueType{I32}}
+	i64Func = FuncType{Params: []ValueType{I64}, Results: []ValueType{I64}}
+	binFunc = FuncType{Params: []ValueType{I32, I32}, Results: []ValueType{I32}}
+)
+
+// newModule 创建只含一个导出函数 "f" 与一页内存的模块
+func newModule(t FuncType, locals []ValueType, body []byte) *Module {
+	return &Module{
+		Types:   []FuncType{t},
+		Funcs:   []uint32{0},
+		Memory:  &Limits{Min: 1},
+		Exports: []Export{{Name: "f", Kind: ExternFunc, Index: 0}},
+		Codes:   []Code{{Locals: locals, Body: body}},
+	}
+}
+
+// instantiate 将模块编码后重新解码并实例化
+func instantiate(t *testing.T, m *Module, host map[string]HostFunc) *Instance {
+	decoded, err := Decode(m.Encode())
+	if !assert.Nil(t, err) {
+		t.FailNow()
+	}
+	inst, err := Instantiate(decoded, host)
+	if !assert.Nil(t, err) {
+		t.FailNow()
+	}
+
+	return inst
+}
+
+// call 调用导出函数 "f" 并返回唯一的结果
+func call(t *testing.T, inst *Instance, args ...uint64) uint64 {
+	res, err := inst.Invoke("f", args...)
+	assert.Nil(t, err)
+	if !assert.Len(t, res, 1) {
+		t.FailNow()
+	}
+
+	return res[0]
+}
+
+func TestLEB128(t *testing.T) {
+	for _, v := range []int64{0, 1, -1, 63, 64, -64, -65, 1 << 40, math.MinInt64, math.MaxInt64} {
+		r := &reader{b: AppendS64(nil, v)}
+		got, err := r.s64()
+		assert.Nil(t, err)
+		assert.Equal(t, v, got)
+	}
+
+	for _, v := range []uint32{0, 127, 128, 624485, math.MaxUint32} {
+		r := &reader{b: AppendU32(nil, v)}
+		got, err := r.u32()
+		assert.Nil(t, err)
+		assert.Equal(t, v, got)
+	}
+
+	r := &reader{b: []byte{0xff, 0xff, 0xff, 0xff, 0x7f}}
+	_, err := r.u32()
+	assert.ErrorIs(t, err, ErrInvalidModule)
+}
+
+func TestDecodeRoundTrip(t *testing.T) {
+	m := newModule(binFunc, []ValueType{I32, I32, I64}, []byte{0x20, 0, 0x20, 1, 0x6a, 0x0b})
+	m.Globals = []Global{{Type: I64, Mutable: true, Init: math.MaxUint64}}
+	m.Data = []DataSegment{{Offset: 16, Data: []byte("hi")}}
+
+	b := m.Encode()
+	assert.True(t, IsWASM(b))
+
+	decoded, err := Decode(b)
+	assert.Nil(t, err)
+	assert.Equal(t, m, decoded)
+	assert.Equal(t, b, decoded.Encode())
+}
+
+func TestDecodeErrors(t *testing.T) {
+	valid := newModule(i32Func, nil, []byte{0x20, 0, 0x0b}).Encode()
+
+	_, err := Decode(valid[:6])
+	assert.ErrorIs(t, err, ErrInvalidModule)
+	_, err = Decode(valid[:len(valid)-1])
+	assert.ErrorIs(t, err, ErrInvalidModule)
+
+	cases := []struct {
+		body []byte
+		err  error
+	}{
+		{[]byte{0x20, 0, 0x8d, 0x0b}, ErrUnsupported},                        // f32.sqrt
+		{[]byte{0x20, 1, 0x0b}, ErrInvalidModule},                            // 局部变量越界
+		{[]byte{0x0c, 1, 0x0b}, ErrInvalidModule},                            // 跳转深度越界
+		{[]byte{0x10, 5, 0x0b}, ErrInvalidModule},                            // 函数索引越界
+		{[]byte{0x05, 0x0b}, ErrInvalidModule},                               // 没有 if 的 else
+		{[]byte{0x02, 0x40, 0x0b}, ErrInvalidModule},                         // 块未结束
+		{[]byte{0x0b, 0x0b}, ErrInvalidModule},                               // 函数结束后还有指令
+		{[]byte{0x02, 0x00, 0x0b, 0x0b}, ErrUnsupported},                     // 类型索引形式的块类型
+		{[]byte{0x1a, 0x0b}, ErrInvalidModule},                               // 操作数栈下溢
+		{[]byte{0x42, 1, 0x0b}, ErrInvalidModule},                            // 结果类型不符
+		{[]byte{0x20, 0, 0x42, 1, 0x6a, 0x0b}, ErrInvalidModule},             // 操作数类型不符
+		{[]byte{0x20, 0, 0x20, 0, 0x0b}, ErrInvalidModule},                   // 函数结束时多余的值
+		{[]byte{0x02, 0x40, 0x20, 0, 0x0b, 0x20, 0, 0x0b}, ErrInvalidModule}, // 块结束时多余的值
+		{[]byte{0x20, 0, 0x04, 0x7f, 0x41, 1, 0x0b, 0x0b}, ErrInvalidModule}, // 带结果但没有 else 的 if
+		{[]byte{0x41, 1, 0x0d, 0, 0x0b}, ErrInvalidModule},                   // 跳转时缺少块的结果
+	}
+	for _, c := range cases {
+		_, err := Decode(newModule(i32Func, nil, c.body).Encode())
+		assert.ErrorIs(t, err, c.err, "body %x", c.body)
+	}
+
+	// 不可达代码中的操作数类型任意
+	for _, body := range [][]byte{{0x00, 0x6a, 0x0b}, {0x41, 1, 0x0f, 0x6a, 0x0b}, {0x20, 0, 0x0c, 0, 0x1a, 0x0b}} {
+		_, err := Decode(newModule(i32Func, nil, body).Encode())
+		assert.Nil(t, err, "body %x", body)
+	}
+
+	// 没有内存时不能访问内存
+	m := newModule(i32Func, nil, []byte{0x20, 0, 0x28, 2, 0, 0x0b})
+	m.Memory = nil
+	_, err = Decode(m.Encode())
+	assert.ErrorIs(t, err, ErrInvalidModule)
+
+	// 不支持表
+	table := append(append([]byte{}, valid[:8]...), sectionTable, 4, 1, 0x70, 0, 1)
+	_, err = Decode(table)
+	assert.ErrorIs(t, err, ErrUnsupported)
+}
+
+func TestInvokeArithmetic(t *testing.T) {
+	inst := instantiate(t, newModule(binFunc, nil, []byte{0x20, 0, 0x20, 1, 0x6a, 0x0b}), nil)
+	assert.Equal(t, uint64(5), call(t, inst, 2, 3))
+	assert.Equal(t, uint64(0), call(t, inst, math.MaxUint32, 1))
+
+	div := instantiate(t, newModule(binFunc, nil, []byte{0x20, 0, 0x20, 1, 0x6d, 0x0b}), nil)
+	minusTwo := uint64(0xfffffffe)
+	assert.Equal(t, minusTwo, call(t, div, 4, minusTwo))
+
+	_, err := div.Invoke("f", 1, 0)
+	assert.ErrorIs(t, err, ErrDivideByZero)
+	_, err = div.Invoke("f", 1<<31, math.MaxUint32)
+	assert.ErrorIs(t, err, ErrIntegerOverflow)
+
+	// 执行中止后实例仍可继续调用
+	assert.Equal(t, uint64(3), call(t, div, 7, 2))
+}
+
+func TestInvokeControlFlow(t *testing.T) {
+	// fac(n) = n == 0 ? 1 : n * fac(n-1)
+	fac := instantiate(t, newModule(i64Func, nil, []byte{
+		0x20, 0, 0x50, 0x04, 0x7e,
+		0x42, 1,
+		0x05,
+		0x20, 0, 0x20, 0, 0x42, 1, 0x7d, 0x10, 0, 0x7e,
+		0x0b, 0x0b,
+	}), nil)
+	assert.Equal(t, uint64(1), call(t, fac, 0))
+	assert.Equal(t, uint64(3628800), call(t, fac, 10))
+
+	// 用 block 与 loop 计算 1 + 2 + ... + n
+	sum := instantiate(t, newModule(i32Func, []ValueType{I32}, []byte{
+		0x02, 0x40, 0x03, 0x40,
+		0x20, 0, 0x45, 0x0d, 1,
+		0x20, 1, 0x20, 0, 0x6a, 0x21, 1,
+		0x20, 0, 0x41, 1, 0x6b, 0x21, 0,
+		0x0c, 0,
+		0x0b, 0x0b,
+		0x20, 1, 0x0b,
+	}), nil)
+	assert.Equal(t, uint64(5050), call(t, sum, 100))
+
+	// br_table 按索引选择跳出的块，越界时使用默认目标
+	sw := instantiate(t, newModule(i32Func, nil, []byte{
+		0x02, 0x40, 0x02, 0x40, 0x02, 0x40,
+		0x20, 0, 0x0e, 2, 0, 1, 2,
+		0x0b, 0x41, 10, 0x0f,
+		0x0b, 0x41, 20, 0x0f,
+		0x0b, 0x41, 30, 0x0b,
+	}), nil)
+	for arg, want := range map[uint64]uint64{0: 10, 1: 20, 2: 30, 7: 30} {
+		assert.Equal(t, want, call(t, sw, arg))
+	}
+
+	// 带结果的块在跳出时丢弃多余的值
+	blk := instantiate(t, newModule(i32Func, nil, []byte{
+		0x02, 0x7f, 0x41, 1, 0x41, 2, 0x20, 0, 0x0d, 0, 0x1a, 0x0b, 0x0b,
+	}), nil)
+	assert.Equal(t, uint64(2), call(t, blk, 1))
+	assert.Equal(t, uint64(1), call(t, blk, 0))
+
+	// select
+	sel := instantiate(t, newModule(i32Func, nil, []byte{0x41, 7, 0x41, 9, 0x20, 0, 0x1b, 0x0b}), nil)
+	assert.Equal(t, uint64(7), call(t, sel, 1))
+	assert.Equal(t, uint64(9), call(t, sel, 0))
+}
+
+func TestInvokeTraps(t *testing.T) {
+	_, err := instantiate(t, newModule(FuncType{}, nil, []byte{0x00, 0x0b}), nil).Invoke("f")
+	assert.ErrorIs(t, err, ErrUnreachable)
+
+	_, err = instantiate(t, newModule(FuncType{}, nil, []byte{0x10, 0, 0x0b}), nil).Invoke("f")
+	assert.ErrorIs(t, err, ErrStackExhausted)
+
+	// 函数不能弹出调用者的操作数：绕过校验替换被调用函数的指令，f 压入 1 后调用 g，g 执行 drop
+	m := newModule(FuncType{}, nil, []byte{0x41, 1, 0x10, 1, 0x1a, 0x0b})
+	m.Funcs = append(m.Funcs, 0)
+	m.Codes = append(m.Codes, Code{Body: []byte{0x0b}})
+	inst := instantiate(t, m, nil)
+	inst.funcs[1] = []instr{{op: opDrop, els: -1}, {op: opEnd, els: -1}}
+	_, err = inst.Invoke("f")
+	assert.ErrorIs(t, err, ErrStackUnderflow)
+
+	inst = instantiate(t, newModule(FuncType{}, nil, []byte{0x0b}), nil)
+	_, err = inst.Invoke("g")
+	assert.ErrorIs(t, err, ErrExportNotFound)
+	_, err = inst.Invoke("f", 1)
+	assert.NotNil(t, err)
+}
+
+func TestMemory(t *testing.T) {
+	// 在 addr 处写入 i64 0x0102，读回 addr+1 处的字节
+	m := newModule(FuncType{Params: []ValueType{I32}, Results: []ValueType{I64}}, nil, []byte{
+		0x20, 0, 0x42, 0x82, 0x02, 0x37, 3, 0,
+		0x20, 0, 0x2d, 0, 1, 0xad, 0x0b,
+	})
+	m.Data = []DataSegment{{Offset: 100, Data: []byte{0xff}}}
+	inst := instantiate(t, m, nil)
+
+	assert.Equal(t, byte(0xff), inst.Memory()[100])
+	assert.Equal(t, uint64(1), call(t, inst, 8))
+	b, err := inst.ReadMemory(8, 2)
+	assert.Nil(t, err)
+	assert.Equal(t, []byte{0x02, 0x01}, b)
+
+	_, err = inst.Invoke("f", PageSize-4)
+	assert.ErrorIs(t, err, ErrOutOfBounds)
+	_, err = inst.ReadMemory(PageSize, 1)
+	assert.ErrorIs(t, err, ErrOutOfBounds)
+
+	// memory.grow 返回原页数，超过上限时返回 -1
+	grow := newModule(i32Func, nil, []byte{0x20, 0, 0x40, 0, 0x0b})
+	grow.Memory = &Limits{Min: 1, Max: 2, HasMax: true}
+	inst = instantiate(t, grow, nil)
+	assert.Equal(t, uint64(1), call(t, inst, 1))
+	assert.Equal(t, 2*PageSize, len(inst.Memory()))
+	assert.Equal(t, uint64(math.MaxUint32), call(t, inst, 1))
+}
+
+func TestHostFunc(t *testing.T) {
+	m := newModule(i32Func, nil, []byte{0x20, 0, 0x10, 0, 0x41, 1, 0x6a, 0x0b})
+	m.Imports = []Import{{Module: HostModule, Name: "double", Type: 0}}
+	m.Exports[0].Index = 1
+
+	errHost := errors.New("host error")
+	host := map[string]HostFunc{
+		"double": {Type: i32Func, Fn: func(inst *Instance, args []uint64) ([]uint64, error) {
+			if args[0] == 0 {
+				return nil, errHost
+			}
+			return []uint64{args[0] * 2}, nil
+		}},
+	}
+	inst := instantiate(t, m, host)
+	assert.Equal(t, uint64(21), call(t, inst, 10))
+
+	// 宿主函数的错误原样返回
+	_, err := inst.Invoke("f", 0)
+	assert.ErrorIs(t, err, errHost)
+
+	decoded, err := Decode(m.Encode())
+	assert.Nil(t, err)
+	_, err = Instantiate(decoded, nil)
+	assert.ErrorIs(t, err, ErrUnknownImport)
+	_, err = Instantiate(decoded, map[string]HostFunc{"double": {Type: binFunc}})
+	assert.ErrorIs(t, err, ErrUnknownImport)
+}
+
+// gasMeter 返回记录 gas 消耗、超过 limit 时中止执行的 gas 宿主函数
+func gasMeter(used *uint64, limit uint64) map[string]HostFunc {
+	errOutOfGas := errors.New("out of gas")
+	return map[string]HostFunc{
+		GasFunc: {Type: FuncType{Params: []ValueType{I64}}, Fn: func(inst *Instance, args []uint64) ([]uint64, error) {
+			if *used+args[0] > limit {
+				return nil, errOutOfGas
+			}
+			*used += args[0]
+			return nil, nil
+		}},
+	}
+}
+
+func TestInjectGas(t *testing.T) {
+	sum := newModule(i32Func, []ValueType{I32}, []byte{
+		0x02, 0x40, 0x03, 0x40,
+		0x20, 0, 0x45, 0x0d, 1,
+		0x20, 1, 0x20, 0, 0x6a, 0x21, 1,
+		0x20, 0, 0x41, 1, 0x6b, 0x21, 0,
+		0x0c, 0,
+		0x0b, 0x0b,
+		0x20, 1, 0x0b,
+	})
+	injected, err := InjectGas(sum, nil)
+	assert.Nil(t, err)
+
+	// 原模块不变，导入的 gas 函数排在模块内函数之前
+	assert.Empty(t, sum.Imports)
+	assert.Equal(t, []Import{{Module: HostModule, Name: GasFunc, Type: 1}}, injected.Imports)
+	assert.Equal(t, uint32(1), injected.Exports[0].Index)
+
+	cost := func(n uint64) uint64 {
+		var used uint64
+		inst := instantiate(t, injected, gasMeter(&used, math.MaxUint64))
+		assert.Equal(t, n*(n+1)/2, call(t, inst, n))
+		return used
+	}
+	// 每轮循环消耗判断段 3 与累加段 9，最后一轮只有判断段，循环结束后读取结果 1
+	assert.Equal(t, uint64(4), cost(0))
+	assert.Equal(t, uint64(4+12*10), cost(10))
+
+	// gas 不足时中止无限循环
+	loop, err := InjectGas(newModule(FuncType{}, nil, []byte{0x03, 0x40, 0x0c, 0, 0x0b, 0x0b}), nil)
+	assert.Nil(t, err)
+	var used uint64
+	_, err = instantiate(t, loop, gasMeter(&used, 1000)).Invoke("f")
+	assert.NotNil(t, err)
+	assert.Equal(t, uint64(1000), used)
+
+	// 函数调用的索引随之移动
+	fac := newModule(i64Func, nil, []byte{
+		0x20, 0, 0x50, 0x04, 0x7e, 0x42, 1, 0x05,
+		0x20, 0, 0x20, 0, 0x42, 1, 0x7d, 0x10, 0, 0x7e,
+		0x0b, 0x0b,
+	})
+	injected, err = InjectGas(fac, nil)
+	assert.Nil(t, err)
+	used = 0
+	assert.Equal(t, uint64(120), call(t, instantiate(t, injected, gasMeter(&used, math.MaxUint64)), 5))
+	assert.Greater(t, used, uint64(0))
+
+	_, err = InjectGas(injected, nil)
+	assert.ErrorIs(t, err, ErrInvalidModule)
+}